@@ -0,0 +1,238 @@
+// Command yaaf-mysql runs schema and data operations over the yaaf-common-mysql connection URI (including SSH tunnel)
+//
+// Usage:
+//
+//	yaaf-mysql [-uri URI] <command> [arguments]
+//
+// Commands:
+//
+//	ddl <file>                 Create tables and indexes from Json file of table -> indexed fields
+//	migrate <dir>              Apply the pending *.sql migration files of the directory (in name order)
+//	dump <table> [file]        Dump the table entities as fixture file (default: stdout)
+//	restore <pattern>          Upsert the entities of the fixture files matching the glob pattern
+//	query <sql> [args...]      Execute SQL query and print the rows as Json
+//	exec <sql> [args...]       Execute SQL command and print the number of affected rows
+//
+// The connection URI is taken from the -uri flag or the MYSQL_URI environment variable.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+)
+
+const usage = `usage: yaaf-mysql [-uri URI] <command> [arguments]
+
+commands:
+  ddl <file>               create tables and indexes from Json file of table -> indexed fields
+  migrate <dir>            apply the pending *.sql migration files of the directory (in name order)
+  dump <table> [file]      dump the table entities as fixture file (default: stdout)
+  restore <pattern>        upsert the entities of the fixture files matching the glob pattern
+  query <sql> [args...]    execute SQL query and print the rows as Json
+  exec <sql> [args...]     execute SQL command and print the number of affected rows
+`
+
+const (
+	ddlMigrations = `CREATE TABLE IF NOT EXISTS "schema_migrations" (version VARCHAR(255) PRIMARY KEY NOT NULL, applied_on BIGINT NOT NULL)`
+	sqlMigrations = `SELECT version FROM "schema_migrations"`
+	sqlMigrated   = `INSERT INTO "schema_migrations" (version, applied_on) VALUES ($1, $2)`
+)
+
+func main() {
+	uri := flag.String("uri", os.Getenv("MYSQL_URI"), "database connection URI (default: $MYSQL_URI)")
+	flag.Usage = func() { _, _ = fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *uri == "" {
+		fail(fmt.Errorf("connection URI is required (-uri or MYSQL_URI)"))
+	}
+
+	idb, err := mysql.NewMySqlDatabase(*uri)
+	if err != nil {
+		fail(err)
+	}
+	db := idb.(*mysql.MySqlDatabase)
+	defer func() { _ = db.Close() }()
+
+	if err = run(db, flag.Arg(0), flag.Args()[1:], os.Stdout); err != nil {
+		_ = db.Close()
+		fail(err)
+	}
+}
+
+// run the command
+func run(db *mysql.MySqlDatabase, command string, args []string, out io.Writer) error {
+	switch command {
+	case "ddl":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: ddl <file>")
+		}
+		return runDDL(db, args[0])
+	case "migrate":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: migrate <dir>")
+		}
+		return runMigrate(db, args[0], out)
+	case "dump":
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("usage: dump <table> [file]")
+		}
+		if len(args) == 2 {
+			file, err := os.Create(args[1])
+			if err != nil {
+				return err
+			}
+			defer func() { _ = file.Close() }()
+			out = file
+		}
+		return runDump(db, args[0], out)
+	case "restore":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: restore <pattern>")
+		}
+		return runRestore(db, args[0], out)
+	case "query":
+		if len(args) < 1 {
+			return fmt.Errorf("usage: query <sql> [args...]")
+		}
+		rows, err := db.ExecuteQuery("cli", args[0], arguments(args[1:])...)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "exec":
+		if len(args) < 1 {
+			return fmt.Errorf("usage: exec <sql> [args...]")
+		}
+		affected, err := db.ExecuteSQL(args[0], arguments(args[1:])...)
+		if err == nil {
+			_, err = fmt.Fprintf(out, "%d rows affected\n", affected)
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown command: %s\n%s", command, usage)
+	}
+}
+
+// runDDL create the tables and indexes of the DDL file (Json of table name -> list of indexed fields)
+func runDDL(db *mysql.MySqlDatabase, file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	ddl := make(map[string][]string)
+	if err = json.Unmarshal(data, &ddl); err != nil {
+		return fmt.Errorf("%s: %s", file, err.Error())
+	}
+	return db.ExecuteDDL(ddl)
+}
+
+// runRestore load the fixture files matching the pattern (absolute or relative to the working directory, the pattern
+// applies to the file names of the directory), it fails if no entity was restored
+func runRestore(db *mysql.MySqlDatabase, pattern string, out io.Writer) error {
+	abs, err := filepath.Abs(pattern)
+	if err != nil {
+		return err
+	}
+	affected, err := db.LoadFixtures(os.DirFS(filepath.Dir(abs)), filepath.Base(abs))
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("no entities restored from %s", pattern)
+	}
+	_, err = fmt.Fprintf(out, "%d entities restored\n", affected)
+	return err
+}
+
+// runMigrate apply the migration files which are not listed in the schema_migrations table, the statements of a file
+// are split by the script delimiter (see mysql.SplitScript)
+func runMigrate(db *mysql.MySqlDatabase, dir string, out io.Writer) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	if _, err = db.ExecuteSQL(ddlMigrations); err != nil {
+		return err
+	}
+	rows, err := db.ExecuteQuery("cli", sqlMigrations)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]bool)
+	for _, row := range rows {
+		applied[fmt.Sprintf("%v", row["version"])] = true
+	}
+
+	for _, file := range files {
+		version := filepath.Base(file)
+		if applied[version] {
+			continue
+		}
+		data, er := os.ReadFile(file)
+		if er != nil {
+			return er
+		}
+		if _, er = db.ExecuteScript(string(data), false); er != nil {
+			return fmt.Errorf("%s: %s", version, er.Error())
+		}
+		if _, er = db.ExecuteSQL(sqlMigrated, version, time.Now().UnixMilli()); er != nil {
+			return er
+		}
+		_, _ = fmt.Fprintf(out, "applied %s\n", version)
+	}
+	return nil
+}
+
+// runDump write the table entities as fixture file (restorable by the restore command)
+func runDump(db *mysql.MySqlDatabase, table string, out io.Writer) error {
+	rows, err := db.ExecuteQuery("cli", fmt.Sprintf(`SELECT id, data FROM "%s" ORDER BY id`, table))
+	if err != nil {
+		return err
+	}
+
+	fixture := mysql.Fixture{Table: table, Entities: make([]map[string]any, 0, len(rows))}
+	for _, row := range rows {
+		doc := make(map[string]any)
+		if err = json.Unmarshal([]byte(fmt.Sprintf("%v", row["data"])), &doc); err != nil {
+			return fmt.Errorf("entity %v: %s", row["id"], err.Error())
+		}
+		doc["id"] = row["id"]
+		fixture.Entities = append(fixture.Entities, doc)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fixture)
+}
+
+// arguments convert the command line arguments to statement arguments
+func arguments(args []string) []any {
+	result := make([]any, len(args))
+	for i, arg := range args {
+		result[i] = arg
+	}
+	return result
+}
+
+// fail print the error and exit
+func fail(err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "yaaf-mysql: %s\n", err.Error())
+	os.Exit(1)
+}
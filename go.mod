@@ -7,6 +7,7 @@ require (
 	github.com/go-yaaf/yaaf-common v1.2.112
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/crypto v0.25.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -19,5 +20,4 @@ require (
 	go.uber.org/multierr v1.10.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/sys v0.22.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
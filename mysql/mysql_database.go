@@ -12,10 +12,10 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-yaaf/yaaf-common/database"
-	"github.com/go-yaaf/yaaf-common/logger"
 	"github.com/go-yaaf/yaaf-common/messaging"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -40,12 +40,47 @@ type DBConfig struct {
 	Port     int
 	DBName   string
 	AppName  string
-	Driver   string
+	Driver   string // The registered SQL driver name (default: mysql), the driver must accept go-sql-driver/mysql DSN
+
+	TLS             string        // TLS mode: true, false, skip-verify, preferred or registered TLS config name (empty to disable)
+	MaxOpenConns    int           // Max open connections in the pool (0 for unlimited)
+	MaxIdleConns    int           // Max idle connections in the pool (0 for the driver default)
+	ConnMaxLifetime time.Duration // Max time a connection may be reused (0 for unlimited)
+	FoundRows       bool          // Report the matched rows instead of the changed rows as affected rows (CLIENT_FOUND_ROWS)
 }
 
 // ConnectionString returns DNS connection
 func (c *DBConfig) ConnectionString() string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", c.Username, c.Password, c.Host, c.Port, c.DBName)
+	return c.dsn(fmt.Sprintf("%s:%d", c.Host, c.Port))
+}
+
+// dsn returns DNS connection to the address (host:port)
+func (c *DBConfig) dsn(address string) string {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", c.Username, c.Password, address, c.DBName)
+	params := make([]string, 0, 2)
+	if c.TLS != "" {
+		params = append(params, "tls="+c.TLS)
+	}
+	if c.FoundRows {
+		params = append(params, "clientFoundRows=true")
+	}
+	if len(params) > 0 {
+		dsn = fmt.Sprintf("%s?%s", dsn, strings.Join(params, "&"))
+	}
+	return dsn
+}
+
+// configurePool apply the connection pool settings
+func (c *DBConfig) configurePool(db *sql.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
 }
 
 //endregion
@@ -53,13 +88,60 @@ func (c *DBConfig) ConnectionString() string {
 // region Database store definitions -----------------------------------------------------------------------------------
 
 type MySqlDatabase struct {
-	pgDb   *sql.DB               // The sql connection
-	bus    messaging.IMessageBus // Message bus for change notifications
-	uri    string                // DB connection URI
-	ssh    *ssh.Client           // SSH client (in case of connection over SSH)
-	tunnel net.Listener          // SSH tunnel (in case of connection over SSH)
+	pgDb            *sql.DB                                   // The sql connection
+	bus             messaging.IMessageBus                     // Message bus for change notifications
+	uri             string                                    // DB connection URI
+	ssh             *ssh.Client                               // SSH client (in case of connection over SSH)
+	tunnel          net.Listener                              // SSH tunnel (in case of connection over SSH)
+	mu              sync.RWMutex                              // Guards the configuration registries below
+	promoted        map[string]map[string]PromotedField       // Promoted fields per entity table template
+	schemaChange    ISchemaChangeExecutor                     // Executor of ALTER TABLE statements (nil for direct ALTER TABLE)
+	clock           func() time.Time                          // Reference clock for time based table name templates (nil for the system clock)
+	resolver        ITableNameResolver                        // Table name resolution strategy (nil for the default resolver)
+	defaultKey      string                                    // Default shard key for operations called without the required keys (empty for strict mode)
+	shardAwareBulk  bool                                      // Group bulk insert entities by their resolved shard table
+	tenants         tenantLimiter                             // Per shard key concurrency limits
+	metrics         IMetricsHook                              // Metrics hook
+	stmtLog         *StatementLogOptions                      // Statement log options (nil if disabled)
+	middleware      []Middleware                              // Statement execution middleware chain
+	commenter       *statementCommenter                       // Statement comments configuration (nil if disabled)
+	audit           *auditLog                                 // Mutation audit log (nil if disabled)
+	replicas        replicaSet                                // Read replicas router
+	logger          ILogger                                   // Logger (nil for yaaf-common logger)
+	logLevel        int                                       // Minimal log level of the messages
+	encryption      map[string]*fieldEncryptor                // Field-level encryption by entity table template
+	envelopes       map[string]*documentEncryptor             // Whole-document encryption by entity table template
+	guard           StatementGuard                            // Policy of the raw SQL passed to ExecuteSQL and ExecuteQuery
+	masking         map[string]MaskFunc                       // Masking rules of the query output
+	ttl             map[string]*ttlPolicy                     // TTL expiration policies by entity table template
+	history         map[string]bool                           // Version history enabled by entity table template
+	companionTables sync.Map                                  // Created companion tables (history and trash)
+	versions        map[string]string                         // Optimistic locking version field by entity table template
+	softDelete      map[string]bool                           // Soft delete enabled by entity table template
+	hooks           map[string]map[HookEvent][]Hook           // Lifecycle hooks by entity table template and event
+	locks           sync.Map                                  // Held advisory locks by name (dedicated connection of each lock)
+	sequences       sequenceGenerator                         // Reserved blocks of sequence ids
+	geo             map[string]map[string]GeoField            // Geo fields by entity table template and column
+	rollups         map[string]*Rollup                        // Rollup tables by name
+	docMigrations   map[string]map[string][]DocumentTransform // Document migrations by entity table template and name
+	timestamps      map[string]bool                           // Entity table templates with created_at / updated_at columns
+	mapped          map[string]map[string]MappedField         // Column mapped fields per entity table template
+	validations     map[string]*documentValidation            // Document validation per entity table template
+	overflow        map[string]*overflowStorage               // Large payload overflow storage per entity table template
+	serializers     map[string]ISerializer                    // Custom serializers per entity table template
+	queries         queryLimiter                              // Heavy queries concurrency limit
+	writeRates      map[string]*tokenBucket                   // Write rate limits per entity table template (empty for global)
+	breaker         *circuitBreaker                           // Circuit breaker of the database calls (nil if disabled)
+	retry           *TransientRetryOptions                    // Retry policy of transient connection errors (nil if disabled)
+	catalog         string                                    // Default database (catalog) of unqualified entity tables
+	catalogs        map[string]string                         // Database (catalog) per entity table template
+	sessionInit     []string                                  // Session initialization statements run by Warmup on every warmed connection
+	warmup          []string                                  // Entity table templates whose hot statements are prepared by Warmup
+	shapes          *shapeCollector                           // Per statement shape statistics (nil if disabled)
+	clientFoundRows bool                                      // The connection reports the matched rows as affected rows (see DBConfig.FoundRows)
 }
 
+// The statements of the package quote identifiers with double quotes and use positional placeholders ($1..$n)
 const (
 	sqlInsert      = `INSERT INTO "%s" (id, data) VALUES ($1, $2)`
 	sqlUpdate      = `UPDATE "%s" SET data = $2 WHERE id = $1`
@@ -70,6 +152,8 @@ const (
 	ddlCreateTable = `CREATE TABLE IF NOT EXISTS "%s" (id character varying PRIMARY KEY NOT NULL, data jsonb NOT NULL default '{}')`
 	ddlCreateIndex = `CREATE INDEX IF NOT EXISTS %s_%s_idx ON "%s" USING BTREE ((data->>'%s'))`
 	ddlPurgeTable  = `TRUNCATE "%s" RESTART IDENTITY CASCADE`
+
+	sqlIncrementField = `UPDATE "%s" SET data = JSON_SET(data, '$.%s', COALESCE(CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED), 0) + $1) WHERE id = $2`
 )
 
 // endregion
@@ -85,10 +169,11 @@ func NewMySqlStore(URI string) (database.IDatastore, error) {
 		return nil, err
 	} else {
 		dbs := &MySqlDatabase{
-			pgDb:   db,
-			uri:    URI,
-			ssh:    sshCli,
-			tunnel: tunnel,
+			pgDb:            db,
+			uri:             URI,
+			ssh:             sshCli,
+			tunnel:          tunnel,
+			clientFoundRows: uriFoundRows(URI),
 		}
 		return dbs, nil
 	}
@@ -103,10 +188,11 @@ func NewMySqlDatabase(URI string) (database.IDatabase, error) {
 		return nil, err
 	} else {
 		dbs := &MySqlDatabase{
-			pgDb:   db,
-			uri:    URI,
-			ssh:    sshCli,
-			tunnel: tunnel,
+			pgDb:            db,
+			uri:             URI,
+			ssh:             sshCli,
+			tunnel:          tunnel,
+			clientFoundRows: uriFoundRows(URI),
 		}
 		return dbs, nil
 	}
@@ -121,11 +207,12 @@ func NewMySqlDatabaseWithMessageBus(URI string, bus messaging.IMessageBus) (data
 		return nil, err
 	} else {
 		dbs := &MySqlDatabase{
-			pgDb:   db,
-			uri:    URI,
-			ssh:    sshCli,
-			tunnel: tunnel,
-			bus:    bus,
+			pgDb:            db,
+			uri:             URI,
+			ssh:             sshCli,
+			tunnel:          tunnel,
+			bus:             bus,
+			clientFoundRows: uriFoundRows(URI),
 		}
 		return dbs, nil
 	}
@@ -152,7 +239,7 @@ func (dbs *MySqlDatabase) Ping(retries uint, intervalInSeconds uint) error {
 		}
 
 		// In case of failure, sleep and try again after 10 seconds
-		logger.Debug("ping to database failed try %d of 5", try)
+		dbs.log().Debug("ping to database failed try %d of 5", try)
 
 		// time.Second
 		duration := time.Second * time.Duration(intervalInSeconds)
@@ -164,6 +251,12 @@ func (dbs *MySqlDatabase) Ping(retries uint, intervalInSeconds uint) error {
 // Close DB and free resources
 func (dbs *MySqlDatabase) Close() error {
 
+	// Release held advisory locks
+	dbs.locks.Range(func(name, _ any) bool {
+		_ = dbs.ReleaseLock(name.(string))
+		return true
+	})
+
 	// Close SSH tunnel
 	if dbs.tunnel != nil {
 		_ = dbs.tunnel.Close()
@@ -178,6 +271,9 @@ func (dbs *MySqlDatabase) Close() error {
 	if dbs.pgDb != nil {
 		_ = dbs.pgDb.Close()
 	}
+
+	// Close read replicas connections
+	dbs.replicas.closeReplicas()
 	return nil
 }
 
@@ -191,12 +287,39 @@ func (dbs *MySqlDatabase) CloneDatastore() (database.IDatastore, error) {
 	return NewMySqlStore(dbs.uri)
 }
 
-// Resolve table name from entity class name and shard keys
-func tableName(table string, keys ...string) (tblName string) {
+// SetClock set the reference clock used to resolve time based table name templates ({{year}}, {{month}}, {{week}}, {{day}}, {{hour}})
+// this allows backfills to target historical shards (nil resets to the system clock)
+//
+// param: clock - Function returning the reference time
+func (dbs *MySqlDatabase) SetClock(clock func() time.Time) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.clock = clock
+}
+
+// now returns the current time of the reference clock
+func (dbs *MySqlDatabase) now() time.Time {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	if dbs.clock == nil {
+		return time.Now()
+	}
+	return dbs.clock()
+}
+
+// Resolve table name from entity class name and shard keys (the reference time is taken from AtTime key if provided)
+func (dbs *MySqlDatabase) tableName(table string, keys ...string) string {
+	now, keys := dbs.referenceTime(keys...)
+	return dbs.resolveName(table, now, keys...)
+}
+
+// Resolve table name from entity class name, shard keys and the reference time
+func resolveTableName(table string, now time.Time, keys ...string) (tblName string) {
 
 	tblName = table
 
-	if len(keys) == 0 {
+	if !strings.Contains(tblName, "{{") {
 		return tblName
 	}
 
@@ -208,13 +331,25 @@ func tableName(table string, keys ...string) (tblName string) {
 		tblName = strings.Replace(tblName, placeHolder, key, -1)
 	}
 
-	// Replace templates: {{year}}
-	tblName = strings.Replace(tblName, "{{year}}", time.Now().Format("2006"), -1)
+	// Replace templates: {{year}} (when combined with {{week}}, the ISO year is used so the last days of December are not mapped to week 01 of the ending year)
+	isoYear, week := now.ISOWeek()
+	if strings.Contains(tblName, "{{week}}") {
+		tblName = strings.Replace(tblName, "{{year}}", fmt.Sprintf("%04d", isoYear), -1)
+	} else {
+		tblName = strings.Replace(tblName, "{{year}}", now.Format("2006"), -1)
+	}
 
 	// Replace templates: {{month}}
-	tblName = strings.Replace(tblName, "{{month}}", time.Now().Format("01"), -1)
+	tblName = strings.Replace(tblName, "{{month}}", now.Format("01"), -1)
+
+	// Replace templates: {{week}} (ISO week number)
+	tblName = strings.Replace(tblName, "{{week}}", fmt.Sprintf("%02d", week), -1)
+
+	// Replace templates: {{day}}
+	tblName = strings.Replace(tblName, "{{day}}", now.Format("02"), -1)
 
-	// TODO: Replace templates: {{week}}
+	// Replace templates: {{hour}}
+	tblName = strings.Replace(tblName, "{{hour}}", now.Format("15"), -1)
 
 	return
 }
@@ -236,10 +371,12 @@ func parseConnectionString(dbUri string) (*DBConfig, *SSHConfig, error) {
 	dbCfg := &DBConfig{}
 	dbCfg.Username = uri.User.Username()
 	dbCfg.Password, _ = uri.User.Password()
-	dbCfg.Driver = strings.ToLower(uri.Scheme)
-	if dbCfg.Driver != "mysql" {
+	if strings.ToLower(uri.Scheme) != "mysql" {
 		return nil, nil, fmt.Errorf("schema for postgresql database must be: mysql")
 	}
+	if dbCfg.Driver, err = driverName(uri.Query().Get("driver")); err != nil {
+		return nil, nil, err
+	}
 
 	dbCfg.DBName = strings.TrimPrefix(uri.Path, "/") // Remove slash
 	if host, port, er := net.SplitHostPort(uri.Host); er != nil {
@@ -260,6 +397,29 @@ func parseConnectionString(dbUri string) (*DBConfig, *SSHConfig, error) {
 		dbCfg.AppName = filepath.Base(executablePath) // Extracts the executable name from the path
 	}
 
+	// Get the TLS mode and the connection pool settings
+	dbCfg.TLS = params.Get("tls")
+	if v := params.Get("max_open_conns"); v != "" {
+		if dbCfg.MaxOpenConns, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("URI: invalid max_open_conns: %s", v)
+		}
+	}
+	if v := params.Get("max_idle_conns"); v != "" {
+		if dbCfg.MaxIdleConns, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("URI: invalid max_idle_conns: %s", v)
+		}
+	}
+	if v := params.Get("conn_max_lifetime"); v != "" {
+		if dbCfg.ConnMaxLifetime, err = time.ParseDuration(v); err != nil {
+			return nil, nil, fmt.Errorf("URI: invalid conn_max_lifetime: %s", v)
+		}
+	}
+	if v := params.Get("found_rows"); v != "" {
+		if dbCfg.FoundRows, err = strconv.ParseBool(v); err != nil {
+			return nil, nil, fmt.Errorf("URI: invalid found_rows: %s", v)
+		}
+	}
+
 	// Check for connection over SSH
 	sshCfg := &SSHConfig{}
 	if _, ok := params["ssh_host"]; ok {
@@ -277,6 +437,9 @@ func parseConnectionString(dbUri string) (*DBConfig, *SSHConfig, error) {
 	if _, ok := params["ssh_pwd"]; ok {
 		sshCfg.Password = params["ssh_pwd"][0]
 	}
+	if _, ok := params["ssh_key"]; ok {
+		sshCfg.KeyFile = params["ssh_key"][0]
+	}
 	return dbCfg, sshCfg, nil
 }
 
@@ -297,6 +460,7 @@ func openConnection(URI string) (*sql.DB, *ssh.Client, net.Listener, error) {
 	if er != nil {
 		return nil, nil, nil, er
 	}
+	dbCfg.configurePool(cli)
 
 	// Ping the DB to test the connection
 	er = cli.Ping()
@@ -322,10 +486,10 @@ func openConnectionOverSSH(dbCfg *DBConfig, sshCfg *SSHConfig) (*sql.DB, *ssh.Cl
 
 	// Connect to the MySQL database
 	localAddr := tunnel.Addr().String()
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", dbCfg.Username, dbCfg.Password, localAddr, dbCfg.DBName)
-	if dbs, er := sql.Open(dbCfg.Driver, dsn); er != nil {
+	if dbs, er := sql.Open(dbCfg.Driver, dbCfg.dsn(localAddr)); er != nil {
 		return nil, nil, nil, fmt.Errorf("failed to connect to MySQL: %v", err)
 	} else {
+		dbCfg.configurePool(dbs)
 		return dbs, sshClient, tunnel, nil
 	}
 }
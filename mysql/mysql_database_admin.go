@@ -0,0 +1,310 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Table maintenance methods ------------------------------------------------------------------------------------
+
+const (
+	sqlAnalyzeTable  = `ANALYZE TABLE "%s"`
+	sqlOptimizeTable = `OPTIMIZE TABLE "%s"`
+	ddlRebuildOnline = `ALTER TABLE "%s" FORCE, ALGORITHM=INPLACE, LOCK=NONE`
+)
+
+// MaintainTable Run table maintenance: refresh the index statistics (ANALYZE TABLE) and optionally defragment the table
+// When online flag is set, the table is rebuilt in-place without locking (ALGORITHM=INPLACE, LOCK=NONE) instead of OPTIMIZE TABLE
+//
+// param: table - Table name to maintain
+// param: optimize - Run OPTIMIZE TABLE after ANALYZE TABLE
+// param: online - Rebuild the table online, concurrent DML is allowed during the rebuild
+// return: The result rows of the maintenance statements, error
+func (dbs *MySqlDatabase) MaintainTable(table string, optimize, online bool) (result []Json, err error) {
+
+	SQL := fmt.Sprintf(sqlAnalyzeTable, table)
+	if result, err = dbs.maintenanceQuery(SQL); err != nil {
+		return
+	}
+
+	if !optimize {
+		return
+	}
+
+	if online {
+		SQL = fmt.Sprintf(ddlRebuildOnline, table)
+		if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+			dbs.log().Error("%s error: %s", SQL, err.Error())
+			return
+		}
+		result = append(result, Json{"Table": table, "Op": "rebuild", "Msg_type": "status", "Msg_text": "OK"})
+		return
+	}
+
+	SQL = fmt.Sprintf(sqlOptimizeTable, table)
+	if rows, er := dbs.maintenanceQuery(SQL); er != nil {
+		return result, er
+	} else {
+		result = append(result, rows...)
+	}
+	return
+}
+
+// maintenanceQuery execute maintenance statement and return the result rows
+func (dbs *MySqlDatabase) maintenanceQuery(SQL string) ([]Json, error) {
+	rows, err := dbs.query(dbs.pgDb, "", "", SQL)
+	if err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+		return nil, err
+	}
+	return scanJsonRows(rows)
+}
+
+// endregion
+
+// region Table copy and rename methods --------------------------------------------------------------------------------
+
+const (
+	ddlRenameTable = `RENAME TABLE "%s" TO "%s"`
+	ddlCreateLike  = `CREATE TABLE "%s" LIKE "%s"`
+	sqlCopyData    = `INSERT INTO "%s" SELECT * FROM "%s"`
+)
+
+// RenameTable Rename table (atomic operation, the indexes are preserved)
+//
+// param: oldName - Current table name
+// param: newName - New table name
+// return: error
+func (dbs *MySqlDatabase) RenameTable(oldName, newName string) (err error) {
+	SQL := fmt.Sprintf(ddlRenameTable, oldName, newName)
+	if _, err = dbs.exec(dbs.pgDb, oldName, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+	}
+	return
+}
+
+// CopyTable Create a new table with the same structure (columns and indexes) of the source table and optionally copy its data
+//
+// param: src - Source table name
+// param: dst - Destination table name (must not exist)
+// param: withData - Copy the source table rows to the destination table
+// return: Number of copied rows, error
+func (dbs *MySqlDatabase) CopyTable(src, dst string, withData bool) (affected int64, err error) {
+	SQL := fmt.Sprintf(ddlCreateLike, dst, src)
+	if _, err = dbs.exec(dbs.pgDb, dst, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+		return
+	}
+
+	if !withData {
+		return
+	}
+
+	SQL = fmt.Sprintf(sqlCopyData, dst, src)
+	if result, er := dbs.exec(dbs.pgDb, dst, "", SQL); er != nil {
+		dbs.log().Error("%s error: %s", SQL, er.Error())
+		return 0, er
+	} else {
+		return result.RowsAffected()
+	}
+}
+
+// endregion
+
+// region Drop tables by pattern methods -------------------------------------------------------------------------------
+
+const (
+	sqlListTables      = `SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE $1 ORDER BY TABLE_NAME`
+	sqlListForeignKeys = `SELECT TABLE_NAME, REFERENCED_TABLE_NAME FROM information_schema.REFERENTIAL_CONSTRAINTS WHERE CONSTRAINT_SCHEMA = DATABASE()`
+	ddlDropTableMySql  = `DROP TABLE IF EXISTS "%s"`
+)
+
+// DropTables Drop all the tables matching the pattern (e.g. all the shards of a deleted tenant)
+// The pattern may be SQL LIKE pattern (using % and _) or glob pattern (using * and ?)
+// Tables are dropped in dependency-safe order: tables referencing other tables (foreign keys) are dropped first
+//
+// param: pattern - Table name pattern
+// param: dryRun - Only return the list of tables to drop, without dropping them
+// return: List of (to be) dropped tables in drop order, error
+func (dbs *MySqlDatabase) DropTables(pattern string, dryRun bool) (tables []string, err error) {
+
+	if tables, err = dbs.listTables(pattern); err != nil {
+		return
+	}
+	if tables, err = dbs.sortByDependency(tables); err != nil {
+		return
+	}
+
+	if dryRun {
+		return
+	}
+
+	for i, table := range tables {
+		SQL := fmt.Sprintf(ddlDropTableMySql, table)
+		if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+			dbs.log().Error("%s error: %s", SQL, err.Error())
+			return tables[:i], err
+		}
+	}
+	return
+}
+
+// listTables returns the list of tables in the current database matching the LIKE / glob pattern
+func (dbs *MySqlDatabase) listTables(pattern string) (tables []string, err error) {
+
+	tables = make([]string, 0)
+
+	rows, err := dbs.query(dbs.pgDb, "", "", sqlListTables, likePattern(pattern))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		table := ""
+		if err = rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// sortByDependency sort the tables so that every table precedes the tables it references
+func (dbs *MySqlDatabase) sortByDependency(tables []string) ([]string, error) {
+
+	included := make(map[string]bool)
+	for _, table := range tables {
+		included[table] = true
+	}
+
+	// Map each table to the list of (included) tables referencing it
+	referencedBy := make(map[string][]string)
+	rows, err := dbs.query(dbs.pgDb, "", "", sqlListForeignKeys)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var child, parent string
+		if err = rows.Scan(&child, &parent); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		if included[child] && included[parent] && child != parent {
+			referencedBy[parent] = append(referencedBy[parent], child)
+		}
+	}
+	_ = rows.Close()
+
+	// Depth first: all the referencing tables are added before the referenced table
+	result := make([]string, 0, len(tables))
+	visited := make(map[string]bool)
+	var visit func(table string)
+	visit = func(table string) {
+		if visited[table] {
+			return
+		}
+		visited[table] = true
+		children := referencedBy[table]
+		sort.Strings(children)
+		for _, child := range children {
+			visit(child)
+		}
+		result = append(result, table)
+	}
+
+	// Since visit appends the referenced table after its children, the result is already in drop order
+	for _, table := range tables {
+		visit(table)
+	}
+	return result, nil
+}
+
+// likePattern convert glob pattern (* and ?) to SQL LIKE pattern
+func likePattern(pattern string) string {
+	pattern = strings.Replace(pattern, "*", "%", -1)
+	return strings.Replace(pattern, "?", "_", -1)
+}
+
+// endregion
+
+// region Index usage report methods -----------------------------------------------------------------------------------
+
+// IndexInfo identifies a table index
+type IndexInfo struct {
+	Table string // The table name
+	Index string // The index name
+}
+
+// RedundantIndex describes an index which is covered by another (dominant) index
+type RedundantIndex struct {
+	Table           string // The table name
+	Index           string // The redundant index name
+	Columns         string // The redundant index columns
+	DominantIndex   string // The index covering the redundant index
+	DominantColumns string // The dominant index columns
+	DropStatement   string // SQL statement to drop the redundant index
+}
+
+// IndexReport lists the unused and redundant indexes of the database tables
+type IndexReport struct {
+	Unused    []IndexInfo      // Indexes not used since the server started
+	Redundant []RedundantIndex // Indexes covered by other indexes
+}
+
+const (
+	sqlUnusedIndexes    = `SELECT object_name, index_name FROM sys.schema_unused_indexes WHERE object_schema = DATABASE() AND object_name LIKE $1 ORDER BY object_name, index_name`
+	sqlRedundantIndexes = `SELECT table_name, redundant_index_name, redundant_index_columns, dominant_index_name, dominant_index_columns, sql_drop_index FROM sys.schema_redundant_indexes WHERE table_schema = DATABASE() AND table_name LIKE $1 ORDER BY table_name, redundant_index_name`
+)
+
+// GetIndexReport Report the unused and redundant indexes of the tables matching the pattern (based on the sys schema views)
+// Note: index usage statistics are collected by performance_schema since the server started, so the report
+// is meaningful only after the server was running a representative workload
+//
+// param: pattern - Table name pattern (SQL LIKE or glob pattern), empty pattern for all tables
+// return: Index report, error
+func (dbs *MySqlDatabase) GetIndexReport(pattern string) (report *IndexReport, err error) {
+
+	if pattern == "" {
+		pattern = "%"
+	}
+	pattern = likePattern(pattern)
+
+	report = &IndexReport{
+		Unused:    make([]IndexInfo, 0),
+		Redundant: make([]RedundantIndex, 0),
+	}
+
+	rows, err := dbs.query(dbs.pgDb, "", "", sqlUnusedIndexes, pattern)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		info := IndexInfo{}
+		if err = rows.Scan(&info.Table, &info.Index); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		report.Unused = append(report.Unused, info)
+	}
+	_ = rows.Close()
+
+	if rows, err = dbs.query(dbs.pgDb, "", "", sqlRedundantIndexes, pattern); err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		ri := RedundantIndex{}
+		if err = rows.Scan(&ri.Table, &ri.Index, &ri.Columns, &ri.DominantIndex, &ri.DominantColumns, &ri.DropStatement); err != nil {
+			return nil, err
+		}
+		report.Redundant = append(report.Redundant, ri)
+	}
+	return report, rows.Err()
+}
+
+// endregion
@@ -0,0 +1,60 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// region Affected rows definitions ------------------------------------------------------------------------------------
+
+// ErrNoRowsAffected is the sentinel of NoRowsAffectedError (use errors.Is)
+var ErrNoRowsAffected = errors.New("no rows affected")
+
+// NoRowsAffectedError is returned by single entity mutations when the entity does not exist. Without the found rows
+// option (see DBConfig.FoundRows) MySQL reports only the changed rows, so update of existing entity with identical data
+// is checked and treated as successful no-op
+type NoRowsAffectedError struct {
+	Operation string // The operation (e.g. update, delete)
+	Table     string // The entity physical table
+	Id        string // The entity id
+}
+
+// Error returns the error message
+func (e *NoRowsAffectedError) Error() string {
+	return fmt.Sprintf("no row affected when executing %s operation", e.Operation)
+}
+
+// Unwrap returns the ErrNoRowsAffected sentinel
+func (e *NoRowsAffectedError) Unwrap() error {
+	return ErrNoRowsAffected
+}
+
+// endregion
+
+// region Affected rows methods ----------------------------------------------------------------------------------------
+
+// foundRows check if the connection reports the matched rows as affected rows (CLIENT_FOUND_ROWS)
+func (dbs *MySqlDatabase) foundRows() bool {
+	return dbs.clientFoundRows
+}
+
+// uriFoundRows check if the connection string enables the found rows option, evaluated once when the database is opened
+func uriFoundRows(URI string) bool {
+	cfg, _, err := parseConnectionString(URI)
+	return err == nil && cfg.FoundRows
+}
+
+// notUpdated returns the error of update statement which did not affect any row: NoRowsAffectedError if the entity
+// does not exist, nil if it exists with identical data (which is reported as zero affected rows without found rows)
+func (dbs *MySqlDatabase) notUpdated(operation, table, tenant, entityId string) error {
+	if !dbs.foundRows() {
+		if doc, err := dbs.readDocument(dbs.pgDb, table, tenant, entityId, false); err != nil {
+			return err
+		} else if doc != nil {
+			return nil
+		}
+	}
+	return &NoRowsAffectedError{Operation: operation, Table: table, Id: entityId}
+}
+
+// endregion
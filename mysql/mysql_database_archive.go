@@ -0,0 +1,190 @@
+package mysql
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// region Archive definitions ------------------------------------------------------------------------------------------
+
+// ArchiveOptions configures the archival of table rows to cold storage
+type ArchiveOptions struct {
+	Field        string                                   // Timestamp field (epoch milliseconds) of the document (default: createdOn)
+	Before       time.Time                                // Archive the documents older than the cutoff time
+	BatchSize    int                                      // Number of rows fetched and deleted per batch (default: 1000)
+	Checkpoint   *ArchiveCheckpoint                       // Checkpoint of a previous interrupted run to resume from (optional)
+	OnCheckpoint func(checkpoint ArchiveCheckpoint) error // Called after every batch flushed to the writer to persist the progress (optional)
+}
+
+// ArchiveCheckpoint is the progress of table archival, rows up to the position (timestamp, id) were flushed to the writer
+type ArchiveCheckpoint struct {
+	Table    string   `json:"table"`    // The archived table
+	Before   int64    `json:"before"`   // The cutoff time (epoch milliseconds)
+	LastTime int64    `json:"lastTime"` // Timestamp of the last archived row
+	LastId   string   `json:"lastId"`   // ID of the last archived row
+	Archived int64    `json:"archived"` // Number of rows written to the archive
+	Uploaded bool     `json:"uploaded"` // The archive was completed successfully (the writer was closed)
+	Deleted  int64    `json:"deleted"`  // Number of rows deleted after the upload
+	Pending  []string `json:"pending"`  // IDs of the archived rows which were not deleted yet
+}
+
+// ArchiveRecord is a single line of the archive (JSON-lines)
+type ArchiveRecord struct {
+	Id   string          `json:"id"`   // The row id
+	Data json.RawMessage `json:"data"` // The Json document
+}
+
+const (
+	sqlArchiveSelect = `SELECT id, CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED) AS ts, data FROM "%s" ` +
+		`WHERE CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED) < $1 AND (CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED) > $2 OR ` +
+		`(CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED) = $2 AND id > $3)) ORDER BY ts, id LIMIT %d`
+)
+
+// endregion
+
+// region Archive methods ----------------------------------------------------------------------------------------------
+
+// ArchiveTable stream the rows of the table older than the cutoff as gzip compressed JSON-lines (see ArchiveRecord) to
+// the writer, and delete them after a successful upload. If the writer implements io.Closer it is closed when the stream
+// is completed, and the rows are deleted only if Close succeeds (e.g. S3 multipart upload completion). Only the archived
+// rows are deleted (by id, see ArchiveCheckpoint.Pending), rows written behind the checkpoint position during the run
+// are kept for the next run.
+// To resume an interrupted run, pass the last persisted checkpoint: rows which were already flushed to the previous
+// writer are skipped (and deleted with the rest), so the previous archive part must be kept.
+//
+// param: table - The physical table name
+// param: w - The archive writer (file, S3 uploader)
+// param: opts - Archive options
+// return: Final checkpoint, error
+func (dbs *MySqlDatabase) ArchiveTable(table string, w io.Writer, opts ArchiveOptions) (cp ArchiveCheckpoint, err error) {
+
+	if opts.Field == "" {
+		opts.Field = "createdOn"
+	}
+	if err = validateFields(opts.Field); err != nil {
+		return
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+
+	cp = ArchiveCheckpoint{Table: table, Before: opts.Before.UnixMilli(), LastTime: -1 << 63}
+	if opts.Checkpoint != nil {
+		if opts.Checkpoint.Table != table {
+			return cp, fmt.Errorf("checkpoint of table %s can not be used for table %s", opts.Checkpoint.Table, table)
+		}
+		cp = *opts.Checkpoint
+	}
+
+	defer dbs.observe("archive", table, opts.BatchSize, time.Now(), &cp.Archived, &err)
+
+	if !cp.Uploaded {
+		if err = dbs.archiveRows(table, w, opts, &cp); err != nil {
+			return
+		}
+	}
+	err = dbs.deleteArchived(table, opts, &cp)
+	return
+}
+
+// archiveRows write the rows to the writer and close it
+func (dbs *MySqlDatabase) archiveRows(table string, w io.Writer, opts ArchiveOptions, cp *ArchiveCheckpoint) error {
+
+	zw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(zw)
+	f := opts.Field
+	SQL := fmt.Sprintf(sqlArchiveSelect, f, table, f, f, f, opts.BatchSize)
+
+	for {
+		rows, err := dbs.query(dbs.pgDb, table, "", SQL, cp.Before, cp.LastTime, cp.LastId)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for rows.Next() {
+			var (
+				rec ArchiveRecord
+				ts  int64
+			)
+			if err = rows.Scan(&rec.Id, &ts, &rec.Data); err == nil {
+				err = encoder.Encode(rec)
+			}
+			if err != nil {
+				_ = rows.Close()
+				return err
+			}
+			cp.LastTime, cp.LastId = ts, rec.Id
+			cp.Pending = append(cp.Pending, rec.Id)
+			cp.Archived++
+			count++
+		}
+		if err = rows.Err(); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		_ = rows.Close()
+
+		if count == 0 {
+			break
+		}
+		if err = zw.Flush(); err != nil {
+			return err
+		}
+		if opts.OnCheckpoint != nil {
+			if err = opts.OnCheckpoint(*cp); err != nil {
+				return err
+			}
+		}
+		if count < opts.BatchSize {
+			break
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if closer, ok := w.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+
+	cp.Uploaded = true
+	if opts.OnCheckpoint != nil {
+		return opts.OnCheckpoint(*cp)
+	}
+	return nil
+}
+
+// deleteArchived delete the archived rows (the pending ids of the checkpoint) in batches
+func (dbs *MySqlDatabase) deleteArchived(table string, opts ArchiveOptions, cp *ArchiveCheckpoint) error {
+	for len(cp.Pending) > 0 {
+		size := opts.BatchSize
+		if size > len(cp.Pending) {
+			size = len(cp.Pending)
+		}
+		SQL := fmt.Sprintf(sqlBulkDelete, table)
+		result, err := dbs.exec(dbs.pgDb, table, "", SQL, cp.Pending[:size])
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		cp.Deleted += affected
+		cp.Pending = cp.Pending[size:]
+		if opts.OnCheckpoint != nil {
+			if err = opts.OnCheckpoint(*cp); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// endregion
@@ -0,0 +1,292 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/go-yaaf/yaaf-common/messaging"
+)
+
+// region Array operations definitions ---------------------------------------------------------------------------------
+
+// Array operations
+const (
+	ArrayAdd    = "add_to_array"
+	ArrayAddSet = "add_to_set"
+	ArrayRemove = "remove_from_array"
+)
+
+// FieldMessageTopic is the topic prefix of field level change messages: FIELD-{Table}-{Key}
+const FieldMessageTopic = "FIELD"
+
+// FieldUpdate is the payload of field level change message
+type FieldUpdate struct {
+	Table    string `json:"table"`    // The entity table (template)
+	EntityId string `json:"entityId"` // The entity id
+	Tenant   string `json:"tenant"`   // The tenant (shard key)
+	Field    string `json:"field"`    // The array field
+	Op       string `json:"op"`       // The array operation: add_to_array, add_to_set or remove_from_array
+	Values   []any  `json:"values"`   // The added or removed values
+}
+
+const (
+	// sqlArrayField is the document with the field initialized to empty array if missing
+	sqlArrayField = "JSON_SET(data, '$.%s', COALESCE(JSON_EXTRACT(data, '$.%s'), JSON_ARRAY()))"
+
+	sqlArrayAppend = `UPDATE "%s" SET data = JSON_ARRAY_APPEND(%s, %s) WHERE id = $%d`
+	sqlArrayAddSet = `UPDATE "%s" SET data = JSON_ARRAY_APPEND(%s, '$.%s', CAST($1 AS JSON)) WHERE id = $2 AND ` +
+		`NOT COALESCE(JSON_CONTAINS(JSON_EXTRACT(data, '$.%s'), CAST($1 AS JSON)), 0)`
+	sqlArrayRemove = `UPDATE "%s" SET data = JSON_REMOVE(data, JSON_UNQUOTE(JSON_SEARCH(data, 'one', $1, NULL, '$.%s[*]'))) ` +
+		`WHERE id = $2 AND JSON_SEARCH(data, 'one', $1, NULL, '$.%s[*]') IS NOT NULL`
+)
+
+// searchEscaper escapes the JSON_SEARCH wildcards
+var searchEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// endregion
+
+// region Array operations methods -------------------------------------------------------------------------------------
+
+// AddToArray append the values to the array field of the document in a single statement (missing field is created)
+//
+// param: factory - Entity factory
+// param: entityID - The entity ID to update
+// param: field - The array field name
+// param: values - The values to append
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) AddToArray(factory EntityFactory, entityID string, field string, values []any, keys ...string) (err error) {
+	template := factory().TABLE()
+	defer dbs.observe(ArrayAdd, template, len(values), time.Now(), nil, &err)
+
+	table, err := dbs.arrayTable(template, field, keys...)
+	if err != nil || len(values) == 0 {
+		return
+	}
+	if err = dbs.admitWrite(template, 1); err != nil {
+		return
+	}
+
+	if dbs.rewritesInMemory(template) {
+		if _, err = dbs.rewriteArray(template, table, entityID, field, keys, values, func(array []any, value any) ([]any, bool) {
+			return append(array, value), true
+		}); err == nil {
+			dbs.publishFieldUpdate(template, entityID, tenantOf(keys...), field, ArrayAdd, values)
+		}
+		return
+	}
+
+	pairs := make([]string, 0, len(values))
+	args := make([]any, 0, len(values)+1)
+	for _, value := range values {
+		doc, er := json.Marshal(value)
+		if er != nil {
+			return er
+		}
+		args = append(args, string(doc))
+		pairs = append(pairs, fmt.Sprintf("'$.%s', CAST($%d AS JSON)", field, len(args)))
+	}
+	SQL := fmt.Sprintf(sqlArrayAppend, table, fmt.Sprintf(sqlArrayField, field, field), strings.Join(pairs, ", "), len(args)+1)
+
+	release := dbs.throttle(keys...)
+	result, err := dbs.execAudited(AuditSetField, template, table, tenantOf(keys...), entityID, nil, SQL, append(args, entityID)...)
+	release()
+	if err != nil {
+		return
+	}
+	if affected, er := result.RowsAffected(); er != nil {
+		return er
+	} else if affected == 0 {
+		return fmt.Errorf("no row affected when executing add to array operation")
+	}
+
+	dbs.publishFieldUpdate(template, entityID, tenantOf(keys...), field, ArrayAdd, values)
+	return nil
+}
+
+// AddToSet append the values which are not already members of the array field (missing field is created), every
+// value is added by a single statement
+//
+// param: factory - Entity factory
+// param: entityID - The entity ID to update
+// param: field - The array field name
+// param: values - The values to add
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) AddToSet(factory EntityFactory, entityID string, field string, values []any, keys ...string) (err error) {
+	template := factory().TABLE()
+	defer dbs.observe(ArrayAddSet, template, len(values), time.Now(), nil, &err)
+
+	table, err := dbs.arrayTable(template, field, keys...)
+	if err != nil {
+		return
+	}
+	if err = dbs.admitWrite(template, 1); err != nil {
+		return
+	}
+
+	if dbs.rewritesInMemory(template) {
+		var added []any
+		if added, err = dbs.rewriteArray(template, table, entityID, field, keys, values, func(array []any, value any) ([]any, bool) {
+			if valueIndex(array, value) >= 0 {
+				return array, false
+			}
+			return append(array, value), true
+		}); err == nil && len(added) > 0 {
+			dbs.publishFieldUpdate(template, entityID, tenantOf(keys...), field, ArrayAddSet, added)
+		}
+		return
+	}
+
+	SQL := fmt.Sprintf(sqlArrayAddSet, table, fmt.Sprintf(sqlArrayField, field, field), field, field)
+	added := make([]any, 0, len(values))
+	for _, value := range values {
+		doc, er := json.Marshal(value)
+		if er != nil {
+			return er
+		}
+		if ok, er := dbs.execArray(template, table, entityID, SQL, keys, string(doc), entityID); er != nil {
+			return er
+		} else if ok {
+			added = append(added, value)
+		}
+	}
+
+	if len(added) > 0 {
+		dbs.publishFieldUpdate(template, entityID, tenantOf(keys...), field, ArrayAddSet, added)
+	}
+	return nil
+}
+
+// RemoveFromArray remove the first occurrence of each value from the array field (string values only, as it relies on
+// JSON_SEARCH), every value is removed by a single statement
+//
+// param: factory - Entity factory
+// param: entityID - The entity ID to update
+// param: field - The array field name
+// param: values - The values to remove
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) RemoveFromArray(factory EntityFactory, entityID string, field string, values []string, keys ...string) (err error) {
+	template := factory().TABLE()
+	defer dbs.observe(ArrayRemove, template, len(values), time.Now(), nil, &err)
+
+	table, err := dbs.arrayTable(template, field, keys...)
+	if err != nil {
+		return
+	}
+	if err = dbs.admitWrite(template, 1); err != nil {
+		return
+	}
+
+	if dbs.rewritesInMemory(template) {
+		var removed []any
+		items := make([]any, 0, len(values))
+		for _, value := range values {
+			items = append(items, value)
+		}
+		if removed, err = dbs.rewriteArray(template, table, entityID, field, keys, items, func(array []any, value any) ([]any, bool) {
+			if idx := valueIndex(array, value); idx >= 0 {
+				return append(array[:idx:idx], array[idx+1:]...), true
+			}
+			return array, false
+		}); err == nil && len(removed) > 0 {
+			dbs.publishFieldUpdate(template, entityID, tenantOf(keys...), field, ArrayRemove, removed)
+		}
+		return
+	}
+
+	SQL := fmt.Sprintf(sqlArrayRemove, table, field, field)
+	removed := make([]any, 0, len(values))
+	for _, value := range values {
+		search := searchEscaper.Replace(value)
+		if ok, er := dbs.execArray(template, table, entityID, SQL, keys, search, entityID); er != nil {
+			return er
+		} else if ok {
+			removed = append(removed, value)
+		}
+	}
+
+	if len(removed) > 0 {
+		dbs.publishFieldUpdate(template, entityID, tenantOf(keys...), field, ArrayRemove, removed)
+	}
+	return nil
+}
+
+// arrayTable validate the array field and resolve the entity table
+func (dbs *MySqlDatabase) arrayTable(template, field string, keys ...string) (string, error) {
+	if err := validateFields(field); err != nil {
+		return "", err
+	}
+	if dbs.envelope(template) != nil {
+		return "", fmt.Errorf("array operations are not supported for encrypted documents")
+	}
+	return dbs.resolveTable(template, keys...)
+}
+
+// rewriteArray apply the array operation of every value to the array field of overflowed document in memory (see
+// rewriteDocument), returns the values which changed the array
+func (dbs *MySqlDatabase) rewriteArray(template, table, entityID, field string, keys []string, values []any, op func(array []any, value any) ([]any, bool)) (changed []any, err error) {
+	items, err := jsonValue(values)
+	if err != nil {
+		return nil, err
+	}
+
+	release := dbs.throttle(keys...)
+	defer release()
+
+	_, err = dbs.rewriteDocument(template, table, tenantOf(keys...), entityID, AuditSetField, func(doc map[string]any) (bool, error) {
+		array, er := arrayValue(doc, field)
+		if er != nil {
+			return false, er
+		}
+		changed = make([]any, 0, len(values))
+		for i, item := range items.([]any) {
+			ok := false
+			if array, ok = op(array, item); ok {
+				changed = append(changed, values[i])
+			}
+		}
+		doc[field] = array
+		return len(changed) > 0, nil
+	})
+	return changed, err
+}
+
+// execArray execute single array statement, returns true if the document was changed
+func (dbs *MySqlDatabase) execArray(template, table, entityID, SQL string, keys []string, args ...any) (bool, error) {
+	release := dbs.throttle(keys...)
+	defer release()
+
+	result, err := dbs.execAudited(AuditSetField, template, table, tenantOf(keys...), entityID, nil, SQL, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	return affected > 0, err
+}
+
+// publishFieldUpdate publish field level change message
+func (dbs *MySqlDatabase) publishFieldUpdate(template, entityID, tenant, field, op string, values []any) {
+	if dbs.bus == nil {
+		return
+	}
+
+	message := &messaging.EntityMessage{
+		BaseMessage: messaging.BaseMessage{
+			MsgTopic:     fmt.Sprintf("%s-%s-%s", FieldMessageTopic, template, tenant),
+			MsgOpCode:    int(UpdateEntity),
+			MsgAddressee: field,
+			MsgSessionId: entityID,
+		},
+		MsgPayload: &FieldUpdate{Table: template, EntityId: entityID, Tenant: tenant, Field: field, Op: op, Values: values},
+	}
+	if err := dbs.bus.Publish(message); err != nil {
+		dbs.log().Warn("error publishing field change: %s", err.Error())
+	}
+}
+
+// endregion
@@ -0,0 +1,309 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Audit log definitions ----------------------------------------------------------------------------------------
+
+// Audit actions
+const (
+	AuditInsert   = "insert"
+	AuditUpdate   = "update"
+	AuditUpsert   = "upsert"
+	AuditDelete   = "delete"
+	AuditSetField = "set_field"
+	AuditPatch    = "patch"
+)
+
+// auditGlobalTenant is the audit table key of non-sharded entities
+const auditGlobalTenant = "global"
+
+// AuditEntry is the audit record of a single mutation, stored in the per-tenant audit table (audit-{{accountId}})
+type AuditEntry struct {
+	BaseEntity
+	Actor    string          `json:"actor"`            // Who made the change
+	Action   string          `json:"action"`           // The mutation: insert, update, upsert, delete, set_field or patch
+	Table    string          `json:"table"`            // The entity physical table
+	EntityId string          `json:"entityId"`         // The entity id
+	Tenant   string          `json:"tenant"`           // The tenant (shard key)
+	Before   json.RawMessage `json:"before,omitempty"` // The entity document before the change (empty for insert)
+	After    json.RawMessage `json:"after,omitempty"`  // The entity document after the change (empty for delete)
+}
+
+func (a *AuditEntry) TABLE() string { return "audit-{{accountId}}" }
+func (a *AuditEntry) NAME() string  { return fmt.Sprintf("%s %s", a.Action, a.EntityId) }
+func (a *AuditEntry) KEY() string   { return a.Tenant }
+
+// NewAuditEntry is the audit entry factory, used to query the audit log (e.g. db.Query(NewAuditEntry).Filter(...).Find(tenant))
+func NewAuditEntry() Entity { return &AuditEntry{} }
+
+// AuditOptions configures the mutation audit log
+type AuditOptions struct {
+	Actor func() string // Returns the actor (user or service) of the current mutation (nil for anonymous)
+}
+
+// auditLog holds the audit configuration and the created audit tables
+type auditLog struct {
+	options AuditOptions
+	tables  sync.Map
+}
+
+// endregion
+
+// region Audit log methods --------------------------------------------------------------------------------------------
+
+// EnableAudit record every single entity mutation: Insert, Update, Upsert, Delete, SetField, IncrementField, Patch and
+// the array operations (who, when, entity id, table, before and after documents) into the per-tenant audit table, within
+// the same transaction of the mutation (nil to disable). Mutations which did not change any row are not recorded.
+// The bulk operations (BulkInsert, BulkUpdate, BulkUpsert, BulkDelete, BulkSetFields) and the query Delete and
+// SetFields are not audited
+//
+// param: options - Audit options
+func (dbs *MySqlDatabase) EnableAudit(options *AuditOptions) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if options == nil {
+		dbs.audit = nil
+		return
+	}
+	dbs.audit = &auditLog{options: *options}
+}
+
+// AuditLog returns the audit entries of a single entity in chronological order
+//
+// param: tenant - The tenant (shard key) of the entity (empty for non-sharded entities)
+// param: entityId - The entity id
+// param: from - Start of the time range (inclusive)
+// param: to - End of the time range (inclusive)
+// return: List of audit entries, error
+func (dbs *MySqlDatabase) AuditLog(tenant, entityId string, from, to Timestamp) (list []*AuditEntry, err error) {
+	if tenant == "" {
+		tenant = auditGlobalTenant
+	}
+
+	list = make([]*AuditEntry, 0)
+	result, _, err := dbs.Query(NewAuditEntry).
+		Filter(database.F("entityId").Eq(entityId)).
+		Range("createdOn", from, to).
+		Sort("createdOn").
+		Limit(0).
+		Find(tenant)
+	if err != nil {
+		return list, err
+	}
+	for _, ent := range result {
+		list = append(list, ent.(*AuditEntry))
+	}
+	return list, nil
+}
+
+// auditLogger returns the audit configuration (nil if disabled)
+func (dbs *MySqlDatabase) auditLogger() *auditLog {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.audit
+}
+
+// execAudited execute mutation statement of single entity, when audit, history, soft delete or lifecycle hooks are
+// enabled the mutation, the audit entry, the prior version, the trash entry and the hooks run in the same transaction.
+// The entity (optional) is passed to the hooks, in which case the statement args are (id, data, ...) and the data is
+// marshaled again if the Before hooks changed the entity
+func (dbs *MySqlDatabase) execAudited(action, template, table, tenant, entityId string, entity Entity, SQL string, args ...any) (result sql.Result, err error) {
+	result, _, err = dbs.execMutation(action, template, table, tenant, entityId, entity, false, SQL, args...)
+	return
+}
+
+// execMutation execute mutation statement of single entity (see execAudited), when lockBefore is set the mutation always
+// runs in transaction and the document before the mutation is read with exclusive lock and returned
+func (dbs *MySqlDatabase) execMutation(action, template, table, tenant, entityId string, entity Entity, lockBefore bool, SQL string, args ...any) (result sql.Result, before json.RawMessage, err error) {
+	audit := dbs.auditLogger()
+	history := action != AuditInsert && dbs.historyEnabled(template)
+	trash := action == AuditDelete && dbs.softDeleteEnabled(template)
+	beforeHooks, afterHooks := dbs.lifecycleHooks(template, action)
+	if audit == nil && !history && !trash && beforeHooks == nil && afterHooks == nil && !lockBefore {
+		// replacing the document (plain upsert) is idempotent
+		if SQL == fmt.Sprintf(sqlUpsert, table) {
+			result, err = dbs.execIdempotent(dbs.pgDb, table, tenant, SQL, args...)
+		} else {
+			result, err = dbs.exec(dbs.pgDb, table, tenant, SQL, args...)
+		}
+		return
+	}
+
+	auditKey := tenant
+	if auditKey == "" {
+		auditKey = auditGlobalTenant
+	}
+	auditTable := dbs.tableName((&AuditEntry{}).TABLE(), auditKey)
+	if audit != nil {
+		if err = audit.ensureTable(dbs, auditTable); err != nil {
+			return nil, nil, err
+		}
+	}
+	if history {
+		if err = dbs.ensureCompanionTable(historyTable(table), "entityId", "createdOn"); err != nil {
+			return nil, nil, err
+		}
+	}
+	if trash {
+		if err = dbs.ensureCompanionTable(trashTableName(table), "createdOn"); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tx, err := dbs.pgDb.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &AuditEntry{Action: action, Table: table, EntityId: entityId, Tenant: auditKey}
+	if audit != nil && audit.options.Actor != nil {
+		entry.Actor = audit.options.Actor()
+	}
+
+	if action != AuditInsert || lockBefore {
+		if entry.Before, err = dbs.readDocument(tx, table, tenant, entityId, lockBefore); err != nil {
+			_ = tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	beforeEvent, afterEvent := hookEvents(action)
+	hookCtx := HookContext{Table: table, Tenant: tenant, EntityId: entityId, Entity: entity, Before: entry.Before, Tx: tx}
+	if len(beforeHooks) > 0 {
+		// the statement data is marshaled again only if the hooks changed the entity (marshaling validates the document
+		// and may write another overflow blob)
+		var snapshot []byte
+		remarshal := entity != nil && action != AuditDelete && len(args) > 1
+		if remarshal {
+			if snapshot, err = json.Marshal(entity); err != nil {
+				_ = tx.Rollback()
+				return nil, nil, err
+			}
+		}
+		hookCtx.Event = beforeEvent
+		if err = runHooks(beforeHooks, hookCtx); err != nil {
+			_ = tx.Rollback()
+			return nil, nil, err
+		}
+		if remarshal {
+			if err = dbs.remarshalChanged(entity, table, snapshot, args); err != nil {
+				_ = tx.Rollback()
+				return nil, nil, err
+			}
+		}
+	}
+
+	if result, err = dbs.exec(tx, table, tenant, SQL, args...); err != nil {
+		_ = tx.Rollback()
+		return nil, nil, err
+	}
+
+	// No row was changed (missing entity, stale version or hash): no version, trash entry, after hooks or audit entry
+	if affected, er := result.RowsAffected(); er != nil || affected == 0 {
+		_ = tx.Rollback()
+		return result, entry.Before, er
+	}
+
+	if history && entry.Before != nil {
+		if err = dbs.writeVersion(tx, table, tenant, entry); err != nil {
+			_ = tx.Rollback()
+			return nil, nil, err
+		}
+	}
+	if trash && entry.Before != nil {
+		if err = dbs.writeTrash(tx, table, tenant, entry); err != nil {
+			_ = tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	if len(afterHooks) > 0 {
+		hookCtx.Event = afterEvent
+		if err = runHooks(afterHooks, hookCtx); err != nil {
+			_ = tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	if audit == nil {
+		return result, entry.Before, tx.Commit()
+	}
+
+	if action != AuditDelete {
+		if entry.After, err = dbs.readDocument(tx, table, tenant, entityId, false); err != nil {
+			_ = tx.Rollback()
+			return nil, nil, err
+		}
+	}
+
+	entry.Id = GUID()
+	entry.CreatedOn = Timestamp(dbs.now().UnixMilli())
+	entry.UpdatedOn = entry.CreatedOn
+	data, err := Marshal(entry)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, nil, err
+	}
+	if _, err = dbs.exec(tx, auditTable, tenant, fmt.Sprintf(sqlInsert, auditTable), entry.Id, data); err != nil {
+		_ = tx.Rollback()
+		return nil, nil, err
+	}
+	return result, entry.Before, tx.Commit()
+}
+
+// remarshalChanged marshal the entity to the statement data argument (args[1]) if it was changed since the snapshot
+func (dbs *MySqlDatabase) remarshalChanged(entity Entity, table string, snapshot []byte, args []any) error {
+	current, err := json.Marshal(entity)
+	if err != nil || bytes.Equal(current, snapshot) {
+		return err
+	}
+	args[1], err = dbs.marshal(entity, table)
+	return err
+}
+
+// readDocument read the entity document (returns nil if not found), optionally locking the row for update
+func (dbs *MySqlDatabase) readDocument(runner sqlRunner, table, tenant, entityId string, forUpdate bool) (json.RawMessage, error) {
+	SQL := fmt.Sprintf(`SELECT data FROM "%s" WHERE id = $1`, table)
+	if forUpdate {
+		SQL += " FOR UPDATE"
+	}
+	rows, err := dbs.query(runner, table, tenant, SQL, entityId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var data []byte
+	if err = rows.Scan(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ensureTable create the audit table if not already created
+func (a *auditLog) ensureTable(dbs *MySqlDatabase, table string) error {
+	if _, exists := a.tables.Load(table); exists {
+		return nil
+	}
+	if err := dbs.ExecuteDDL(map[string][]string{table: {"entityId", "createdOn"}}); err != nil {
+		dbs.log().Error("create audit table %s error: %s", table, err.Error())
+		return err
+	}
+	a.tables.Store(table, true)
+	return nil
+}
+
+// endregion
@@ -0,0 +1,181 @@
+package mysql
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Backup definitions -------------------------------------------------------------------------------------------
+
+// RestoreOptions configures the restore of table backup
+type RestoreOptions struct {
+	Fields    []string // Fields to index in the restored table (optional)
+	BatchSize int      // Number of rows inserted in a single transaction (default: 1000)
+}
+
+const sqlBackupTable = `SELECT id, data FROM "%s" ORDER BY id`
+
+// endregion
+
+// region Backup methods -----------------------------------------------------------------------------------------------
+
+// BackupTable write consistent snapshot of the table (single read-only repeatable-read transaction) to the writer as
+// gzip compressed JSON-lines (see ArchiveRecord), the rows are streamed without buffering
+//
+// param: table - The physical table name
+// param: w - The backup writer (file, storage uploader)
+// return: Number of rows written, error
+func (dbs *MySqlDatabase) BackupTable(table string, w io.Writer) (count int64, err error) {
+
+	defer dbs.observe("backup", table, 0, time.Now(), &count, &err)
+
+	tx, err := dbs.pgDb.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	rows, err := dbs.query(tx, table, "", fmt.Sprintf(sqlBackupTable, table))
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	zw := gzip.NewWriter(w)
+	encoder := json.NewEncoder(zw)
+	for rows.Next() {
+		rec := ArchiveRecord{}
+		if err = rows.Scan(&rec.Id, &rec.Data); err != nil {
+			return
+		}
+		if err = encoder.Encode(rec); err != nil {
+			return
+		}
+		count++
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	err = zw.Close()
+	return
+}
+
+// BackupShards backup all the existing shard tables of the entity (or its single table if it is not sharded), the open
+// function returns the writer of every table backup (closed when the table backup is completed)
+//
+// param: factory - Entity factory
+// param: open - Returns the backup writer of the table
+// return: Number of rows written per table, error
+func (dbs *MySqlDatabase) BackupShards(factory EntityFactory, open func(table string) (io.WriteCloser, error)) (counts map[string]int64, err error) {
+
+	counts = make(map[string]int64)
+	template := factory().TABLE()
+
+	tables := []string{template}
+	if strings.Contains(template, "{{") {
+		shards, er := dbs.listShards(template)
+		if er != nil {
+			return counts, er
+		}
+		tables = make([]string, 0, len(shards))
+		for _, shard := range shards {
+			tables = append(tables, shard.Table)
+		}
+	}
+
+	for _, table := range tables {
+		w, er := open(table)
+		if er != nil {
+			return counts, er
+		}
+		counts[table], er = dbs.BackupTable(table, w)
+		if cer := w.Close(); er == nil {
+			er = cer
+		}
+		if er != nil {
+			return counts, fmt.Errorf("backup %s: %s", table, er.Error())
+		}
+	}
+	return counts, nil
+}
+
+// RestoreTable restore table backup (see BackupTable) into a fresh table, the table must not exist.
+// To replace existing table, restore into a new table and swap the tables with RenameTable.
+//
+// param: table - The new physical table name
+// param: r - The backup reader
+// param: opts - Restore options
+// return: Number of restored rows, error
+func (dbs *MySqlDatabase) RestoreTable(table string, r io.Reader, opts RestoreOptions) (count int64, err error) {
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	defer dbs.observe("restore_table", table, opts.BatchSize, time.Now(), &count, &err)
+
+	if exists, er := dbs.listTables(table); er != nil {
+		return 0, er
+	} else if len(exists) > 0 {
+		return 0, fmt.Errorf("table %s already exists", table)
+	}
+
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return
+	}
+	if err = dbs.ExecuteDDL(map[string][]string{table: opts.Fields}); err != nil {
+		return
+	}
+
+	SQL := fmt.Sprintf(sqlInsert, table)
+	batch := make([]ArchiveRecord, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		tx, er := dbs.pgDb.Begin()
+		if er != nil {
+			return er
+		}
+		for _, rec := range batch {
+			if _, er = dbs.exec(tx, table, "", SQL, rec.Id, []byte(rec.Data)); er != nil {
+				_ = tx.Rollback()
+				return er
+			}
+		}
+		if er = tx.Commit(); er != nil {
+			return er
+		}
+		count += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(zr))
+	for {
+		rec := ArchiveRecord{}
+		if err = decoder.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return
+		}
+		if batch = append(batch, rec); len(batch) >= opts.BatchSize {
+			if err = flush(); err != nil {
+				return
+			}
+		}
+	}
+	err = flush()
+	return
+}
+
+// endregion
@@ -0,0 +1,204 @@
+package mysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// region Circuit breaker definitions ----------------------------------------------------------------------------------
+
+// ErrCircuitOpen is the sentinel of CircuitOpenError (use errors.Is)
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned (without calling the database) while the circuit breaker is open
+type CircuitOpenError struct {
+	OpenedAt time.Time // The time the circuit was opened
+	RetryAt  time.Time // The time the circuit breaker probes the database again
+}
+
+// Error returns the error message
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s since %s, retry at %s", ErrCircuitOpen.Error(), e.OpenedAt.Format(time.RFC3339), e.RetryAt.Format(time.RFC3339))
+}
+
+// Unwrap returns the ErrCircuitOpen sentinel
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// CircuitState is the state of the circuit breaker
+type CircuitState int
+
+const (
+	CircuitClosed   CircuitState = iota // Database calls pass through
+	CircuitOpen                         // Database calls fail fast with CircuitOpenError
+	CircuitHalfOpen                     // Limited probe calls pass through to detect recovery
+)
+
+// String returns the state name
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerOptions configures the circuit breaker
+type CircuitBreakerOptions struct {
+	Failures      int                         // Consecutive connection errors opening the circuit (default 5)
+	OpenTimeout   time.Duration               // Time the circuit stays open before probing recovery (default 30 seconds)
+	Probes        int                         // Concurrent probe calls of the half-open circuit (default 1)
+	OnStateChange func(from, to CircuitState) // Optional callback of state transitions
+	IsFailure     func(err error) bool        // Optional classification of failures (default: connection errors and timeouts)
+}
+
+// circuitBreaker opens after consecutive connection errors and closes when a probe call succeeds
+type circuitBreaker struct {
+	mu       sync.Mutex
+	options  CircuitBreakerOptions
+	state    CircuitState
+	failures int
+	probes   int
+	openedAt time.Time
+}
+
+// endregion
+
+// region Circuit breaker methods --------------------------------------------------------------------------------------
+
+// SetCircuitBreaker enable the circuit breaker of the database calls (nil to disable): after consecutive connection
+// errors or timeouts the circuit opens and the calls fail fast with CircuitOpenError, after the open timeout probe calls
+// pass through, a successful probe closes the circuit and a failed probe opens it again.
+// Statement errors returned by a reachable server (e.g. duplicate key) do not count as failures.
+//
+// param: options - Circuit breaker options
+func (dbs *MySqlDatabase) SetCircuitBreaker(options *CircuitBreakerOptions) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if options == nil {
+		dbs.breaker = nil
+		return
+	}
+	opts := *options
+	if opts.Failures <= 0 {
+		opts.Failures = 5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+	if opts.Probes <= 0 {
+		opts.Probes = 1
+	}
+	if opts.IsFailure == nil {
+		opts.IsFailure = IsConnectionError
+	}
+	dbs.breaker = &circuitBreaker{options: opts}
+}
+
+// CircuitState returns the state of the circuit breaker (closed if disabled)
+func (dbs *MySqlDatabase) CircuitState() CircuitState {
+	if cb := dbs.circuitBreaker(); cb != nil {
+		cb.mu.Lock()
+		defer cb.mu.Unlock()
+		return cb.state
+	}
+	return CircuitClosed
+}
+
+// IsConnectionError check if the error is a connection error or timeout (the database is unreachable or overloaded)
+//
+// param: err - The error
+// return: true if the error is a connection error
+func IsConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1040, 1053, 1081, 1129, 1130, 1152, 1153, 1159, 1161, 3024:
+			// too many connections, server shutdown, connection errors and execution timeout
+			return true
+		}
+	}
+	return false
+}
+
+// circuitBreaker returns the circuit breaker (nil if disabled)
+func (dbs *MySqlDatabase) circuitBreaker() *circuitBreaker {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.breaker
+}
+
+// allow check if the call may pass through, returns CircuitOpenError otherwise
+func (cb *circuitBreaker) allow(now time.Time) error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.options.OpenTimeout {
+		cb.transition(CircuitHalfOpen)
+		cb.probes = 0
+	}
+
+	switch cb.state {
+	case CircuitOpen:
+		return &CircuitOpenError{OpenedAt: cb.openedAt, RetryAt: cb.openedAt.Add(cb.options.OpenTimeout)}
+	case CircuitHalfOpen:
+		if cb.probes >= cb.options.Probes {
+			return &CircuitOpenError{OpenedAt: cb.openedAt, RetryAt: now}
+		}
+		cb.probes++
+	}
+	return nil
+}
+
+// record the result of the call
+func (cb *circuitBreaker) record(err error, now time.Time) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.options.IsFailure(err) {
+		cb.failures++
+		if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.options.Failures) {
+			cb.openedAt = now
+			cb.transition(CircuitOpen)
+		}
+		return
+	}
+
+	cb.failures = 0
+	if cb.state == CircuitHalfOpen {
+		cb.transition(CircuitClosed)
+	}
+}
+
+// transition change the state and notify the state change callback (called with the lock held)
+func (cb *circuitBreaker) transition(to CircuitState) {
+	from := cb.state
+	cb.state = to
+	if cb.options.OnStateChange != nil && from != to {
+		go cb.options.OnStateChange(from, to)
+	}
+}
+
+// endregion
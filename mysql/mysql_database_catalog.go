@@ -0,0 +1,127 @@
+package mysql
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// catalogSeparator joins the catalog and table names of the resolved table name, the separator is replaced by the
+// quoted dot of the enclosing quotes (see qualifyNames) when the statement is executed, so the same resolved name is
+// quoted as "catalog"."table" by the entity statements and as `catalog`.`table` by the MySQL statements
+const catalogSeparator = "\x1f"
+
+// region Catalog methods ----------------------------------------------------------------------------------------------
+
+// SetDefaultCatalog set the database (catalog) of the entity tables which are not qualified by their template or by
+// SetEntityCatalog, so one handle can serve several logical databases of the same server (empty for the database of
+// the connection)
+//
+// param: catalog - The default database name
+func (dbs *MySqlDatabase) SetDefaultCatalog(catalog string) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.catalog = catalog
+}
+
+// SetEntityCatalog set the database (catalog) of the entity table (empty to use the default catalog), entity table
+// templates may also be qualified directly (e.g. crm.accounts)
+//
+// param: factory - Entity factory
+// param: catalog - The database name
+func (dbs *MySqlDatabase) SetEntityCatalog(factory EntityFactory, catalog string) {
+	template := factory().TABLE()
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if catalog == "" {
+		delete(dbs.catalogs, template)
+		return
+	}
+	if dbs.catalogs == nil {
+		dbs.catalogs = make(map[string]string)
+	}
+	dbs.catalogs[template] = catalog
+}
+
+// resolveName resolve the physical table name of the template and qualify it by its catalog: the catalog of the template
+// (taken before the keys are substituted, so a key which contains a dot, e.g. acme.com, is part of the table name), of
+// SetEntityCatalog or the default catalog. A name already qualified by the resolver (see catalogSeparator) is kept
+func (dbs *MySqlDatabase) resolveName(template string, now time.Time, keys ...string) string {
+	table := dbs.tableNameResolver().Resolve(template, now, keys...)
+	if strings.Contains(table, catalogSeparator) {
+		return table
+	}
+
+	name := table
+	catalog := templateCatalog(template)
+	if catalog != "" && strings.HasPrefix(table, catalog+".") {
+		name = table[len(catalog)+1:]
+	} else {
+		dbs.mu.RLock()
+		if catalog = dbs.catalogs[template]; catalog == "" {
+			catalog = dbs.catalog
+		}
+		dbs.mu.RUnlock()
+	}
+	if catalog == "" {
+		return name
+	}
+	return catalog + catalogSeparator + name
+}
+
+// templateCatalog returns the catalog of the qualified table template (e.g. crm of crm.accounts), the catalog is a
+// literal name without keys (empty if the template is not qualified)
+func templateCatalog(template string) string {
+	idx := strings.Index(template, ".")
+	if idx <= 0 || strings.Contains(template[:idx], "{") {
+		return ""
+	}
+	return template[:idx]
+}
+
+// splitCatalog split the resolved table name to the catalog and the table name (empty catalog if not qualified)
+func splitCatalog(table string) (catalog, name string) {
+	if idx := strings.Index(table, catalogSeparator); idx >= 0 {
+		return table[:idx], table[idx+len(catalogSeparator):]
+	}
+	return "", table
+}
+
+// schemaArgs returns the arguments of information_schema query of the table: the catalog (empty for the database of
+// the connection), the table name and the additional arguments
+func schemaArgs(table string, args ...any) []any {
+	catalog, name := splitCatalog(table)
+	return append([]any{catalog, name}, args...)
+}
+
+// baseName returns the table name without the catalog, used for the names of the objects derived from the table name
+// which cannot be qualified (e.g. index and constraint names)
+func baseName(table string) string {
+	_, name := splitCatalog(table)
+	return name
+}
+
+// qualifyNames quote the qualified table names of the statement: the catalog separator is replaced by the closing
+// quote, dot and opening quote of the enclosing identifier quotes (double quotes or backticks)
+func qualifyNames(SQL string) string {
+	parts := strings.Split(SQL, catalogSeparator)
+	if len(parts) == 1 {
+		return SQL
+	}
+
+	var sb strings.Builder
+	quote := ""
+	for _, part := range parts[:len(parts)-1] {
+		if idx := strings.LastIndexAny(part, "`\""); idx >= 0 {
+			quote = part[idx : idx+1]
+		}
+		sb.WriteString(part)
+		sb.WriteString(quote + "." + quote)
+	}
+	sb.WriteString(parts[len(parts)-1])
+	return sb.String()
+}
+
+// endregion
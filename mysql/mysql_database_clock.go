@@ -0,0 +1,51 @@
+package mysql
+
+import (
+	"strings"
+	"time"
+)
+
+// referenceTimeKeyPrefix is the prefix of the pseudo shard key carrying the reference time of a single operation
+const referenceTimeKeyPrefix = "@time:"
+
+// region Reference time methods ---------------------------------------------------------------------------------------
+
+// AtTime returns pseudo shard key overriding the reference time of a single operation, used to resolve time based table
+// name templates ({{year}}, {{month}}, {{week}}, {{day}}, {{hour}}) of historical imports and tests, for example:
+//
+//	db.Insert(event)                                        // resolved by the database clock
+//	db.Get(NewEvent, "id", "acme", mysql.AtTime(lastMonth)) // resolved by the explicit time
+//
+// The key may be passed in any position, it is not counted as a shard key. The time zone offset of the time is kept,
+// so the periods are resolved in the time zone of the given time (as of the database clock).
+//
+// param: t - The reference time
+// return: Pseudo shard key
+func AtTime(t time.Time) string {
+	return referenceTimeKeyPrefix + t.Format(time.RFC3339Nano)
+}
+
+// referenceTime returns the reference time of the operation (explicit AtTime key or the database clock) and the shard
+// keys without the reference time key
+func (dbs *MySqlDatabase) referenceTime(keys ...string) (time.Time, []string) {
+	if at, rest, ok := splitReferenceTime(keys...); ok {
+		return at, rest
+	}
+	return dbs.now(), keys
+}
+
+// splitReferenceTime extract the reference time key from the shard keys
+func splitReferenceTime(keys ...string) (at time.Time, rest []string, ok bool) {
+	for i, key := range keys {
+		if !strings.HasPrefix(key, referenceTimeKeyPrefix) {
+			continue
+		}
+		if at, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(key, referenceTimeKeyPrefix)); err == nil {
+			rest = append(append(make([]string, 0, len(keys)-1), keys[:i]...), keys[i+1:]...)
+			return at, rest, true
+		}
+	}
+	return time.Time{}, keys, false
+}
+
+// endregion
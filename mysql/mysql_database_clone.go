@@ -0,0 +1,158 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Point-in-time clone definitions ------------------------------------------------------------------------------
+
+const (
+	sqlVersionsAfter = `SELECT data FROM "%s" WHERE (data->>'createdOn')::BIGINT > $1 ORDER BY data->>'entityId', (data->>'createdOn')::BIGINT`
+	sqlCloneSource   = `SELECT id, data FROM "%s"`
+	cloneBatchSize   = 1000
+)
+
+// endregion
+
+// region Point-in-time clone methods ----------------------------------------------------------------------------------
+
+// CloneTableData materialize the state of the table at a past time into a new scratch table (e.g. for incident
+// forensics), using the version history of the table (see SetHistory): entities modified or deleted since are taken
+// from their prior version, entities created since are excluded. The state is accurate only for changes made while
+// the history was enabled.
+//
+// param: src - The source physical table name
+// param: dst - The new physical table name (created like the source table)
+// param: asOf - The point in time
+// return: Number of cloned entities, error
+func (dbs *MySqlDatabase) CloneTableData(src, dst string, asOf Timestamp) (count int64, err error) {
+
+	defer dbs.observe("clone_table", src, 0, time.Now(), &count, &err)
+
+	history := historyTable(src)
+	if exists, er := dbs.listTables(history); er != nil {
+		return 0, er
+	} else if len(exists) == 0 {
+		return 0, fmt.Errorf("table %s has no version history", src)
+	}
+
+	// The state at the point in time of the entities changed since is their first version replaced after it
+	versions, err := dbs.versionsAfter(history, asOf)
+	if err != nil {
+		return
+	}
+
+	if _, err = dbs.CopyTable(src, dst, false); err != nil {
+		return
+	}
+
+	batch := make([]ArchiveRecord, 0, cloneBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		tx, er := dbs.pgDb.Begin()
+		if er != nil {
+			return er
+		}
+		for _, rec := range batch {
+			if _, er = dbs.exec(tx, dst, "", fmt.Sprintf(sqlInsert, dst), rec.Id, []byte(rec.Data)); er != nil {
+				_ = tx.Rollback()
+				return er
+			}
+		}
+		if er = tx.Commit(); er != nil {
+			return er
+		}
+		count += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+	add := func(id string, data []byte) error {
+		if !existedAt(data, asOf) {
+			return nil
+		}
+		if batch = append(batch, ArchiveRecord{Id: id, Data: data}); len(batch) >= cloneBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	// Current rows which were not changed since the point in time
+	rows, err := dbs.query(dbs.pgDb, src, "", fmt.Sprintf(sqlCloneSource, src))
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+		if err = rows.Scan(&id, &data); err == nil {
+			if _, changed := versions[id]; !changed {
+				err = add(id, data)
+			}
+		}
+		if err != nil {
+			_ = rows.Close()
+			return
+		}
+	}
+	if err = rows.Err(); err != nil {
+		_ = rows.Close()
+		return
+	}
+	_ = rows.Close()
+
+	// Prior versions of the changed (or deleted) entities
+	for id, data := range versions {
+		if err = add(id, data); err != nil {
+			return
+		}
+	}
+	err = flush()
+	return
+}
+
+// versionsAfter returns the first version (by entity id) replaced after the point in time
+func (dbs *MySqlDatabase) versionsAfter(history string, asOf Timestamp) (map[string]json.RawMessage, error) {
+	rows, err := dbs.query(dbs.pgDb, history, "", fmt.Sprintf(sqlVersionsAfter, history), int64(asOf))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	versions := make(map[string]json.RawMessage)
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		version := EntityVersion{}
+		if err = json.Unmarshal(data, &version); err != nil {
+			return nil, err
+		}
+		if _, exists := versions[version.EntityId]; !exists {
+			versions[version.EntityId] = version.Data
+		}
+	}
+	return versions, rows.Err()
+}
+
+// existedAt returns true if the entity document was created at or before the point in time (documents without
+// creation time are considered existing)
+func existedAt(data []byte, asOf Timestamp) bool {
+	doc := struct {
+		CreatedOn *Timestamp `json:"createdOn"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil || doc.CreatedOn == nil {
+		return true
+	}
+	return *doc.CreatedOn <= asOf
+}
+
+// endregion
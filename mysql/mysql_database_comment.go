@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var commentReplacer = strings.NewReplacer("*", "", "\n", "_", "\r", "_", "\t", "_", " ", "_", "=", "_")
+
+// region Statement comments definitions -------------------------------------------------------------------------------
+
+// StatementTagger returns additional tags of the statement (e.g. trace_id of the current request)
+type StatementTagger func(stmt *Statement) map[string]string
+
+// statementCommenter holds the statement comments configuration
+type statementCommenter struct {
+	service string          // The service name
+	tagger  StatementTagger // Additional tags provider
+}
+
+// endregion
+
+// region Statement comments methods -----------------------------------------------------------------------------------
+
+// SetStatementComments prepend marginalia-style comment (/* service=X trace_id=Y tenant=Z */) to the executed statements,
+// so DBAs can attribute load in performance_schema and slow logs to services and tenants
+// The tenant tag is the shard key of the statement, additional tags are provided by the tagger
+//
+// param: service - The service name (empty to omit the service tag)
+// param: tagger - Additional tags provider (nil for no additional tags)
+func (dbs *MySqlDatabase) SetStatementComments(service string, tagger StatementTagger) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if service == "" && tagger == nil {
+		dbs.commenter = nil
+		return
+	}
+	dbs.commenter = &statementCommenter{service: service, tagger: tagger}
+}
+
+// statementComment returns the function building the statement comment (empty comment if disabled)
+func (dbs *MySqlDatabase) statementComment() func(stmt *Statement) string {
+	dbs.mu.RLock()
+	commenter := dbs.commenter
+	dbs.mu.RUnlock()
+
+	if commenter == nil {
+		return func(stmt *Statement) string { return "" }
+	}
+	return commenter.comment
+}
+
+// comment build the statement comment
+func (c *statementCommenter) comment(stmt *Statement) string {
+	tags := make([]string, 0)
+	if c.service != "" {
+		tags = append(tags, commentTag("service", c.service))
+	}
+
+	if c.tagger != nil {
+		extra := c.tagger(stmt)
+		names := make([]string, 0, len(extra))
+		for name := range extra {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if extra[name] != "" {
+				tags = append(tags, commentTag(name, extra[name]))
+			}
+		}
+	}
+
+	if stmt.Tenant != "" {
+		tags = append(tags, commentTag("tenant", stmt.Tenant))
+	}
+
+	if len(tags) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("/* %s */ ", strings.Join(tags, " "))
+}
+
+// commentTag format single comment tag, asterisks are removed (so the comment can not be closed) and whitespaces are replaced
+func commentTag(name, value string) string {
+	return fmt.Sprintf("%s=%s", commentReplacer.Replace(name), commentReplacer.Replace(value))
+}
+
+// endregion
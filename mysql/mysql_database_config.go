@@ -0,0 +1,228 @@
+package mysql
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/go-yaaf/yaaf-common/messaging"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// region Config builder definitions -----------------------------------------------------------------------------------
+
+// ConfigBuilder is a typed builder of the database connection, it creates the database instance directly or renders
+// the canonical connection URI, for example:
+//
+//	db, err := mysql.NewConfigBuilder().
+//		WithHost("db.internal", 3306).
+//		WithCredentials("user", "secret").
+//		WithDatabase("app").
+//		WithSSHTunnel("bastion", 22, "ubuntu", "").WithSSHKeyFile("~/.ssh/id_rsa").
+//		WithPool(20, 5, time.Hour).
+//		Database()
+type ConfigBuilder struct {
+	db        DBConfig
+	ssh       *SSHConfig
+	tlsConfig *tls.Config
+	bus       messaging.IMessageBus
+}
+
+// NewConfigBuilder create config builder of local database (localhost:3306)
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{db: DBConfig{Host: "localhost", Port: 3306, Driver: defaultDriver}}
+}
+
+// endregion
+
+// region Config builder methods ---------------------------------------------------------------------------------------
+
+// WithHost set the database server host and port
+func (b *ConfigBuilder) WithHost(host string, port int) *ConfigBuilder {
+	b.db.Host, b.db.Port = host, port
+	return b
+}
+
+// WithCredentials set the database user and password
+func (b *ConfigBuilder) WithCredentials(username, password string) *ConfigBuilder {
+	b.db.Username, b.db.Password = username, password
+	return b
+}
+
+// WithDatabase set the database name
+func (b *ConfigBuilder) WithDatabase(name string) *ConfigBuilder {
+	b.db.DBName = name
+	return b
+}
+
+// WithAppName set the application name
+func (b *ConfigBuilder) WithAppName(name string) *ConfigBuilder {
+	b.db.AppName = name
+	return b
+}
+
+// WithSSHTunnel connect to the database through SSH tunnel (use empty password for key file authentication)
+func (b *ConfigBuilder) WithSSHTunnel(host string, port int, username, password string) *ConfigBuilder {
+	keyFile := ""
+	if b.ssh != nil {
+		keyFile = b.ssh.KeyFile
+	}
+	b.ssh = &SSHConfig{Host: host, Port: port, Username: username, Password: password, KeyFile: keyFile}
+	return b
+}
+
+// WithSSHKeyFile set the private key file of the SSH tunnel authentication
+func (b *ConfigBuilder) WithSSHKeyFile(keyFile string) *ConfigBuilder {
+	if b.ssh == nil {
+		b.ssh = &SSHConfig{Port: 22}
+	}
+	b.ssh.KeyFile = keyFile
+	return b
+}
+
+// WithTLS set the TLS mode: true, false, skip-verify, preferred or name of TLS config registered in the driver
+func (b *ConfigBuilder) WithTLS(mode string) *ConfigBuilder {
+	b.db.TLS, b.tlsConfig = mode, nil
+	return b
+}
+
+// WithTLSConfig use custom TLS configuration (e.g. client certificates), the configuration is registered in the driver
+// by the builder, hence the rendered URI is valid in the current process only
+func (b *ConfigBuilder) WithTLSConfig(config *tls.Config) *ConfigBuilder {
+	b.tlsConfig = config
+	return b
+}
+
+// WithDriver use the SQL driver registered by the name (e.g. instrumented or patched driver wrapping go-sql-driver/mysql)
+// instead of the default mysql driver
+func (b *ConfigBuilder) WithDriver(name string) *ConfigBuilder {
+	b.db.Driver = name
+	return b
+}
+
+// WithPool set the connection pool settings (zero value keeps the driver default)
+//
+// param: maxOpen - Max open connections
+// param: maxIdle - Max idle connections
+// param: maxLifetime - Max time a connection may be reused
+func (b *ConfigBuilder) WithPool(maxOpen, maxIdle int, maxLifetime time.Duration) *ConfigBuilder {
+	b.db.MaxOpenConns, b.db.MaxIdleConns, b.db.ConnMaxLifetime = maxOpen, maxIdle, maxLifetime
+	return b
+}
+
+// WithFoundRows report the matched rows instead of the changed rows as affected rows (CLIENT_FOUND_ROWS), so update of
+// existing entity with identical data affects one row
+func (b *ConfigBuilder) WithFoundRows(enabled bool) *ConfigBuilder {
+	b.db.FoundRows = enabled
+	return b
+}
+
+// WithMessageBus set the message bus for change notifications
+func (b *ConfigBuilder) WithMessageBus(bus messaging.IMessageBus) *ConfigBuilder {
+	b.bus = bus
+	return b
+}
+
+// URI render the canonical connection URI
+//
+// return: Connection URI, error
+func (b *ConfigBuilder) URI() (string, error) {
+	if b.db.Host == "" || b.db.Port <= 0 {
+		return "", fmt.Errorf("database host and port are required")
+	}
+	if b.db.DBName == "" {
+		return "", fmt.Errorf("database name is required")
+	}
+	if b.ssh != nil && (b.ssh.Host == "" || b.ssh.Port <= 0 || b.ssh.Username == "") {
+		return "", fmt.Errorf("ssh tunnel host, port and user are required")
+	}
+	if b.db.MaxOpenConns < 0 || b.db.MaxIdleConns < 0 || b.db.ConnMaxLifetime < 0 {
+		return "", fmt.Errorf("connection pool settings must not be negative")
+	}
+
+	tlsMode := b.db.TLS
+	if b.tlsConfig != nil {
+		tlsMode = fmt.Sprintf("yaaf-%s-%d", b.db.Host, b.db.Port)
+		if err := driver.RegisterTLSConfig(tlsMode, b.tlsConfig); err != nil {
+			return "", err
+		}
+	}
+
+	params := url.Values{}
+	if b.db.AppName != "" {
+		params.Set("application_name", b.db.AppName)
+	}
+	if tlsMode != "" {
+		params.Set("tls", tlsMode)
+	}
+	if b.db.MaxOpenConns > 0 {
+		params.Set("max_open_conns", strconv.Itoa(b.db.MaxOpenConns))
+	}
+	if b.db.MaxIdleConns > 0 {
+		params.Set("max_idle_conns", strconv.Itoa(b.db.MaxIdleConns))
+	}
+	if b.db.ConnMaxLifetime > 0 {
+		params.Set("conn_max_lifetime", b.db.ConnMaxLifetime.String())
+	}
+	if b.db.FoundRows {
+		params.Set("found_rows", "true")
+	}
+	if b.ssh != nil {
+		params.Set("ssh_host", b.ssh.Host)
+		params.Set("ssh_port", strconv.Itoa(b.ssh.Port))
+		params.Set("ssh_user", b.ssh.Username)
+		if b.ssh.Password != "" {
+			params.Set("ssh_pwd", b.ssh.Password)
+		}
+		if b.ssh.KeyFile != "" {
+			params.Set("ssh_key", b.ssh.KeyFile)
+		}
+	}
+
+	if b.db.Driver != "" && b.db.Driver != defaultDriver {
+		params.Set("driver", b.db.Driver)
+	}
+
+	uri := url.URL{
+		Scheme:   "mysql",
+		Host:     net.JoinHostPort(b.db.Host, strconv.Itoa(b.db.Port)),
+		Path:     "/" + b.db.DBName,
+		RawQuery: params.Encode(),
+	}
+	if b.db.Username != "" {
+		uri.User = url.UserPassword(b.db.Username, b.db.Password)
+	}
+	return uri.String(), nil
+}
+
+// Database create the database instance
+//
+// return: IDatabase instance, error
+func (b *ConfigBuilder) Database() (database.IDatabase, error) {
+	uri, err := b.URI()
+	if err != nil {
+		return nil, err
+	}
+	if b.bus != nil {
+		return NewMySqlDatabaseWithMessageBus(uri, b.bus)
+	}
+	return NewMySqlDatabase(uri)
+}
+
+// Store create the datastore instance
+//
+// return: IDatastore instance, error
+func (b *ConfigBuilder) Store() (database.IDatastore, error) {
+	uri, err := b.URI()
+	if err != nil {
+		return nil, err
+	}
+	return NewMySqlStore(uri)
+}
+
+// endregion
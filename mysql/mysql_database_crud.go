@@ -9,7 +9,6 @@ import (
 
 	"github.com/go-yaaf/yaaf-common/database"
 	. "github.com/go-yaaf/yaaf-common/entity"
-	"github.com/go-yaaf/yaaf-common/logger"
 	"github.com/go-yaaf/yaaf-common/messaging"
 )
 
@@ -21,7 +20,16 @@ import (
 // param: entityID - Entity id
 // param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
 // return: Entity, error
-func (dbs *MySqlDatabase) Get(factory EntityFactory, entityID string, keys ...string) (result Entity, err error) {
+func (dbs *MySqlDatabase) Get(factory EntityFactory, entityID string, keys ...string) (Entity, error) {
+	if result, err := dbs.get(factory, entityID, keys...); err != nil {
+		return nil, err
+	} else {
+		return dbs.maskEntity(factory, result)
+	}
+}
+
+// get a single entity by ID (without masking)
+func (dbs *MySqlDatabase) get(factory EntityFactory, entityID string, keys ...string) (result Entity, err error) {
 
 	var (
 		rows *sql.Rows
@@ -42,9 +50,17 @@ func (dbs *MySqlDatabase) Get(factory EntityFactory, entityID string, keys ...st
 		return nil, fmt.Errorf("empty entity id passed to Get operation")
 	}
 
-	SQL := fmt.Sprintf(`SELECT id, data FROM "%s" WHERE id = $1`, tableName(result.TABLE(), keys...))
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("get", result.TABLE(), 0, time.Now(), nil, &err)
 
-	if rows, err = dbs.pgDb.Query(SQL, entityID); err != nil {
+	tblName, err := dbs.resolveTable(result.TABLE(), keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	SQL := fmt.Sprintf(`SELECT id, data FROM "%s" WHERE id = $1`, tblName)
+
+	if rows, err = dbs.query(dbs.pgDb, tblName, tenantOf(keys...), SQL, entityID); err != nil {
 		return nil, err
 	}
 
@@ -60,13 +76,101 @@ func (dbs *MySqlDatabase) Get(factory EntityFactory, entityID string, keys ...st
 		return nil, err
 	}
 
-	if err = Unmarshal([]byte(jsonDoc.Data), &result); err != nil {
+	if result, err = dbs.unmarshal(factory, []byte(jsonDoc.Data)); err != nil {
 		return nil, err
 	}
 
 	return
 }
 
+// GetFields Get only the selected top level fields of a single entity by ID, the fields are projected by the database
+// (JSON_OBJECT) so hot code paths don't fetch and decode the whole document. Missing fields are returned as nil.
+// Entity types with encrypted, enveloped, overflowed or custom serialized documents are decoded in full instead.
+//
+// param: factory - Entity factory
+// param: entityID - Entity id
+// param: fields - List of top level fields to fetch
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Json map of field name to value, error
+func (dbs *MySqlDatabase) GetFields(factory EntityFactory, entityID string, fields []string, keys ...string) (result Json, err error) {
+
+	if entityID == "" {
+		return nil, fmt.Errorf("empty entity id passed to GetFields operation")
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields passed to GetFields operation")
+	}
+	if err = validateFields(fields...); err != nil {
+		return nil, err
+	}
+
+	template := factory().TABLE()
+	if dbs.encryptor(template) != nil || dbs.envelope(template) != nil || dbs.overflowStorage(template) != nil || dbs.serializer(template) != nil {
+		return dbs.getFieldsDecoded(factory, entityID, fields, keys...)
+	}
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("get_fields", template, 0, time.Now(), nil, &err)
+
+	tblName, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make([]string, 0, len(fields))
+	for _, field := range fields {
+		pairs = append(pairs, fmt.Sprintf(`'%s', JSON_EXTRACT(data, '$.%s')`, field, field))
+	}
+	SQL := fmt.Sprintf(`SELECT JSON_OBJECT(%s) FROM "%s" WHERE id = $1`, strings.Join(pairs, ", "), tblName)
+
+	rows, err := dbs.query(dbs.pgDb, tblName, tenantOf(keys...), SQL, entityID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("no row fetched for id: %s", entityID)
+	}
+
+	var data string
+	if err = rows.Scan(&data); err != nil {
+		return nil, err
+	}
+
+	result = make(Json)
+	if err = Unmarshal([]byte(data), &result); err != nil {
+		return nil, err
+	}
+	if rules := dbs.maskingRules(); len(rules) > 0 {
+		maskMap(rules, result)
+	}
+	return result, nil
+}
+
+// getFieldsDecoded get the entity and pick the selected fields from its (masked) document
+func (dbs *MySqlDatabase) getFieldsDecoded(factory EntityFactory, entityID string, fields []string, keys ...string) (Json, error) {
+	entity, err := dbs.Get(factory, entityID, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(Json)
+	if err = Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	result := make(Json, len(fields))
+	for _, field := range fields {
+		result[field] = doc[field]
+	}
+	return result, nil
+}
+
 // Exists Check if entity exists by ID
 //
 // param: factory - Entity factory
@@ -75,9 +179,17 @@ func (dbs *MySqlDatabase) Get(factory EntityFactory, entityID string, keys ...st
 // return: bool, error
 func (dbs *MySqlDatabase) Exists(factory EntityFactory, entityID string, keys ...string) (result bool, err error) {
 
-	SQL := fmt.Sprintf(`SELECT id FROM "%s" WHERE id = $1`, tableName(factory().TABLE(), keys...))
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("exists", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	tblName, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return false, err
+	}
+
+	SQL := fmt.Sprintf(`SELECT id FROM "%s" WHERE id = $1`, tblName)
 
-	if rows, err := dbs.pgDb.Query(SQL, entityID); err != nil {
+	if rows, err := dbs.query(dbs.pgDb, tblName, tenantOf(keys...), SQL, entityID); err != nil {
 		return false, err
 	} else {
 		result = rows.Next()
@@ -86,13 +198,77 @@ func (dbs *MySqlDatabase) Exists(factory EntityFactory, entityID string, keys ..
 	}
 }
 
+// ExistsMany Check which of the entities exist by their IDs in a single query
+//
+// param: factory - Entity factory
+// param: entityIDs - List of entity IDs
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: The existing IDs, the missing IDs (both in the order of the provided IDs, without duplicates), error
+func (dbs *MySqlDatabase) ExistsMany(factory EntityFactory, entityIDs []string, keys ...string) (existing, missing []string, err error) {
+
+	existing, missing = make([]string, 0), make([]string, 0)
+	if len(entityIDs) == 0 {
+		return
+	}
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("exists_many", factory().TABLE(), len(entityIDs), time.Now(), nil, &err)
+
+	tblName, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	SQL := fmt.Sprintf(`SELECT id FROM "%s" WHERE id = ANY($1)`, tblName)
+	rows, err := dbs.query(dbs.pgDb, tblName, tenantOf(keys...), SQL, entityIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	found := make(map[string]bool, len(entityIDs))
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, nil, err
+		}
+		found[id] = true
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool, len(entityIDs))
+	for _, id := range entityIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if found[id] {
+			existing = append(existing, id)
+		} else {
+			missing = append(missing, id)
+		}
+	}
+	return
+}
+
 // List Get list of entities by IDs
 //
 // param: factory - Entity factory
 // param: entityIDs - List of Entity IDs
 // param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
 // return: []Entity, error
-func (dbs *MySqlDatabase) List(factory EntityFactory, entityIDs []string, keys ...string) (list []Entity, err error) {
+func (dbs *MySqlDatabase) List(factory EntityFactory, entityIDs []string, keys ...string) ([]Entity, error) {
+	if list, err := dbs.list(factory, entityIDs, keys...); err != nil {
+		return list, err
+	} else {
+		return dbs.maskEntities(factory, list)
+	}
+}
+
+// list get list of entities by IDs (without masking)
+func (dbs *MySqlDatabase) list(factory EntityFactory, entityIDs []string, keys ...string) (list []Entity, err error) {
 
 	var (
 		rows *sql.Rows
@@ -105,9 +281,15 @@ func (dbs *MySqlDatabase) List(factory EntityFactory, entityIDs []string, keys .
 		return list, nil
 	}
 
-	table := tableName(factory().TABLE(), keys...)
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("list", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	table, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return
+	}
 	SQL := fmt.Sprintf(`SELECT id, data FROM "%s" WHERE id = ANY($1)`, table)
-	if rows, err = dbs.pgDb.Query(SQL, entityIDs); err != nil {
+	if rows, err = dbs.query(dbs.pgDb, table, tenantOf(keys...), SQL, entityIDs); err != nil {
 		return
 	}
 	defer func() { _ = rows.Close() }()
@@ -117,9 +299,11 @@ func (dbs *MySqlDatabase) List(factory EntityFactory, entityIDs []string, keys .
 		if err = rows.Scan(&jsonDoc.Id, &jsonDoc.Data); err != nil {
 			return
 		} else {
-			entity := factory()
-			if err = Unmarshal([]byte(jsonDoc.Data), &entity); err == nil {
+			var entity Entity
+			if entity, err = dbs.unmarshal(factory, []byte(jsonDoc.Data)); err == nil {
 				list = append(list, entity)
+			} else {
+				dbs.log().Warn("list %s: skipping undecodable document %s (see VerifyTable): %s", table, jsonDoc.Id, err.Error())
 			}
 		}
 	}
@@ -136,14 +320,27 @@ func (dbs *MySqlDatabase) Insert(entity Entity) (added Entity, err error) {
 		data   []byte
 	)
 
-	tblName := tableName(entity.TABLE(), entity.KEY())
+	defer dbs.throttle(entity.KEY())()
+	defer dbs.observe("insert", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return nil, err
+	}
+
+	tblName, err := dbs.resolveTable(entity.TABLE(), entity.KEY())
+	if err != nil {
+		return
+	}
 
 	SQL := fmt.Sprintf(sqlInsert, tblName)
-	if data, err = Marshal(entity); err != nil {
+	if err = dbs.initVersion(entity); err != nil {
+		return
+	}
+	if data, err = dbs.marshal(entity, tblName); err != nil {
 		return
 	}
 
-	if result, err = dbs.pgDb.Exec(SQL, entity.ID(), data); err != nil {
+	if result, err = dbs.execAudited(AuditInsert, entity.TABLE(), tblName, entity.KEY(), entity.ID(), entity, SQL, entity.ID(), data); err != nil {
 		return
 	}
 
@@ -159,10 +356,10 @@ func (dbs *MySqlDatabase) Insert(entity Entity) (added Entity, err error) {
 	return
 }
 
-// Update existing entity
+// Update existing entity, updating the entity with identical data is a successful no-op
 //
 // param: entity - The entity to update
-// return: Updated Entity, error
+// return: Updated Entity, error (NoRowsAffectedError if the entity does not exist)
 func (dbs *MySqlDatabase) Update(entity Entity) (updated Entity, err error) {
 
 	var (
@@ -170,21 +367,41 @@ func (dbs *MySqlDatabase) Update(entity Entity) (updated Entity, err error) {
 		data   []byte
 	)
 
-	tblName := tableName(entity.TABLE(), entity.KEY())
-	SQL := fmt.Sprintf(sqlUpdate, tblName)
-	if data, err = Marshal(entity); err != nil {
-		return
+	defer dbs.throttle(entity.KEY())()
+	defer dbs.observe("update", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return nil, err
 	}
 
-	if result, err = dbs.pgDb.Exec(SQL, entity.ID(), data); err != nil {
+	tblName, err := dbs.resolveTable(entity.TABLE(), entity.KEY())
+	if err != nil {
 		return
 	}
+	SQL, versionArgs, restore, err := dbs.versionedStatement(false, entity, tblName)
+	if err != nil {
+		return
+	}
+	if data, err = dbs.marshal(entity, tblName); err == nil {
+		result, err = dbs.execAudited(AuditUpdate, entity.TABLE(), tblName, entity.KEY(), entity.ID(), entity, SQL, append([]any{entity.ID(), data}, versionArgs...)...)
+	}
 
 	var affected int64
-	if affected, err = result.RowsAffected(); err != nil {
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err == nil && affected == 0 && restore != nil {
+		err = dbs.concurrentModification(entity, tblName)
+	}
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
 		return
 	} else if affected == 0 {
-		return nil, fmt.Errorf("no row affected when executing update operation")
+		if err = dbs.notUpdated("update", tblName, entity.KEY(), entity.ID()); err != nil {
+			return nil, err
+		}
 	}
 	updated = entity
 
@@ -203,22 +420,39 @@ func (dbs *MySqlDatabase) Upsert(entity Entity) (updated Entity, err error) {
 		data   []byte
 	)
 
-	tblName := tableName(entity.TABLE(), entity.KEY())
-	SQL := fmt.Sprintf(sqlUpsert, tblName)
-	if data, err = Marshal(entity); err != nil {
-		return
+	defer dbs.throttle(entity.KEY())()
+	defer dbs.observe("upsert", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return nil, err
 	}
 
-	if result, err = dbs.pgDb.Exec(SQL, entity.ID(), data); err != nil {
+	tblName, err := dbs.resolveTable(entity.TABLE(), entity.KEY())
+	if err != nil {
+		return
+	}
+	SQL, versionArgs, restore, err := dbs.versionedStatement(true, entity, tblName)
+	if err != nil {
 		return
 	}
+	if data, err = dbs.marshal(entity, tblName); err == nil {
+		result, err = dbs.execAudited(AuditUpsert, entity.TABLE(), tblName, entity.KEY(), entity.ID(), entity, SQL, append([]any{entity.ID(), data}, versionArgs...)...)
+	}
 
 	var affected int64
-	if affected, err = result.RowsAffected(); err != nil {
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err == nil && affected == 0 && restore != nil {
+		err = dbs.concurrentModification(entity, tblName)
+	}
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
 		return
-	} else if affected == 0 {
-		return nil, fmt.Errorf("no row affected when executing upsert operation")
 	}
+	// zero affected rows: the entity exists with identical data (without found rows)
 	updated = entity
 
 	// Publish the change
@@ -226,6 +460,63 @@ func (dbs *MySqlDatabase) Upsert(entity Entity) (updated Entity, err error) {
 	return
 }
 
+// UpsertReturningOld Update entity or insert it if it does not exist, and return the previously stored entity. The prior
+// document is read with exclusive row lock (SELECT ... FOR UPDATE) in the transaction of the upsert
+//
+// param: entity - The entity to upsert
+// return: The previous entity (nil if inserted), error
+func (dbs *MySqlDatabase) UpsertReturningOld(entity Entity) (previous Entity, err error) {
+	var (
+		result sql.Result
+		data   []byte
+		before []byte
+	)
+
+	defer dbs.throttle(entity.KEY())()
+	defer dbs.observe("upsert", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return nil, err
+	}
+
+	tblName, err := dbs.resolveTable(entity.TABLE(), entity.KEY())
+	if err != nil {
+		return
+	}
+	SQL, versionArgs, restore, err := dbs.versionedStatement(true, entity, tblName)
+	if err != nil {
+		return
+	}
+	if data, err = dbs.marshal(entity, tblName); err == nil {
+		result, before, err = dbs.execMutation(AuditUpsert, entity.TABLE(), tblName, entity.KEY(), entity.ID(), entity, true, SQL, append([]any{entity.ID(), data}, versionArgs...)...)
+	}
+
+	var affected int64
+	if err == nil {
+		affected, err = result.RowsAffected()
+	}
+	if err == nil && affected == 0 && restore != nil {
+		err = dbs.concurrentModification(entity, tblName)
+	}
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
+		return
+	}
+
+	// zero affected rows: the entity exists with identical data (without found rows)
+	if len(before) > 0 {
+		if previous, err = dbs.unmarshal(entityFactory(entity), before); err != nil {
+			return nil, err
+		}
+	}
+
+	// Publish the change
+	dbs.publishChange(UpdateEntity, entity)
+	return
+}
+
 // Delete entity
 //
 // param: factory - Entity factory
@@ -240,21 +531,31 @@ func (dbs *MySqlDatabase) Delete(factory EntityFactory, entityID string, keys ..
 	entity := factory()
 
 	// Get entity
-	deleted, er := dbs.Get(factory, entityID, keys...)
+	deleted, er := dbs.get(factory, entityID, keys...)
 	if er != nil {
 		return er
 	}
 
-	tblName := tableName(entity.TABLE(), keys...)
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("delete", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return err
+	}
+
+	tblName, err := dbs.resolveTable(entity.TABLE(), keys...)
+	if err != nil {
+		return
+	}
 	SQL := fmt.Sprintf(sqlDelete, tblName)
-	if result, err = dbs.pgDb.Exec(SQL, entityID); err != nil {
+	if result, err = dbs.execAudited(AuditDelete, entity.TABLE(), tblName, tenantOf(keys...), entityID, deleted, SQL, entityID); err != nil {
 		return
 	}
 
 	if affected, err = result.RowsAffected(); err != nil {
 		return
 	} else if affected == 0 {
-		return fmt.Errorf("no row affected when executing delete operation")
+		return &NoRowsAffectedError{Operation: "delete", Table: tblName, Id: entityID}
 	}
 
 	// Publish the change
@@ -276,24 +577,32 @@ func (dbs *MySqlDatabase) BulkInsert(entities []Entity) (affected int64, err err
 		return 0, nil
 	}
 
+	defer dbs.observe("bulk_insert", entities[0].TABLE(), len(entities), time.Now(), &affected, &err)
+
+	if err = dbs.admitWrite(entities[0].TABLE(), len(entities)); err != nil {
+		return 0, err
+	}
+
+	if dbs.isShardAwareBulk() {
+		return dbs.bulkInsertSharded(entities)
+	}
+
+	defer dbs.throttle(entities[0].KEY())()
+
 	// Get the table
-	table := tableName(entities[0].TABLE(), entities[0].KEY())
-	valueStrings := make([]string, 0, len(entities))
-	valueArgs := make([]any, 0, len(entities)*2)
-	i := 0
-	for _, entity := range entities {
-		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d)", i*2+1, i*2+2))
-		valueArgs = append(valueArgs, entity.ID())
-		bytes, _ := Marshal(entity)
-		valueArgs = append(valueArgs, string(bytes))
-		i++
+	table, err := dbs.resolveTable(entities[0].TABLE(), entities[0].KEY())
+	if err != nil {
+		return
+	}
+	SQL, valueArgs, err := dbs.buildBulkInsert(table, entities)
+	if err != nil {
+		return
 	}
-	SQL := fmt.Sprintf(`INSERT INTO "%s" (id, data) VALUES %s`, table, strings.Join(valueStrings, ","))
 
 	var (
 		result sql.Result
 	)
-	if result, err = dbs.pgDb.Exec(SQL, valueArgs...); err != nil {
+	if result, err = dbs.exec(dbs.pgDb, table, entities[0].KEY(), SQL, valueArgs...); err != nil {
 		return
 	}
 
@@ -310,6 +619,103 @@ func (dbs *MySqlDatabase) BulkInsert(entities []Entity) (affected int64, err err
 	return
 }
 
+// SetShardAwareBulk enable grouping of bulk insert entities by their resolved shard table, so entities of
+// different shards (e.g. mixed-tenant batches) are inserted to their own tables. When disabled (default),
+// all the entities are inserted to the table of the first entity
+//
+// param: enabled - Enable or disable shard aware bulk operations
+func (dbs *MySqlDatabase) SetShardAwareBulk(enabled bool) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.shardAwareBulk = enabled
+}
+
+// isShardAwareBulk returns true if bulk operations should group entities by shard
+func (dbs *MySqlDatabase) isShardAwareBulk() bool {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.shardAwareBulk
+}
+
+// bulkInsertSharded group the entities by their shard table and execute a single batched insert per shard within one transaction
+func (dbs *MySqlDatabase) bulkInsertSharded(entities []Entity) (affected int64, err error) {
+
+	// Group entities by table, preserving the order of the first appearance
+	tables := make([]string, 0)
+	groups := make(map[string][]Entity)
+	for _, entity := range entities {
+		table, er := dbs.resolveTable(entity.TABLE(), entity.KEY())
+		if er != nil {
+			return 0, er
+		}
+		if _, ok := groups[table]; !ok {
+			tables = append(tables, table)
+		}
+		groups[table] = append(groups[table], entity)
+	}
+
+	var (
+		tx     *sql.Tx
+		result sql.Result
+	)
+
+	// Start transaction
+	if tx, err = dbs.pgDb.Begin(); err != nil {
+		return
+	}
+
+	for _, table := range tables {
+		SQL, args, er := dbs.buildBulkInsert(table, groups[table])
+		if er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		}
+		if result, err = dbs.exec(tx, table, groups[table][0].KEY(), SQL, args...); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+		if count, er := result.RowsAffected(); er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		} else {
+			affected += count
+		}
+	}
+
+	// Commit the transaction
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return affected, fmt.Errorf("no row affected when executing bulk insert operation")
+	}
+
+	// Publish the change
+	for _, entity := range entities {
+		dbs.publishChange(AddEntity, entity)
+	}
+	return
+}
+
+// buildBulkInsert build multi rows insert statement of the entities to the table
+func (dbs *MySqlDatabase) buildBulkInsert(table string, entities []Entity) (SQL string, valueArgs []any, err error) {
+	valueStrings := make([]string, 0, len(entities))
+	valueArgs = make([]any, 0, len(entities)*2)
+	i := 0
+	for _, entity := range entities {
+		valueStrings = append(valueStrings, fmt.Sprintf("($%d, $%d)", i*2+1, i*2+2))
+		valueArgs = append(valueArgs, entity.ID())
+		bytes, er := dbs.marshal(entity, table)
+		if er != nil {
+			return "", nil, er
+		}
+		valueArgs = append(valueArgs, string(bytes))
+		i++
+	}
+	SQL = fmt.Sprintf(`INSERT INTO "%s" (id, data) VALUES %s`, table, strings.Join(valueStrings, ","))
+	return
+}
+
 // BulkUpdate Update multiple entities to database in a single transaction (all must be of the same type)
 //
 // param: entities - List of entities to update
@@ -320,6 +726,13 @@ func (dbs *MySqlDatabase) BulkUpdate(entities []Entity) (affected int64, err err
 		return 0, nil
 	}
 
+	defer dbs.throttle(entities[0].KEY())()
+	defer dbs.observe("bulk_update", entities[0].TABLE(), len(entities), time.Now(), &affected, &err)
+
+	if err = dbs.admitWrite(entities[0].TABLE(), len(entities)); err != nil {
+		return 0, err
+	}
+
 	var (
 		tx *sql.Tx
 	)
@@ -331,10 +744,18 @@ func (dbs *MySqlDatabase) BulkUpdate(entities []Entity) (affected int64, err err
 
 	// Loop over entities and update each entity within the transaction scope
 	for _, entity := range entities {
-		table := tableName(entity.TABLE(), entity.KEY())
+		table, er := dbs.resolveTable(entity.TABLE(), entity.KEY())
+		if er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		}
 		SQL := fmt.Sprintf(sqlUpdate, table)
-		data, _ := Marshal(entity)
-		if _, err = dbs.pgDb.Exec(SQL, entity.ID(), data); err != nil {
+		data, er := dbs.marshal(entity, table)
+		if er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		}
+		if _, err = dbs.exec(tx, table, entity.KEY(), SQL, entity.ID(), data); err != nil {
 			_ = tx.Rollback()
 			return 0, err
 		}
@@ -364,6 +785,13 @@ func (dbs *MySqlDatabase) BulkUpsert(entities []Entity) (affected int64, err err
 		return 0, nil
 	}
 
+	defer dbs.throttle(entities[0].KEY())()
+	defer dbs.observe("bulk_upsert", entities[0].TABLE(), len(entities), time.Now(), &affected, &err)
+
+	if err = dbs.admitWrite(entities[0].TABLE(), len(entities)); err != nil {
+		return 0, err
+	}
+
 	var (
 		tx *sql.Tx
 	)
@@ -375,10 +803,18 @@ func (dbs *MySqlDatabase) BulkUpsert(entities []Entity) (affected int64, err err
 
 	// Loop over entities and update each entity within the transaction scope
 	for _, entity := range entities {
-		table := tableName(entity.TABLE(), entity.KEY())
+		table, er := dbs.resolveTable(entity.TABLE(), entity.KEY())
+		if er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		}
 		SQL := fmt.Sprintf(sqlUpsert, table)
-		data, _ := Marshal(entity)
-		if _, err = dbs.pgDb.Exec(SQL, entity.ID(), data); err != nil {
+		data, er := dbs.marshal(entity, table)
+		if er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		}
+		if _, err = dbs.exec(tx, table, entity.KEY(), SQL, entity.ID(), data); err != nil {
 			_ = tx.Rollback()
 			return 0, err
 		}
@@ -414,17 +850,27 @@ func (dbs *MySqlDatabase) BulkDelete(factory EntityFactory, entityIDs []string,
 		return 0, nil
 	}
 
-	tblName := tableName(entity.TABLE(), keys...)
+	tblName, err := dbs.resolveTable(entity.TABLE(), keys...)
+	if err != nil {
+		return
+	}
 
 	// Get the list of deleted entities (for notification)
-	deleted, e := dbs.List(factory, entityIDs, keys...)
+	deleted, e := dbs.list(factory, entityIDs, keys...)
 	if e != nil {
 		return 0, e
 	}
 
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("bulk_delete", entity.TABLE(), len(entityIDs), time.Now(), &affected, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), len(entityIDs)); err != nil {
+		return 0, err
+	}
+
 	SQL := fmt.Sprintf(sqlBulkDelete, tblName)
 
-	if result, err = dbs.pgDb.Exec(SQL, entityIDs); err != nil {
+	if result, err = dbs.exec(dbs.pgDb, tblName, tenantOf(keys...), SQL, entityIDs); err != nil {
 		return
 	}
 
@@ -456,20 +902,105 @@ func (dbs *MySqlDatabase) BulkDelete(factory EntityFactory, entityIDs []string,
 func (dbs *MySqlDatabase) SetField(factory EntityFactory, entityID string, field string, value any, keys ...string) (err error) {
 
 	entity := factory()
-	tblName := tableName(entity.TABLE(), keys...)
+	defer dbs.observe("set_field", entity.TABLE(), 0, time.Now(), nil, &err)
 
-	SQL := fmt.Sprintf(`UPDATE "%s" SET data = jsonb_set(data, '{%s}', $1, false) WHERE id = $2`, tblName, field)
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return err
+	}
 
-	args := make([]any, 0)
-	args = append(args, value)
-	args = append(args, entityID)
+	if err = validateFields(field); err != nil {
+		return
+	}
 
-	if _, err = dbs.pgDb.Exec(SQL, args...); err != nil {
+	// Encrypted documents can't be updated in place
+	if dbs.envelope(entity.TABLE()) != nil {
+		return dbs.setEncryptedField(factory, entityID, field, value, keys...)
+	}
+
+	tblName, err := dbs.resolveTable(entity.TABLE(), keys...)
+	if err != nil {
+		return
+	}
+
+	release := dbs.throttle(keys...)
+	if dbs.rewritesInMemory(entity.TABLE()) {
+		// Overflowed and validated documents are modified in memory
+		_, err = dbs.rewriteDocument(entity.TABLE(), tblName, tenantOf(keys...), entityID, AuditSetField, func(doc map[string]any) (bool, error) {
+			doc[field] = value
+			return true, nil
+		})
+	} else if value, err = dbs.encryptField(factory, field, value); err == nil {
+		SQL := fmt.Sprintf(`UPDATE "%s" SET data = jsonb_set(data, '{%s}', $1, false) WHERE id = $2`, tblName, field)
+		_, err = dbs.execAudited(AuditSetField, entity.TABLE(), tblName, tenantOf(keys...), entityID, nil, SQL, value, entityID)
+	}
+	release()
+	if err != nil {
 		return
 	}
 
 	// Get the updated entity and publish the change
-	if updated, fer := dbs.Get(factory, entityID, keys...); fer == nil {
+	if updated, fer := dbs.get(factory, entityID, keys...); fer == nil {
+		dbs.publishChange(UpdateEntity, updated)
+	}
+	return
+}
+
+// IncrementField Atomically add delta to numeric field of the document in a single statement (missing field is
+// treated as zero), used for counters without read-modify-write transaction
+//
+// param: factory - Entity factory
+// param: entityID - The entity ID to update the field
+// param: field - The numeric field name
+// param: delta - The value to add (negative to decrement)
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) IncrementField(factory EntityFactory, entityID string, field string, delta int64, keys ...string) (err error) {
+
+	entity := factory()
+	defer dbs.observe("increment_field", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return err
+	}
+
+	if err = validateFields(field); err != nil {
+		return
+	}
+	if dbs.envelope(entity.TABLE()) != nil {
+		return fmt.Errorf("increment field is not supported for encrypted documents")
+	}
+
+	tblName, err := dbs.resolveTable(entity.TABLE(), keys...)
+	if err != nil {
+		return
+	}
+
+	release := dbs.throttle(keys...)
+	if dbs.rewritesInMemory(entity.TABLE()) {
+		// Overflowed and validated documents are modified in memory
+		_, err = dbs.rewriteDocument(entity.TABLE(), tblName, tenantOf(keys...), entityID, AuditSetField, func(doc map[string]any) (bool, error) {
+			return true, incrementValue(doc, field, delta)
+		})
+		release()
+		if err != nil {
+			return
+		}
+	} else {
+		SQL := fmt.Sprintf(sqlIncrementField, tblName, field, field)
+		result, er := dbs.execAudited(AuditSetField, entity.TABLE(), tblName, tenantOf(keys...), entityID, nil, SQL, delta, entityID)
+		release()
+		if er != nil {
+			return er
+		}
+		if affected, er := result.RowsAffected(); er != nil {
+			return er
+		} else if affected == 0 {
+			return fmt.Errorf("no row affected when executing increment field operation")
+		}
+	}
+
+	// Get the updated entity and publish the change
+	if updated, fer := dbs.get(factory, entityID, keys...); fer == nil {
 		dbs.publishChange(UpdateEntity, updated)
 	}
 	return
@@ -484,6 +1015,13 @@ func (dbs *MySqlDatabase) SetField(factory EntityFactory, entityID string, field
 // return: error
 func (dbs *MySqlDatabase) SetFields(factory EntityFactory, entityID string, fields map[string]any, keys ...string) (err error) {
 
+	// Validate all the fields before updating any of them
+	for f := range fields {
+		if err = validateFields(f); err != nil {
+			return
+		}
+	}
+
 	for f, v := range fields {
 		if er := dbs.SetField(factory, entityID, f, v, keys...); er != nil {
 			return er
@@ -505,13 +1043,41 @@ func (dbs *MySqlDatabase) BulkSetFields(factory EntityFactory, field string, val
 		return 0, nil
 	}
 
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("bulk_set_fields", factory().TABLE(), len(values), time.Now(), &affected, &error)
+
+	if error = dbs.admitWrite(factory().TABLE(), len(values)); error != nil {
+		return 0, error
+	}
+
+	if err := validateFields(field); err != nil {
+		return 0, err
+	}
+	if dbs.envelope(factory().TABLE()) != nil {
+		return 0, fmt.Errorf("bulk set fields is not supported for encrypted documents")
+	}
+	if dbs.overflowStorage(factory().TABLE()) != nil {
+		return 0, fmt.Errorf("bulk set fields is not supported for overflowed documents")
+	}
+
+	// Encrypt the values of encrypted field
+	encrypted := make(map[string]any, len(values))
+	for id, val := range values {
+		enc, err := dbs.encryptField(factory, field, val)
+		if err != nil {
+			return 0, err
+		}
+		encrypted[id] = enc
+	}
+	values = encrypted
+
 	// Determine the type of the field
 	sqlType := dbs.getSqlType(values)
 
 	// Create temp table to map entity to field id
 	tmpTable := fmt.Sprintf("ch%d", time.Now().UnixMilli())
 	createTmp := fmt.Sprintf("create TEMP table %s (id character varying PRIMARY KEY NOT NULL, val %s)", tmpTable, sqlType)
-	if _, err := dbs.pgDb.Exec(createTmp); err != nil {
+	if _, err := dbs.exec(dbs.pgDb, tmpTable, tenantOf(keys...), createTmp); err != nil {
 		return 0, err
 	}
 
@@ -526,24 +1092,27 @@ func (dbs *MySqlDatabase) BulkSetFields(factory EntityFactory, field string, val
 		i++
 	}
 	SQL := fmt.Sprintf(`INSERT INTO "%s" (id, val) VALUES %s`, tmpTable, strings.Join(valueStrings, ","))
-	if _, err := dbs.pgDb.Exec(SQL, valueArgs...); err != nil {
+	if _, err := dbs.exec(dbs.pgDb, tmpTable, tenantOf(keys...), SQL, valueArgs...); err != nil {
 		return 0, err
 	}
 
 	// Create bulk update statement
 	entity := factory()
-	tblName := tableName(entity.TABLE(), keys...)
+	tblName, err := dbs.resolveTable(entity.TABLE(), keys...)
+	if err != nil {
+		return
+	}
 
 	SQL = fmt.Sprintf("UPDATE %s SET data['%s'] = to_jsonb(%s.val) FROM %s WHERE %s.id = %s.id", tblName, field, tmpTable, tmpTable, tmpTable, tblName)
 
 	// Drop the temp table
 	defer func() {
 		DROP := fmt.Sprintf("DROP TABLE %s", tmpTable)
-		_, _ = dbs.pgDb.Exec(DROP)
+		_, _ = dbs.exec(dbs.pgDb, tmpTable, tenantOf(keys...), DROP)
 	}()
 
 	// Execute update
-	if result, err := dbs.pgDb.Exec(SQL); err != nil {
+	if result, err := dbs.exec(dbs.pgDb, tblName, tenantOf(keys...), SQL); err != nil {
 		return 0, err
 	} else {
 		return result.RowsAffected()
@@ -598,15 +1167,27 @@ func (dbs *MySqlDatabase) Query(factory EntityFactory) database.IQuery {
 func (dbs *MySqlDatabase) ExecuteDDL(ddl map[string][]string) (err error) {
 	for table, fields := range ddl {
 
+		if err = validateFields(fields...); err != nil {
+			return
+		}
+
 		SQL := fmt.Sprintf(ddlCreateTable, table)
-		if _, err = dbs.pgDb.Exec(SQL); err != nil {
-			logger.Error("%s error: %s", SQL, err.Error())
+		if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+			dbs.log().Error("%s error: %s", SQL, err.Error())
 			return
 		}
 		for _, field := range fields {
+			// Delegate the index creation to the schema change executor (e.g. online schema change tool for large tables)
+			if dbs.schemaChangeExecutor() != nil {
+				if err = dbs.AlterTable(table, fmt.Sprintf(ddlAddJsonIndex, baseName(table), field, field)); err != nil {
+					return
+				}
+				continue
+			}
+
 			SQL = fmt.Sprintf(ddlCreateIndex, table, field, table, field)
-			if _, err = dbs.pgDb.Exec(SQL); err != nil {
-				logger.Error("%s error: %s", SQL, err.Error())
+			if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+				dbs.log().Error("%s error: %s", SQL, err.Error())
 				return
 			}
 		}
@@ -617,11 +1198,19 @@ func (dbs *MySqlDatabase) ExecuteDDL(ddl map[string][]string) (err error) {
 // ExecuteSQL Execute SQL command
 //
 // param: sql - The SQL command to execute
-// param: args - Statement arguments
+// param: args - Statement arguments (or single map of :name parameters, see BindNamed)
 // return: Number of affected records, error
 func (dbs *MySqlDatabase) ExecuteSQL(sql string, args ...any) (int64, error) {
-	if result, err := dbs.pgDb.Exec(sql, args...); err != nil {
-		logger.Error("%s error: %s", sql, err.Error())
+	sql, args, err := namedArgs(sql, args)
+	if err != nil {
+		return 0, err
+	}
+	if sql, err = dbs.guardStatement(sql, false); err != nil {
+		return 0, err
+	}
+
+	if result, err := dbs.exec(dbs.pgDb, "", "", sql, args...); err != nil {
+		dbs.log().Error("%s error: %s", sql, err.Error())
 		return 0, err
 	} else {
 		if a, er := result.RowsAffected(); er != nil {
@@ -632,13 +1221,113 @@ func (dbs *MySqlDatabase) ExecuteSQL(sql string, args ...any) (int64, error) {
 	}
 }
 
-// ExecuteQuery Execute native SQL query
-func (dbs *MySqlDatabase) ExecuteQuery(source, sql string, args ...any) ([]Json, error) {
+// ExecuteQuery Execute native SQL query, the args may be a single map of :name parameters (see BindNamed)
+// The source labels the query in the statement log and the metrics (the table of the operation metric), and routes
+// it when read replicas are configured: SourcePrimary reads from the primary, SourceReplica reads from a replica even
+// within the read-your-writes window, and any other source (including empty) follows the replica routing policy
+//
+// param: source - The query source (label or routing source)
+// param: sql - The SQL query
+// param: args - The query arguments
+// return: List of rows (column name -> value), error
+func (dbs *MySqlDatabase) ExecuteQuery(source, sql string, args ...any) (result []Json, err error) {
 
-	rows, err := dbs.pgDb.Query(sql, args...)
+	var count int64
+	defer dbs.observe("execute_query", source, 0, time.Now(), &count, &err)
+
+	sql, args, err = namedArgs(sql, args)
 	if err != nil {
 		return nil, err
 	}
+	if sql, err = dbs.guardStatement(sql, true); err != nil {
+		return nil, err
+	}
+
+	rows, err := dbs.querySource(source, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	if result, err = scanJsonRows(rows); err != nil {
+		return nil, err
+	}
+	count = int64(len(result))
+	return dbs.maskRows(result), nil
+}
+
+// ExecuteQueryPaged Execute native SQL query page by page and call the function with every page, for large raw
+// extractions. Without key column the pages are fetched by LIMIT / OFFSET appended to the query (which should be
+// ordered and must not have its own LIMIT), with key column the query is wrapped and paged by keyset conditions on the
+// column (which must be unique and returned by the query), this is stable and efficient for deep pages.
+// The statement guard (see SetStatementGuard) is applied to the paged statement of every page, so page size larger than
+// the max limit of the guard is rejected. Returning error from the function stops the paging
+//
+// param: source - The query source
+// param: sql - The SQL query, the args may be a single map of :name parameters (see BindNamed)
+// param: keyColumn - The unique column of the keyset paging (empty for LIMIT / OFFSET paging)
+// param: pageSize - Number of rows per page
+// param: fn - The page function
+// param: args - The query arguments
+// return: error
+func (dbs *MySqlDatabase) ExecuteQueryPaged(source, sql, keyColumn string, pageSize int, fn func(page []Json) error, args ...any) error {
+	if pageSize <= 0 {
+		return fmt.Errorf("invalid page size: %d", pageSize)
+	}
+	if keyColumn != "" {
+		if err := validateFields(keyColumn); err != nil {
+			return err
+		}
+	}
+
+	sql, args, err := namedArgs(sql, args)
+	if err != nil {
+		return err
+	}
+	sql = strings.TrimRight(strings.TrimSpace(sql), ";")
+
+	var lastKey any
+	for page := 0; ; page++ {
+		SQL, params := fmt.Sprintf("%s LIMIT %d OFFSET %d", sql, pageSize, page*pageSize), args
+		if keyColumn != "" {
+			SQL = fmt.Sprintf(`SELECT * FROM (%s) AS paged ORDER BY "%s" LIMIT %d`, sql, keyColumn, pageSize)
+			if page > 0 {
+				SQL = fmt.Sprintf(`SELECT * FROM (%s) AS paged WHERE "%s" > $%d ORDER BY "%s" LIMIT %d`, sql, keyColumn, len(args)+1, keyColumn, pageSize)
+				params = append(append([]any{}, args...), lastKey)
+			}
+		}
+
+		// The statement guard inspects the paged statement, so the page size is subject to the max limit
+		SQL, er := dbs.guardStatement(SQL, true)
+		if er != nil {
+			return er
+		}
+		rows, er := dbs.querySource(source, SQL, params...)
+		if er != nil {
+			return er
+		}
+		result, er := scanJsonRows(rows)
+		if er != nil {
+			return er
+		}
+		if len(result) == 0 {
+			return nil
+		}
+
+		if keyColumn != "" {
+			var ok bool
+			if lastKey, ok = result[len(result)-1][keyColumn]; !ok {
+				return fmt.Errorf("key column %s is not returned by the query", keyColumn)
+			}
+		}
+		if er = fn(dbs.maskRows(result)); er != nil || len(result) < pageSize {
+			return er
+		}
+	}
+}
+
+// scanJsonRows scan all the rows into a list of Json documents (column name -> value) and close the rows
+func scanJsonRows(rows *sql.Rows) ([]Json, error) {
+
+	defer func() { _ = rows.Close() }()
 
 	// Get column names
 	columns, err := rows.Columns()
@@ -696,8 +1385,8 @@ func (dbs *MySqlDatabase) ExecuteQuery(source, sql string, args ...any) ([]Json,
 // return: error
 func (dbs *MySqlDatabase) DropTable(table string) (err error) {
 	SQL := fmt.Sprintf(ddlDropTable, table)
-	if _, err = dbs.pgDb.Exec(SQL); err != nil {
-		logger.Error("%s error: %s", SQL, err.Error())
+	if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
 	}
 	return
 }
@@ -708,8 +1397,8 @@ func (dbs *MySqlDatabase) DropTable(table string) (err error) {
 // return: error
 func (dbs *MySqlDatabase) PurgeTable(table string) (err error) {
 	SQL := fmt.Sprintf(ddlPurgeTable, table)
-	if _, err = dbs.pgDb.Exec(SQL); err != nil {
-		logger.Error("%s error: %s", SQL, err.Error())
+	if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
 	}
 	return
 }
@@ -734,25 +1423,37 @@ func (dbs *MySqlDatabase) publishChange(action EntityAction, entity Entity) {
 		return
 	}
 
+	if err := dbs.bus.Publish(entityMessage(action, entity)); err != nil {
+		dbs.log().Warn("error publishing change: %s", err.Error())
+	}
+}
+
+// entityFactory returns factory of entities of the same type of the entity
+func entityFactory(entity Entity) EntityFactory {
+	kind := reflect.TypeOf(entity)
+	if kind.Kind() != reflect.Pointer {
+		return func() Entity { return reflect.New(kind).Elem().Interface().(Entity) }
+	}
+	return func() Entity { return reflect.New(kind.Elem()).Interface().(Entity) }
+}
+
+// entityMessage build the entity change message
+func entityMessage(action EntityAction, entity Entity) *messaging.EntityMessage {
+
 	// Set topic in the format of: ENTITY-{Table}-{Key}
 	topic := fmt.Sprintf("%s-%s-%s", messaging.EntityMessageTopic, entity.TABLE(), entity.KEY())
 	addressee := reflect.TypeOf(entity).String()
 	idx := strings.LastIndex(addressee, ".")
 	addressee = addressee[idx+1:]
 
-	if dbs.bus != nil {
-		msg := messaging.EntityMessage{
-			BaseMessage: messaging.BaseMessage{
-				MsgTopic:     topic,
-				MsgOpCode:    int(action),
-				MsgAddressee: addressee,
-				MsgSessionId: entity.ID(),
-			},
-			MsgPayload: entity,
-		}
-		if err := dbs.bus.Publish(&msg); err != nil {
-			logger.Warn("error publishing change: %s", err.Error())
-		}
+	return &messaging.EntityMessage{
+		BaseMessage: messaging.BaseMessage{
+			MsgTopic:     topic,
+			MsgOpCode:    int(action),
+			MsgAddressee: addressee,
+			MsgSessionId: entity.ID(),
+		},
+		MsgPayload: entity,
 	}
 }
 
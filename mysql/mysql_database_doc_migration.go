@@ -0,0 +1,290 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Document migration definitions -------------------------------------------------------------------------------
+
+// DocumentTransform transforms the stored Json document in place, returns true if the document was changed
+type DocumentTransform func(doc map[string]any) (changed bool, err error)
+
+// MigrationOptions configures the document migration run
+type MigrationOptions struct {
+	Keys         []string                                   // Sharding key(s) of the table
+	BatchSize    int                                        // Number of documents in each batch (default: 500)
+	Checkpoint   *MigrationCheckpoint                       // Resume from checkpoint of previous run (optional)
+	OnCheckpoint func(checkpoint MigrationCheckpoint) error // Called after every batch to persist the checkpoint (optional)
+}
+
+// MigrationCheckpoint is the progress of the document migration
+type MigrationCheckpoint struct {
+	Table     string `json:"table"`     // The physical table
+	Migration string `json:"migration"` // The migration name
+	LastId    string `json:"lastId"`    // The last processed document id
+	Scanned   int64  `json:"scanned"`   // Number of scanned documents
+	Migrated  int64  `json:"migrated"`  // Number of changed documents
+	Done      bool   `json:"done"`      // The whole table was processed
+}
+
+// endregion
+
+// region Document migration transforms --------------------------------------------------------------------------------
+
+// RenameField returns transform renaming the field (existing target field is overwritten)
+func RenameField(from, to string) DocumentTransform {
+	return func(doc map[string]any) (bool, error) {
+		value, ok := doc[from]
+		if !ok {
+			return false, nil
+		}
+		delete(doc, from)
+		doc[to] = value
+		return true, nil
+	}
+}
+
+// SetDefault returns transform setting the field value if the field is missing (or null)
+func SetDefault(field string, value any) DocumentTransform {
+	return func(doc map[string]any) (bool, error) {
+		if current, ok := doc[field]; ok && current != nil {
+			return false, nil
+		}
+		doc[field] = value
+		return true, nil
+	}
+}
+
+// RemoveField returns transform removing the field
+func RemoveField(field string) DocumentTransform {
+	return func(doc map[string]any) (bool, error) {
+		if _, ok := doc[field]; !ok {
+			return false, nil
+		}
+		delete(doc, field)
+		return true, nil
+	}
+}
+
+// ConvertField returns transform converting the field value (missing fields are skipped)
+func ConvertField(field string, convert func(value any) (any, error)) DocumentTransform {
+	return func(doc map[string]any) (bool, error) {
+		value, ok := doc[field]
+		if !ok {
+			return false, nil
+		}
+		converted, err := convert(value)
+		if err != nil {
+			return false, fmt.Errorf("convert field %s: %w", field, err)
+		}
+		doc[field] = converted
+		return fmt.Sprintf("%#v", converted) != fmt.Sprintf("%#v", value), nil
+	}
+}
+
+// ToString returns transform changing the field type to string
+func ToString(field string) DocumentTransform {
+	return ConvertField(field, func(value any) (any, error) {
+		switch v := value.(type) {
+		case nil, string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		}
+		return fmt.Sprintf("%v", value), nil
+	})
+}
+
+// ToNumber returns transform changing the field type to number (the field must be numeric string)
+func ToNumber(field string) DocumentTransform {
+	return ConvertField(field, func(value any) (any, error) {
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, err
+		}
+		return json.Number(s), nil
+	})
+}
+
+// endregion
+
+// region Document migration methods -----------------------------------------------------------------------------------
+
+// RegisterDocumentMigration register named document migration of the entity (ordered list of transforms)
+//
+// param: factory - Entity factory
+// param: name - The migration name
+// param: transforms - The document transforms
+func (dbs *MySqlDatabase) RegisterDocumentMigration(factory EntityFactory, name string, transforms ...DocumentTransform) {
+	template := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.docMigrations == nil {
+		dbs.docMigrations = make(map[string]map[string][]DocumentTransform)
+	}
+	if dbs.docMigrations[template] == nil {
+		dbs.docMigrations[template] = make(map[string][]DocumentTransform)
+	}
+	dbs.docMigrations[template][name] = transforms
+}
+
+// RunDocumentMigration stream through the entity table (by id order) and apply the transforms of the migration, every
+// batch of changed documents is updated in a single transaction and then the checkpoint is reported, so an interrupted
+// migration can be resumed from the last checkpoint. The transforms should be idempotent
+//
+// param: factory - Entity factory
+// param: name - The migration name
+// param: opts - Migration options
+// return: Final checkpoint, error
+func (dbs *MySqlDatabase) RunDocumentMigration(factory EntityFactory, name string, opts MigrationOptions) (cp MigrationCheckpoint, err error) {
+	template := factory().TABLE()
+	defer dbs.observe("document_migration", template, 0, time.Now(), nil, &err)
+
+	dbs.mu.RLock()
+	transforms, ok := dbs.docMigrations[template][name]
+	dbs.mu.RUnlock()
+	if !ok {
+		return cp, fmt.Errorf("document migration %s of %s is not registered", name, template)
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	table, err := dbs.resolveTable(template, opts.Keys...)
+	if err != nil {
+		return
+	}
+	tenant := tenantOf(opts.Keys...)
+
+	cp = MigrationCheckpoint{Table: table, Migration: name}
+	if opts.Checkpoint != nil {
+		if opts.Checkpoint.Table != table || opts.Checkpoint.Migration != name {
+			return cp, fmt.Errorf("checkpoint of %s/%s does not match %s/%s", opts.Checkpoint.Table, opts.Checkpoint.Migration, table, name)
+		}
+		cp = *opts.Checkpoint
+	}
+
+	for !cp.Done {
+		docs, er := dbs.verifyBatch(table, tenant, cp.LastId, opts.BatchSize)
+		if er != nil {
+			return cp, er
+		}
+		migrated, er := dbs.migrateBatch(template, table, tenant, docs, transforms)
+		if er != nil {
+			return cp, er
+		}
+
+		cp.Scanned += int64(len(docs))
+		cp.Migrated += migrated
+		cp.Done = len(docs) < opts.BatchSize
+		if len(docs) > 0 {
+			cp.LastId = docs[len(docs)-1].Id
+		}
+		if opts.OnCheckpoint != nil {
+			if er = opts.OnCheckpoint(cp); er != nil {
+				return cp, er
+			}
+		}
+	}
+	return cp, nil
+}
+
+// migrateBatch apply the transforms to the batch documents and update the changed documents in a single transaction.
+// The changed documents are read again with exclusive row lock (SELECT ... FOR UPDATE) in the transaction and the
+// transforms are applied to the locked document, so concurrent writes after the batch scan are not overwritten
+func (dbs *MySqlDatabase) migrateBatch(template, table, tenant string, docs []JsonDoc, transforms []DocumentTransform) (migrated int64, err error) {
+	candidates := make([]string, 0)
+	for _, doc := range docs {
+		data, er := dbs.migrateDocument(template, table, []byte(doc.Data), transforms)
+		if er != nil {
+			return 0, fmt.Errorf("document %s: %w", doc.Id, er)
+		}
+		if data != nil {
+			candidates = append(candidates, doc.Id)
+		}
+	}
+	if len(candidates) == 0 {
+		return 0, nil
+	}
+
+	var tx *sql.Tx
+	if tx, err = dbs.pgDb.Begin(); err != nil {
+		return 0, err
+	}
+	for _, id := range candidates {
+		if err = dbs.migrateLocked(tx, template, table, tenant, id, transforms, &migrated); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return migrated, nil
+}
+
+// migrateLocked read the document with exclusive row lock in the transaction, apply the transforms and update it if
+// changed (deleted documents are skipped)
+func (dbs *MySqlDatabase) migrateLocked(tx *sql.Tx, template, table, tenant, id string, transforms []DocumentTransform, migrated *int64) error {
+	stored, err := dbs.readDocument(tx, table, tenant, id, true)
+	if err != nil || stored == nil {
+		return err
+	}
+	data, err := dbs.migrateDocument(template, table, stored, transforms)
+	if err != nil {
+		return fmt.Errorf("document %s: %w", id, err)
+	}
+	if data == nil {
+		return nil
+	}
+	if _, err = dbs.exec(tx, table, tenant, fmt.Sprintf(sqlUpdate, table), id, data); err != nil {
+		return err
+	}
+	*migrated++
+	return nil
+}
+
+// migrateDocument apply the transforms to the stored document, returns the encoded document (nil if not changed)
+func (dbs *MySqlDatabase) migrateDocument(template, table string, data []byte, transforms []DocumentTransform) ([]byte, error) {
+	plain, err := dbs.decode(template, data)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(plain))
+	decoder.UseNumber()
+	if err = decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for _, transform := range transforms {
+		c, er := transform(doc)
+		if er != nil {
+			return nil, er
+		}
+		changed = changed || c
+	}
+	if !changed {
+		return nil, nil
+	}
+
+	if plain, err = json.Marshal(doc); err != nil {
+		return nil, err
+	}
+	return dbs.encode(template, table, plain)
+}
+
+// endregion
@@ -0,0 +1,27 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// defaultDriver is the name of the go-sql-driver/mysql driver
+const defaultDriver = "mysql"
+
+// region SQL driver methods -------------------------------------------------------------------------------------------
+
+// driverName returns the SQL driver of the connection: the driver URI parameter (e.g. mysql://...?driver=otel-mysql)
+// or the default mysql driver, custom drivers must be registered (sql.Register) before the database is opened
+func driverName(name string) (string, error) {
+	if name == "" || name == defaultDriver {
+		return defaultDriver, nil
+	}
+	for _, registered := range sql.Drivers() {
+		if registered == name {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("SQL driver %s is not registered", name)
+}
+
+// endregion
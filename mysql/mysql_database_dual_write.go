@@ -0,0 +1,602 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Dual write definitions ---------------------------------------------------------------------------------------
+
+// DualWriteOptions configures the dual write database
+type DualWriteOptions struct {
+	QueueSize     int                            // Size of the replication queue (default: 10000)
+	Retries       int                            // Number of retries of failed replication (default: 3)
+	RetryInterval time.Duration                  // Interval between retries (default: 1 second)
+	MirrorSQL     bool                           // Mirror ExecuteSQL commands (the SQL must be valid in both datastores)
+	OnFailure     func(failure DualWriteFailure) // Called when mutation could not be replicated (optional)
+	Logger        ILogger                        // Logger (default: yaaf-common logger)
+}
+
+// DualWriteFailure is a mutation which was applied to the primary database and not replicated to the secondary database
+type DualWriteFailure struct {
+	Operation string    // The operation (e.g. insert, update, delete)
+	Table     string    // The entity table (template)
+	EntityIds []string  // The entity ids
+	Error     string    // The last replication error
+	Time      time.Time // The failure time
+}
+
+// DualWriteStatus is the replication status of the dual write database
+type DualWriteStatus struct {
+	Queued     int64              // Number of mutations queued for replication
+	Replicated int64              // Number of mutations replicated to the secondary database
+	Failed     int64              // Number of mutations failed to replicate (after retries)
+	Dropped    int64              // Number of mutations dropped since the replication queue was full
+	Pending    int                // Number of mutations waiting in the queue
+	Failures   []DualWriteFailure // The recent failures (up to 100)
+}
+
+// ConsistencyReport is the result of comparing the entities of the primary and the secondary databases
+type ConsistencyReport struct {
+	Table      string   // The entity table (template)
+	Checked    int      // Number of compared entities
+	Missing    []string // Ids of entities which exist in the primary database only
+	Extra      []string // Ids of entities which exist in the secondary database only
+	Mismatched []string // Ids of entities with different documents
+}
+
+// Consistent returns true if no difference was found
+func (r *ConsistencyReport) Consistent() bool {
+	return len(r.Missing) == 0 && len(r.Extra) == 0 && len(r.Mismatched) == 0
+}
+
+// DualWriteDatabase is IDatabase which serves all the reads from the primary database and mirrors all the mutations to
+// the secondary database (e.g. the target datastore of a live migration). Mutations are applied to the primary database
+// synchronously and replicated to the secondary database asynchronously (in order), so secondary failures never fail or
+// slow down the caller: they are retried, then reported in the status and to the OnFailure callback.
+// Query based deletes (IQuery.Delete) and raw SQL (unless MirrorSQL is set) are not mirrored.
+type DualWriteDatabase struct {
+	primary   database.IDatabase
+	secondary database.IDatabase
+	options   DualWriteOptions
+	queue     chan dualWriteOp
+	done      chan struct{}
+	queueMu   sync.RWMutex // Protect the queue from sending after close
+	closed    bool
+	inflight  sync.WaitGroup
+
+	queued     atomic.Int64
+	replicated atomic.Int64
+	failed     atomic.Int64
+	dropped    atomic.Int64
+
+	mu       sync.Mutex
+	failures []DualWriteFailure
+}
+
+// dualWriteOp is a single mutation to replicate
+type dualWriteOp struct {
+	operation string
+	table     string
+	ids       []string
+	apply     func(db database.IDatabase) error
+}
+
+// maxDualWriteFailures is the number of recent failures kept in the status
+const maxDualWriteFailures = 100
+
+// endregion
+
+// region Dual write factory and connectivity methods ------------------------------------------------------------------
+
+// NewDualWriteDatabase create database which mirrors the mutations of the primary database to the secondary database
+//
+// param: primary - The primary database (source of truth, serves all the reads)
+// param: secondary - The secondary database (e.g. the Postgres adapter or another MySQL cluster)
+// param: options - Dual write options
+// return: Dual write database
+func NewDualWriteDatabase(primary, secondary database.IDatabase, options DualWriteOptions) *DualWriteDatabase {
+	if options.QueueSize <= 0 {
+		options.QueueSize = 10000
+	}
+	if options.Retries <= 0 {
+		options.Retries = 3
+	}
+	if options.RetryInterval <= 0 {
+		options.RetryInterval = time.Second
+	}
+	if options.Logger == nil {
+		options.Logger = defaultLogger{}
+	}
+
+	d := &DualWriteDatabase{
+		primary:   primary,
+		secondary: secondary,
+		options:   options,
+		queue:     make(chan dualWriteOp, options.QueueSize),
+		done:      make(chan struct{}),
+		failures:  make([]DualWriteFailure, 0),
+	}
+	go d.replicate()
+	return d
+}
+
+// Ping Test the connectivity of both databases
+func (d *DualWriteDatabase) Ping(retries uint, intervalInSeconds uint) error {
+	if err := d.primary.Ping(retries, intervalInSeconds); err != nil {
+		return err
+	}
+	return d.secondary.Ping(retries, intervalInSeconds)
+}
+
+// Close drain the replication queue and close both databases
+func (d *DualWriteDatabase) Close() error {
+	d.queueMu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.queueMu.Unlock()
+	<-d.done
+
+	err := d.primary.Close()
+	if er := d.secondary.Close(); err == nil {
+		err = er
+	}
+	return err
+}
+
+// CloneDatabase Returns dual write database of the clones of both databases
+func (d *DualWriteDatabase) CloneDatabase() (database.IDatabase, error) {
+	primary, err := d.primary.CloneDatabase()
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := d.secondary.CloneDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return NewDualWriteDatabase(primary, secondary, d.options), nil
+}
+
+// Primary returns the primary database
+func (d *DualWriteDatabase) Primary() database.IDatabase {
+	return d.primary
+}
+
+// Secondary returns the secondary database
+func (d *DualWriteDatabase) Secondary() database.IDatabase {
+	return d.secondary
+}
+
+// endregion
+
+// region Dual write read methods --------------------------------------------------------------------------------------
+
+// Get a single entity by ID (from the primary database)
+func (d *DualWriteDatabase) Get(factory EntityFactory, entityID string, keys ...string) (Entity, error) {
+	return d.primary.Get(factory, entityID, keys...)
+}
+
+// List Get multiple entities by IDs (from the primary database)
+func (d *DualWriteDatabase) List(factory EntityFactory, entityIDs []string, keys ...string) ([]Entity, error) {
+	return d.primary.List(factory, entityIDs, keys...)
+}
+
+// Exists Check if entity exists by ID (in the primary database)
+func (d *DualWriteDatabase) Exists(factory EntityFactory, entityID string, keys ...string) (bool, error) {
+	return d.primary.Exists(factory, entityID, keys...)
+}
+
+// Query Utility struct method to build a query (of the primary database)
+func (d *DualWriteDatabase) Query(factory EntityFactory) database.IQuery {
+	return d.primary.Query(factory)
+}
+
+// ExecuteQuery Execute native SQL query (on the primary database)
+func (d *DualWriteDatabase) ExecuteQuery(source, sql string, args ...any) ([]Json, error) {
+	return d.primary.ExecuteQuery(source, sql, args...)
+}
+
+// endregion
+
+// region Dual write mutation methods ----------------------------------------------------------------------------------
+
+// Insert new entity
+func (d *DualWriteDatabase) Insert(entity Entity) (Entity, error) {
+	added, err := d.primary.Insert(entity)
+	if err == nil {
+		d.mirrorEntity("insert", added, func(db database.IDatabase, e Entity) error { _, er := db.Insert(e); return er })
+	}
+	return added, err
+}
+
+// Update existing entity
+func (d *DualWriteDatabase) Update(entity Entity) (Entity, error) {
+	updated, err := d.primary.Update(entity)
+	if err == nil {
+		d.mirrorEntity("update", updated, func(db database.IDatabase, e Entity) error { _, er := db.Update(e); return er })
+	}
+	return updated, err
+}
+
+// Upsert Update entity or create it if it does not exist
+func (d *DualWriteDatabase) Upsert(entity Entity) (Entity, error) {
+	updated, err := d.primary.Upsert(entity)
+	if err == nil {
+		d.mirrorEntity("upsert", updated, func(db database.IDatabase, e Entity) error { _, er := db.Upsert(e); return er })
+	}
+	return updated, err
+}
+
+// Delete entity by id and shard (key)
+func (d *DualWriteDatabase) Delete(factory EntityFactory, entityID string, keys ...string) error {
+	err := d.primary.Delete(factory, entityID, keys...)
+	if err == nil {
+		d.enqueue("delete", factory().TABLE(), []string{entityID}, func(db database.IDatabase) error {
+			return db.Delete(factory, entityID, keys...)
+		})
+	}
+	return err
+}
+
+// BulkInsert Insert multiple entities
+func (d *DualWriteDatabase) BulkInsert(entities []Entity) (int64, error) {
+	affected, err := d.primary.BulkInsert(entities)
+	if err == nil {
+		d.mirrorEntities("bulk_insert", entities, func(db database.IDatabase, list []Entity) error { _, er := db.BulkInsert(list); return er })
+	}
+	return affected, err
+}
+
+// BulkUpdate Update multiple entities
+func (d *DualWriteDatabase) BulkUpdate(entities []Entity) (int64, error) {
+	affected, err := d.primary.BulkUpdate(entities)
+	if err == nil {
+		d.mirrorEntities("bulk_update", entities, func(db database.IDatabase, list []Entity) error { _, er := db.BulkUpdate(list); return er })
+	}
+	return affected, err
+}
+
+// BulkUpsert Update or insert multiple entities
+func (d *DualWriteDatabase) BulkUpsert(entities []Entity) (int64, error) {
+	affected, err := d.primary.BulkUpsert(entities)
+	if err == nil {
+		d.mirrorEntities("bulk_upsert", entities, func(db database.IDatabase, list []Entity) error { _, er := db.BulkUpsert(list); return er })
+	}
+	return affected, err
+}
+
+// BulkDelete Delete multiple entities by IDs
+func (d *DualWriteDatabase) BulkDelete(factory EntityFactory, entityIDs []string, keys ...string) (int64, error) {
+	affected, err := d.primary.BulkDelete(factory, entityIDs, keys...)
+	if err == nil {
+		ids := append([]string{}, entityIDs...)
+		d.enqueue("bulk_delete", factory().TABLE(), ids, func(db database.IDatabase) error {
+			_, er := db.BulkDelete(factory, ids, keys...)
+			return er
+		})
+	}
+	return affected, err
+}
+
+// SetField Update single field of the document
+func (d *DualWriteDatabase) SetField(factory EntityFactory, entityID string, field string, value any, keys ...string) error {
+	err := d.primary.SetField(factory, entityID, field, value, keys...)
+	if err == nil {
+		d.enqueue("set_field", factory().TABLE(), []string{entityID}, func(db database.IDatabase) error {
+			return db.SetField(factory, entityID, field, value, keys...)
+		})
+	}
+	return err
+}
+
+// SetFields Update some fields of the document
+func (d *DualWriteDatabase) SetFields(factory EntityFactory, entityID string, fields map[string]any, keys ...string) error {
+	err := d.primary.SetFields(factory, entityID, fields, keys...)
+	if err == nil {
+		copied := make(map[string]any, len(fields))
+		for k, v := range fields {
+			copied[k] = v
+		}
+		d.enqueue("set_fields", factory().TABLE(), []string{entityID}, func(db database.IDatabase) error {
+			return db.SetFields(factory, entityID, copied, keys...)
+		})
+	}
+	return err
+}
+
+// BulkSetFields Update specific field of multiple entities
+func (d *DualWriteDatabase) BulkSetFields(factory EntityFactory, field string, values map[string]any, keys ...string) (int64, error) {
+	affected, err := d.primary.BulkSetFields(factory, field, values, keys...)
+	if err == nil {
+		copied := make(map[string]any, len(values))
+		ids := make([]string, 0, len(values))
+		for k, v := range values {
+			copied[k] = v
+			ids = append(ids, k)
+		}
+		d.enqueue("bulk_set_fields", factory().TABLE(), ids, func(db database.IDatabase) error {
+			_, er := db.BulkSetFields(factory, field, copied, keys...)
+			return er
+		})
+	}
+	return affected, err
+}
+
+// ExecuteDDL Execute DDL - create table and indexes (in both databases)
+func (d *DualWriteDatabase) ExecuteDDL(ddl map[string][]string) error {
+	err := d.primary.ExecuteDDL(ddl)
+	if err == nil {
+		d.enqueue("ddl", "", nil, func(db database.IDatabase) error { return db.ExecuteDDL(ddl) })
+	}
+	return err
+}
+
+// ExecuteSQL Execute SQL command (mirrored only if MirrorSQL is set)
+func (d *DualWriteDatabase) ExecuteSQL(sql string, args ...any) (int64, error) {
+	affected, err := d.primary.ExecuteSQL(sql, args...)
+	if err == nil && d.options.MirrorSQL {
+		d.enqueue("sql", "", nil, func(db database.IDatabase) error { _, er := db.ExecuteSQL(sql, args...); return er })
+	}
+	return affected, err
+}
+
+// DropTable Drop table and indexes (in both databases)
+func (d *DualWriteDatabase) DropTable(table string) error {
+	err := d.primary.DropTable(table)
+	if err == nil {
+		d.enqueue("drop_table", table, nil, func(db database.IDatabase) error { return db.DropTable(table) })
+	}
+	return err
+}
+
+// PurgeTable Fast delete table content (in both databases)
+func (d *DualWriteDatabase) PurgeTable(table string) error {
+	err := d.primary.PurgeTable(table)
+	if err == nil {
+		d.enqueue("purge_table", table, nil, func(db database.IDatabase) error { return db.PurgeTable(table) })
+	}
+	return err
+}
+
+// endregion
+
+// region Dual write replication methods -------------------------------------------------------------------------------
+
+// Flush wait until all the queued mutations are replicated (or failed)
+//
+// param: timeout - Maximum time to wait
+// return: error if the timeout expired
+func (d *DualWriteDatabase) Flush(timeout time.Duration) error {
+	drained := make(chan struct{})
+	go func() {
+		d.inflight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("dual write flush timeout: %d mutations pending", len(d.queue))
+	}
+}
+
+// Status returns the replication status
+func (d *DualWriteDatabase) Status() DualWriteStatus {
+	d.mu.Lock()
+	failures := append([]DualWriteFailure{}, d.failures...)
+	d.mu.Unlock()
+
+	return DualWriteStatus{
+		Queued:     d.queued.Load(),
+		Replicated: d.replicated.Load(),
+		Failed:     d.failed.Load(),
+		Dropped:    d.dropped.Load(),
+		Pending:    len(d.queue),
+		Failures:   failures,
+	}
+}
+
+// Compare the entities of the primary and the secondary databases by ids
+//
+// param: factory - Entity factory
+// param: entityIDs - List of entity ids to compare
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Consistency report, error
+func (d *DualWriteDatabase) Compare(factory EntityFactory, entityIDs []string, keys ...string) (*ConsistencyReport, error) {
+	report := &ConsistencyReport{Table: factory().TABLE(), Missing: []string{}, Extra: []string{}, Mismatched: []string{}}
+	if err := d.compare(report, factory, entityIDs, keys...); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// CompareTable compare all the entities of the primary database table with the secondary database (page by page), the
+// entities which exist in the secondary database only are not detected
+//
+// param: factory - Entity factory
+// param: pageSize - Number of entities per page (default: 500)
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Consistency report, error
+func (d *DualWriteDatabase) CompareTable(factory EntityFactory, pageSize int, keys ...string) (*ConsistencyReport, error) {
+	if pageSize <= 0 {
+		pageSize = 500
+	}
+	report := &ConsistencyReport{Table: factory().TABLE(), Missing: []string{}, Extra: []string{}, Mismatched: []string{}}
+	for page := 0; ; page++ {
+		list, _, err := d.primary.Query(factory).Sort("id").Page(page).Limit(pageSize).Find(keys...)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]string, 0, len(list))
+		for _, ent := range list {
+			ids = append(ids, ent.ID())
+		}
+		if err = d.compare(report, factory, ids, keys...); err != nil {
+			return nil, err
+		}
+		if len(list) < pageSize {
+			return report, nil
+		}
+	}
+}
+
+// compare the entities by ids and add the differences to the report
+func (d *DualWriteDatabase) compare(report *ConsistencyReport, factory EntityFactory, entityIDs []string, keys ...string) error {
+	if len(entityIDs) == 0 {
+		return nil
+	}
+	primary, err := d.primary.List(factory, entityIDs, keys...)
+	if err != nil {
+		return err
+	}
+	secondary, err := d.secondary.List(factory, entityIDs, keys...)
+	if err != nil {
+		return err
+	}
+
+	docs := make(map[string][]byte, len(secondary))
+	for _, ent := range secondary {
+		if docs[ent.ID()], err = json.Marshal(ent); err != nil {
+			return err
+		}
+	}
+	found := make(map[string]bool, len(primary))
+	for _, ent := range primary {
+		found[ent.ID()] = true
+		report.Checked++
+		doc, exists := docs[ent.ID()]
+		if !exists {
+			report.Missing = append(report.Missing, ent.ID())
+			continue
+		}
+		data, er := json.Marshal(ent)
+		if er != nil {
+			return er
+		}
+		if !bytes.Equal(data, doc) {
+			report.Mismatched = append(report.Mismatched, ent.ID())
+		}
+	}
+	for _, ent := range secondary {
+		if !found[ent.ID()] {
+			report.Extra = append(report.Extra, ent.ID())
+		}
+	}
+	return nil
+}
+
+// mirrorEntity queue the replication of single entity mutation (the entity is copied so later changes of the caller are
+// not replicated)
+func (d *DualWriteDatabase) mirrorEntity(operation string, entity Entity, apply func(db database.IDatabase, entity Entity) error) {
+	copied, err := copyEntity(entity)
+	if err != nil {
+		d.fail(dualWriteOp{operation: operation, table: entity.TABLE(), ids: []string{entity.ID()}}, err)
+		return
+	}
+	d.enqueue(operation, entity.TABLE(), []string{entity.ID()}, func(db database.IDatabase) error { return apply(db, copied) })
+}
+
+// mirrorEntities queue the replication of bulk mutation (the entities are copied)
+func (d *DualWriteDatabase) mirrorEntities(operation string, entities []Entity, apply func(db database.IDatabase, entities []Entity) error) {
+	if len(entities) == 0 {
+		return
+	}
+	copied := make([]Entity, 0, len(entities))
+	ids := make([]string, 0, len(entities))
+	for _, entity := range entities {
+		ids = append(ids, entity.ID())
+		c, err := copyEntity(entity)
+		if err != nil {
+			d.fail(dualWriteOp{operation: operation, table: entities[0].TABLE(), ids: ids}, err)
+			return
+		}
+		copied = append(copied, c)
+	}
+	d.enqueue(operation, entities[0].TABLE(), ids, func(db database.IDatabase) error { return apply(db, copied) })
+}
+
+// enqueue the mutation for replication, the mutation is dropped (and reported) if the queue is full
+func (d *DualWriteDatabase) enqueue(operation, table string, ids []string, apply func(db database.IDatabase) error) {
+	op := dualWriteOp{operation: operation, table: table, ids: ids, apply: apply}
+
+	d.queueMu.RLock()
+	defer d.queueMu.RUnlock()
+	if d.closed {
+		d.fail(op, fmt.Errorf("dual write database is closed"))
+		return
+	}
+
+	d.inflight.Add(1)
+	select {
+	case d.queue <- op:
+		d.queued.Add(1)
+	default:
+		d.inflight.Done()
+		d.dropped.Add(1)
+		d.fail(op, fmt.Errorf("replication queue is full"))
+	}
+}
+
+// replicate apply the queued mutations to the secondary database (in order) until the queue is closed
+func (d *DualWriteDatabase) replicate() {
+	defer close(d.done)
+	for op := range d.queue {
+		var err error
+		for attempt := 0; attempt <= d.options.Retries; attempt++ {
+			if attempt > 0 {
+				time.Sleep(d.options.RetryInterval)
+			}
+			if err = op.apply(d.secondary); err == nil {
+				break
+			}
+		}
+		if err == nil {
+			d.replicated.Add(1)
+		} else {
+			d.failed.Add(1)
+			d.fail(op, err)
+		}
+		d.inflight.Done()
+	}
+}
+
+// fail record the replication failure and report it
+func (d *DualWriteDatabase) fail(op dualWriteOp, err error) {
+	failure := DualWriteFailure{Operation: op.operation, Table: op.table, EntityIds: op.ids, Error: err.Error(), Time: time.Now()}
+	d.options.Logger.Error("dual write %s of %s %v error: %s", op.operation, op.table, op.ids, err.Error())
+
+	d.mu.Lock()
+	d.failures = append(d.failures, failure)
+	if len(d.failures) > maxDualWriteFailures {
+		d.failures = d.failures[len(d.failures)-maxDualWriteFailures:]
+	}
+	d.mu.Unlock()
+
+	if d.options.OnFailure != nil {
+		d.options.OnFailure(failure)
+	}
+}
+
+// copyEntity returns deep copy of the entity (via Json)
+func copyEntity(entity Entity) (Entity, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	copied := entityFactory(entity)()
+	if err = json.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+	return copied, nil
+}
+
+// endregion
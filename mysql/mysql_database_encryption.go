@@ -0,0 +1,339 @@
+package mysql
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// encryptedPrefix is the prefix of encrypted field values: enc:v1:<key id>:<base64 of nonce and cipher text>
+const encryptedPrefix = "enc:v1:"
+
+// region Field encryption definitions ---------------------------------------------------------------------------------
+
+// IKeyProvider provides the data encryption keys (e.g. backed by KMS), every key is tagged by its key id so values
+// encrypted by older keys can still be decrypted after rotation
+type IKeyProvider interface {
+	// CurrentKey returns the id and the key (16, 24 or 32 bytes AES key) used to encrypt new values
+	CurrentKey() (keyId string, key []byte, err error)
+
+	// Key returns the key by its id, used to decrypt values
+	Key(keyId string) ([]byte, error)
+}
+
+// StaticKeyProvider is an in-memory key provider
+type StaticKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewStaticKeyProvider create in-memory key provider
+//
+// param: currentId - The id of the key used to encrypt new values
+// param: keys - Map of key id to AES key (16, 24 or 32 bytes)
+// return: Key provider
+func NewStaticKeyProvider(currentId string, keys map[string][]byte) *StaticKeyProvider {
+	return &StaticKeyProvider{current: currentId, keys: keys}
+}
+
+// CurrentKey returns the current encryption key
+func (p *StaticKeyProvider) CurrentKey() (string, []byte, error) {
+	key, err := p.Key(p.current)
+	return p.current, key, err
+}
+
+// Key returns the key by its id
+func (p *StaticKeyProvider) Key(keyId string) ([]byte, error) {
+	if key, ok := p.keys[keyId]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key not found: %s", keyId)
+}
+
+// keyCiphers caches the AEAD ciphers of the provider keys
+type keyCiphers struct {
+	provider IKeyProvider
+	ciphers  sync.Map // Map of key id to AEAD cipher
+}
+
+// fieldEncryptor encrypts and decrypts the designated fields of the entity document
+type fieldEncryptor struct {
+	keyCiphers
+	fields []string
+}
+
+// endregion
+
+// region Field encryption methods -------------------------------------------------------------------------------------
+
+// SetFieldEncryption transparently encrypt the designated fields of the entity type before storage and decrypt them on
+// read (AES-GCM, each value is tagged by the key id). Encrypted fields can't be used in query filters, sort or indexes.
+// Calling it without fields disables the encryption of the entity type.
+//
+// param: factory - Entity factory
+// param: provider - Encryption keys provider
+// param: fields - List of top level fields to encrypt
+// return: error
+func (dbs *MySqlDatabase) SetFieldEncryption(factory EntityFactory, provider IKeyProvider, fields ...string) error {
+	if err := validateFields(fields...); err != nil {
+		return err
+	}
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	table := factory().TABLE()
+	if provider == nil || len(fields) == 0 {
+		delete(dbs.encryption, table)
+		return nil
+	}
+	if dbs.encryption == nil {
+		dbs.encryption = make(map[string]*fieldEncryptor)
+	}
+	dbs.encryption[table] = &fieldEncryptor{keyCiphers: keyCiphers{provider: provider}, fields: fields}
+	return nil
+}
+
+// encryptor returns the field encryptor of the entity table template (nil if not encrypted)
+func (dbs *MySqlDatabase) encryptor(table string) *fieldEncryptor {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.encryption[table]
+}
+
+// marshal convert the entity to Json document, validate it and encrypt its designated fields and then the whole document
+// (if enabled), the table is the physical table the document is written to
+func (dbs *MySqlDatabase) marshal(entity Entity, table string) ([]byte, error) {
+	data, err := dbs.serialize(entity)
+	if err != nil {
+		return nil, err
+	}
+	if err = dbs.validate(entity.TABLE(), entity.ID(), data); err != nil {
+		return nil, err
+	}
+	return dbs.encode(entity.TABLE(), table, data)
+}
+
+// encode encrypt the designated fields of the Json document and then the whole document, and spill large documents
+// of the physical table to the overflow storage (if enabled)
+func (dbs *MySqlDatabase) encode(template, table string, data []byte) (_ []byte, err error) {
+	if enc := dbs.encryptor(template); enc != nil {
+		if data, err = enc.encryptDocument(data); err != nil {
+			return nil, err
+		}
+	}
+	if env := dbs.envelope(template); env != nil {
+		if data, err = env.seal(data, dbs.promotedFields(template)); err != nil {
+			return nil, err
+		}
+	}
+	return dbs.spill(template, table, data)
+}
+
+// unmarshal decrypt the Json document and its designated fields (if enabled) and convert it to entity
+func (dbs *MySqlDatabase) unmarshal(factory EntityFactory, data []byte) (entity Entity, err error) {
+	entity = factory()
+	if data, err = dbs.decode(entity.TABLE(), data); err != nil {
+		return nil, err
+	}
+	if err = dbs.deserialize(data, entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// decode load the overflowed document, open the document envelope and decrypt the designated fields (if enabled), the
+// reverse of encode
+func (dbs *MySqlDatabase) decode(template string, data []byte) (_ []byte, err error) {
+	if data, err = dbs.restore(template, data); err != nil {
+		return nil, err
+	}
+	if env := dbs.envelope(template); env != nil {
+		if data, err = env.open(data); err != nil {
+			return nil, err
+		}
+	}
+	if enc := dbs.encryptor(template); enc != nil {
+		if data, err = enc.decryptDocument(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// encryptField encrypt single field value if the field is encrypted (used by SetField and SetFields)
+func (dbs *MySqlDatabase) encryptField(factory EntityFactory, field string, value any) (any, error) {
+	enc := dbs.encryptor(factory().TABLE())
+	if enc == nil || !enc.isEncrypted(field) {
+		return value, nil
+	}
+	return enc.encryptValue(field, value)
+}
+
+// isEncrypted check if the field is one of the encrypted fields
+func (e *fieldEncryptor) isEncrypted(field string) bool {
+	for _, f := range e.fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptDocument encrypt the designated fields of the Json document
+func (e *fieldEncryptor) encryptDocument(data []byte) ([]byte, error) {
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, field := range e.fields {
+		raw, ok := doc[field]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		token, err := e.encrypt(field, raw)
+		if err != nil {
+			return nil, err
+		}
+		if doc[field], err = json.Marshal(token); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// decryptDocument decrypt the designated fields of the Json document (plain values are returned as is)
+func (e *fieldEncryptor) decryptDocument(data []byte) ([]byte, error) {
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	for _, field := range e.fields {
+		var token string
+		if raw, ok := doc[field]; !ok || json.Unmarshal(raw, &token) != nil || !strings.HasPrefix(token, encryptedPrefix) {
+			continue
+		}
+		plain, err := e.decrypt(field, token)
+		if err != nil {
+			return nil, err
+		}
+		doc[field] = plain
+	}
+	return json.Marshal(doc)
+}
+
+// encryptValue encrypt single field value
+func (e *fieldEncryptor) encryptValue(field string, value any) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return e.encrypt(field, raw)
+}
+
+// encrypt the Json value of the field using the current key, the field name is used as additional authenticated data
+func (e *fieldEncryptor) encrypt(field string, plain []byte) (string, error) {
+	keyId, aead, err := e.current()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, plain, []byte(field))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + keyId + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt the field value using the key tagged in the value
+func (e *fieldEncryptor) decrypt(field, token string) ([]byte, error) {
+	body := strings.TrimPrefix(token, encryptedPrefix)
+	idx := strings.LastIndex(body, ":")
+	if idx < 0 {
+		return nil, fmt.Errorf("invalid encrypted value of field: %s", field)
+	}
+	keyId := body[:idx]
+
+	sealed, err := base64.StdEncoding.DecodeString(body[idx+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := e.byId(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed, []byte(field))
+}
+
+// current returns the id and the AEAD cipher of the current key
+func (k *keyCiphers) current() (string, cipher.AEAD, error) {
+	keyId, key, err := k.provider.CurrentKey()
+	if err != nil {
+		return "", nil, err
+	}
+	aead, err := k.cipher(keyId, key)
+	return keyId, aead, err
+}
+
+// byId returns the AEAD cipher of the key id
+func (k *keyCiphers) byId(keyId string) (cipher.AEAD, error) {
+	if aead, ok := k.ciphers.Load(keyId); ok {
+		return aead.(cipher.AEAD), nil
+	}
+	key, err := k.provider.Key(keyId)
+	if err != nil {
+		return nil, err
+	}
+	return k.cipher(keyId, key)
+}
+
+// cipher returns the AEAD cipher of the key id
+func (k *keyCiphers) cipher(keyId string, key []byte) (cipher.AEAD, error) {
+	if aead, ok := k.ciphers.Load(keyId); ok {
+		return aead.(cipher.AEAD), nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	k.ciphers.Store(keyId, aead)
+	return aead, nil
+}
+
+// newAEAD create AES-GCM cipher of the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypt the plain text, the random nonce is prepended to the cipher text
+func seal(aead cipher.AEAD, plain, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, additional), nil
+}
+
+// open decrypt the sealed text (nonce followed by the cipher text)
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted value")
+	}
+	nonce, cipherText := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, cipherText, additional)
+}
+
+// endregion
@@ -0,0 +1,291 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// envelopeField is the document field holding the encrypted payload
+const envelopeField = "_enc"
+
+// region Document encryption definitions ------------------------------------------------------------------------------
+
+// envelope is the encrypted payload of the document: the document is encrypted by random data key, and the data key
+// is encrypted (wrapped) by the provider key
+type envelope struct {
+	Version int    `json:"v"`    // Envelope format version
+	KeyId   string `json:"kid"`  // The id of the key wrapping the data key
+	DataKey string `json:"dek"`  // The wrapped data key (base64)
+	Data    string `json:"data"` // The encrypted document (base64)
+}
+
+// documentEncryptor encrypts and decrypts the whole entity document
+type documentEncryptor struct {
+	keyCiphers
+}
+
+// dataKeyAAD is the additional authenticated data of the wrapped data keys
+var dataKeyAAD = []byte(envelopeField)
+
+// endregion
+
+// region Document encryption methods ----------------------------------------------------------------------------------
+
+// SetDocumentEncryption encrypt the entire document of the entity type at rest (AES-GCM envelope encryption), for
+// deployments whose MySQL hosting doesn't offer TDE. The id column and the promoted fields (see PromoteFields) are
+// kept in clear so lookup by id and the promoted indexes keep working, other fields can't be used in query filters.
+// Passing nil provider disables the encryption of the entity type.
+//
+// param: factory - Entity factory
+// param: provider - Key encryption keys provider
+func (dbs *MySqlDatabase) SetDocumentEncryption(factory EntityFactory, provider IKeyProvider) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	table := factory().TABLE()
+	if provider == nil {
+		delete(dbs.envelopes, table)
+		return
+	}
+	if dbs.envelopes == nil {
+		dbs.envelopes = make(map[string]*documentEncryptor)
+	}
+	dbs.envelopes[table] = &documentEncryptor{keyCiphers: keyCiphers{provider: provider}}
+}
+
+// RotateDocumentKeys re-wrap the data keys of all the documents which are not wrapped by the current key, the
+// documents themselves are not re-encrypted
+//
+// param: factory - Entity factory
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Number of rotated documents, error
+func (dbs *MySqlDatabase) RotateDocumentKeys(factory EntityFactory, keys ...string) (affected int64, err error) {
+	template := factory().TABLE()
+	enc := dbs.envelope(template)
+	if enc == nil {
+		return 0, fmt.Errorf("document encryption is not enabled for: %s", template)
+	}
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("rotate_document_keys", template, 0, time.Now(), &affected, &err)
+
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+
+	docs, err := dbs.scanDocuments(table, tenantOf(keys...))
+	if err != nil {
+		return
+	}
+
+	for id, data := range docs {
+		rotated, changed, er := enc.rewrap(data)
+		if er != nil {
+			return affected, er
+		}
+		if !changed {
+			continue
+		}
+		if _, err = dbs.exec(dbs.pgDb, table, tenantOf(keys...), fmt.Sprintf(sqlUpdate, table), id, rotated); err != nil {
+			return
+		}
+		affected++
+	}
+	return
+}
+
+// setEncryptedField update single field of encrypted document by reading, modifying and updating the entire document
+// (unlike SetField of clear documents, the read and the update are not atomic)
+func (dbs *MySqlDatabase) setEncryptedField(factory EntityFactory, entityID, field string, value any, keys ...string) error {
+	entity, err := dbs.get(factory, entityID, keys...)
+	if err != nil {
+		return err
+	}
+
+	data, err := Marshal(entity)
+	if err != nil {
+		return err
+	}
+	doc := make(map[string]any)
+	if err = Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	doc[field] = value
+	if data, err = Marshal(doc); err != nil {
+		return err
+	}
+
+	entity = factory()
+	if err = Unmarshal(data, &entity); err != nil {
+		return err
+	}
+	_, err = dbs.Update(entity)
+	return err
+}
+
+// envelope returns the document encryptor of the entity table template (nil if not encrypted)
+func (dbs *MySqlDatabase) envelope(table string) *documentEncryptor {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.envelopes[table]
+}
+
+// scanDocuments read all the documents of the table
+func (dbs *MySqlDatabase) scanDocuments(table, tenant string) (docs map[string][]byte, err error) {
+	var rows *sql.Rows
+	if rows, err = dbs.query(dbs.pgDb, table, tenant, fmt.Sprintf(`SELECT id, data FROM "%s"`, table)); err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	docs = make(map[string][]byte)
+	for rows.Next() {
+		var (
+			id   string
+			data []byte
+		)
+		if err = rows.Scan(&id, &data); err != nil {
+			return
+		}
+		docs[id] = data
+	}
+	return docs, rows.Err()
+}
+
+// seal encrypt the document, the clear fields are copied as is to the encrypted document
+func (e *documentEncryptor) seal(data []byte, clear []PromotedField) ([]byte, error) {
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(aead, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	env := envelope{Version: 1, Data: base64.StdEncoding.EncodeToString(sealed)}
+	if env.KeyId, env.DataKey, err = e.wrap(dataKey); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]any)
+	for _, field := range clear {
+		if value, ok := doc[field.Field]; ok {
+			out[field.Field] = value
+		}
+	}
+	out[envelopeField] = env
+	return json.Marshal(out)
+}
+
+// open decrypt the document (documents which are not encrypted are returned as is)
+func (e *documentEncryptor) open(data []byte) ([]byte, error) {
+	env, ok, err := parseEnvelope(data)
+	if err != nil || !ok {
+		return data, err
+	}
+
+	dataKey, err := e.unwrap(env)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(env.Data)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed, nil)
+}
+
+// rewrap wrap the data key of the document by the current key (if wrapped by older key)
+func (e *documentEncryptor) rewrap(data []byte) (out []byte, changed bool, err error) {
+	env, ok, err := parseEnvelope(data)
+	if err != nil || !ok {
+		return data, false, err
+	}
+
+	keyId, _, err := e.current()
+	if err != nil || keyId == env.KeyId {
+		return data, false, err
+	}
+
+	dataKey, err := e.unwrap(env)
+	if err != nil {
+		return nil, false, err
+	}
+	if env.KeyId, env.DataKey, err = e.wrap(dataKey); err != nil {
+		return nil, false, err
+	}
+
+	doc := make(map[string]any)
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, false, err
+	}
+	doc[envelopeField] = env
+	out, err = json.Marshal(doc)
+	return out, err == nil, err
+}
+
+// wrap encrypt the data key by the current key
+func (e *documentEncryptor) wrap(dataKey []byte) (keyId, wrapped string, err error) {
+	keyId, aead, err := e.current()
+	if err != nil {
+		return "", "", err
+	}
+	sealed, err := seal(aead, dataKey, dataKeyAAD)
+	if err != nil {
+		return "", "", err
+	}
+	return keyId, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrap decrypt the data key of the envelope
+func (e *documentEncryptor) unwrap(env *envelope) ([]byte, error) {
+	aead, err := e.byId(env.KeyId)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(env.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, wrapped, dataKeyAAD)
+}
+
+// parseEnvelope extract the envelope of the encrypted document (returns false if the document is not encrypted)
+func parseEnvelope(data []byte) (*envelope, bool, error) {
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false, err
+	}
+	raw, ok := doc[envelopeField]
+	if !ok {
+		return nil, false, nil
+	}
+	env := &envelope{}
+	if err := json.Unmarshal(raw, env); err != nil {
+		return nil, false, err
+	}
+	return env, true, nil
+}
+
+// endregion
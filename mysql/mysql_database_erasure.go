@@ -0,0 +1,162 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Erasure definitions ------------------------------------------------------------------------------------------
+
+// ErasureCertificate is the record proving the erasure of an entity, it holds only the hash of the entity id so it
+// does not retain any personal data
+type ErasureCertificate struct {
+	BaseEntity
+	Table      string           `json:"table"`      // The entity physical table
+	EntityHash string           `json:"entityHash"` // SHA-256 of the table and the entity id
+	Tenant     string           `json:"tenant"`     // The tenant (shard key)
+	Actor      string           `json:"actor"`      // Who requested the erasure (the audit actor, if configured)
+	Scrubbed   map[string]int64 `json:"scrubbed"`   // Map of table to the number of removed rows
+}
+
+func (c *ErasureCertificate) TABLE() string { return "erasure_certificate" }
+func (c *ErasureCertificate) NAME() string  { return c.EntityHash }
+func (c *ErasureCertificate) KEY() string   { return "" }
+
+// NewErasureCertificate is the erasure certificate factory
+func NewErasureCertificate() Entity { return &ErasureCertificate{} }
+
+// erasureScrub is a single statement removing the entity traces from a related table
+type erasureScrub struct {
+	table string
+	SQL   string
+	args  []any
+}
+
+// endregion
+
+// region Erasure methods ----------------------------------------------------------------------------------------------
+
+// EraseEntity hard-delete the entity and scrub its traces from the related tables (audit log, version history, trash) in a single transaction,
+// and store an erasure certificate record. The erasure is idempotent: erasing entity which does not exist still scrubs
+// the related tables and emits certificate.
+//
+// param: factory - Entity factory
+// param: entityID - Entity id
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Erasure certificate, error
+func (dbs *MySqlDatabase) EraseEntity(factory EntityFactory, entityID string, keys ...string) (cert *ErasureCertificate, err error) {
+
+	if entityID == "" {
+		return nil, fmt.Errorf("empty entity id passed to Erase operation")
+	}
+
+	// Get the entity to publish its deletion (if exists)
+	deleted, _ := dbs.get(factory, entityID, keys...)
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("erase", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	table, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return
+	}
+	tenant := tenantOf(keys...)
+
+	certTable := (&ErasureCertificate{}).TABLE()
+	if err = dbs.ExecuteDDL(map[string][]string{certTable: {"entityHash"}}); err != nil {
+		return
+	}
+
+	scrubs, err := dbs.erasureScrubs(table, tenant, entityID)
+	if err != nil {
+		return
+	}
+
+	hash := sha256.Sum256([]byte(table + ":" + entityID))
+	cert = &ErasureCertificate{Table: table, EntityHash: hex.EncodeToString(hash[:]), Tenant: tenant, Scrubbed: make(map[string]int64)}
+	cert.Id = GUID()
+	cert.CreatedOn = Timestamp(dbs.now().UnixMilli())
+	cert.UpdatedOn = cert.CreatedOn
+	if audit := dbs.auditLogger(); audit != nil && audit.options.Actor != nil {
+		cert.Actor = audit.options.Actor()
+	}
+
+	var tx *sql.Tx
+	if tx, err = dbs.pgDb.Begin(); err != nil {
+		return nil, err
+	}
+
+	for _, scrub := range scrubs {
+		result, er := dbs.exec(tx, scrub.table, tenant, scrub.SQL, scrub.args...)
+		if er != nil {
+			_ = tx.Rollback()
+			return nil, er
+		}
+		if cert.Scrubbed[scrub.table], er = result.RowsAffected(); er != nil {
+			_ = tx.Rollback()
+			return nil, er
+		}
+	}
+
+	data, err := Marshal(cert)
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if _, err = dbs.exec(tx, certTable, tenant, fmt.Sprintf(sqlInsert, certTable), cert.Id, data); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if deleted != nil {
+		dbs.publishChange(DeleteEntity, deleted)
+	}
+	return cert, nil
+}
+
+// erasureScrubs returns the statements removing the entity and its traces from the related tables
+func (dbs *MySqlDatabase) erasureScrubs(table, tenant, entityID string) (scrubs []erasureScrub, err error) {
+
+	scrubs = []erasureScrub{{table: table, SQL: fmt.Sprintf(sqlDelete, table), args: []any{entityID}}}
+
+	// Audit log entries of the entity (the audit table may exist even if the audit is currently disabled)
+	auditKey := tenant
+	if auditKey == "" {
+		auditKey = auditGlobalTenant
+	}
+	auditTable := dbs.tableName((&AuditEntry{}).TABLE(), auditKey)
+	if exists, er := dbs.listTables(auditTable); er != nil {
+		return nil, er
+	} else if len(exists) > 0 {
+		SQL := fmt.Sprintf(`DELETE FROM "%s" WHERE data->>'entityId' = $1 AND data->>'table' = $2`, auditTable)
+		scrubs = append(scrubs, erasureScrub{table: auditTable, SQL: SQL, args: []any{entityID, table}})
+	}
+
+	// Prior versions of the entity (the history table may exist even if the history is currently disabled)
+	history := historyTable(table)
+	if exists, er := dbs.listTables(history); er != nil {
+		return nil, er
+	} else if len(exists) > 0 {
+		SQL := fmt.Sprintf(`DELETE FROM "%s" WHERE data->>'entityId' = $1`, history)
+		scrubs = append(scrubs, erasureScrub{table: history, SQL: SQL, args: []any{entityID}})
+	}
+
+	// Soft deleted copy of the entity
+	trash := trashTableName(table)
+	if exists, er := dbs.listTables(trash); er != nil {
+		return nil, er
+	} else if len(exists) > 0 {
+		scrubs = append(scrubs, erasureScrub{table: trash, SQL: fmt.Sprintf(sqlDelete, trash), args: []any{entityID}})
+	}
+	return scrubs, nil
+}
+
+// endregion
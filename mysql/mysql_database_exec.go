@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+)
+
+// region Statement executor definitions -------------------------------------------------------------------------------
+
+// Statement is a single SQL statement executed by the database
+type Statement struct {
+	Table      string // The physical table of the statement (empty if not related to a single table)
+	Tenant     string // The tenant (shard key) of the statement (empty if not related to a single tenant)
+	SQL        string // The SQL statement
+	Args       []any  // The statement arguments
+	Query      bool   // The statement returns rows (query) or not (exec)
+	InTx       bool   // The statement is executed within a transaction
+	Source     string // The source (label) of native query (see ExecuteQuery), empty for the package statements
+	Idempotent bool   // The statement can be safely executed again (retried on transient errors, see SetTransientRetry)
+}
+
+// StatementResult is the result of statement execution
+type StatementResult struct {
+	Result sql.Result // The exec result (for statements which does not return rows)
+	Rows   *sql.Rows  // The query rows (for statements which return rows), the caller is responsible to close them
+}
+
+// Executor executes a single statement
+type Executor func(stmt *Statement) (*StatementResult, error)
+
+// Middleware wraps the statement executor, used to plug in custom tracing, caching, tenancy checks or chaos injection
+// A middleware which does not call the next executor (e.g. to reject the statement) must return an error
+type Middleware func(next Executor) Executor
+
+// sqlRunner is the common interface of sql.DB and sql.Tx used to execute statements
+type sqlRunner interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// endregion
+
+// region Statement execution methods ----------------------------------------------------------------------------------
+
+// Use add middlewares to the statement execution chain, every statement executed by the database is passed through the chain
+// The first middleware is the outermost one (called first)
+//
+// param: middleware - List of middlewares
+func (dbs *MySqlDatabase) Use(middleware ...Middleware) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.middleware = append(dbs.middleware, middleware...)
+}
+
+// exec execute statement which does not return rows, all the package statements are executed through this method
+func (dbs *MySqlDatabase) exec(runner sqlRunner, table, tenant, SQL string, args ...any) (result sql.Result, err error) {
+	res, err := dbs.execute(runner, &Statement{Table: table, Tenant: tenant, SQL: SQL, Args: args})
+	if res != nil {
+		result = res.Result
+	}
+	return
+}
+
+// execIdempotent execute statement which does not return rows and has the same effect when executed again (e.g. replace
+// document), so it is retried on transient errors
+func (dbs *MySqlDatabase) execIdempotent(runner sqlRunner, table, tenant, SQL string, args ...any) (result sql.Result, err error) {
+	res, err := dbs.execute(runner, &Statement{Table: table, Tenant: tenant, SQL: SQL, Args: args, Idempotent: true})
+	if res != nil {
+		result = res.Result
+	}
+	return
+}
+
+// query execute statement which returns rows, all the package queries are executed through this method
+func (dbs *MySqlDatabase) query(runner sqlRunner, table, tenant, SQL string, args ...any) (rows *sql.Rows, err error) {
+	res, err := dbs.execute(runner, &Statement{Table: table, Tenant: tenant, SQL: SQL, Args: args, Query: true})
+	if res != nil {
+		rows = res.Rows
+	}
+	if err != nil && rows != nil {
+		_ = rows.Close()
+		rows = nil
+	}
+	return
+}
+
+// querySource execute native query of the source (label), which is used for the logging and metrics attribution and
+// for the replica routing (see SourcePrimary and SourceReplica)
+func (dbs *MySqlDatabase) querySource(source, SQL string, args ...any) (rows *sql.Rows, err error) {
+	res, err := dbs.execute(dbs.pgDb, &Statement{SQL: SQL, Args: args, Query: true, Source: source})
+	if res != nil {
+		rows = res.Rows
+	}
+	if err != nil && rows != nil {
+		_ = rows.Close()
+		rows = nil
+	}
+	return
+}
+
+// execute pass the statement through the circuit breaker and the middleware chain (retrying transient errors of
+// idempotent statements) and log it
+func (dbs *MySqlDatabase) execute(runner sqlRunner, stmt *Statement) (res *StatementResult, err error) {
+	_, stmt.InTx = runner.(*sql.Tx)
+	stmt.SQL, stmt.Table = qualifyNames(stmt.SQL), qualifyNames(stmt.Table)
+	runner = dbs.readRunner(runner, stmt)
+
+	start := time.Now()
+	res, err = dbs.attempt(runner, stmt)
+	for retry := 1; err != nil && dbs.retryTransient(stmt, err, retry); retry++ {
+		res, err = dbs.attempt(runner, stmt)
+	}
+
+	var result sql.Result
+	if res != nil {
+		result = res.Result
+	}
+	label := stmt.Table
+	if label == "" {
+		label = stmt.Source
+	}
+	dbs.logStatement(label, stmt.SQL, stmt.Args, start, result, err)
+	dbs.recordShape(stmt.SQL, start, result, err)
+	return
+}
+
+// attempt execute the statement once through the circuit breaker and the middleware chain
+func (dbs *MySqlDatabase) attempt(runner sqlRunner, stmt *Statement) (res *StatementResult, err error) {
+	cb := dbs.circuitBreaker()
+	if cb != nil {
+		if err = cb.allow(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	res, err = dbs.executor(runner)(stmt)
+	if cb != nil {
+		cb.record(err, time.Now())
+	}
+	return
+}
+
+// executor build the statement executor: the middleware chain wrapping the runner
+func (dbs *MySqlDatabase) executor(runner sqlRunner) Executor {
+	comment := dbs.statementComment()
+	exec := func(stmt *Statement) (*StatementResult, error) {
+		SQL := comment(stmt) + stmt.SQL
+		if stmt.Query {
+			rows, err := runner.Query(SQL, stmt.Args...)
+			return &StatementResult{Rows: rows}, err
+		}
+		result, err := runner.Exec(SQL, stmt.Args...)
+		return &StatementResult{Result: result}, err
+	}
+
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	for i := len(dbs.middleware) - 1; i >= 0; i-- {
+		exec = dbs.middleware[i](exec)
+	}
+	return exec
+}
+
+// tenantOf returns the tenant of the shard keys (the first key)
+func tenantOf(keys ...string) string {
+	_, keys, _ = splitReferenceTime(keys...)
+	if len(keys) > 0 {
+		return keys[0]
+	}
+	return ""
+}
+
+// scalar execute query and scan the first row into the destination values (returns sql.ErrNoRows if no row is fetched)
+func (dbs *MySqlDatabase) scalar(table, SQL string, args []any, dest ...any) error {
+	return dbs.scalarOn(dbs.pgDb, table, SQL, args, dest...)
+}
+
+// scalarOn query a single row on the runner (e.g. transaction or dedicated connection) and scan it to the destination
+func (dbs *MySqlDatabase) scalarOn(runner sqlRunner, table, SQL string, args []any, dest ...any) error {
+	rows, err := dbs.query(runner, table, "", SQL, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	return rows.Scan(dest...)
+}
+
+// endregion
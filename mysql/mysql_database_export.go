@@ -0,0 +1,163 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Export definitions -------------------------------------------------------------------------------------------
+
+// ExportFormat is the output format of the exported entities
+type ExportFormat string
+
+const (
+	ExportJsonLines ExportFormat = "jsonl" // Json document per line
+	ExportCSV       ExportFormat = "csv"   // Header line and a line per entity, nested values are encoded as Json
+)
+
+// endregion
+
+// region Export methods -----------------------------------------------------------------------------------------------
+
+// Export stream the entities matching the query to the writer row by row (without buffering the result set).
+// Masking rules and query callbacks (Apply) are applied. For cross-shard queries the shards are exported one after the
+// other, hence the sort order and limit are applied per shard.
+// The CSV columns are the top level fields of the first exported entity (sorted by name).
+//
+// param: factory - Entity factory
+// param: query - The query (nil to export all the entities), must be created by this database Query()
+// param: w - The output writer
+// param: format - The output format
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Number of exported entities, error
+func (dbs *MySqlDatabase) Export(factory EntityFactory, query database.IQuery, w io.Writer, format ExportFormat, keys ...string) (count int64, err error) {
+
+	if query == nil {
+		query = dbs.Query(factory)
+	}
+	q, ok := query.(*mSqlDatabaseQuery)
+	if !ok {
+		return 0, fmt.Errorf("query is not a MySQL query")
+	}
+
+	var write func(entity Entity) error
+	switch format {
+	case ExportJsonLines:
+		encoder := json.NewEncoder(w)
+		write = func(entity Entity) error { return encoder.Encode(entity) }
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		defer func() {
+			cw.Flush()
+			if err == nil {
+				err = cw.Error()
+			}
+		}()
+		write = csvEntityWriter(cw)
+	default:
+		return 0, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	if err = q.validateKeys(keys...); err != nil {
+		return 0, err
+	}
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("export", factory().TABLE(), 0, time.Now(), &count, &err)
+
+	tables := []string{q.tableName(keys...)}
+	if q.isAcross() {
+		if tables, err = q.shardTables(keys...); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, table := range tables {
+		err = q.shardQuery(table).stream(tenantOf(keys...), func(entity Entity) error {
+			count++
+			return write(entity)
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// stream execute the query and call the function for every result entity (after the callbacks are applied)
+func (s *mSqlDatabaseQuery) stream(tenant string, fn func(entity Entity) error) error {
+
+	SQL, args := s.buildStatement()
+	rows, err := s.db.query(s.db.pgDb, s.table, tenant, SQL, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		entity, er := s.unMarshal(s.scanRow(rows))
+		if er != nil {
+			return er
+		}
+		if entity = s.processCallbacks(entity); entity == nil {
+			continue
+		}
+		if er = fn(entity); er != nil {
+			return er
+		}
+	}
+	return rows.Err()
+}
+
+// csvEntityWriter returns function writing entities as CSV lines (the header is written with the first entity)
+func csvEntityWriter(cw *csv.Writer) func(entity Entity) error {
+	var columns []string
+	return func(entity Entity) error {
+		data, err := json.Marshal(entity)
+		if err != nil {
+			return err
+		}
+		doc := make(map[string]any)
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err = decoder.Decode(&doc); err != nil {
+			return err
+		}
+
+		if columns == nil {
+			columns = make([]string, 0, len(doc))
+			for field := range doc {
+				columns = append(columns, field)
+			}
+			sort.Strings(columns)
+			if err = cw.Write(columns); err != nil {
+				return err
+			}
+		}
+
+		record := make([]string, len(columns))
+		for i, field := range columns {
+			switch v := doc[field].(type) {
+			case nil:
+			case string:
+				record[i] = v
+			case map[string]any, []any:
+				b, _ := json.Marshal(v)
+				record[i] = string(b)
+			default:
+				record[i] = fmt.Sprintf("%v", v)
+			}
+		}
+		return cw.Write(record)
+	}
+}
+
+// endregion
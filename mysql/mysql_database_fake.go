@@ -0,0 +1,503 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/go-yaaf/yaaf-common/messaging"
+)
+
+// region Fake database definitions ------------------------------------------------------------------------------------
+
+// FakeDatabase is an in-memory implementation of the IDatabase behavior (table templates resolution, query filters,
+// sort, pagination and change publishing), used to unit-test repositories without MySQL server.
+// Entities are stored as Json documents, so the returned entities never share memory with the stored ones.
+// Tables are created on first write, and reading from table which does not exist returns empty result.
+type FakeDatabase struct {
+	mu     sync.RWMutex                                  // Protect the tables
+	tables map[string]map[string][]byte                  // Map of table name to map of entity id to Json document
+	bus    messaging.IMessageBus                         // Message bus to publish changes (optional)
+	clock  func() time.Time                              // Clock used for time based table names
+	logger ILogger                                       // Logger
+	ddl    map[string][]string                           // Indexed fields per table (recorded by ExecuteDDL)
+	sqlLog []string                                      // Raw SQL passed to ExecuteSQL / ExecuteQuery
+	rows   func(SQL string, args ...any) ([]Json, error) // Handler of ExecuteQuery (optional)
+}
+
+// endregion
+
+// region Factory and connectivity methods -----------------------------------------------------------------------------
+
+// NewFakeDatabase create in-memory fake database
+//
+// return: Fake database
+func NewFakeDatabase() *FakeDatabase {
+	return NewFakeDatabaseWithMessageBus(nil)
+}
+
+// NewFakeDatabaseWithMessageBus create in-memory fake database which publishes changes to the message bus
+//
+// param: bus - Message bus
+// return: Fake database
+func NewFakeDatabaseWithMessageBus(bus messaging.IMessageBus) *FakeDatabase {
+	return &FakeDatabase{
+		tables: make(map[string]map[string][]byte),
+		bus:    bus,
+		clock:  time.Now,
+		logger: defaultLogger{},
+		ddl:    make(map[string][]string),
+	}
+}
+
+// Ping Test database connectivity (always succeeds)
+func (f *FakeDatabase) Ping(retries uint, intervalInSeconds uint) error {
+	return nil
+}
+
+// Close the database (no-op)
+func (f *FakeDatabase) Close() error {
+	return nil
+}
+
+// CloneDatabase Returns the same instance (the clone shares the data)
+func (f *FakeDatabase) CloneDatabase() (database.IDatabase, error) {
+	return f, nil
+}
+
+// SetClock set the clock used to resolve time based table names (nil resets to the system clock)
+//
+// param: clock - Function returning the current time
+func (f *FakeDatabase) SetClock(clock func() time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if clock == nil {
+		clock = time.Now
+	}
+	f.clock = clock
+}
+
+// SetQueryHandler set the handler of ExecuteQuery, to stub the results of raw SQL queries
+//
+// param: handler - Function returning the rows of the raw SQL query
+func (f *FakeDatabase) SetQueryHandler(handler func(SQL string, args ...any) ([]Json, error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rows = handler
+}
+
+// Tables returns the names of all the tables (sorted)
+func (f *FakeDatabase) Tables() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	result := make([]string, 0, len(f.tables))
+	for table := range f.tables {
+		result = append(result, table)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Indexes returns the indexed fields of the table, as recorded by ExecuteDDL
+//
+// param: table - Table name
+// return: List of indexed fields
+func (f *FakeDatabase) Indexes(table string) []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.ddl[table]
+}
+
+// ExecutedSQL returns the raw SQL statements passed to ExecuteSQL and ExecuteQuery
+func (f *FakeDatabase) ExecutedSQL() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]string{}, f.sqlLog...)
+}
+
+// endregion
+
+// region Basic CRUD methods -------------------------------------------------------------------------------------------
+
+// Get a single entity by ID
+func (f *FakeDatabase) Get(factory EntityFactory, entityID string, keys ...string) (Entity, error) {
+	if entityID == "" {
+		return nil, fmt.Errorf("empty entity id passed to Get operation")
+	}
+
+	f.mu.RLock()
+	data, ok := f.tables[f.tableName(factory().TABLE(), keys...)][entityID]
+	f.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("no row fetched for id: %s", entityID)
+	}
+	return fakeDecode(factory, data)
+}
+
+// List Get list of entities by IDs
+func (f *FakeDatabase) List(factory EntityFactory, entityIDs []string, keys ...string) (list []Entity, err error) {
+	list = make([]Entity, 0)
+
+	f.mu.RLock()
+	table := f.tables[f.tableName(factory().TABLE(), keys...)]
+	docs := make([][]byte, 0, len(entityIDs))
+	for _, id := range entityIDs {
+		if data, ok := table[id]; ok {
+			docs = append(docs, data)
+		}
+	}
+	f.mu.RUnlock()
+
+	for _, data := range docs {
+		entity, er := fakeDecode(factory, data)
+		if er != nil {
+			return nil, er
+		}
+		list = append(list, entity)
+	}
+	return list, nil
+}
+
+// Exists Check if entity exists by ID
+func (f *FakeDatabase) Exists(factory EntityFactory, entityID string, keys ...string) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	_, ok := f.tables[f.tableName(factory().TABLE(), keys...)][entityID]
+	return ok, nil
+}
+
+// Insert new entity (fails if the entity already exists)
+func (f *FakeDatabase) Insert(entity Entity) (Entity, error) {
+	if err := f.write(entity, func(exists bool) error {
+		if exists {
+			return fmt.Errorf("duplicate entry '%s' for key 'PRIMARY'", entity.ID())
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	f.publishChange(AddEntity, entity)
+	return entity, nil
+}
+
+// Update existing entity (fails if the entity does not exist)
+func (f *FakeDatabase) Update(entity Entity) (Entity, error) {
+	if err := f.write(entity, func(exists bool) error {
+		if !exists {
+			return fmt.Errorf("no row affected when executing update operation")
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	f.publishChange(UpdateEntity, entity)
+	return entity, nil
+}
+
+// Upsert Update entity or insert it if it does not exist
+func (f *FakeDatabase) Upsert(entity Entity) (Entity, error) {
+	if err := f.write(entity, nil); err != nil {
+		return nil, err
+	}
+	f.publishChange(UpdateEntity, entity)
+	return entity, nil
+}
+
+// Delete entity by id
+func (f *FakeDatabase) Delete(factory EntityFactory, entityID string, keys ...string) error {
+	deleted, err := f.Get(factory, entityID, keys...)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	delete(f.tables[f.tableName(factory().TABLE(), keys...)], entityID)
+	f.mu.Unlock()
+
+	f.publishChange(DeleteEntity, deleted)
+	return nil
+}
+
+// BulkInsert Insert multiple entities (all or nothing)
+func (f *FakeDatabase) BulkInsert(entities []Entity) (int64, error) {
+	for _, entity := range entities {
+		if exists, _ := f.Exists(entityFactoryOf(entity), entity.ID(), entity.KEY()); exists {
+			return 0, fmt.Errorf("duplicate entry '%s' for key 'PRIMARY'", entity.ID())
+		}
+	}
+	for _, entity := range entities {
+		if _, err := f.Insert(entity); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(entities)), nil
+}
+
+// BulkUpdate Update multiple entities
+func (f *FakeDatabase) BulkUpdate(entities []Entity) (affected int64, err error) {
+	for _, entity := range entities {
+		if _, err = f.Update(entity); err != nil {
+			return
+		}
+		affected++
+	}
+	return
+}
+
+// BulkUpsert Upsert multiple entities
+func (f *FakeDatabase) BulkUpsert(entities []Entity) (affected int64, err error) {
+	for _, entity := range entities {
+		if _, err = f.Upsert(entity); err != nil {
+			return
+		}
+		affected++
+	}
+	return
+}
+
+// BulkDelete Delete multiple entities (ids which do not exist are ignored)
+func (f *FakeDatabase) BulkDelete(factory EntityFactory, entityIDs []string, keys ...string) (affected int64, err error) {
+	for _, id := range entityIDs {
+		if f.Delete(factory, id, keys...) == nil {
+			affected++
+		}
+	}
+	return
+}
+
+// SetField Update single field of the document
+func (f *FakeDatabase) SetField(factory EntityFactory, entityID string, field string, value any, keys ...string) error {
+	return f.SetFields(factory, entityID, map[string]any{field: value}, keys...)
+}
+
+// SetFields Update some fields of the document
+func (f *FakeDatabase) SetFields(factory EntityFactory, entityID string, fields map[string]any, keys ...string) error {
+	for field := range fields {
+		if err := validateFields(field); err != nil {
+			return err
+		}
+	}
+
+	entity, err := f.Get(factory, entityID, keys...)
+	if err != nil {
+		return err
+	}
+	if entity, err = fakeSetFields(factory, entity, fields); err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	err = f.put(f.tableName(factory().TABLE(), keys...), entity)
+	f.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	f.publishChange(UpdateEntity, entity)
+	return nil
+}
+
+// BulkSetFields Update specific field of multiple entities (values is a map of entityId -> field value)
+func (f *FakeDatabase) BulkSetFields(factory EntityFactory, field string, values map[string]any, keys ...string) (affected int64, err error) {
+	for id, value := range values {
+		if exists, _ := f.Exists(factory, id, keys...); !exists {
+			continue
+		}
+		if err = f.SetField(factory, id, field, value, keys...); err != nil {
+			return
+		}
+		affected++
+	}
+	return
+}
+
+// Query is a builder method to construct query
+func (f *FakeDatabase) Query(factory EntityFactory) database.IQuery {
+	return &fakeQuery{db: f, factory: factory}
+}
+
+// endregion
+
+// region DDL and raw SQL methods --------------------------------------------------------------------------------------
+
+// ExecuteDDL create the tables (the indexed fields are recorded)
+func (f *FakeDatabase) ExecuteDDL(ddl map[string][]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for table, fields := range ddl {
+		if err := validateFields(fields...); err != nil {
+			return err
+		}
+		if _, ok := f.tables[table]; !ok {
+			f.tables[table] = make(map[string][]byte)
+		}
+		f.ddl[table] = fields
+	}
+	return nil
+}
+
+// ExecuteSQL records the raw SQL command (it is not executed)
+func (f *FakeDatabase) ExecuteSQL(sql string, args ...any) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sqlLog = append(f.sqlLog, sql)
+	return 0, nil
+}
+
+// ExecuteQuery records the raw SQL query and returns the rows of the query handler (empty if not set)
+func (f *FakeDatabase) ExecuteQuery(source, sql string, args ...any) ([]Json, error) {
+	f.mu.Lock()
+	f.sqlLog = append(f.sqlLog, sql)
+	handler := f.rows
+	f.mu.Unlock()
+
+	if handler == nil {
+		return make([]Json, 0), nil
+	}
+	return handler(sql, args...)
+}
+
+// DropTable Drop table
+func (f *FakeDatabase) DropTable(table string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.tables, table)
+	delete(f.ddl, table)
+	return nil
+}
+
+// PurgeTable Delete table content
+func (f *FakeDatabase) PurgeTable(table string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.tables[table]; ok {
+		f.tables[table] = make(map[string][]byte)
+	}
+	return nil
+}
+
+// endregion
+
+// region Fake database helpers ----------------------------------------------------------------------------------------
+
+// tableName resolve the physical table name of the template (same rules of the default table name resolver)
+func (f *FakeDatabase) tableName(template string, keys ...string) string {
+	if at, rest, ok := splitReferenceTime(keys...); ok {
+		return resolveTableName(template, at, rest...)
+	}
+	return resolveTableName(template, f.clock(), keys...)
+}
+
+// write store the entity, the check function validates the write by the entity existence
+func (f *FakeDatabase) write(entity Entity, check func(exists bool) error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table := f.tableName(entity.TABLE(), entity.KEY())
+	if check != nil {
+		_, exists := f.tables[table][entity.ID()]
+		if err := check(exists); err != nil {
+			return err
+		}
+	}
+	return f.put(table, entity)
+}
+
+// put store the entity Json document in the table (the caller must hold the lock)
+func (f *FakeDatabase) put(table string, entity Entity) error {
+	data, err := Marshal(entity)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.tables[table]; !ok {
+		f.tables[table] = make(map[string][]byte)
+	}
+	f.tables[table][entity.ID()] = data
+	return nil
+}
+
+// documents returns the documents of the entity table (sorted by id, for deterministic results)
+func (f *FakeDatabase) documents(template string, keys ...string) (ids []string, docs [][]byte) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	rows := f.tables[f.tableName(template, keys...)]
+	ids = make([]string, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	docs = make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		docs = append(docs, rows[id])
+	}
+	return ids, docs
+}
+
+// publishChange publish the entity change to the message bus
+func (f *FakeDatabase) publishChange(action EntityAction, entity Entity) {
+	if f.bus == nil || entity == nil {
+		return
+	}
+	if err := f.bus.Publish(entityMessage(action, entity)); err != nil {
+		f.logger.Warn("error publishing change: %s", err.Error())
+	}
+}
+
+// fakeDecode convert Json document to entity
+func fakeDecode(factory EntityFactory, data []byte) (Entity, error) {
+	entity := factory()
+	if err := Unmarshal(data, &entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// fakeSetFields returns copy of the entity with the fields set
+func fakeSetFields(factory EntityFactory, entity Entity, fields map[string]any) (Entity, error) {
+	data, err := Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]any)
+	if err = Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	for field, value := range fields {
+		doc[field] = value
+	}
+	if data, err = Marshal(doc); err != nil {
+		return nil, err
+	}
+	return fakeDecode(factory, data)
+}
+
+// entityFactoryOf returns factory creating entities of the same table template and key as the entity
+func entityFactoryOf(entity Entity) EntityFactory {
+	return func() Entity { return entity }
+}
+
+// fakeField returns the value of the (dot separated) field in the document
+func fakeField(doc map[string]any, field string) (any, bool) {
+	var current any = doc
+	for _, part := range strings.Split(field, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// endregion
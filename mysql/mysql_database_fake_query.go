@@ -0,0 +1,594 @@
+package mysql
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Fake query definitions ---------------------------------------------------------------------------------------
+
+// fakeQuery is the in-memory implementation of the query builder, evaluating the filters on the Json documents
+type fakeQuery struct {
+	db         *FakeDatabase            // The fake database
+	factory    EntityFactory            // The entity factory method
+	allFilters [][]database.QueryFilter // List of lists of AND filters
+	anyFilters [][]database.QueryFilter // List of lists of OR filters
+	orders     []fakeOrder              // List of sort orders
+	callbacks  []func(in Entity) Entity // List of entity transformation callback functions
+	page       int                      // Page number (for pagination)
+	limit      int                      // Page size (for pagination)
+	rangeField string                   // Field name for range filter
+	rangeFrom  Timestamp                // Start timestamp for range filter
+	rangeTo    Timestamp                // End timestamp for range filter
+}
+
+// fakeOrder is a single sort order
+type fakeOrder struct {
+	field string
+	desc  bool
+}
+
+// fakeMatch is a single document matching the query
+type fakeMatch struct {
+	id  string
+	doc map[string]any
+	raw []byte
+}
+
+// endregion
+
+// region Fake query construction methods ------------------------------------------------------------------------------
+
+// Apply adds a callback to apply on each result entity in the query
+func (q *fakeQuery) Apply(cb func(in Entity) Entity) database.IQuery {
+	if cb != nil {
+		q.callbacks = append(q.callbacks, cb)
+	}
+	return q
+}
+
+// Filter Add single field filter
+func (q *fakeQuery) Filter(filter database.QueryFilter) database.IQuery {
+	if filter.IsActive() {
+		q.allFilters = append(q.allFilters, []database.QueryFilter{filter})
+	}
+	return q
+}
+
+// Range add time frame filter on specific time field
+func (q *fakeQuery) Range(field string, from Timestamp, to Timestamp) database.IQuery {
+	q.rangeField, q.rangeFrom, q.rangeTo = field, from, to
+	return q
+}
+
+// MatchAll Add list of filters, all of them should be satisfied (AND)
+func (q *fakeQuery) MatchAll(filters ...database.QueryFilter) database.IQuery {
+	list := make([]database.QueryFilter, 0)
+	for _, filter := range filters {
+		if filter.IsActive() {
+			list = append(list, filter)
+		}
+	}
+	q.allFilters = append(q.allFilters, list)
+	return q
+}
+
+// MatchAny Add list of filters, any of them should be satisfied (OR)
+func (q *fakeQuery) MatchAny(filters ...database.QueryFilter) database.IQuery {
+	list := make([]database.QueryFilter, 0)
+	for _, filter := range filters {
+		if filter.IsActive() {
+			list = append(list, filter)
+		}
+	}
+	q.anyFilters = append(q.anyFilters, list)
+	return q
+}
+
+// Sort Add sort order by field: field_name (Ascending) or field_name- (Descending)
+func (q *fakeQuery) Sort(sort string) database.IQuery {
+	switch {
+	case sort == "":
+	case strings.HasSuffix(sort, "-"):
+		q.orders = append(q.orders, fakeOrder{field: sort[:len(sort)-1], desc: true})
+	case strings.HasSuffix(sort, "+"):
+		q.orders = append(q.orders, fakeOrder{field: sort[:len(sort)-1]})
+	default:
+		q.orders = append(q.orders, fakeOrder{field: sort})
+	}
+	return q
+}
+
+// Limit Set page size limit (for pagination)
+func (q *fakeQuery) Limit(limit int) database.IQuery {
+	q.limit = limit
+	return q
+}
+
+// Page Set page number (for pagination)
+func (q *fakeQuery) Page(page int) database.IQuery {
+	q.page = page
+	return q
+}
+
+// endregion
+
+// region Fake query execution methods ---------------------------------------------------------------------------------
+
+// List Execute a query to get list of entities by IDs (the criteria is ignored)
+func (q *fakeQuery) List(entityIDs []string, keys ...string) (out []Entity, err error) {
+	list, err := q.db.List(q.factory, entityIDs, keys...)
+	if err != nil {
+		return nil, err
+	}
+	return q.transform(list), nil
+}
+
+// Find Execute query based on the criteria, order and pagination
+func (q *fakeQuery) Find(keys ...string) (out []Entity, total int64, err error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+	total = int64(len(matches))
+
+	list := make([]Entity, 0)
+	for _, m := range q.paginate(matches) {
+		entity, er := fakeDecode(q.factory, m.raw)
+		if er != nil {
+			return nil, 0, er
+		}
+		list = append(list, entity)
+	}
+	return q.transform(list), total, nil
+}
+
+// Select is similar to find but with ability to retrieve specific fields
+func (q *fakeQuery) Select(fields ...string) ([]Json, error) {
+	matches, err := q.match()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Json, 0)
+	for _, m := range q.paginate(matches) {
+		entry := Json{"id": m.id}
+		if len(fields) > 0 {
+			entry = Json{}
+			for _, field := range fields {
+				entry[field], _ = fakeField(m.doc, field)
+			}
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// Count Execute the query based on the criteria and return only the count of matching rows
+func (q *fakeQuery) Count(keys ...string) (int64, error) {
+	matches, err := q.match(keys...)
+	return int64(len(matches)), err
+}
+
+// Aggregation Execute the query based on the criteria and return the aggregation function on the field
+func (q *fakeQuery) Aggregation(field string, function database.AggFunc, keys ...string) (float64, error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return 0, err
+	}
+	_, value := fakeAggregate(matches, field, function)
+	return value, nil
+}
+
+// GroupCount Execute the query based on the criteria, grouped by field and return count per group
+func (q *fakeQuery) GroupCount(field string, keys ...string) (out map[any]int64, total int64, err error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+	out = make(map[any]int64)
+	for _, m := range matches {
+		value, _ := fakeField(m.doc, field)
+		out[fakeGroupKey(value)]++
+		total++
+	}
+	return out, total, nil
+}
+
+// GroupAggregation Execute the query based on the criteria and return the aggregated value per group
+func (q *fakeQuery) GroupAggregation(field string, function database.AggFunc, keys ...string) (out map[any]Tuple[int64, float64], total float64, err error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+	groups := make(map[any][]fakeMatch)
+	for _, m := range matches {
+		value, _ := fakeField(m.doc, field)
+		key := fakeGroupKey(value)
+		groups[key] = append(groups[key], m)
+	}
+
+	out = make(map[any]Tuple[int64, float64])
+	for key, group := range groups {
+		count, value := fakeAggregate(group, field, function)
+		out[key] = Tuple[int64, float64]{Key: count, Value: value}
+		total += value
+	}
+	return out, total, nil
+}
+
+// Histogram returns a time series data points based on the time field
+func (q *fakeQuery) Histogram(field string, function database.AggFunc, timeField string, interval time.Duration, keys ...string) (out map[Timestamp]Tuple[int64, float64], total float64, err error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	buckets := fakeBuckets(matches, timeField, interval)
+	out = make(map[Timestamp]Tuple[int64, float64])
+	for ts, bucket := range buckets {
+		count, value := fakeAggregate(bucket, field, function)
+		out[ts] = Tuple[int64, float64]{Key: count, Value: value}
+		total += value
+	}
+	return out, total, nil
+}
+
+// Histogram2D returns a two-dimensional time series data points based on the time field
+func (q *fakeQuery) Histogram2D(field string, function database.AggFunc, dim, timeField string, interval time.Duration, keys ...string) (out map[Timestamp]map[any]Tuple[int64, float64], total float64, err error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out = make(map[Timestamp]map[any]Tuple[int64, float64])
+	for ts, bucket := range fakeBuckets(matches, timeField, interval) {
+		groups := make(map[any][]fakeMatch)
+		for _, m := range bucket {
+			value, _ := fakeField(m.doc, dim)
+			key := fakeGroupKey(value)
+			groups[key] = append(groups[key], m)
+		}
+		out[ts] = make(map[any]Tuple[int64, float64])
+		for key, group := range groups {
+			count, value := fakeAggregate(group, field, function)
+			out[ts][key] = Tuple[int64, float64]{Key: count, Value: value}
+			total += value
+		}
+	}
+	return out, total, nil
+}
+
+// FindSingle Execute query based on the criteria to get the first result
+func (q *fakeQuery) FindSingle(keys ...string) (Entity, error) {
+	list, _, err := q.Find(keys...)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("not found")
+	}
+	return list[0], nil
+}
+
+// GetMap Execute query based on the criteria, order and pagination and return the results as a map of id->Entity
+func (q *fakeQuery) GetMap(keys ...string) (map[string]Entity, error) {
+	list, _, err := q.Find(keys...)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]Entity, len(list))
+	for _, entity := range list {
+		out[entity.ID()] = entity
+	}
+	return out, nil
+}
+
+// GetIDs Execute query based on the criteria, order and pagination and return the list of Ids
+func (q *fakeQuery) GetIDs(keys ...string) ([]string, error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(matches))
+	for _, m := range q.paginate(matches) {
+		out = append(out, m.id)
+	}
+	return out, nil
+}
+
+// Delete the entities satisfying the criteria
+func (q *fakeQuery) Delete(keys ...string) (int64, error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, m.id)
+	}
+	return q.db.BulkDelete(q.factory, ids, keys...)
+}
+
+// SetField Update single field of all the documents meeting the criteria
+func (q *fakeQuery) SetField(field string, value any, keys ...string) (int64, error) {
+	return q.SetFields(map[string]any{field: value}, keys...)
+}
+
+// SetFields Update multiple fields of all the documents meeting the criteria
+func (q *fakeQuery) SetFields(fields map[string]any, keys ...string) (total int64, err error) {
+	matches, err := q.match(keys...)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range matches {
+		if err = q.db.SetFields(q.factory, m.id, fields, keys...); err != nil {
+			return
+		}
+		total++
+	}
+	return
+}
+
+// ToString Get the string representation of the query
+func (q *fakeQuery) ToString() string {
+	parts := make([]string, 0)
+	for _, list := range q.allFilters {
+		for _, f := range list {
+			parts = append(parts, fmt.Sprintf("%s %s %v", f.GetField(), f.GetOperator(), f.GetValues()))
+		}
+	}
+	for _, list := range q.anyFilters {
+		or := make([]string, 0)
+		for _, f := range list {
+			or = append(or, fmt.Sprintf("%s %s %v", f.GetField(), f.GetOperator(), f.GetValues()))
+		}
+		parts = append(parts, fmt.Sprintf("(%s)", strings.Join(or, " OR ")))
+	}
+	return fmt.Sprintf("%s WHERE %s", q.factory().TABLE(), strings.Join(parts, " AND "))
+}
+
+// endregion
+
+// region Fake query helpers -------------------------------------------------------------------------------------------
+
+// match returns the sorted documents matching the criteria
+func (q *fakeQuery) match(keys ...string) ([]fakeMatch, error) {
+	ids, docs := q.db.documents(q.factory().TABLE(), keys...)
+
+	result := make([]fakeMatch, 0)
+	for i, raw := range docs {
+		doc := make(map[string]any)
+		if err := Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		doc["id"] = ids[i]
+		if q.matches(doc) {
+			result = append(result, fakeMatch{id: ids[i], doc: doc, raw: raw})
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		for _, o := range q.orders {
+			a, _ := fakeField(result[i].doc, o.field)
+			b, _ := fakeField(result[j].doc, o.field)
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != o.desc
+			}
+		}
+		return false
+	})
+	return result, nil
+}
+
+// matches check if the document satisfies all the criteria
+func (q *fakeQuery) matches(doc map[string]any) bool {
+	for _, list := range q.allFilters {
+		for _, filter := range list {
+			if !fakeTest(doc, filter) {
+				return false
+			}
+		}
+	}
+	for _, list := range q.anyFilters {
+		if len(list) == 0 {
+			continue
+		}
+		matched := false
+		for _, filter := range list {
+			if fakeTest(doc, filter) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if q.rangeField != "" {
+		return fakeTest(doc, database.F(q.rangeField).Between(q.rangeFrom, q.rangeTo))
+	}
+	return true
+}
+
+// paginate returns the page of the matches
+func (q *fakeQuery) paginate(list []fakeMatch) []fakeMatch {
+	if q.limit <= 0 {
+		return list
+	}
+	offset := 0
+	if q.page > 1 {
+		offset = (q.page - 1) * q.limit
+	}
+	if offset >= len(list) {
+		return nil
+	}
+	return list[offset:int(math.Min(float64(offset+q.limit), float64(len(list))))]
+}
+
+// transform the entities through the chain of callbacks
+func (q *fakeQuery) transform(list []Entity) []Entity {
+	out := make([]Entity, 0, len(list))
+	for _, entity := range list {
+		for _, cb := range q.callbacks {
+			if entity = cb(entity); entity == nil {
+				break
+			}
+		}
+		if entity != nil {
+			out = append(out, entity)
+		}
+	}
+	return out
+}
+
+// fakeTest check if the document satisfies the filter (same semantic of the SQL filters)
+func fakeTest(doc map[string]any, filter database.QueryFilter) bool {
+	values := filter.GetValues()
+	if len(values) == 0 {
+		return true
+	}
+	value, exists := fakeField(doc, filter.GetField())
+
+	switch filter.GetOperator() {
+	case database.Neq:
+		return exists && compareValues(value, values[0]) != 0
+	case database.Gt:
+		return exists && compareValues(value, values[0]) > 0
+	case database.Gte:
+		return exists && compareValues(value, values[0]) >= 0
+	case database.Lt:
+		return exists && compareValues(value, values[0]) < 0
+	case database.Lte:
+		return exists && compareValues(value, values[0]) <= 0
+	case database.Between:
+		return exists && len(values) > 1 && compareValues(value, values[0]) >= 0 && compareValues(value, values[1]) <= 0
+	case database.Like:
+		for _, v := range values {
+			if fakeLike(fmt.Sprintf("%v", value), fmt.Sprintf("%v", v)) {
+				return exists
+			}
+		}
+		return false
+	case database.In, database.NotIn:
+		found := false
+		for _, v := range fakeFlatten(values) {
+			if compareValues(value, v) == 0 {
+				found = true
+				break
+			}
+		}
+		return exists && found == (filter.GetOperator() == database.In)
+	case database.Contains:
+		items, ok := value.([]any)
+		if !ok {
+			return false
+		}
+		for _, item := range items {
+			if compareValues(item, values[0]) == 0 {
+				return true
+			}
+		}
+		return false
+	default:
+		return exists && compareValues(value, values[0]) == 0
+	}
+}
+
+// fakeLike check if the value matches the (case-insensitive) LIKE pattern, using the same wildcards of the SQL filter
+func fakeLike(value, pattern string) bool {
+	expr := regexp.QuoteMeta(strings.ToLower(parseWildcards(pattern)))
+	expr = strings.ReplaceAll(strings.ReplaceAll(expr, "%", ".*"), "_", ".")
+	matched, _ := regexp.MatchString("^"+expr+"$", strings.ToLower(value))
+	return matched
+}
+
+// fakeFlatten flatten the slice values of the IN filter
+func fakeFlatten(values []any) []any {
+	result := make([]any, 0, len(values))
+	for _, v := range values {
+		switch list := v.(type) {
+		case []any:
+			result = append(result, list...)
+		case []string:
+			for _, s := range list {
+				result = append(result, s)
+			}
+		case []int:
+			for _, n := range list {
+				result = append(result, n)
+			}
+		default:
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// fakeAggregate calculate the aggregation function on the field of the documents
+func fakeAggregate(matches []fakeMatch, field string, function database.AggFunc) (count int64, value float64) {
+	values := make([]float64, 0, len(matches))
+	for _, m := range matches {
+		count++
+		if v, ok := fakeField(m.doc, field); ok {
+			if n, isNumber := v.(float64); isNumber {
+				values = append(values, n)
+			}
+		}
+	}
+
+	switch function {
+	case database.COUNT:
+		return count, float64(count)
+	case database.SUM, database.AVG:
+		for _, v := range values {
+			value += v
+		}
+		if function == database.AVG && len(values) > 0 {
+			value /= float64(len(values))
+		}
+	case database.MIN, database.MAX:
+		for i, v := range values {
+			if i == 0 || (function == database.MIN && v < value) || (function == database.MAX && v > value) {
+				value = v
+			}
+		}
+	}
+	return count, value
+}
+
+// fakeBuckets split the documents to time buckets of the time field
+func fakeBuckets(matches []fakeMatch, timeField string, interval time.Duration) map[Timestamp][]fakeMatch {
+	step := interval.Milliseconds()
+	if step <= 0 {
+		step = 1
+	}
+	buckets := make(map[Timestamp][]fakeMatch)
+	for _, m := range matches {
+		v, _ := fakeField(m.doc, timeField)
+		ts, ok := v.(float64)
+		if !ok {
+			continue
+		}
+		bucket := Timestamp(int64(ts) / step * step)
+		buckets[bucket] = append(buckets[bucket], m)
+	}
+	return buckets
+}
+
+// fakeGroupKey normalize the group value (Json numbers are float64)
+func fakeGroupKey(value any) any {
+	if n, ok := value.(float64); ok && n == math.Trunc(n) {
+		return int64(n)
+	}
+	return value
+}
+
+// endregion
@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// region Fixtures definitions -----------------------------------------------------------------------------------------
+
+// Fixture is a set of entities of a single table, the fixture file (JSON or YAML) contains a single fixture or a list
+// of fixtures, for example:
+//
+//	table: event-{{accountId}}
+//	key: acme
+//	entities:
+//	  - id: "1"
+//	    name: first
+type Fixture struct {
+	Table    string           `json:"table" yaml:"table"`       // The entity table (or table template)
+	Key      string           `json:"key" yaml:"key"`           // The shard key used to resolve the table template (optional)
+	Entities []map[string]any `json:"entities" yaml:"entities"` // The entities Json documents (each must have an id)
+}
+
+// endregion
+
+// region Fixtures methods ---------------------------------------------------------------------------------------------
+
+// LoadFixtures read the fixture files (.json, .yaml or .yml) matching the glob pattern and upsert their entities,
+// every file is loaded in a single transaction. Field and document encryption configured for the table template are
+// applied, but changes are not published.
+//
+// param: fsys - The file system (e.g. os.DirFS("testdata") or embed.FS)
+// param: pattern - Glob pattern of the fixture files (e.g. "fixtures/*.yaml")
+// return: Number of upserted entities, error
+func (dbs *MySqlDatabase) LoadFixtures(fsys fs.FS, pattern string) (affected int64, err error) {
+
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(files)
+
+	defer dbs.observe("load_fixtures", "", len(files), time.Now(), &affected, &err)
+
+	for _, file := range files {
+		fixtures, er := readFixtures(fsys, file)
+		if er != nil {
+			return affected, fmt.Errorf("fixture %s: %s", file, er.Error())
+		}
+		count, er := dbs.loadFixtures(fixtures)
+		if er != nil {
+			return affected, fmt.Errorf("fixture %s: %s", file, er.Error())
+		}
+		affected += count
+	}
+	return affected, nil
+}
+
+// loadFixtures upsert the entities of the fixtures in a single transaction
+func (dbs *MySqlDatabase) loadFixtures(fixtures []Fixture) (affected int64, err error) {
+	var tx *sql.Tx
+	if tx, err = dbs.pgDb.Begin(); err != nil {
+		return
+	}
+
+	for _, fixture := range fixtures {
+		table, er := dbs.resolveTable(fixture.Table, fixture.Key)
+		if er != nil {
+			_ = tx.Rollback()
+			return 0, er
+		}
+		SQL := fmt.Sprintf(sqlUpsert, table)
+
+		for _, doc := range fixture.Entities {
+			id, ok := doc["id"].(string)
+			if !ok || id == "" {
+				_ = tx.Rollback()
+				return 0, fmt.Errorf("entity of table %s has no string id", fixture.Table)
+			}
+			data, er := json.Marshal(doc)
+			if er == nil {
+				data, er = dbs.encode(fixture.Table, table, data)
+			}
+			if er != nil {
+				_ = tx.Rollback()
+				return 0, er
+			}
+			if _, err = dbs.exec(tx, table, fixture.Key, SQL, id, data); err != nil {
+				_ = tx.Rollback()
+				return 0, err
+			}
+			affected++
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return affected, nil
+}
+
+// readFixtures parse the fixture file (single fixture or list of fixtures)
+func readFixtures(fsys fs.FS, file string) ([]Fixture, error) {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	var unmarshal func([]byte, any) error
+	switch strings.ToLower(path.Ext(file)) {
+	case ".json":
+		unmarshal = json.Unmarshal
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	default:
+		return nil, fmt.Errorf("unsupported fixture file type")
+	}
+
+	list := make([]Fixture, 0)
+	if err = unmarshal(data, &list); err != nil {
+		single := Fixture{}
+		if er := unmarshal(data, &single); er != nil {
+			return nil, er
+		}
+		list = append(list, single)
+	}
+
+	for _, fixture := range list {
+		if fixture.Table == "" {
+			return nil, fmt.Errorf("fixture has no table")
+		}
+	}
+	return list, nil
+}
+
+// endregion
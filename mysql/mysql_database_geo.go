@@ -0,0 +1,215 @@
+package mysql
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Geo fields definitions ---------------------------------------------------------------------------------------
+
+// GeoField describes a location of the entity (latitude and longitude fields) which is materialized as a generated
+// POINT column (SRID 4326) with a SPATIAL index, used by the geo filters of the query builder
+type GeoField struct {
+	Column string // The generated POINT column name (e.g. location)
+	Lat    string // The entity (json) latitude field
+	Lng    string // The entity (json) longitude field
+}
+
+// geoFilter is a geo filter of the query: bounding box, optionally narrowed to radius from the center
+type geoFilter struct {
+	column string   // The POINT column
+	boxes  []string // The bounding box polygons (WKT), two boxes for box crossing the antimeridian
+	lat    float64  // The center latitude (radius filter and distance order)
+	lng    float64  // The center longitude (radius filter and distance order)
+	radius float64  // The radius in meters (zero for bounding box filter)
+}
+
+const (
+	// Missing coordinates are stored as (0, 0) since SPATIAL index requires NOT NULL column, the axis order of
+	// SRID 4326 is latitude first
+	ddlAddGeoColumn = `ADD COLUMN "%s" POINT GENERATED ALWAYS AS (ST_SRID(POINT(` +
+		"COALESCE(CAST(JSON_EXTRACT(data, '$.%s') AS DOUBLE), 0), COALESCE(CAST(JSON_EXTRACT(data, '$.%s') AS DOUBLE), 0)), 4326)) " +
+		"STORED NOT NULL SRID 4326"
+	ddlAddSpatialIndex = `ADD SPATIAL INDEX "%s_%s_geo_idx" ("%s")`
+
+	sqlGeoWithin   = `MBRContains(ST_GeomFromText($%d, 4326), "%s")`
+	sqlGeoDistance = `ST_Distance_Sphere("%s", ST_SRID(POINT(%s, %s), 4326))`
+
+	// metersPerDegree is the length of one degree of latitude
+	metersPerDegree = 111320.0
+)
+
+// boxPolygon returns the WKT polygon of the bounding box (latitude first)
+func boxPolygon(minLat, minLng, maxLat, maxLng float64) string {
+	return fmt.Sprintf("POLYGON((%[1]g %[2]g, %[3]g %[2]g, %[3]g %[4]g, %[1]g %[4]g, %[1]g %[2]g))", minLat, minLng, maxLat, maxLng)
+}
+
+// boxPolygons returns the WKT polygons of the bounding box, box crossing the antimeridian (min longitude greater than
+// max longitude) is split to the boxes of its east and west sides
+func boxPolygons(minLat, minLng, maxLat, maxLng float64) []string {
+	if minLng <= maxLng {
+		return []string{boxPolygon(minLat, minLng, maxLat, maxLng)}
+	}
+	return []string{boxPolygon(minLat, minLng, maxLat, 180), boxPolygon(minLat, -180, maxLat, maxLng)}
+}
+
+// radiusBox returns the bounding boxes of the radius around the center (split when crossing the antimeridian)
+func radiusBox(lat, lng, meters float64) []string {
+	dLat := meters / metersPerDegree
+	dLng := 180.0
+	if cos := math.Cos(lat * math.Pi / 180); cos > 1e-6 {
+		dLng = math.Min(dLng, meters/(metersPerDegree*cos))
+	}
+	minLat, maxLat := math.Max(lat-dLat, -90), math.Min(lat+dLat, 90)
+
+	switch {
+	case dLng >= 180:
+		return boxPolygons(minLat, -180, maxLat, 180)
+	case lng-dLng < -180:
+		return boxPolygons(minLat, lng-dLng+360, maxLat, lng+dLng)
+	case lng+dLng > 180:
+		return boxPolygons(minLat, lng-dLng, maxLat, lng+dLng-360)
+	default:
+		return boxPolygons(minLat, lng-dLng, maxLat, lng+dLng)
+	}
+}
+
+// endregion
+
+// region Geo fields methods -------------------------------------------------------------------------------------------
+
+// SetGeoFields register the geo fields of the entity, the columns are created by CreatePromotedColumns (and with the
+// promoted columns of new rollover and tenant tables)
+//
+// param: factory - Entity factory
+// param: fields - List of geo fields
+func (dbs *MySqlDatabase) SetGeoFields(factory EntityFactory, fields ...GeoField) error {
+	for _, field := range fields {
+		if err := validateFields(field.Column, field.Lat, field.Lng); err != nil {
+			return err
+		}
+	}
+
+	template := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.geo == nil {
+		dbs.geo = make(map[string]map[string]GeoField)
+	}
+	if _, ok := dbs.geo[template]; !ok {
+		dbs.geo[template] = make(map[string]GeoField)
+	}
+	for _, field := range fields {
+		dbs.geo[template][field.Column] = field
+	}
+	return nil
+}
+
+// createGeoColumns create the POINT columns and SPATIAL indexes of the geo fields of the template in the physical table
+func (dbs *MySqlDatabase) createGeoColumns(template, table string) (err error) {
+
+	dbs.mu.RLock()
+	fields := make([]GeoField, 0, len(dbs.geo[template]))
+	for _, field := range dbs.geo[template] {
+		fields = append(fields, field)
+	}
+	dbs.mu.RUnlock()
+
+	for _, field := range fields {
+		var count int
+		if err = dbs.scalar(table, sqlColumnExists, schemaArgs(table, field.Column), &count); err != nil {
+			return
+		}
+		if count > 0 {
+			continue
+		}
+
+		alter := fmt.Sprintf(ddlAddGeoColumn, field.Column, field.Lat, field.Lng)
+		alter = fmt.Sprintf("%s, %s", alter, fmt.Sprintf(ddlAddSpatialIndex, baseName(table), field.Column, field.Column))
+		if err = dbs.AlterTable(table, alter); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// endregion
+
+// region Geo query methods --------------------------------------------------------------------------------------------
+
+// WithinRadius filter entities located within the radius (in meters) from the center, the column must be registered
+// by SetGeoFields
+func (s *mSqlDatabaseQuery) WithinRadius(column string, lat, lng, meters float64) IMySqlQuery {
+	s.geoFilters = append(s.geoFilters, geoFilter{column: column, boxes: radiusBox(lat, lng, meters), lat: lat, lng: lng, radius: meters})
+	return s
+}
+
+// WithinBox filter entities located within the bounding box (min longitude greater than max longitude for box crossing
+// the antimeridian), the column must be registered by SetGeoFields
+func (s *mSqlDatabaseQuery) WithinBox(column string, minLat, minLng, maxLat, maxLng float64) IMySqlQuery {
+	s.geoFilters = append(s.geoFilters, geoFilter{column: column, boxes: boxPolygons(minLat, minLng, maxLat, maxLng)})
+	return s
+}
+
+// NearestFirst sort the results by the distance from the point (nearest first), the column must be registered by SetGeoFields
+func (s *mSqlDatabaseQuery) NearestFirst(column string, lat, lng float64) IMySqlQuery {
+	s.geoOrder = &geoFilter{column: column, lat: lat, lng: lng}
+	return s
+}
+
+// validateGeo check that the columns of the geo filters and order are registered geo fields of the entity
+func (s *mSqlDatabaseQuery) validateGeo() error {
+	filters := s.geoFilters
+	if s.geoOrder != nil {
+		filters = append(append([]geoFilter{}, filters...), *s.geoOrder)
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+
+	template := s.factory().TABLE()
+	s.db.mu.RLock()
+	defer s.db.mu.RUnlock()
+
+	for _, gf := range filters {
+		if _, ok := s.db.geo[template][gf.column]; !ok {
+			return fmt.Errorf("column %s is not a geo field of %s (see SetGeoFields)", gf.column, template)
+		}
+	}
+	return nil
+}
+
+// distanceExpr returns the sphere distance (in meters) of the column from the point
+func (s *mSqlDatabaseQuery) distanceExpr(column string, lat, lng float64) string {
+	return fmt.Sprintf(sqlGeoDistance, column, fmt.Sprint(lat), fmt.Sprint(lng))
+}
+
+// buildGeoCriteria build the geo filters conditions, the bounding box condition uses the SPATIAL index
+func (s *mSqlDatabaseQuery) buildGeoCriteria(varIndex int) (parts []string, args []any) {
+	for _, gf := range s.geoFilters {
+		within := make([]string, 0, len(gf.boxes))
+		for _, box := range gf.boxes {
+			within = append(within, fmt.Sprintf(sqlGeoWithin, varIndex, gf.column))
+			args = append(args, box)
+			varIndex++
+		}
+		part := within[0]
+		if len(within) > 1 {
+			part = fmt.Sprintf("(%s)", strings.Join(within, " OR "))
+		}
+		if gf.radius > 0 {
+			part = fmt.Sprintf("%s AND %s <= $%d", part, s.distanceExpr(gf.column, gf.lat, gf.lng), varIndex)
+			args = append(args, gf.radius)
+			varIndex++
+		}
+		parts = append(parts, part)
+	}
+	return
+}
+
+// endregion
@@ -0,0 +1,172 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var ddlStatementRegex = regexp.MustCompile(`(?i)^\s*(CREATE|ALTER|DROP|TRUNCATE|RENAME|GRANT|REVOKE)\b`)
+var limitClauseRegex = regexp.MustCompile(`(?i)\bLIMIT\s+(\d+|\?|\$\d+)(?:\s*,\s*(\d+|\?|\$\d+))?`)
+
+// region Statement guard definitions ----------------------------------------------------------------------------------
+
+// StatementGuard inspects the raw SQL passed to ExecuteSQL (query = false) and ExecuteQuery (query = true), it returns
+// the SQL to execute (possibly rewritten) or error to reject the statement
+type StatementGuard func(SQL string, query bool) (string, error)
+
+// StatementGuardOptions configures the built-in statement guard
+type StatementGuardOptions struct {
+	DenyDDL            bool // Reject DDL statements (CREATE, ALTER, DROP, TRUNCATE, RENAME, GRANT, REVOKE)
+	DenyMultiStatement bool // Reject multiple statements separated by semicolon
+	MaxLimit           int  // Enforce LIMIT on queries: append it when missing and reject larger limits (0 to disable)
+}
+
+// StatementDeniedError is returned when the statement is rejected by the statement guard
+type StatementDeniedError struct {
+	SQL    string // The rejected statement
+	Reason string // The reason of the rejection
+}
+
+// Error returns the error message
+func (e *StatementDeniedError) Error() string {
+	return fmt.Sprintf("statement denied: %s", e.Reason)
+}
+
+// endregion
+
+// region Statement guard methods --------------------------------------------------------------------------------------
+
+// SetStatementGuard set the policy inspecting the raw SQL passed to ExecuteSQL and ExecuteQuery, so these methods can
+// be exposed to plugins without opening full SQL access (nil to disable)
+//
+// param: guard - Statement guard (see NewStatementGuard for the built-in policy)
+func (dbs *MySqlDatabase) SetStatementGuard(guard StatementGuard) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.guard = guard
+}
+
+// NewStatementGuard create the built-in statement guard
+//
+// param: options - Statement guard options
+// return: Statement guard
+func NewStatementGuard(options StatementGuardOptions) StatementGuard {
+	return func(SQL string, query bool) (string, error) {
+		stripped := stripLiterals(SQL)
+
+		if options.DenyMultiStatement {
+			if idx := strings.Index(stripped, ";"); idx >= 0 && strings.TrimSpace(stripped[idx+1:]) != "" {
+				return "", &StatementDeniedError{SQL: SQL, Reason: "multiple statements are not allowed"}
+			}
+		}
+
+		if options.DenyDDL && ddlStatementRegex.MatchString(stripped) {
+			return "", &StatementDeniedError{SQL: SQL, Reason: "DDL statements are not allowed"}
+		}
+
+		if query && options.MaxLimit > 0 {
+			return enforceLimit(SQL, stripped, options.MaxLimit)
+		}
+		return SQL, nil
+	}
+}
+
+// guardStatement apply the statement guard on the raw SQL
+func (dbs *MySqlDatabase) guardStatement(SQL string, query bool) (string, error) {
+	dbs.mu.RLock()
+	guard := dbs.guard
+	dbs.mu.RUnlock()
+
+	if guard == nil {
+		return SQL, nil
+	}
+	return guard(SQL, query)
+}
+
+// enforceLimit append the LIMIT clause to the query if missing, or reject it if its limit exceeds the max limit
+// Only the LIMIT clause of the outer query counts (LIMIT of subqueries does not bound the result)
+func enforceLimit(SQL, stripped string, maxLimit int) (string, error) {
+	var match []string
+	for _, loc := range limitClauseRegex.FindAllStringSubmatchIndex(stripped, -1) {
+		if strings.Count(stripped[:loc[0]], "(") != strings.Count(stripped[:loc[0]], ")") {
+			continue
+		}
+		match = make([]string, 3)
+		for i := range match {
+			if loc[2*i] >= 0 {
+				match[i] = stripped[loc[2*i]:loc[2*i+1]]
+			}
+		}
+	}
+
+	if match == nil {
+		// The trailing comments and semicolons are dropped, so the appended clause is not commented out
+		end := len(strings.TrimRight(stripped, " \t\r\n;"))
+		return fmt.Sprintf("%s LIMIT %d", SQL[:end], maxLimit), nil
+	}
+
+	// LIMIT count or LIMIT offset, count
+	count := match[1]
+	if match[2] != "" {
+		count = match[2]
+	}
+	limit, err := strconv.Atoi(count)
+	if err != nil {
+		return "", &StatementDeniedError{SQL: SQL, Reason: "LIMIT must be a literal number"}
+	}
+	if limit > maxLimit {
+		return "", &StatementDeniedError{SQL: SQL, Reason: fmt.Sprintf("LIMIT %d exceeds the max limit %d", limit, maxLimit)}
+	}
+	return SQL, nil
+}
+
+// stripLiterals replace the quoted strings, quoted identifiers and comments of the statement with spaces, so the
+// statement structure can be inspected without being misled by their content. The content of MySQL executable comments
+// (/*! ... */) and optimizer hints (/*+ ... */) is executed by the server, so only their markers are replaced
+func stripLiterals(SQL string) string {
+	out := []byte(SQL)
+	for i := 0; i < len(out); i++ {
+		switch {
+		case out[i] == '\'' || out[i] == '"' || out[i] == '`':
+			quote := out[i]
+			for i++; i < len(out); i++ {
+				if out[i] == '\\' && quote != '`' && i+1 < len(out) {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					continue
+				}
+				if out[i] == quote {
+					break
+				}
+				out[i] = ' '
+			}
+		case out[i] == '#' || (out[i] == '-' && i+1 < len(out) && out[i+1] == '-'):
+			for ; i < len(out) && out[i] != '\n'; i++ {
+				out[i] = ' '
+			}
+		case out[i] == '/' && i+2 < len(out) && out[i+1] == '*' && (out[i+2] == '!' || out[i+2] == '+'):
+			out[i], out[i+1], out[i+2] = ' ', ' ', ' '
+			for i += 3; i < len(out) && out[i] >= '0' && out[i] <= '9'; i++ {
+				out[i] = ' '
+			}
+			if end := strings.Index(string(out[i:]), "*/"); end >= 0 {
+				out[i+end], out[i+end+1] = ' ', ' '
+			}
+			i--
+		case out[i] == '/' && i+1 < len(out) && out[i+1] == '*':
+			for ; i < len(out); i++ {
+				if out[i] == '*' && i+1 < len(out) && out[i+1] == '/' {
+					out[i], out[i+1] = ' ', ' '
+					i++
+					break
+				}
+				out[i] = ' '
+			}
+		}
+	}
+	return string(out)
+}
+
+// endregion
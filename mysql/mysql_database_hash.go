@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Content hash definitions -------------------------------------------------------------------------------------
+
+const (
+	sqlDocumentHash      = `SELECT SHA2(CAST(data AS CHAR), 256) FROM "%s" WHERE id = $1`
+	sqlUpdateIfUnchanged = `UPDATE "%s" SET data = $2 WHERE id = $1 AND SHA2(CAST(data AS CHAR), 256) = $3`
+)
+
+// endregion
+
+// region Content hash methods -----------------------------------------------------------------------------------------
+
+// DocumentHash returns the content hash of the stored entity document (SHA-256 hex of the stored Json), computed on the
+// server so it applies to existing data without version field
+//
+// param: factory - Entity factory
+// param: entityID - The entity id
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: The document hash, error
+func (dbs *MySqlDatabase) DocumentHash(factory EntityFactory, entityID string, keys ...string) (hash string, err error) {
+	template := factory().TABLE()
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("document_hash", template, 0, time.Now(), nil, &err)
+
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+	if err = dbs.scalar(table, fmt.Sprintf(sqlDocumentHash, table), []any{entityID}, &hash); errors.Is(err, sql.ErrNoRows) {
+		err = fmt.Errorf("no row fetched for id: %s", entityID)
+	}
+	return
+}
+
+// UpdateIfUnchanged update the entity only if the stored document hash matches the expected hash (see DocumentHash),
+// otherwise ConcurrentModificationError is returned (update with identical data succeeds). This is a lightweight alternative to the version field
+// (see SetVersionField) which does not require a field in the document
+//
+// param: entity - The entity to update
+// param: expectedHash - The hash of the document the entity was read from
+// return: Updated Entity, error
+func (dbs *MySqlDatabase) UpdateIfUnchanged(entity Entity, expectedHash string) (updated Entity, err error) {
+	defer dbs.throttle(entity.KEY())()
+	defer dbs.observe("update", entity.TABLE(), 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(entity.TABLE(), 1); err != nil {
+		return nil, err
+	}
+
+	table, err := dbs.resolveTable(entity.TABLE(), entity.KEY())
+	if err != nil {
+		return
+	}
+	data, err := dbs.marshal(entity, table)
+	if err != nil {
+		return
+	}
+
+	SQL := fmt.Sprintf(sqlUpdateIfUnchanged, table)
+	result, err := dbs.execAudited(AuditUpdate, entity.TABLE(), table, entity.KEY(), entity.ID(), entity, SQL, entity.ID(), data, expectedHash)
+	if err != nil {
+		return
+	}
+	if affected, er := result.RowsAffected(); er != nil {
+		return nil, er
+	} else if affected == 0 {
+		// without found rows, update of the expected document with identical data does not change the row
+		var stored, hash string
+		if er = dbs.scalar(table, fmt.Sprintf(sqlMergeRead, table), []any{entity.ID()}, &stored, &hash); errors.Is(er, sql.ErrNoRows) {
+			return nil, &NoRowsAffectedError{Operation: "update", Table: table, Id: entity.ID()}
+		} else if er != nil {
+			return nil, er
+		}
+		if hash != expectedHash {
+			return nil, &ConcurrentModificationError{Table: table, Id: entity.ID(), Hash: expectedHash}
+		}
+	}
+
+	dbs.publishChange(UpdateEntity, entity)
+	return entity, nil
+}
+
+// endregion
@@ -0,0 +1,270 @@
+package mysql
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Consistent hash resolver definitions -------------------------------------------------------------------------
+
+const virtualNodes = 100
+
+// ConsistentHashResolver is a table name resolver mapping arbitrary shard key to one of N fixed buckets using consistent hashing
+// The first shard key placeholder ({{0}} / {{accountId}}) is replaced by the bucket number, so template like event_{{accountId}}
+// is resolved to one of the tables event_00..event_NN. Changing the number of buckets moves only ~1/N of the keys
+type ConsistentHashResolver struct {
+	buckets int            // Number of buckets
+	ring    []uint32       // Sorted hash ring of the buckets virtual nodes
+	owners  map[uint32]int // Map of virtual node hash to bucket
+}
+
+// NewConsistentHashResolver factory method for consistent hash resolver
+//
+// param: buckets - Number of buckets (tables per template)
+// return: Consistent hash resolver
+func NewConsistentHashResolver(buckets int) *ConsistentHashResolver {
+	if buckets < 1 {
+		buckets = 1
+	}
+	r := &ConsistentHashResolver{
+		buckets: buckets,
+		ring:    make([]uint32, 0, buckets*virtualNodes),
+		owners:  make(map[uint32]int),
+	}
+	for bucket := 0; bucket < buckets; bucket++ {
+		for node := 0; node < virtualNodes; node++ {
+			h := hashKey(fmt.Sprintf("%d#%d", bucket, node))
+			if _, exists := r.owners[h]; exists {
+				continue
+			}
+			r.owners[h] = bucket
+			r.ring = append(r.ring, h)
+		}
+	}
+	sort.Slice(r.ring, func(i, j int) bool { return r.ring[i] < r.ring[j] })
+	return r
+}
+
+// BucketMove describes the entities of a single shard key to move between buckets tables
+type BucketMove struct {
+	Key    string   // The shard key
+	Source string   // The current table
+	Target string   // The new table
+	IDs    []string // List of entities IDs to move
+}
+
+// endregion
+
+// region Consistent hash resolver methods -----------------------------------------------------------------------------
+
+// Buckets returns the number of buckets
+func (r *ConsistentHashResolver) Buckets() int {
+	return r.buckets
+}
+
+// Bucket returns the bucket of the shard key
+func (r *ConsistentHashResolver) Bucket(key string) int {
+	h := hashKey(key)
+	idx := sort.Search(len(r.ring), func(i int) bool { return r.ring[i] >= h })
+	if idx == len(r.ring) {
+		idx = 0
+	}
+	return r.owners[r.ring[idx]]
+}
+
+// Resolve returns the physical table name
+func (r *ConsistentHashResolver) Resolve(template string, now time.Time, keys ...string) string {
+	if len(keys) == 0 || keys[0] == "" {
+		return resolveTableName(template, now, keys...)
+	}
+	resolved := append([]string{r.bucketName(r.Bucket(keys[0]))}, keys[1:]...)
+	return resolveTableName(template, now, resolved...)
+}
+
+// bucketName returns the zero padded bucket number (at least 2 digits)
+func (r *ConsistentHashResolver) bucketName(bucket int) string {
+	width := len(strconv.Itoa(r.buckets - 1))
+	if width < 2 {
+		width = 2
+	}
+	return fmt.Sprintf("%0*d", width, bucket)
+}
+
+// hashKey returns the 32 bits FNV-1a hash of the key
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// endregion
+
+// region Buckets rebalance methods ------------------------------------------------------------------------------------
+
+// PlanBuckets Scan the existing bucket tables of the entity and return the list of moves required to change the buckets count
+// The shard key of every entity is taken from the entity KEY() method
+//
+// param: factory - Entity factory
+// param: from - The current consistent hash resolver
+// param: to - The new consistent hash resolver
+// return: List of moves, error
+func (dbs *MySqlDatabase) PlanBuckets(factory EntityFactory, from, to *ConsistentHashResolver) (plan []BucketMove, err error) {
+
+	plan = make([]BucketMove, 0)
+	template := strings.Replace(factory().TABLE(), "{{accountId}}", "{{0}}", -1)
+	if requiredKeys(template) == 0 {
+		return plan, fmt.Errorf("table template %s has no shard key placeholder", template)
+	}
+
+	shards, err := dbs.listShards(template)
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make(map[string]*BucketMove)
+	for _, shard := range shards {
+		bucket, er := strconv.Atoi(shard.Keys[0])
+		if er != nil || bucket >= from.Buckets() {
+			continue
+		}
+
+		now, ok := shardTime(shard)
+		if !ok {
+			now = dbs.now()
+		}
+
+		entities, er := dbs.scanEntities(factory, shard.Table)
+		if er != nil {
+			return nil, er
+		}
+		for _, entity := range entities {
+			key := entity.KEY()
+			target := to.Resolve(template, now, append([]string{key}, shard.Keys[1:]...)...)
+			if target == shard.Table {
+				continue
+			}
+			id := shard.Table + "/" + key
+			move, exists := moves[id]
+			if !exists {
+				move = &BucketMove{Key: key, Source: shard.Table, Target: target, IDs: make([]string, 0)}
+				moves[id] = move
+			}
+			move.IDs = append(move.IDs, entity.ID())
+		}
+	}
+
+	for _, move := range moves {
+		plan = append(plan, *move)
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		if plan[i].Source != plan[j].Source {
+			return plan[i].Source < plan[j].Source
+		}
+		return plan[i].Key < plan[j].Key
+	})
+	return plan, nil
+}
+
+// ExecuteBuckets Execute the moves returned by PlanBuckets, each move is executed in a single transaction
+// (missing target tables are created with the structure of the source table)
+//
+// param: plan - List of moves
+// return: Number of moved entities, error
+func (dbs *MySqlDatabase) ExecuteBuckets(plan []BucketMove) (moved int64, err error) {
+
+	for _, move := range plan {
+		if len(move.IDs) == 0 {
+			continue
+		}
+
+		SQL := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" LIKE "%s"`, move.Target, move.Source)
+		if _, err = dbs.exec(dbs.pgDb, move.Target, "", SQL); err != nil {
+			dbs.log().Error("%s error: %s", SQL, err.Error())
+			return
+		}
+
+		affected, er := dbs.executeMove(move)
+		if er != nil {
+			return moved, er
+		}
+		moved += affected
+		dbs.log().Info("moved %d entities of key %s from %s to %s", affected, move.Key, move.Source, move.Target)
+	}
+	return
+}
+
+// RebalanceBuckets Plan and execute the moves required to change the buckets count of the entity tables
+// The new resolver should be set (SetTableNameResolver) once the rebalance is completed
+//
+// param: factory - Entity factory
+// param: from - The current consistent hash resolver
+// param: to - The new consistent hash resolver
+// return: Number of moved entities, error
+func (dbs *MySqlDatabase) RebalanceBuckets(factory EntityFactory, from, to *ConsistentHashResolver) (moved int64, err error) {
+	plan, err := dbs.PlanBuckets(factory, from, to)
+	if err != nil {
+		return 0, err
+	}
+	return dbs.ExecuteBuckets(plan)
+}
+
+// executeMove copy the entities to the target table and delete them from the source table in a single transaction
+func (dbs *MySqlDatabase) executeMove(move BucketMove) (affected int64, err error) {
+
+	tx, err := dbs.pgDb.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	SQL := fmt.Sprintf(`INSERT INTO "%s" SELECT * FROM "%s" WHERE id = ANY($1)`, move.Target, move.Source)
+	result, err := dbs.exec(tx, move.Target, "", SQL, move.IDs)
+	if err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if affected, err = result.RowsAffected(); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	SQL = fmt.Sprintf(sqlBulkDelete, move.Source)
+	if _, err = dbs.exec(tx, move.Source, "", SQL, move.IDs); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+		_ = tx.Rollback()
+		return 0, err
+	}
+	return affected, tx.Commit()
+}
+
+// scanEntities read all the entities of the table
+func (dbs *MySqlDatabase) scanEntities(factory EntityFactory, table string) (list []Entity, err error) {
+
+	rows, err := dbs.query(dbs.pgDb, table, "", fmt.Sprintf(`SELECT data FROM "%s"`, table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	list = make([]Entity, 0)
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		entity, er := dbs.unmarshal(factory, data)
+		if er != nil {
+			return nil, er
+		}
+		list = append(list, entity)
+	}
+	return list, rows.Err()
+}
+
+// endregion
@@ -0,0 +1,237 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Version history definitions ----------------------------------------------------------------------------------
+
+// EntityVersion is a prior version of an entity, stored in the companion history table of the entity table
+// (<table>_history) when the version is replaced by Update, Upsert, SetField or deleted
+type EntityVersion struct {
+	BaseEntity
+	EntityId string          `json:"entityId"` // The entity id
+	Action   string          `json:"action"`   // The mutation which replaced the version: update, upsert, set_field or delete
+	Actor    string          `json:"actor"`    // Who replaced the version (when audit actor is configured)
+	Data     json.RawMessage `json:"data"`     // The entity document of the version (as stored)
+}
+
+func (v *EntityVersion) TABLE() string { return "" }
+func (v *EntityVersion) NAME() string  { return fmt.Sprintf("%s %d", v.EntityId, v.CreatedOn) }
+func (v *EntityVersion) KEY() string   { return "" }
+
+// FieldChange is a single field difference between two entity versions
+type FieldChange struct {
+	Field string `json:"field"` // The field path (nested fields are separated by dot)
+	Old   any    `json:"old"`   // The field value in the first version (nil if missing)
+	New   any    `json:"new"`   // The field value in the second version (nil if missing)
+}
+
+const (
+	sqlListVersions = `SELECT data FROM "%s" WHERE data->>'entityId' = $1 ORDER BY data->>'createdOn', id`
+)
+
+// endregion
+
+// region Version history methods --------------------------------------------------------------------------------------
+
+// SetHistory enable (or disable) the version history of the entity table, every prior version of an entity is written
+// to the companion history table in the same transaction of the single entity mutations (Update, Upsert, Delete,
+// SetField, IncrementField, Patch and the array operations). The bulk operations and the query Delete and SetFields do
+// not write versions
+//
+// param: factory - Entity factory
+// param: enabled - Enable or disable the history
+func (dbs *MySqlDatabase) SetHistory(factory EntityFactory, enabled bool) {
+	template := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if !enabled {
+		delete(dbs.history, template)
+		return
+	}
+	if dbs.history == nil {
+		dbs.history = make(map[string]bool)
+	}
+	dbs.history[template] = true
+}
+
+// ListVersions returns the prior versions of the entity in chronological order (the CreatedOn of a version is the time
+// it was replaced)
+//
+// param: factory - Entity factory
+// param: entityID - The entity id
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: List of versions, error
+func (dbs *MySqlDatabase) ListVersions(factory EntityFactory, entityID string, keys ...string) (list []*EntityVersion, err error) {
+
+	list = make([]*EntityVersion, 0)
+	tblName, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return
+	}
+	table := historyTable(tblName)
+	if exists, er := dbs.listTables(table); er != nil || len(exists) == 0 {
+		return list, er
+	}
+
+	rows, err := dbs.query(dbs.pgDb, table, tenantOf(keys...), fmt.Sprintf(sqlListVersions, table), entityID)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		version := &EntityVersion{}
+		if err = json.Unmarshal(data, version); err != nil {
+			return
+		}
+		list = append(list, version)
+	}
+	return list, rows.Err()
+}
+
+// GetVersion returns the entity as it was at the given time (the current entity if it was not replaced since)
+//
+// param: factory - Entity factory
+// param: entityID - The entity id
+// param: ts - The point in time
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Entity, error
+func (dbs *MySqlDatabase) GetVersion(factory EntityFactory, entityID string, ts Timestamp, keys ...string) (Entity, error) {
+	data, err := dbs.versionDocument(factory, entityID, ts, keys...)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return dbs.Get(factory, entityID, keys...)
+	}
+	entity, err := dbs.unmarshal(factory, data)
+	if err != nil {
+		return nil, err
+	}
+	return dbs.maskEntity(factory, entity)
+}
+
+// Diff returns the field changes between the entity versions at two points in time
+//
+// param: factory - Entity factory
+// param: entityID - The entity id
+// param: v1 - Time of the first version
+// param: v2 - Time of the second version
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: List of field changes (sorted by field), error
+func (dbs *MySqlDatabase) Diff(factory EntityFactory, entityID string, v1, v2 Timestamp, keys ...string) ([]FieldChange, error) {
+	docs := make([]map[string]any, 2)
+	for i, ts := range []Timestamp{v1, v2} {
+		entity, err := dbs.GetVersion(factory, entityID, ts, keys...)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(entity)
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = make(map[string]any)
+		if err = json.Unmarshal(data, &docs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := make([]FieldChange, 0)
+	diffDocuments("", docs[0], docs[1], &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// versionDocument returns the stored document of the version in effect at the time (nil if not replaced since)
+func (dbs *MySqlDatabase) versionDocument(factory EntityFactory, entityID string, ts Timestamp, keys ...string) ([]byte, error) {
+	versions, err := dbs.ListVersions(factory, entityID, keys...)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if version.CreatedOn > ts {
+			return version.Data, nil
+		}
+	}
+	return nil, nil
+}
+
+// historyEnabled returns true if the version history of the table template is enabled
+func (dbs *MySqlDatabase) historyEnabled(template string) bool {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.history[template]
+}
+
+// writeVersion write the prior version of the entity (the audit entry before document) to the history table
+func (dbs *MySqlDatabase) writeVersion(tx *sql.Tx, table, tenant string, entry *AuditEntry) error {
+	version := &EntityVersion{EntityId: entry.EntityId, Action: entry.Action, Actor: entry.Actor, Data: entry.Before}
+	version.Id = GUID()
+	version.CreatedOn = Timestamp(dbs.now().UnixMilli())
+	version.UpdatedOn = version.CreatedOn
+
+	data, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	history := historyTable(table)
+	_, err = dbs.exec(tx, history, tenant, fmt.Sprintf(sqlInsert, history), version.Id, data)
+	return err
+}
+
+// ensureCompanionTable create the companion table (history or trash) with the indexed fields if not already created
+func (dbs *MySqlDatabase) ensureCompanionTable(table string, fields ...string) error {
+	if _, exists := dbs.companionTables.Load(table); exists {
+		return nil
+	}
+	if err := dbs.ExecuteDDL(map[string][]string{table: fields}); err != nil {
+		dbs.log().Error("create companion table %s error: %s", table, err.Error())
+		return err
+	}
+	dbs.companionTables.Store(table, true)
+	return nil
+}
+
+// historyTable returns the history table name of the entity physical table
+func historyTable(table string) string {
+	return table + "_history"
+}
+
+// diffDocuments collect the field changes between two Json documents (nested objects are compared field by field)
+func diffDocuments(prefix string, a, b map[string]any, changes *[]FieldChange) {
+	for field, oldValue := range a {
+		path := prefix + field
+		newValue, exists := b[field]
+		oldDoc, oldIsDoc := oldValue.(map[string]any)
+		newDoc, newIsDoc := newValue.(map[string]any)
+		switch {
+		case oldIsDoc && newIsDoc:
+			diffDocuments(path+".", oldDoc, newDoc, changes)
+		case !exists:
+			*changes = append(*changes, FieldChange{Field: path, Old: oldValue})
+		case !reflect.DeepEqual(oldValue, newValue):
+			*changes = append(*changes, FieldChange{Field: path, Old: oldValue, New: newValue})
+		}
+	}
+	for field, newValue := range b {
+		if _, exists := a[field]; !exists {
+			*changes = append(*changes, FieldChange{Field: prefix + field, New: newValue})
+		}
+	}
+}
+
+// endregion
@@ -0,0 +1,105 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Lifecycle hooks definitions ----------------------------------------------------------------------------------
+
+// HookEvent is the entity lifecycle event
+type HookEvent string
+
+// Lifecycle events
+const (
+	BeforeInsert HookEvent = "before_insert"
+	AfterInsert  HookEvent = "after_insert"
+	BeforeUpdate HookEvent = "before_update"
+	AfterUpdate  HookEvent = "after_update"
+	BeforeUpsert HookEvent = "before_upsert"
+	AfterUpsert  HookEvent = "after_upsert"
+	BeforeDelete HookEvent = "before_delete"
+	AfterDelete  HookEvent = "after_delete"
+)
+
+// HookContext is the context of the mutation passed to the hook
+type HookContext struct {
+	Event    HookEvent       // The lifecycle event
+	Table    string          // The entity physical table
+	Tenant   string          // The tenant (shard key)
+	EntityId string          // The entity id
+	Entity   Entity          // The entity (for delete: the entity before the deletion)
+	Before   json.RawMessage // The stored document before the mutation (empty for insert or if it did not exist)
+	Tx       *sql.Tx         // The transaction of the mutation
+}
+
+// Hook is a lifecycle hook, Before hooks may modify the entity (e.g. defaulting) and any hook may execute statements
+// in the mutation transaction (e.g. denormalization). Returning error aborts the mutation and rolls back the transaction
+type Hook func(ctx *HookContext) error
+
+// endregion
+
+// region Lifecycle hooks methods --------------------------------------------------------------------------------------
+
+// RegisterHook register lifecycle hook of the entity table, hooks run in order of registration inside the transaction
+// of the mutation. Hooks are fired by the single entity Insert, Update, Upsert and Delete operations (bulk, set field
+// and query operations do not fire hooks)
+//
+// param: table - The entity table name (template, e.g. the factory().TABLE())
+// param: event - The lifecycle event
+// param: fn - The hook function
+func (dbs *MySqlDatabase) RegisterHook(table string, event HookEvent, fn Hook) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.hooks == nil {
+		dbs.hooks = make(map[string]map[HookEvent][]Hook)
+	}
+	if dbs.hooks[table] == nil {
+		dbs.hooks[table] = make(map[HookEvent][]Hook)
+	}
+	dbs.hooks[table][event] = append(dbs.hooks[table][event], fn)
+}
+
+// hookEvents returns the Before and After lifecycle events of the mutation action
+func hookEvents(action string) (before, after HookEvent) {
+	switch action {
+	case AuditInsert:
+		return BeforeInsert, AfterInsert
+	case AuditUpdate:
+		return BeforeUpdate, AfterUpdate
+	case AuditUpsert:
+		return BeforeUpsert, AfterUpsert
+	case AuditDelete:
+		return BeforeDelete, AfterDelete
+	}
+	return "", ""
+}
+
+// lifecycleHooks returns the Before and After hooks of the mutation action on the entity table
+func (dbs *MySqlDatabase) lifecycleHooks(template, action string) (before, after []Hook) {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	if hooks := dbs.hooks[template]; len(hooks) > 0 {
+		b, a := hookEvents(action)
+		return hooks[b], hooks[a]
+	}
+	return nil, nil
+}
+
+// runHooks run the hooks of the event in the transaction
+func runHooks(hooks []Hook, ctx HookContext) error {
+	for _, hook := range hooks {
+		hc := ctx
+		if err := hook(&hc); err != nil {
+			return fmt.Errorf("%s hook of %s: %w", ctx.Event, ctx.Table, err)
+		}
+	}
+	return nil
+}
+
+// endregion
@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var fieldNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// region Identifier validation ----------------------------------------------------------------------------------------
+
+// InvalidFieldError is returned when a field name which is not a valid identifier is interpolated into SQL statement
+type InvalidFieldError struct {
+	Field string // The invalid field name
+}
+
+// Error returns the error message
+func (e *InvalidFieldError) Error() string {
+	return fmt.Sprintf("invalid field name: %q (letters, digits and underscore only, up to 64 characters)", e.Field)
+}
+
+// validateFields check that all the field names are valid identifiers, since field names are interpolated into the
+// SQL statements (JSON paths and index names) they must not be taken as is from user input
+func validateFields(fields ...string) error {
+	for _, field := range fields {
+		if !fieldNameRegex.MatchString(field) {
+			return &InvalidFieldError{Field: field}
+		}
+	}
+	return nil
+}
+
+// endregion
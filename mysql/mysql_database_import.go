@@ -0,0 +1,123 @@
+package mysql
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Import definitions -------------------------------------------------------------------------------------------
+
+// ImportOptions configures the import of entities from JSON-lines
+type ImportOptions struct {
+	ChunkSize  int                         // Number of entities upserted in a single transaction (default: 500)
+	Validate   func(entity Entity) error   // Validates the entity before it is imported, rejected entities are reported (optional)
+	OnProgress func(progress ImportReport) // Called after every chunk is upserted (optional)
+}
+
+// ImportReport is the import progress and the list of rejected lines
+type ImportReport struct {
+	Lines    int64            // Number of lines read (empty lines excluded)
+	Imported int64            // Number of upserted entities
+	Rejected []ImportRejected // Rejected lines
+}
+
+// ImportRejected describes a line rejected by the import
+type ImportRejected struct {
+	Line  int64  // The line number (1 based)
+	Error string // The rejection reason
+}
+
+// endregion
+
+// region Import methods -----------------------------------------------------------------------------------------------
+
+// Import read entities from JSON-lines (e.g. the output of Export) and upsert them in chunks, lines which can not be
+// converted to the entity, have no id or fail the validation are rejected and reported without failing the import.
+// Each chunk is upserted by BulkUpsert (the shard table is resolved by the entity KEY()) and changes are published.
+//
+// param: factory - Entity factory
+// param: r - The JSON-lines reader
+// param: opts - Import options
+// return: Import report, error (read or database error, the entities of the previous chunks remain imported)
+func (dbs *MySqlDatabase) Import(factory EntityFactory, r io.Reader, opts ImportOptions) (report ImportReport, err error) {
+
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 500
+	}
+	report.Rejected = make([]ImportRejected, 0)
+
+	defer dbs.observe("import", factory().TABLE(), opts.ChunkSize, time.Now(), &report.Imported, &err)
+
+	flush := func(chunk []Entity) error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		affected, er := dbs.BulkUpsert(chunk)
+		report.Imported += affected
+		if er != nil {
+			return er
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(report)
+		}
+		return nil
+	}
+
+	reader := bufio.NewReader(r)
+	chunk := make([]Entity, 0, opts.ChunkSize)
+	lineNumber := int64(0)
+	for {
+		line, er := reader.ReadBytes('\n')
+		if er != nil && er != io.EOF {
+			return report, er
+		}
+		lineNumber++
+
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			report.Lines++
+			if entity, reason := importEntity(factory, line, opts.Validate); reason != nil {
+				report.Rejected = append(report.Rejected, ImportRejected{Line: lineNumber, Error: reason.Error()})
+			} else {
+				chunk = append(chunk, entity)
+			}
+		}
+
+		if len(chunk) >= opts.ChunkSize {
+			if err = flush(chunk); err != nil {
+				return
+			}
+			chunk = make([]Entity, 0, opts.ChunkSize)
+		}
+		if er == io.EOF {
+			break
+		}
+	}
+
+	err = flush(chunk)
+	return
+}
+
+// importEntity convert single line to entity and validate it
+func importEntity(factory EntityFactory, line []byte, validate func(entity Entity) error) (Entity, error) {
+	entity := factory()
+	if err := json.Unmarshal(line, entity); err != nil {
+		return nil, err
+	}
+	if entity.ID() == "" {
+		return nil, fmt.Errorf("entity has no id")
+	}
+	if validate != nil {
+		if err := validate(entity); err != nil {
+			return nil, err
+		}
+	}
+	return entity, nil
+}
+
+// endregion
@@ -0,0 +1,549 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region JSON patch definitions ---------------------------------------------------------------------------------------
+
+// JSON patch operation codes (RFC 6902)
+const (
+	PatchAdd     = "add"
+	PatchRemove  = "remove"
+	PatchReplace = "replace"
+	PatchMove    = "move"
+	PatchTest    = "test"
+)
+
+// ErrPatchTestFailed is returned by JsonPatch when a test operation does not match the stored document
+var ErrPatchTestFailed = errors.New("json patch test failed")
+
+// PatchOperation is a single RFC 6902 JSON patch operation, paths are JSON pointers (e.g. /address/city, /tags/0,
+// /tags/- to append). Numeric path segments address array elements
+type PatchOperation struct {
+	Op    string `json:"op"`              // The operation: add, remove, replace, move or test
+	Path  string `json:"path"`            // The target JSON pointer
+	From  string `json:"from,omitempty"`  // The source JSON pointer (move)
+	Value any    `json:"value,omitempty"` // The value (add, replace and test)
+}
+
+const sqlJsonPatch = `UPDATE "%s" SET data = %s WHERE id = $%d%s`
+
+// endregion
+
+// region JSON patch methods -------------------------------------------------------------------------------------------
+
+// JsonPatch apply ordered list of RFC 6902 JSON patch operations to the entity document atomically: if any test
+// operation does not match, nothing is changed and ErrPatchTestFailed is returned.
+// When all the test operations precede the other operations the patch is applied on the server in a single statement
+// (the tests are conditions of the update, and removing or replacing missing targets is ignored), numeric and "-"
+// pointer tokens are array indexes on the server only if the addressed value is an array, otherwise the patch is
+// applied in memory. If the statement changed no row although the tests still pass, ConcurrentModificationError is
+// returned (unless the patch does not change the stored document).
+// Patches with tests after modifications, and patches of encrypted, overflowed, custom serialized or validated (see
+// SetJsonSchema) documents are applied in memory and written back only if the document was not modified in the
+// meantime (ConcurrentModificationError)
+//
+// param: factory - Entity factory
+// param: entityID - The entity ID to patch
+// param: ops - The patch operations
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) JsonPatch(factory EntityFactory, entityID string, ops []PatchOperation, keys ...string) (err error) {
+	template := factory().TABLE()
+	defer dbs.observe("json_patch", template, len(ops), time.Now(), nil, &err)
+
+	if len(ops) == 0 {
+		return nil
+	}
+	if err = validatePatch(ops); err != nil {
+		return err
+	}
+	if err = dbs.admitWrite(template, 1); err != nil {
+		return err
+	}
+
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+
+	defer dbs.throttle(keys...)()
+	if dbs.encryptor(template) != nil || dbs.envelope(template) != nil || dbs.overflowStorage(template) != nil || dbs.serializer(template) != nil || dbs.validating(template) || !testsFirst(ops) {
+		return dbs.jsonPatchDocument(template, table, tenantOf(keys...), entityID, ops)
+	}
+	return dbs.jsonPatchServer(template, table, tenantOf(keys...), entityID, ops)
+}
+
+// jsonPatchServer apply the patch on the server in a single update statement, the test operations and the types of the
+// arrays addressed by index are the conditions
+func (dbs *MySqlDatabase) jsonPatchServer(template, table, tenant, entityID string, ops []PatchOperation) error {
+	expr, args := "data", make([]any, 0)
+	for _, op := range ops {
+		path, _ := pointerPath(op.Path)
+		value, _ := json.Marshal(op.Value)
+
+		switch op.Op {
+		case PatchAdd:
+			if op.Path == "" {
+				expr, args = "CAST($1 AS JSON)", []any{string(value)}
+			} else {
+				fn, target := patchAddTarget(op.Path)
+				args = append(args, target, string(value))
+				expr = fmt.Sprintf("%s(%s, $%d, CAST($%d AS JSON))", fn, expr, len(args)-1, len(args))
+			}
+		case PatchReplace:
+			if op.Path == "" {
+				expr, args = "CAST($1 AS JSON)", []any{string(value)}
+			} else {
+				args = append(args, path, string(value))
+				expr = fmt.Sprintf("JSON_REPLACE(%s, $%d, CAST($%d AS JSON))", expr, len(args)-1, len(args))
+			}
+		case PatchRemove:
+			args = append(args, path)
+			expr = fmt.Sprintf("JSON_REMOVE(%s, $%d)", expr, len(args))
+		case PatchMove:
+			from, _ := pointerPath(op.From)
+			args = append(args, from)
+			source := fmt.Sprintf("JSON_EXTRACT(%s, $%d)", expr, len(args))
+			if op.Path == "" {
+				expr = source
+			} else {
+				fn, target := patchAddTarget(op.Path)
+				args = append(args, target)
+				expr = fmt.Sprintf("%s(JSON_REMOVE(%s, $%d), $%d, %s)", fn, expr, len(args)-1, len(args), source)
+			}
+		}
+	}
+
+	// the conditions follow the entity id: the types of the arrays addressed by index and the test operations
+	args = append(args, entityID)
+	idIndex, conditions := len(args), ""
+	for _, array := range patchArrays(ops) {
+		args = append(args, tokensPath(array))
+		conditions += fmt.Sprintf(" AND JSON_TYPE(JSON_EXTRACT(data, $%d)) = 'ARRAY'", len(args))
+	}
+	for _, op := range ops {
+		if op.Op == PatchTest {
+			path, _ := pointerPath(op.Path)
+			value, _ := json.Marshal(op.Value)
+			args = append(args, path, string(value))
+			conditions += fmt.Sprintf(" AND JSON_EXTRACT(data, $%d) = CAST($%d AS JSON)", len(args)-1, len(args))
+		}
+	}
+
+	SQL := fmt.Sprintf(sqlJsonPatch, table, expr, idIndex, conditions)
+
+	result, err := dbs.execAudited(AuditPatch, template, table, tenant, entityID, nil, SQL, args...)
+	if err != nil {
+		return err
+	}
+	if affected, er := result.RowsAffected(); er != nil {
+		return er
+	} else if affected > 0 {
+		return nil
+	}
+
+	// no row was changed: the entity does not exist, a condition failed, the patch did not change the document or the
+	// document was modified concurrently
+	var data, hash string
+	if err = dbs.scalar(table, fmt.Sprintf(sqlMergeRead, table), []any{entityID}, &data, &hash); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no row affected when executing json patch operation")
+	} else if err != nil {
+		return err
+	}
+	doc, err := decodeValue([]byte(data))
+	if err != nil {
+		return err
+	}
+
+	// tokens addressing objects (not arrays) are object keys, the patch is applied in memory
+	for _, array := range patchArrays(ops) {
+		if node, er := pointerGet(doc, array); er != nil || !isArray(node) {
+			return dbs.jsonPatchDocument(template, table, tenant, entityID, ops)
+		}
+	}
+
+	original, _ := json.Marshal(doc)
+	for _, op := range ops {
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return err
+		}
+	}
+	if patched, _ := json.Marshal(doc); bytes.Equal(original, patched) {
+		return nil
+	}
+	return &ConcurrentModificationError{Table: table, Id: entityID, Hash: hash}
+}
+
+// jsonPatchDocument read the stored document, apply the patch in memory and write it back if it was not modified
+func (dbs *MySqlDatabase) jsonPatchDocument(template, table, tenant, entityID string, ops []PatchOperation) error {
+	var data, hash string
+	if err := dbs.scalar(table, fmt.Sprintf(sqlMergeRead, table), []any{entityID}, &data, &hash); errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no row fetched for id: %s", entityID)
+	} else if err != nil {
+		return err
+	}
+
+	plain, err := dbs.decode(template, []byte(data))
+	if err != nil {
+		return err
+	}
+	doc, err := decodeValue(plain)
+	if err != nil {
+		return err
+	}
+	original, _ := json.Marshal(doc)
+	for _, op := range ops {
+		if doc, err = applyPatchOperation(doc, op); err != nil {
+			return err
+		}
+	}
+
+	// unchanged document is not written
+	if plain, err = json.Marshal(doc); err != nil {
+		return err
+	}
+	if bytes.Equal(original, plain) {
+		return nil
+	}
+	if err = dbs.validate(template, entityID, plain); err != nil {
+		return err
+	}
+	encoded, err := dbs.encode(template, table, plain)
+	if err != nil {
+		return err
+	}
+
+	result, err := dbs.execAudited(AuditPatch, template, table, tenant, entityID, nil, fmt.Sprintf(sqlUpdateIfUnchanged, table), entityID, encoded, hash)
+	if err != nil {
+		return err
+	}
+	if affected, er := result.RowsAffected(); er != nil {
+		return er
+	} else if affected == 0 {
+		return &ConcurrentModificationError{Table: table, Id: entityID, Hash: hash}
+	}
+	return nil
+}
+
+// validatePatch check the operation codes and pointers of the patch
+func validatePatch(ops []PatchOperation) error {
+	for i, op := range ops {
+		switch op.Op {
+		case PatchAdd, PatchReplace, PatchTest:
+		case PatchRemove:
+			if op.Path == "" {
+				return fmt.Errorf("json patch operation %d: can't remove the whole document", i)
+			}
+		case PatchMove:
+			if _, err := parsePointer(op.From); err != nil || op.From == "" {
+				return fmt.Errorf("json patch operation %d: invalid from pointer: %s", i, op.From)
+			}
+			if strings.HasPrefix(op.Path+"/", op.From+"/") {
+				return fmt.Errorf("json patch operation %d: can't move %s into itself", i, op.From)
+			}
+		default:
+			return fmt.Errorf("json patch operation %d: unsupported operation: %s", i, op.Op)
+		}
+		if _, err := parsePointer(op.Path); err != nil {
+			return fmt.Errorf("json patch operation %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// testsFirst check if all the test operations precede the other operations
+func testsFirst(ops []PatchOperation) bool {
+	modified := false
+	for _, op := range ops {
+		if op.Op != PatchTest {
+			modified = true
+		} else if modified {
+			return false
+		}
+	}
+	return true
+}
+
+// patchArrays returns the pointer tokens of the values which the patch addresses as arrays (by index or "-")
+func patchArrays(ops []PatchOperation) [][]string {
+	arrays := make([][]string, 0)
+	seen := make(map[string]bool)
+	for _, op := range ops {
+		for _, pointer := range []string{op.Path, op.From} {
+			tokens, _ := parsePointer(pointer)
+			for i, token := range tokens {
+				if !isArrayIndex(token) && !(token == "-" && i == len(tokens)-1) {
+					continue
+				}
+				if path := tokensPath(tokens[:i]); !seen[path] {
+					seen[path] = true
+					arrays = append(arrays, tokens[:i])
+				}
+			}
+		}
+	}
+	return arrays
+}
+
+// isArray check if the decoded Json value is array
+func isArray(value any) bool {
+	_, ok := value.([]any)
+	return ok
+}
+
+// patchAddTarget returns the JSON function and the path of the add operation to the (non root) JSON pointer: appending
+// to the parent array (-), inserting to array index or setting object member
+func patchAddTarget(pointer string) (string, string) {
+	tokens, _ := parsePointer(pointer)
+	last := tokens[len(tokens)-1]
+
+	switch {
+	case last == "-":
+		parent, _ := pointerPath(pointer[:strings.LastIndex(pointer, "/")])
+		return "JSON_ARRAY_APPEND", parent
+	case isArrayIndex(last):
+		path, _ := pointerPath(pointer)
+		return "JSON_ARRAY_INSERT", path
+	default:
+		path, _ := pointerPath(pointer)
+		return "JSON_SET", path
+	}
+}
+
+// parsePointer split the JSON pointer to its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid json pointer: %s", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// pointerPath convert the JSON pointer to MySQL JSON path (numeric tokens are array indexes, see patchArrays)
+func pointerPath(pointer string) (string, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return "", err
+	}
+	return tokensPath(tokens), nil
+}
+
+// tokensPath convert the JSON pointer tokens to MySQL JSON path (numeric tokens are array indexes)
+func tokensPath(tokens []string) string {
+	path := strings.Builder{}
+	path.WriteString("$")
+	for _, token := range tokens {
+		if isArrayIndex(token) {
+			path.WriteString("[" + token + "]")
+		} else {
+			path.WriteString(`."` + strings.ReplaceAll(strings.ReplaceAll(token, `\`, `\\`), `"`, `\"`) + `"`)
+		}
+	}
+	return path.String()
+}
+
+// isArrayIndex check if the pointer token is array index
+func isArrayIndex(token string) bool {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return false
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeValue decode Json value (numbers are kept as json.Number)
+func decodeValue(data []byte) (value any, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err = decoder.Decode(&value)
+	return
+}
+
+// applyPatchOperation apply the patch operation to the document, returns the patched document
+func applyPatchOperation(doc any, op PatchOperation) (any, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := op.Value
+	if op.Op == PatchAdd || op.Op == PatchReplace || op.Op == PatchTest {
+		data, er := json.Marshal(op.Value)
+		if er != nil {
+			return nil, er
+		}
+		if value, er = decodeValue(data); er != nil {
+			return nil, er
+		}
+	}
+
+	switch op.Op {
+	case PatchAdd:
+		return pointerAdd(doc, tokens, value)
+	case PatchRemove:
+		doc, _, err = pointerRemove(doc, tokens)
+		return doc, err
+	case PatchReplace:
+		if doc, _, err = pointerRemove(doc, tokens); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, tokens, value)
+	case PatchMove:
+		from, _ := parsePointer(op.From)
+		if doc, value, err = pointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, tokens, value)
+	case PatchTest:
+		current, er := pointerGet(doc, tokens)
+		if er != nil {
+			return nil, fmt.Errorf("%w: %s", ErrPatchTestFailed, er.Error())
+		}
+		expected, _ := json.Marshal(value)
+		actual, _ := json.Marshal(current)
+		if !bytes.Equal(expected, actual) {
+			return nil, fmt.Errorf("%w: %s is %s", ErrPatchTestFailed, op.Path, string(actual))
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("unsupported json patch operation: %s", op.Op)
+}
+
+// pointerGet returns the value of the pointer tokens
+func pointerGet(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found: %s", token)
+			}
+			node = child
+		case []any:
+			idx, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("path not found: %s", token)
+		}
+	}
+	return node, nil
+}
+
+// pointerAdd add the value at the pointer tokens (array elements are inserted), returns the updated node
+func pointerAdd(node any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token, rest := tokens[0], tokens[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			n[token] = value
+			return n, nil
+		}
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("path not found: %s", token)
+		}
+		updated, err := pointerAdd(child, rest, value)
+		n[token] = updated
+		return n, err
+	case []any:
+		if len(rest) == 0 {
+			if token == "-" {
+				return append(n, value), nil
+			}
+			idx, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+			return n, nil
+		}
+		idx, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerAdd(n[idx], rest, value)
+		n[idx] = updated
+		return n, err
+	}
+	return nil, fmt.Errorf("path not found: %s", token)
+}
+
+// pointerRemove remove the value at the pointer tokens, returns the updated node and the removed value
+func pointerRemove(node any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return nil, node, nil
+	}
+	token, rest := tokens[0], tokens[1:]
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path not found: %s", token)
+		}
+		if len(rest) == 0 {
+			delete(n, token)
+			return n, child, nil
+		}
+		updated, removed, err := pointerRemove(child, rest)
+		n[token] = updated
+		return n, removed, err
+	case []any:
+		idx, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := n[idx]
+			return append(n[:idx], n[idx+1:]...), removed, nil
+		}
+		updated, removed, err := pointerRemove(n[idx], rest)
+		n[idx] = updated
+		return n, removed, err
+	}
+	return nil, nil, fmt.Errorf("path not found: %s", token)
+}
+
+// arrayIndex parse the array index token (up to the last index)
+func arrayIndex(token string, last int) (int, error) {
+	if !isArrayIndex(token) {
+		return 0, fmt.Errorf("invalid array index: %s", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx > last {
+		return 0, fmt.Errorf("array index out of range: %s", token)
+	}
+	return idx, nil
+}
+
+// endregion
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// region Distributed lock definitions ---------------------------------------------------------------------------------
+
+// ErrLockTimeout is returned by AcquireLock when the lock is not acquired within the timeout
+var ErrLockTimeout = errors.New("lock timeout")
+
+const (
+	sqlGetLock     = "SELECT GET_LOCK($1, $2)"
+	sqlReleaseLock = "SELECT RELEASE_LOCK($1)"
+
+	// maxLockName is the max length of MySQL lock name (longer names are hashed)
+	maxLockName = 64
+)
+
+// connRunner is the sqlRunner of a dedicated connection
+type connRunner struct {
+	conn *sql.Conn
+}
+
+func (c connRunner) Exec(query string, args ...any) (sql.Result, error) {
+	return c.conn.ExecContext(context.Background(), query, args...)
+}
+
+func (c connRunner) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.conn.QueryContext(context.Background(), query, args...)
+}
+
+// endregion
+
+// region Distributed lock methods -------------------------------------------------------------------------------------
+
+// AcquireLock acquire cluster wide named lock (MySQL advisory lock), the lock is held by a dedicated connection until
+// it is released (or the connection is lost). A lock name is held once per database instance: acquiring a lock which
+// is held (or being acquired) by this instance fails immediately, without waiting for the timeout
+//
+// param: name - The lock name
+// param: timeout - Max time to wait for the lock (negative for infinite wait)
+// return: error (ErrLockTimeout if the lock is held by another session)
+func (dbs *MySqlDatabase) AcquireLock(name string, timeout time.Duration) (err error) {
+	defer dbs.observe("acquire_lock", name, 0, time.Now(), nil, &err)
+
+	// The name is reserved (with no connection) while the lock is acquired, so concurrent acquires fail fast
+	if _, loaded := dbs.locks.LoadOrStore(name, (*sql.Conn)(nil)); loaded {
+		return fmt.Errorf("acquire lock %s: lock is already held by this database instance", name)
+	}
+	defer func() {
+		if err != nil {
+			dbs.locks.Delete(name)
+		}
+	}()
+
+	conn, err := dbs.pgDb.Conn(context.Background())
+	if err != nil {
+		return err
+	}
+
+	seconds := -1
+	if timeout >= 0 {
+		seconds = int(math.Ceil(timeout.Seconds()))
+	}
+
+	var acquired sql.NullInt64
+	if err = dbs.scalarOn(connRunner{conn: conn}, "", sqlGetLock, []any{lockName(name), seconds}, &acquired); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	if !acquired.Valid {
+		_ = conn.Close()
+		return fmt.Errorf("acquire lock %s: GET_LOCK failed", name)
+	}
+	if acquired.Int64 == 0 {
+		_ = conn.Close()
+		return fmt.Errorf("acquire lock %s: %w", name, ErrLockTimeout)
+	}
+
+	dbs.locks.Store(name, conn)
+	return nil
+}
+
+// ReleaseLock release the named lock acquired by AcquireLock
+//
+// param: name - The lock name
+// return: error
+func (dbs *MySqlDatabase) ReleaseLock(name string) (err error) {
+	defer dbs.observe("release_lock", name, 0, time.Now(), nil, &err)
+
+	// A lock which is being acquired (no connection yet) is not held
+	value, _ := dbs.locks.Load(name)
+	conn, _ := value.(*sql.Conn)
+	if conn == nil || !dbs.locks.CompareAndDelete(name, conn) {
+		return fmt.Errorf("release lock %s: lock is not held", name)
+	}
+	defer func() { _ = conn.Close() }()
+
+	var released sql.NullInt64
+	if err = dbs.scalarOn(connRunner{conn: conn}, "", sqlReleaseLock, []any{lockName(name)}, &released); err != nil {
+		return err
+	}
+	if !released.Valid || released.Int64 == 0 {
+		return fmt.Errorf("release lock %s: lock is not held by the session", name)
+	}
+	return nil
+}
+
+// WithLock run the function while holding the named lock, used to coordinate cluster singleton jobs, for example:
+//
+//	err := db.WithLock("rollover", time.Second, func() error { return manager.RunOnce() })
+//
+// param: name - The lock name
+// param: timeout - Max time to wait for the lock (negative for infinite wait)
+// param: fn - The function to run
+// return: The function error, or lock error (ErrLockTimeout if the lock is held by another session)
+func (dbs *MySqlDatabase) WithLock(name string, timeout time.Duration, fn func() error) (err error) {
+	if err = dbs.AcquireLock(name, timeout); err != nil {
+		return err
+	}
+	defer func() {
+		if er := dbs.ReleaseLock(name); er != nil && err == nil {
+			err = er
+		}
+	}()
+	return fn()
+}
+
+// lockName returns the MySQL lock name (names longer than 64 characters are hashed)
+func lockName(name string) string {
+	if len(name) <= maxLockName {
+		return name
+	}
+	hash := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(hash[:])
+}
+
+// endregion
@@ -0,0 +1,104 @@
+package mysql
+
+import (
+	"strings"
+
+	"github.com/go-yaaf/yaaf-common/logger"
+)
+
+// region Logger definitions -------------------------------------------------------------------------------------------
+
+// ILogger is the logger used by the database handle (the default logger is yaaf-common logger)
+type ILogger interface {
+	Debug(format string, params ...any)
+	Info(format string, params ...any)
+	Warn(format string, params ...any)
+	Error(format string, params ...any)
+}
+
+// Log levels
+var logLevels = map[string]int{"DEBUG": 0, "INFO": 1, "WARN": 2, "ERROR": 3, "OFF": 4}
+
+// defaultLogger delegates to yaaf-common logger
+type defaultLogger struct{}
+
+func (l defaultLogger) Debug(format string, params ...any) { logger.Debug(format, params...) }
+func (l defaultLogger) Info(format string, params ...any)  { logger.Info(format, params...) }
+func (l defaultLogger) Warn(format string, params ...any)  { logger.Warn(format, params...) }
+func (l defaultLogger) Error(format string, params ...any) { logger.Error(format, params...) }
+
+// levelLogger filters out messages below the log level
+type levelLogger struct {
+	next  ILogger
+	level int
+}
+
+func (l levelLogger) Debug(format string, params ...any) {
+	if l.level <= 0 {
+		l.next.Debug(format, params...)
+	}
+}
+
+func (l levelLogger) Info(format string, params ...any) {
+	if l.level <= 1 {
+		l.next.Info(format, params...)
+	}
+}
+
+func (l levelLogger) Warn(format string, params ...any) {
+	if l.level <= 2 {
+		l.next.Warn(format, params...)
+	}
+}
+
+func (l levelLogger) Error(format string, params ...any) {
+	if l.level <= 3 {
+		l.next.Error(format, params...)
+	}
+}
+
+// endregion
+
+// region Logger methods -----------------------------------------------------------------------------------------------
+
+// SetLogger set the logger of the database handle, so libraries embedding this package can redirect its output
+// (nil resets to yaaf-common logger)
+//
+// param: l - Logger
+func (dbs *MySqlDatabase) SetLogger(l ILogger) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.logger = l
+}
+
+// SetLogLevel set the minimal level of the messages logged by the database handle: DEBUG, INFO, WARN, ERROR or OFF
+// (empty string resets to log all the messages and let the logger filter them)
+//
+// param: level - Log level
+func (dbs *MySqlDatabase) SetLogLevel(level string) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if lvl, ok := logLevels[strings.ToUpper(level)]; ok {
+		dbs.logLevel = lvl
+	} else {
+		dbs.logLevel = 0
+	}
+}
+
+// log returns the logger of the database handle
+func (dbs *MySqlDatabase) log() ILogger {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	var l ILogger = defaultLogger{}
+	if dbs.logger != nil {
+		l = dbs.logger
+	}
+	if dbs.logLevel > 0 {
+		return levelLogger{next: l, level: dbs.logLevel}
+	}
+	return l
+}
+
+// endregion
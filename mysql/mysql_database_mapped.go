@@ -0,0 +1,179 @@
+package mysql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Mapped fields definitions ------------------------------------------------------------------------------------
+
+// MappedField describes an entity field which is stored in a real typed column alongside the Json document.
+// Unlike promoted fields (generated columns), mapped columns can be referenced by foreign keys and updated directly:
+// the column is populated from the document on every write, and a direct change of the column is merged back into the document
+type MappedField struct {
+	Field      string // The entity (json) field name
+	Column     string // The column name (default: the field name)
+	SqlType    string // The column SQL type (default: varchar(255)), the field value must be convertible to the type
+	Index      bool   // Create index on the column
+	References string // Foreign key reference in the format of: table(column) (optional)
+	OnDelete   string // Foreign key ON DELETE action: RESTRICT, CASCADE, SET NULL (default: RESTRICT)
+}
+
+const (
+	ddlAddMappedColumn  = `ADD COLUMN "%s" %s NULL`
+	ddlAddForeignKey    = `ADD CONSTRAINT "%s_%s_fk" FOREIGN KEY ("%s") REFERENCES %s ON DELETE %s`
+	sqlBackfillMapped   = `UPDATE "%s" SET "%s" = %s`
+	ddlDropTrigger      = `DROP TRIGGER IF EXISTS "%s"`
+	ddlMappedInsertTrig = `CREATE TRIGGER "%s" BEFORE INSERT ON "%s" FOR EACH ROW BEGIN %s END`
+	ddlMappedUpdateTrig = `CREATE TRIGGER "%s" BEFORE UPDATE ON "%s" FOR EACH ROW BEGIN IF NOT (NEW.data <=> OLD.data) THEN %s ELSE %s END IF; END`
+)
+
+// column returns the mapped column name
+func (m MappedField) column() string {
+	if m.Column == "" {
+		return m.Field
+	}
+	return m.Column
+}
+
+// sqlType returns the mapped column SQL type
+func (m MappedField) sqlType() string {
+	if m.SqlType == "" {
+		return "varchar(255)"
+	}
+	return m.SqlType
+}
+
+// extract returns the expression of the field value in the document of the row (Json null is mapped to NULL)
+func (m MappedField) extract(row string) string {
+	value := fmt.Sprintf("JSON_EXTRACT(%s, '$.%s')", row, m.Field)
+	return fmt.Sprintf("IF(JSON_TYPE(%s) = 'NULL', NULL, JSON_UNQUOTE(%s))", value, value)
+}
+
+// endregion
+
+// region Mapped fields methods ----------------------------------------------------------------------------------------
+
+// MapFields register entity fields to be stored in real typed columns (hybrid storage). Once registered, the query
+// builder uses the column instead of extracting the field from the json document.
+// The columns are kept in sync with the document by BEFORE INSERT / BEFORE UPDATE triggers (see CreatePromotedColumns),
+// so every write path (including bulk operations and raw SQL) populates them
+//
+// param: factory - Entity factory
+// param: fields - List of fields to map
+// return: error
+func (dbs *MySqlDatabase) MapFields(factory EntityFactory, fields ...MappedField) error {
+	for _, field := range fields {
+		if err := validateFields(field.Field, field.column()); err != nil {
+			return err
+		}
+		switch strings.ToUpper(field.OnDelete) {
+		case "", "RESTRICT", "CASCADE", "SET NULL", "NO ACTION":
+		default:
+			return fmt.Errorf("invalid foreign key action %s of field %s", field.OnDelete, field.Field)
+		}
+	}
+
+	template := factory().TABLE()
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.mapped == nil {
+		dbs.mapped = make(map[string]map[string]MappedField)
+	}
+	if _, ok := dbs.mapped[template]; !ok {
+		dbs.mapped[template] = make(map[string]MappedField)
+	}
+	for _, field := range fields {
+		dbs.mapped[template][field.Field] = field
+	}
+	return nil
+}
+
+// createMappedColumns create the mapped columns (backfilled from the existing documents), their indexes and foreign
+// keys, and (re)create the triggers keeping the columns in sync with the document
+func (dbs *MySqlDatabase) createMappedColumns(template, table string) (err error) {
+	fields := dbs.mappedFields(template)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	for _, field := range fields {
+		column := field.column()
+
+		var count int
+		if err = dbs.scalar(table, sqlColumnExists, schemaArgs(table, column), &count); err != nil {
+			return
+		}
+		if count > 0 {
+			continue
+		}
+
+		alter := fmt.Sprintf(ddlAddMappedColumn, column, field.sqlType())
+		if field.Index {
+			alter = fmt.Sprintf("%s, %s", alter, fmt.Sprintf(ddlAddColumnIndex, baseName(table), column, column))
+		}
+		if err = dbs.AlterTable(table, alter); err != nil {
+			return
+		}
+		if _, err = dbs.exec(dbs.pgDb, table, "", fmt.Sprintf(sqlBackfillMapped, table, column, field.extract("data"))); err != nil {
+			return
+		}
+		if field.References != "" {
+			onDelete := field.OnDelete
+			if onDelete == "" {
+				onDelete = "RESTRICT"
+			}
+			if err = dbs.AlterTable(table, fmt.Sprintf(ddlAddForeignKey, baseName(table), column, column, field.References, strings.ToUpper(onDelete))); err != nil {
+				return
+			}
+		}
+	}
+	return dbs.createMappedTriggers(table, fields)
+}
+
+// createMappedTriggers (re)create the triggers of the mapped columns: on insert and on document change the columns are
+// populated from the document, on direct change of the column (document unchanged) the column is merged into the document
+func (dbs *MySqlDatabase) createMappedTriggers(table string, fields []MappedField) error {
+	populate := make([]string, 0, len(fields))
+	merge := make([]string, 0, len(fields))
+	for _, field := range fields {
+		column := field.column()
+		populate = append(populate, fmt.Sprintf(`SET NEW."%s" = %s;`, column, field.extract("NEW.data")))
+		merge = append(merge, fmt.Sprintf(`IF NOT (NEW."%s" <=> OLD."%s") THEN SET NEW.data = JSON_SET(NEW.data, '$.%s', NEW."%s"); END IF;`, column, column, field.Field, column))
+	}
+
+	insertTrigger := fmt.Sprintf("%s_mapped_bi", table)
+	updateTrigger := fmt.Sprintf("%s_mapped_bu", table)
+	statements := []string{
+		fmt.Sprintf(ddlDropTrigger, insertTrigger),
+		fmt.Sprintf(ddlMappedInsertTrig, insertTrigger, table, strings.Join(populate, " ")),
+		fmt.Sprintf(ddlDropTrigger, updateTrigger),
+		fmt.Sprintf(ddlMappedUpdateTrig, updateTrigger, table, strings.Join(populate, " "), strings.Join(merge, " ")),
+	}
+	for _, SQL := range statements {
+		if _, err := dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+			dbs.log().Error("%s error: %s", SQL, err.Error())
+			return err
+		}
+	}
+	return nil
+}
+
+// mappedFields returns the list of mapped fields of the entity table template (ordered by field name)
+func (dbs *MySqlDatabase) mappedFields(template string) []MappedField {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	result := make([]MappedField, 0, len(dbs.mapped[template]))
+	for _, field := range dbs.mapped[template] {
+		result = append(result, field)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Field < result[j].Field })
+	return result
+}
+
+// endregion
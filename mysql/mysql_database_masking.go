@@ -0,0 +1,159 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Data masking definitions -------------------------------------------------------------------------------------
+
+// MaskFunc masks single field value, it should return value of the same Json type (e.g. string for string fields)
+// so the masked document can still be converted to the entity
+type MaskFunc func(value any) any
+
+// MaskRedact replace string values with *** (other values are replaced with their zero value)
+func MaskRedact(value any) any {
+	switch value.(type) {
+	case nil:
+		return nil
+	case string:
+		return redacted
+	case float64:
+		return float64(0)
+	case bool:
+		return false
+	default:
+		return nil
+	}
+}
+
+// MaskPartial returns mask function which keeps only the last characters of string values (e.g. ****1234)
+//
+// param: keep - Number of characters to keep
+// return: Mask function
+func MaskPartial(keep int) MaskFunc {
+	return func(value any) any {
+		str, ok := value.(string)
+		if !ok {
+			return MaskRedact(value)
+		}
+		if len(str) <= keep {
+			return strings.Repeat("*", len(str))
+		}
+		return strings.Repeat("*", len(str)-keep) + str[len(str)-keep:]
+	}
+}
+
+// MaskEmail keeps the first character of the user name and the domain of email values (e.g. j***@example.com)
+func MaskEmail(value any) any {
+	str, ok := value.(string)
+	if !ok {
+		return MaskRedact(value)
+	}
+	at := strings.LastIndex(str, "@")
+	if at < 1 {
+		return redacted
+	}
+	return str[:1] + redacted + str[at:]
+}
+
+// endregion
+
+// region Data masking methods -----------------------------------------------------------------------------------------
+
+// SetMaskingRules set the masking rules (field name -> mask function) applied to the entities returned from Get, List
+// and the query builder, and to the rows returned from ExecuteQuery. Fields are matched by name at any nesting level,
+// so a dedicated database handle can serve support tooling with redacted PII (nil to disable)
+//
+// param: rules - Map of field name to mask function
+func (dbs *MySqlDatabase) SetMaskingRules(rules map[string]MaskFunc) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.masking = rules
+}
+
+// maskingRules returns the masking rules (nil if disabled)
+func (dbs *MySqlDatabase) maskingRules() map[string]MaskFunc {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.masking
+}
+
+// maskEntity returns masked copy of the entity
+func (dbs *MySqlDatabase) maskEntity(factory EntityFactory, entity Entity) (Entity, error) {
+	rules := dbs.maskingRules()
+	if len(rules) == 0 || entity == nil {
+		return entity, nil
+	}
+
+	data, err := Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]any)
+	if err = Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	maskMap(rules, doc)
+	if data, err = Marshal(doc); err != nil {
+		return nil, err
+	}
+
+	masked := factory()
+	if err = Unmarshal(data, &masked); err != nil {
+		return nil, fmt.Errorf("mask entity %s error: %s", entity.ID(), err.Error())
+	}
+	return masked, nil
+}
+
+// maskEntities returns masked copy of the entities
+func (dbs *MySqlDatabase) maskEntities(factory EntityFactory, list []Entity) ([]Entity, error) {
+	if len(dbs.maskingRules()) == 0 {
+		return list, nil
+	}
+	result := make([]Entity, 0, len(list))
+	for _, entity := range list {
+		masked, err := dbs.maskEntity(factory, entity)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, masked)
+	}
+	return result, nil
+}
+
+// maskRows mask the columns of the query result rows
+func (dbs *MySqlDatabase) maskRows(rows []Json) []Json {
+	rules := dbs.maskingRules()
+	if len(rules) == 0 {
+		return rows
+	}
+	for _, row := range rows {
+		maskMap(rules, row)
+	}
+	return rows
+}
+
+// maskMap mask the fields of the document recursively
+func maskMap(rules map[string]MaskFunc, doc map[string]any) {
+	for key, value := range doc {
+		if mask, ok := rules[key]; ok {
+			doc[key] = mask(value)
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			maskMap(rules, v)
+		case []any:
+			for _, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					maskMap(rules, m)
+				}
+			}
+		}
+	}
+}
+
+// endregion
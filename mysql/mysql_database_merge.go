@@ -0,0 +1,108 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Merge definitions --------------------------------------------------------------------------------------------
+
+const (
+	mergeAttempts       = 10                   // Maximum number of read-modify-write attempts
+	mergeBackoff        = 5 * time.Millisecond // Initial delay between attempts (doubled on every conflict)
+	sqlMergeRead        = `SELECT data, SHA2(CAST(data AS CHAR), 256) FROM "%s" WHERE id = $1`
+	errDuplicateKeyCode = "1062" // MySQL duplicate entry error code
+)
+
+// MergeFunc merge into the current entity and returns the entity to store, the current entity is a new (zero value)
+// entity when the entity does not exist. It may be called several times (on conflicts) so it must not have side effects
+type MergeFunc func(current Entity, exists bool) (Entity, error)
+
+// endregion
+
+// region Merge methods ------------------------------------------------------------------------------------------------
+
+// Merge read-modify-write the entity safely: load the current document (or zero value), apply the merge function and
+// write the result back only if the stored document was not modified in the meantime (by the document hash, see
+// UpdateIfUnchanged), the whole cycle is retried on conflict. This is the "accumulate into a document" pattern
+// (counters, sets, last-seen values) done without locks
+//
+// param: factory - Entity factory
+// param: entityID - The entity id
+// param: mergeFn - The merge function
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: The stored entity, error (ConcurrentModificationError if all attempts conflicted)
+func (dbs *MySqlDatabase) Merge(factory EntityFactory, entityID string, mergeFn MergeFunc, keys ...string) (merged Entity, err error) {
+	if entityID == "" {
+		return nil, fmt.Errorf("empty entity id passed to Merge operation")
+	}
+	defer dbs.observe("merge", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	backoff := mergeBackoff
+	for attempt := 1; ; attempt++ {
+		if merged, err = dbs.merge(factory, entityID, mergeFn, keys...); !errors.Is(err, ErrConcurrentModification) || attempt >= mergeAttempts {
+			return
+		}
+		dbs.log().Debug("merge %s of %s: retry %d after conflict", entityID, factory().TABLE(), attempt)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// merge single read-modify-write attempt
+func (dbs *MySqlDatabase) merge(factory EntityFactory, entityID string, mergeFn MergeFunc, keys ...string) (Entity, error) {
+	template := factory().TABLE()
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	var data, hash string
+	err = dbs.scalar(table, fmt.Sprintf(sqlMergeRead, table), []any{entityID}, &data, &hash)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	current := factory()
+	var original []byte
+	if exists {
+		if current, err = dbs.unmarshal(factory, []byte(data)); err != nil {
+			return nil, err
+		}
+		// the merge function may modify the current entity, so it is serialized before the merge
+		if original, err = dbs.serialize(current); err != nil {
+			return nil, err
+		}
+	}
+
+	merged, err := mergeFn(current, exists)
+	if err != nil {
+		return nil, err
+	}
+	if merged == nil || merged.ID() != entityID {
+		return nil, fmt.Errorf("merge of %s returned entity with different id", entityID)
+	}
+
+	if exists {
+		// nothing to write if the merge did not change the entity (e.g. adding existing member to a set)
+		if result, er := dbs.serialize(merged); er != nil {
+			return nil, er
+		} else if bytes.Equal(result, original) {
+			return merged, nil
+		}
+		return dbs.UpdateIfUnchanged(merged, hash)
+	}
+	if merged, err = dbs.Insert(merged); errorCode(err) == errDuplicateKeyCode {
+		// inserted by another writer since the read
+		return nil, &ConcurrentModificationError{Table: table, Id: entityID}
+	}
+	return merged, err
+}
+
+// endregion
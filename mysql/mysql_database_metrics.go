@@ -0,0 +1,89 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// region Metrics hook definitions -------------------------------------------------------------------------------------
+
+// OperationMetric describes a single database operation
+type OperationMetric struct {
+	Operation string        // The operation type (e.g. get, insert, bulk_insert, find, count)
+	Table     string        // The entity table template (not the resolved shard table, to keep the labels cardinality low)
+	Duration  time.Duration // The operation latency
+	Rows      int64         // Number of rows affected or returned (when known)
+	Batch     int           // Number of entities in the batch (bulk operations only)
+	Error     error         // The operation error (nil on success)
+	ErrorCode string        // The MySQL error code (e.g. 1062), empty if the error is not a MySQL server error
+}
+
+// IMetricsHook is the hook to export the database metrics to a metrics registry (e.g. Prometheus counters, histograms and gauges)
+type IMetricsHook interface {
+
+	// ObserveOperation is called after every database operation
+	ObserveOperation(metric OperationMetric)
+
+	// ObservePool is called after every database operation with the connection pool statistics
+	ObservePool(stats sql.DBStats)
+}
+
+// endregion
+
+// region Metrics hook methods -----------------------------------------------------------------------------------------
+
+// SetMetricsHook set the hook to export operations latency, errors, rows and connection pool metrics (nil to disable)
+//
+// param: hook - Metrics hook
+func (dbs *MySqlDatabase) SetMetricsHook(hook IMetricsHook) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.metrics = hook
+}
+
+// metricsHook returns the configured metrics hook
+func (dbs *MySqlDatabase) metricsHook() IMetricsHook {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.metrics
+}
+
+// observe report the operation metric to the metrics hook (to be used with defer, rows and err are read when the operation completes)
+func (dbs *MySqlDatabase) observe(op, table string, batch int, start time.Time, rows *int64, err *error) {
+	hook := dbs.metricsHook()
+	if hook == nil {
+		return
+	}
+
+	metric := OperationMetric{
+		Operation: op,
+		Table:     table,
+		Duration:  time.Since(start),
+		Batch:     batch,
+	}
+	if rows != nil {
+		metric.Rows = *rows
+	}
+	if err != nil && *err != nil {
+		metric.Error = *err
+		metric.ErrorCode = errorCode(*err)
+	}
+
+	hook.ObserveOperation(metric)
+	hook.ObservePool(dbs.pgDb.Stats())
+}
+
+// errorCode returns the MySQL server error code of the error (empty if not a MySQL error)
+func errorCode(err error) string {
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return strconv.Itoa(int(mysqlErr.Number))
+	}
+	return ""
+}
+
+// endregion
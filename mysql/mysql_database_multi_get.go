@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"fmt"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Multi get definitions ----------------------------------------------------------------------------------------
+
+// GetRequest is a single entity fetched by MultiGet
+type GetRequest struct {
+	Factory EntityFactory // Entity factory
+	Id      string        // Entity id
+	Keys    []string      // Sharding key(s) (for sharded entities and multi-tenant support)
+}
+
+// multiGetGroup is the requests resolved from the same physical table
+type multiGetGroup struct {
+	factory EntityFactory
+	keys    []string
+	ids     []string
+	index   map[string][]int // Map of entity id to the positions of its requests
+}
+
+// endregion
+
+// region Multi get methods --------------------------------------------------------------------------------------------
+
+// MultiGet Get entities of different types by their IDs, the requests are grouped by their physical table and every
+// group is fetched by a single query, for aggregate endpoints assembling several entities per request
+//
+// param: requests - List of (factory, id, keys) requests
+// return: List of entities in the order of the requests (nil for entities which were not found), error
+func (dbs *MySqlDatabase) MultiGet(requests ...GetRequest) ([]Entity, error) {
+	result := make([]Entity, len(requests))
+
+	groups := make(map[string]*multiGetGroup)
+	order := make([]string, 0)
+	for i, req := range requests {
+		if req.Factory == nil || req.Id == "" {
+			return nil, fmt.Errorf("invalid MultiGet request %d: factory and id are required", i)
+		}
+		template := req.Factory().TABLE()
+		table, err := dbs.resolveTable(template, req.Keys...)
+		if err != nil {
+			return nil, err
+		}
+
+		name := template + "|" + table + "|" + tenantOf(req.Keys...)
+		group, ok := groups[name]
+		if !ok {
+			group = &multiGetGroup{factory: req.Factory, keys: req.Keys, index: make(map[string][]int)}
+			groups[name] = group
+			order = append(order, name)
+		}
+		if _, ok = group.index[req.Id]; !ok {
+			group.ids = append(group.ids, req.Id)
+		}
+		group.index[req.Id] = append(group.index[req.Id], i)
+	}
+
+	for _, name := range order {
+		group := groups[name]
+		list, err := dbs.List(group.factory, group.ids, group.keys...)
+		if err != nil {
+			return nil, err
+		}
+		for _, entity := range list {
+			for _, i := range group.index[entity.ID()] {
+				result[i] = entity
+			}
+		}
+	}
+	return result, nil
+}
+
+// endregion
@@ -0,0 +1,132 @@
+package mysql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Named parameters methods -------------------------------------------------------------------------------------
+
+// BindNamed expand the :name parameters of the SQL to positional placeholders (?) and returns the matching arguments,
+// slice values are expanded to list of placeholders (e.g. IN (:ids)) and empty slice is expanded to NULL. String
+// literals, quoted identifiers, comments, casts (::) and assignments (:=) are left intact
+//
+// param: sql - The SQL with named parameters
+// param: params - Map of parameter name to value
+// return: SQL with positional placeholders, arguments, error
+func BindNamed(sql string, params map[string]any) (string, []any, error) {
+	sb := strings.Builder{}
+	args := make([]any, 0, len(params))
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(sql, i)
+			sb.WriteString(sql[i:end])
+			i = end - 1
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			sb.WriteString(sql[i : i+end])
+			i += end - 1
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				end = len(sql) - i
+			} else {
+				end += 4
+			}
+			sb.WriteString(sql[i : i+end])
+			i += end - 1
+		case c == ':' && i+1 < len(sql) && (sql[i+1] == ':' || sql[i+1] == '='):
+			sb.WriteString(sql[i : i+2])
+			i++
+		case c == ':' && i+1 < len(sql) && isNameStart(sql[i+1]):
+			end := i + 1
+			for end < len(sql) && isNamePart(sql[end]) {
+				end++
+			}
+			name := sql[i+1 : end]
+			value, ok := params[name]
+			if !ok {
+				return "", nil, fmt.Errorf("missing value of named parameter: %s", name)
+			}
+			args = bindValue(&sb, args, value)
+			i = end - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String(), args, nil
+}
+
+// namedArgs expand the named parameters when the single statement argument is a map of parameters
+func namedArgs(sql string, args []any) (string, []any, error) {
+	if len(args) != 1 {
+		return sql, args, nil
+	}
+	switch params := args[0].(type) {
+	case map[string]any:
+		return BindNamed(sql, params)
+	case Json:
+		return BindNamed(sql, params)
+	}
+	return sql, args, nil
+}
+
+// bindValue write the placeholder(s) of the value and append the argument(s)
+func bindValue(sb *strings.Builder, args []any, value any) []any {
+	v := reflect.ValueOf(value)
+	if value == nil || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Type().Elem().Kind() == reflect.Uint8 {
+		sb.WriteByte('?')
+		return append(args, value)
+	}
+	if v.Len() == 0 {
+		sb.WriteString("NULL")
+		return args
+	}
+	for j := 0; j < v.Len(); j++ {
+		if j > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteByte('?')
+		args = append(args, v.Index(j).Interface())
+	}
+	return args
+}
+
+// skipQuoted returns the index after the quoted literal starting at i (doubled or backslash escaped quotes included)
+func skipQuoted(sql string, i int) int {
+	quote := sql[i]
+	for j := i + 1; j < len(sql); j++ {
+		switch sql[j] {
+		case '\\':
+			if quote != '`' {
+				j++
+			}
+		case quote:
+			if j+1 < len(sql) && sql[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(sql)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNamePart(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// endregion
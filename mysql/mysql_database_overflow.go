@@ -0,0 +1,519 @@
+package mysql
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// overflowField is the document field holding the pointer to the overflow blob
+const overflowField = "_overflow"
+
+// overflowGrace is the age below which unreferenced blobs are not purged: the blob is stored before the row is written,
+// so recent blobs may belong to writes in progress
+const overflowGrace = time.Minute
+
+// region Overflow storage definitions ---------------------------------------------------------------------------------
+
+// IBlobStore stores the bodies of large documents outside the entity table (e.g. object store)
+type IBlobStore interface {
+
+	// Put store the blob by key (blobs are content addressed, so putting existing key may be skipped)
+	Put(key string, data []byte) error
+
+	// Get returns the blob by key
+	Get(key string) ([]byte, error)
+
+	// Delete the blob by key
+	Delete(key string) error
+}
+
+// IBlobLister is optionally implemented by blob stores to support PurgeOverflow
+type IBlobLister interface {
+
+	// List returns the keys of the blobs with the prefix
+	List(prefix string) ([]string, error)
+}
+
+// overflowPointer is the pointer stored in the main row instead of the document body
+type overflowPointer struct {
+	Key  string `json:"key"`  // The blob key
+	Size int    `json:"size"` // The document size (bytes)
+}
+
+// overflowStorage is the overflow configuration of entity table template
+type overflowStorage struct {
+	threshold int
+	store     IBlobStore
+}
+
+const (
+	overflowBlobsTable = "overflow_blobs"
+	ddlOverflowBlobs   = `CREATE TABLE IF NOT EXISTS "overflow_blobs" (blob_key VARCHAR(255) PRIMARY KEY NOT NULL, data LONGBLOB NOT NULL)`
+	sqlPutBlob         = `INSERT IGNORE INTO "overflow_blobs" (blob_key, data) VALUES ($1, $2)`
+	sqlGetBlob         = `SELECT data FROM "overflow_blobs" WHERE blob_key = $1`
+	sqlDeleteBlob      = `DELETE FROM "overflow_blobs" WHERE blob_key = $1`
+	sqlListBlobs       = `SELECT blob_key FROM "overflow_blobs" WHERE blob_key LIKE $1`
+	sqlOverflowKeys    = `SELECT JSON_UNQUOTE(JSON_EXTRACT(data, '$._overflow.key')) FROM "%s" WHERE JSON_EXTRACT(data, '$._overflow') IS NOT NULL`
+
+	// sqlOverflowCopyKeys list the keys of the documents copied to the history and trash tables (under the data field),
+	// and sqlOverflowAuditKeys the keys of the before or after documents of the table audit entries
+	sqlOverflowCopyKeys  = `SELECT JSON_UNQUOTE(JSON_EXTRACT(data, '$.data._overflow.key')) FROM "%s" WHERE JSON_EXTRACT(data, '$.data._overflow') IS NOT NULL`
+	sqlOverflowAuditKeys = `SELECT JSON_UNQUOTE(JSON_EXTRACT(data, '$.%s._overflow.key')) FROM "%s" WHERE data->>'table' = $1 AND JSON_EXTRACT(data, '$.%s._overflow') IS NOT NULL`
+)
+
+// overflowReference is a statement listing the blob keys referenced by the documents of a table
+type overflowReference struct {
+	table string
+	SQL   string
+	args  []any
+}
+
+// mySqlBlobStore is the default blob store: the overflow_blobs table of the database
+type mySqlBlobStore struct {
+	dbs   *MySqlDatabase
+	mu    sync.Mutex
+	ready bool
+}
+
+// endregion
+
+// region Overflow storage methods -------------------------------------------------------------------------------------
+
+// SetOverflowStorage store the body of documents larger than the threshold in the blob store, the main row holds only
+// the id, the promoted, mapped and version fields and a pointer to the blob, keeping the entity table small. Like
+// encrypted documents, only these fields can be used in query filters of overflowed documents.
+// The blob key is the physical table, the write time and the content hash (e.g. hero-acme/1700000000000-3f2a..), so a
+// failed or replaced write leaves orphan blobs (see PurgeOverflow). In place updates (SetField, IncrementField, Patch
+// and the array operations) of overflowed documents are applied in memory and written back if the row was not modified
+// in the meantime, bulk and query set fields are not supported
+//
+// param: factory - Entity factory
+// param: threshold - Document size (bytes) above which the body is stored in the blob store (0 to disable)
+// param: store - The blob store (nil for the overflow_blobs table of the database)
+func (dbs *MySqlDatabase) SetOverflowStorage(factory EntityFactory, threshold int, store IBlobStore) {
+	template := factory().TABLE()
+	if store == nil {
+		store = &mySqlBlobStore{dbs: dbs}
+	}
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if threshold <= 0 {
+		delete(dbs.overflow, template)
+		return
+	}
+	if dbs.overflow == nil {
+		dbs.overflow = make(map[string]*overflowStorage)
+	}
+	dbs.overflow[template] = &overflowStorage{threshold: threshold, store: store}
+}
+
+// PurgeOverflow delete the blobs of the physical table which are no longer referenced by any of its documents, or by the
+// copies of its documents: prior versions (history), soft deleted entities (trash) and audit entries (requires blob
+// store which implements IBlobLister, the default store does). Blobs written less than a minute before the purge
+// started are kept (their rows may not be written yet), as well as blobs whose key has no write time
+//
+// param: factory - Entity factory
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Number of deleted blobs, error
+func (dbs *MySqlDatabase) PurgeOverflow(factory EntityFactory, keys ...string) (deleted int64, err error) {
+	template := factory().TABLE()
+	storage := dbs.overflowStorage(template)
+	if storage == nil {
+		return 0, fmt.Errorf("overflow storage is not enabled for: %s", template)
+	}
+	lister, ok := storage.store.(IBlobLister)
+	if !ok {
+		return 0, fmt.Errorf("the overflow blob store of %s does not support listing", template)
+	}
+
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-overflowGrace).UnixMilli()
+	refs, err := dbs.overflowReferences(table, tenantOf(keys...))
+	if err != nil {
+		return
+	}
+	referenced := make(map[string]bool)
+	for _, ref := range refs {
+		if err = dbs.collectOverflowKeys(ref, tenantOf(keys...), referenced); err != nil {
+			return
+		}
+	}
+
+	blobs, err := lister.List(table + "/")
+	if err != nil {
+		return
+	}
+	for _, key := range blobs {
+		if referenced[key] {
+			continue
+		}
+		if written, ok := blobTime(table, key); !ok || written >= cutoff {
+			continue
+		}
+		if err = storage.store.Delete(key); err != nil {
+			return
+		}
+		deleted++
+	}
+	return
+}
+
+// overflowReferences returns the statements listing the blob keys referenced by the documents of the physical table and
+// by the copies of its documents in the history, trash and audit tables (the companion tables may exist even if the
+// features are currently disabled)
+func (dbs *MySqlDatabase) overflowReferences(table, tenant string) (refs []overflowReference, err error) {
+
+	refs = []overflowReference{{table: table, SQL: fmt.Sprintf(sqlOverflowKeys, table)}}
+
+	for _, companion := range []string{historyTable(table), trashTableName(table)} {
+		if exists, er := dbs.listTables(companion); er != nil {
+			return nil, er
+		} else if len(exists) > 0 {
+			refs = append(refs, overflowReference{table: companion, SQL: fmt.Sprintf(sqlOverflowCopyKeys, companion)})
+		}
+	}
+
+	auditKey := tenant
+	if auditKey == "" {
+		auditKey = auditGlobalTenant
+	}
+	auditTable := dbs.tableName((&AuditEntry{}).TABLE(), auditKey)
+	if exists, er := dbs.listTables(auditTable); er != nil {
+		return nil, er
+	} else if len(exists) > 0 {
+		for _, doc := range []string{"before", "after"} {
+			SQL := fmt.Sprintf(sqlOverflowAuditKeys, doc, auditTable, doc)
+			refs = append(refs, overflowReference{table: auditTable, SQL: SQL, args: []any{table}})
+		}
+	}
+	return refs, nil
+}
+
+// collectOverflowKeys add the blob keys listed by the reference statement to the referenced keys
+func (dbs *MySqlDatabase) collectOverflowKeys(ref overflowReference, tenant string, referenced map[string]bool) error {
+	rows, err := dbs.query(dbs.pgDb, ref.table, tenant, ref.SQL, ref.args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return err
+		}
+		referenced[key] = true
+	}
+	return rows.Err()
+}
+
+// overflowStorage returns the overflow storage of the entity table template (nil if not enabled)
+func (dbs *MySqlDatabase) overflowStorage(template string) *overflowStorage {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.overflow[template]
+}
+
+// blobTime returns the write time (epoch milliseconds) of the physical table blob key
+func blobTime(table, key string) (int64, bool) {
+	name := strings.TrimPrefix(key, table+"/")
+	idx := strings.Index(name, "-")
+	if idx < 0 || strings.Contains(name, "/") {
+		return 0, false
+	}
+	written, err := strconv.ParseInt(name[:idx], 10, 64)
+	return written, err == nil
+}
+
+// spill store the document of the physical table in the blob store if it exceeds the threshold, returns the pointer document
+func (dbs *MySqlDatabase) spill(template, table string, data []byte) ([]byte, error) {
+	storage := dbs.overflowStorage(template)
+	if storage == nil || len(data) <= storage.threshold {
+		return data, nil
+	}
+
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	pointer := overflowPointer{Key: fmt.Sprintf("%s/%d-%s", table, time.Now().UnixMilli(), hex.EncodeToString(hash[:])), Size: len(data)}
+	if err := storage.store.Put(pointer.Key, data); err != nil {
+		return nil, err
+	}
+
+	// keep the fields used by the database in the clear: id, promoted, mapped and version fields
+	clear := []string{"id", dbs.versionField(template)}
+	for _, field := range dbs.promotedFields(template) {
+		clear = append(clear, field.Field)
+	}
+	for _, field := range dbs.mappedFields(template) {
+		clear = append(clear, field.Field)
+	}
+
+	out := map[string]any{overflowField: pointer}
+	for _, field := range clear {
+		if value, ok := doc[field]; ok {
+			out[field] = value
+		}
+	}
+	return json.Marshal(out)
+}
+
+// restore load the document body of pointer document from the blob store (other documents are returned as is)
+func (dbs *MySqlDatabase) restore(template string, data []byte) ([]byte, error) {
+	if !bytes.Contains(data, []byte(`"`+overflowField+`"`)) {
+		return data, nil
+	}
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	raw, ok := doc[overflowField]
+	if !ok {
+		return data, nil
+	}
+	pointer := overflowPointer{}
+	if err := json.Unmarshal(raw, &pointer); err != nil {
+		return nil, err
+	}
+
+	storage := dbs.overflowStorage(template)
+	if storage == nil {
+		return nil, fmt.Errorf("overflow storage is not enabled for: %s, can't load blob %s", template, pointer.Key)
+	}
+	return storage.store.Get(pointer.Key)
+}
+
+// endregion
+
+// region Overflowed documents update methods -------------------------------------------------------------------------
+
+// rewritesInMemory check if the in-place updates (set field, increment, patch and array operations) of the table
+// template are applied in memory (see rewriteDocument): overflowed documents, whose body can't be modified on the
+// server, and validated documents, which are validated before they are written
+func (dbs *MySqlDatabase) rewritesInMemory(template string) bool {
+	return dbs.overflowStorage(template) != nil || dbs.validating(template)
+}
+
+// rewriteDocument read-modify-write the stored document in memory, used by the in-place updates of overflowed and
+// validated documents (see rewritesInMemory). The modified document is validated, and written back (and spilled again)
+// only if the row was not modified in the meantime, the cycle is retried on conflict.
+// The modify function returns false if the document was not changed (nothing is written)
+func (dbs *MySqlDatabase) rewriteDocument(template, table, tenant, entityID, action string, modify func(doc map[string]any) (bool, error)) (changed bool, err error) {
+	backoff := mergeBackoff
+	for attempt := 1; ; attempt++ {
+		if changed, err = dbs.rewriteDocumentOnce(template, table, tenant, entityID, action, modify); !errors.Is(err, ErrConcurrentModification) || attempt >= mergeAttempts {
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// rewriteDocumentOnce single read-modify-write attempt of the stored document
+func (dbs *MySqlDatabase) rewriteDocumentOnce(template, table, tenant, entityID, action string, modify func(doc map[string]any) (bool, error)) (bool, error) {
+	var data, hash string
+	if err := dbs.scalar(table, fmt.Sprintf(sqlMergeRead, table), []any{entityID}, &data, &hash); errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("no row fetched for id: %s", entityID)
+	} else if err != nil {
+		return false, err
+	}
+
+	plain, err := dbs.decode(template, []byte(data))
+	if err != nil {
+		return false, err
+	}
+	doc := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(plain))
+	decoder.UseNumber()
+	if err = decoder.Decode(&doc); err != nil {
+		return false, err
+	}
+
+	if changed, er := modify(doc); er != nil || !changed {
+		return false, er
+	}
+
+	if plain, err = json.Marshal(doc); err != nil {
+		return false, err
+	}
+	if err = dbs.validate(template, entityID, plain); err != nil {
+		return false, err
+	}
+	encoded, err := dbs.encode(template, table, plain)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := dbs.execAudited(action, template, table, tenant, entityID, nil, fmt.Sprintf(sqlUpdateIfUnchanged, table), entityID, encoded, hash)
+	if err != nil {
+		return false, err
+	}
+	if affected, er := result.RowsAffected(); er != nil {
+		return false, er
+	} else if affected == 0 {
+		return false, &ConcurrentModificationError{Table: table, Id: entityID, Hash: hash}
+	}
+	return true, nil
+}
+
+// incrementValue add delta to the numeric field of the document (missing field is treated as zero)
+func incrementValue(doc map[string]any, field string, delta int64) error {
+	current := int64(0)
+	switch value := doc[field].(type) {
+	case nil:
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return fmt.Errorf("field %s is not numeric", field)
+		}
+		current = int64(f)
+	default:
+		return fmt.Errorf("field %s is not numeric", field)
+	}
+	doc[field] = current + delta
+	return nil
+}
+
+// mergePatchValue apply RFC 7386 merge patch to the target value, returns the patched value
+func mergePatchValue(target, patch any) any {
+	fields, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = make(map[string]any)
+	}
+	for field, value := range fields {
+		if value == nil {
+			delete(doc, field)
+		} else {
+			doc[field] = mergePatchValue(doc[field], value)
+		}
+	}
+	return doc
+}
+
+// arrayValue returns the array field of the document (empty array if missing)
+func arrayValue(doc map[string]any, field string) ([]any, error) {
+	switch value := doc[field].(type) {
+	case nil:
+		return make([]any, 0), nil
+	case []any:
+		return value, nil
+	default:
+		return nil, fmt.Errorf("field %s is not an array", field)
+	}
+}
+
+// valueIndex returns the index of the value in the array (-1 if not found), values are compared as Json values
+func valueIndex(array []any, value any) int {
+	for i, item := range array {
+		if reflect.DeepEqual(item, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// jsonValue convert the value to its decoded Json representation (numbers are kept as json.Number)
+func jsonValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(data)
+}
+
+// endregion
+
+// region Default blob store methods -----------------------------------------------------------------------------------
+
+// Put store the blob in the overflow_blobs table
+func (s *mySqlBlobStore) Put(key string, data []byte) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+	_, err := s.dbs.exec(s.dbs.pgDb, overflowBlobsTable, "", sqlPutBlob, key, data)
+	return err
+}
+
+// Get returns the blob from the overflow_blobs table
+func (s *mySqlBlobStore) Get(key string) (data []byte, err error) {
+	if err = s.ensureTable(); err != nil {
+		return nil, err
+	}
+	if err = s.dbs.scalar(overflowBlobsTable, sqlGetBlob, []any{key}, &data); errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("overflow blob %s not found", key)
+	}
+	return
+}
+
+// Delete the blob from the overflow_blobs table
+func (s *mySqlBlobStore) Delete(key string) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+	_, err := s.dbs.exec(s.dbs.pgDb, overflowBlobsTable, "", sqlDeleteBlob, key)
+	return err
+}
+
+// List returns the keys of the blobs with the prefix
+func (s *mySqlBlobStore) List(prefix string) ([]string, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+	rows, err := s.dbs.query(s.dbs.pgDb, overflowBlobsTable, "", sqlListBlobs, globToLike(prefix)+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ensureTable create the overflow_blobs table if not already created
+func (s *mySqlBlobStore) ensureTable() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ready {
+		return nil
+	}
+	if _, err := s.dbs.exec(s.dbs.pgDb, overflowBlobsTable, "", ddlOverflowBlobs); err != nil {
+		return err
+	}
+	s.ready = true
+	return nil
+}
+
+// endregion
@@ -0,0 +1,116 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/go-yaaf/yaaf-common/messaging"
+)
+
+// region Patch definitions --------------------------------------------------------------------------------------------
+
+// PatchMessageTopic is the topic prefix of entity patch messages: PATCH-{Table}-{Key}
+const PatchMessageTopic = "PATCH"
+
+// EntityPatch is the payload of entity patch message
+type EntityPatch struct {
+	Table    string `json:"table"`    // The entity table (template)
+	EntityId string `json:"entityId"` // The entity id
+	Tenant   string `json:"tenant"`   // The tenant (shard key)
+	Patch    Json   `json:"patch"`    // The RFC 7386 merge patch
+}
+
+const sqlMergePatch = `UPDATE "%s" SET data = JSON_MERGE_PATCH(data, CAST($1 AS JSON)) WHERE id = $2`
+
+// endregion
+
+// region Patch methods ------------------------------------------------------------------------------------------------
+
+// Patch apply RFC 7386 merge patch to the entity document on the server in a single statement: fields of the patch are
+// set (recursively for nested objects) and fields with null value are removed. The patch is published as entity patch
+// message (see PatchMessageTopic)
+//
+// param: factory - Entity factory
+// param: entityID - The entity ID to patch
+// param: patch - The merge patch
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) Patch(factory EntityFactory, entityID string, patch Json, keys ...string) (err error) {
+	template := factory().TABLE()
+	defer dbs.observe("patch", template, 0, time.Now(), nil, &err)
+
+	if err = dbs.admitWrite(template, 1); err != nil {
+		return err
+	}
+
+	if len(patch) == 0 {
+		return nil
+	}
+	if dbs.envelope(template) != nil {
+		return fmt.Errorf("patch is not supported for encrypted documents")
+	}
+
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return
+	}
+
+	release := dbs.throttle(keys...)
+	defer release()
+
+	if dbs.rewritesInMemory(template) {
+		// Overflowed and validated documents are patched in memory
+		value, er := decodeValue(data)
+		if er != nil {
+			return er
+		}
+		if _, err = dbs.rewriteDocument(template, table, tenantOf(keys...), entityID, AuditPatch, func(doc map[string]any) (bool, error) {
+			mergePatchValue(doc, value)
+			return true, nil
+		}); err != nil {
+			return
+		}
+		dbs.publishPatch(template, entityID, tenantOf(keys...), patch)
+		return nil
+	}
+
+	result, err := dbs.execAudited(AuditPatch, template, table, tenantOf(keys...), entityID, nil, fmt.Sprintf(sqlMergePatch, table), string(data), entityID)
+	if err != nil {
+		return
+	}
+	if affected, er := result.RowsAffected(); er != nil {
+		return er
+	} else if affected == 0 {
+		return fmt.Errorf("no row affected when executing patch operation")
+	}
+
+	dbs.publishPatch(template, entityID, tenantOf(keys...), patch)
+	return nil
+}
+
+// publishPatch publish entity patch message
+func (dbs *MySqlDatabase) publishPatch(template, entityID, tenant string, patch Json) {
+	if dbs.bus == nil {
+		return
+	}
+
+	message := &messaging.EntityMessage{
+		BaseMessage: messaging.BaseMessage{
+			MsgTopic:     fmt.Sprintf("%s-%s-%s", PatchMessageTopic, template, tenant),
+			MsgOpCode:    int(UpdateEntity),
+			MsgSessionId: entityID,
+		},
+		MsgPayload: &EntityPatch{Table: template, EntityId: entityID, Tenant: tenant, Patch: patch},
+	}
+	if err := dbs.bus.Publish(message); err != nil {
+		dbs.log().Warn("error publishing patch: %s", err.Error())
+	}
+}
+
+// endregion
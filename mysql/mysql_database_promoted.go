@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"fmt"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Promoted fields definitions ----------------------------------------------------------------------------------
+
+// PromotedField describes an entity field which is materialized as a generated column with a real index
+type PromotedField struct {
+	Field   string // The entity (json) field name
+	Column  string // The generated column name (default: the field name)
+	SqlType string // The generated column SQL type (default: varchar(255))
+	Stored  bool   // Create STORED column (true) or VIRTUAL column (false)
+}
+
+const (
+	ddlAddGeneratedColumn = `ADD COLUMN "%s" %s GENERATED ALWAYS AS (JSON_UNQUOTE(JSON_EXTRACT(data, '$.%s'))) %s`
+	ddlAddColumnIndex     = `ADD INDEX "%s_%s_idx" ("%s")`
+	sqlColumnExists       = `SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), DATABASE()) AND TABLE_NAME = $2 AND COLUMN_NAME = $3`
+)
+
+// column returns the generated column name
+func (p PromotedField) column() string {
+	if p.Column == "" {
+		return p.Field
+	}
+	return p.Column
+}
+
+// sqlType returns the generated column SQL type
+func (p PromotedField) sqlType() string {
+	if p.SqlType == "" {
+		return "varchar(255)"
+	}
+	return p.SqlType
+}
+
+// endregion
+
+// region Promoted fields methods --------------------------------------------------------------------------------------
+
+// PromoteFields register entity fields to be materialized as generated columns.
+// Once registered, the query builder uses the generated column instead of extracting the field from the json document
+//
+// param: factory - Entity factory
+// param: fields - List of fields to promote
+func (dbs *MySqlDatabase) PromoteFields(factory EntityFactory, fields ...PromotedField) {
+	table := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.promoted == nil {
+		dbs.promoted = make(map[string]map[string]PromotedField)
+	}
+	if _, ok := dbs.promoted[table]; !ok {
+		dbs.promoted[table] = make(map[string]PromotedField)
+	}
+	for _, field := range fields {
+		dbs.promoted[table][field.Field] = field
+	}
+}
+
+// CreatePromotedColumns create the generated columns and indexes of all the promoted fields, geo fields, mapped fields
+// and timestamp columns of the entity table
+// columns which already exist are skipped, so it is safe to call it on every startup
+//
+// param: factory - Entity factory
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) CreatePromotedColumns(factory EntityFactory, keys ...string) (err error) {
+	template := factory().TABLE()
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+	return dbs.createPromotedColumns(template, table)
+}
+
+// createPromotedColumns create the generated columns and indexes of the promoted fields (the geo fields, the mapped fields and the timestamp columns) of the template
+// in the physical table
+func (dbs *MySqlDatabase) createPromotedColumns(template, table string) (err error) {
+
+	for _, field := range dbs.promotedFields(template) {
+		column := field.column()
+
+		var count int
+		if err = dbs.scalar(table, sqlColumnExists, schemaArgs(table, column), &count); err != nil {
+			return
+		}
+		if count > 0 {
+			continue
+		}
+
+		kind := "VIRTUAL"
+		if field.Stored {
+			kind = "STORED"
+		}
+
+		alter := fmt.Sprintf(ddlAddGeneratedColumn, column, field.sqlType(), field.Field, kind)
+		alter = fmt.Sprintf("%s, %s", alter, fmt.Sprintf(ddlAddColumnIndex, baseName(table), column, column))
+		if err = dbs.AlterTable(table, alter); err != nil {
+			return
+		}
+	}
+	if err = dbs.createGeoColumns(template, table); err != nil {
+		return
+	}
+	if err = dbs.createMappedColumns(template, table); err != nil {
+		return
+	}
+	return dbs.createTimestampColumns(template, table)
+}
+
+// promotedFields returns the list of promoted fields of the entity table template
+func (dbs *MySqlDatabase) promotedFields(template string) []PromotedField {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	result := make([]PromotedField, 0, len(dbs.promoted[template]))
+	for _, field := range dbs.promoted[template] {
+		result = append(result, field)
+	}
+	return result
+}
+
+// promotedColumn returns the column of the entity field (if the field is promoted or mapped)
+func (dbs *MySqlDatabase) promotedColumn(template, field string) (column string, ok bool) {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	if pf, exists := dbs.promoted[template][field]; exists {
+		return fmt.Sprintf(`"%s"`, pf.column()), true
+	}
+	if mf, exists := dbs.mapped[template][field]; exists {
+		return fmt.Sprintf(`"%s"`, mf.column()), true
+	}
+	return "", false
+}
+
+// endregion
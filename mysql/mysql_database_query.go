@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strconv"
@@ -14,6 +15,64 @@ import (
 
 var functions = []string{"count", "avg", "sum", "min", "max"}
 
+// region mySql query extended interface -------------------------------------------------------------------------------
+
+// IMySqlQuery extends the database query interface with MySQL specific capabilities
+// The query returned by the database Query() method can be asserted to this interface
+type IMySqlQuery interface {
+	database.IQuery
+
+	// Across execute the query against multiple shard tables (one per shard key) and merge the results
+	Across(keys ...string) IMySqlQuery
+
+	// MergeOnServer merge the cross-shard results in a single UNION ALL statement instead of concurrent queries
+	MergeOnServer() IMySqlQuery
+
+	// WithinRadius filter entities located within the radius (in meters) from the center (see SetGeoFields)
+	WithinRadius(column string, lat, lng, meters float64) IMySqlQuery
+
+	// WithinBox filter entities located within the bounding box (see SetGeoFields)
+	WithinBox(column string, minLat, minLng, maxLat, maxLng float64) IMySqlQuery
+
+	// NearestFirst sort the results by the distance from the point (nearest first, before any other sort order)
+	NearestFirst(column string, lat, lng float64) IMySqlQuery
+
+	// Include load the related entities of the relation with the results of FindRelated
+	Include(relation Relation) IMySqlQuery
+
+	// FindRelated execute the query and returns the entities with the related entities of the included relations
+	FindRelated(keys ...string) (out []RelatedEntity, total int64, err error)
+
+	// UseIndex hint the optimizer to consider only the listed indexes of the entity table
+	UseIndex(indexes ...string) IMySqlQuery
+
+	// ForceIndex hint the optimizer to use the listed indexes of the entity table instead of table scan
+	ForceIndex(indexes ...string) IMySqlQuery
+
+	// IgnoreIndex hint the optimizer not to use the listed indexes of the entity table
+	IgnoreIndex(indexes ...string) IMySqlQuery
+
+	// FindWithTotal execute the query and returns the page of entities with the exact total of matching rows in a single round trip
+	FindWithTotal(keys ...string) (out []Entity, total int64, err error)
+
+	// Window execute the query and returns the entities with the window function values (running total, rank, lag/lead)
+	Window(columns []WindowColumn, keys ...string) (out []WindowResult, err error)
+
+	// Downsample bucket the entities into fixed time intervals and returns the aggregated values per bucket
+	Downsample(timeField string, interval time.Duration, aggregations []Downsampling, keys ...string) (out []DataPoint, err error)
+
+	// Exists filter entities having at least one related entity matching the filters
+	Exists(relation Relation, filters ...database.QueryFilter) IMySqlQuery
+
+	// NotExists filter entities having no related entity matching the filters
+	NotExists(relation Relation, filters ...database.QueryFilter) IMySqlQuery
+
+	// FindAsync execute the query and stream the result entities over channel while they are read from the server
+	FindAsync(ctx context.Context, keys ...string) (<-chan Entity, <-chan error)
+}
+
+// endregion
+
 // region mySql query internal structure ----------------------------------------------------------------------------
 
 type mSqlDatabaseQuery struct {
@@ -29,6 +88,14 @@ type mSqlDatabaseQuery struct {
 	rangeField string                   // Field name for range filter (must be timestamp field)
 	rangeFrom  Timestamp                // Start timestamp for range filter
 	rangeTo    Timestamp                // End timestamp for range filter
+	table      string                   // Explicit physical table name (overrides the table name resolution)
+	shards     []string                 // Shard keys for cross-shard queries
+	serverSide bool                     // Merge cross-shard results on the server (UNION ALL)
+	geoFilters []geoFilter              // Geo filters (bounding box or radius)
+	geoOrder   *geoFilter               // Point to sort by the distance from (nearest first)
+	relations  []Relation               // Related entities to load with the results (FindRelated)
+	indexHints []indexHint              // Index hints of the entity table (USE, FORCE or IGNORE INDEX)
+	relFilters []relatedFilter          // Filters on the related entity tables (EXISTS / NOT EXISTS)
 }
 
 // endregion
@@ -52,6 +119,9 @@ func (s *mSqlDatabaseQuery) Filter(filter database.QueryFilter) database.IQuery
 }
 
 // Range add time frame filter on specific time field
+// For time based entity tables (e.g. monthly tables), Find, FindWithTotal, FindAsync, Count, Aggregation and GroupCount
+// target all the existing tables of the periods within the range (the shard keys are still required), the other
+// operations target the table of the reference time only
 func (s *mSqlDatabaseQuery) Range(field string, from Timestamp, to Timestamp) database.IQuery {
 	s.rangeField = field
 	s.rangeFrom = from
@@ -138,26 +208,30 @@ func (s *mSqlDatabaseQuery) List(entityIDs []string, keys ...string) (out []Enti
 // On each record, after the marshaling the result shall be transformed via the query callback chain
 func (s *mSqlDatabaseQuery) Find(keys ...string) (out []Entity, total int64, err error) {
 
-	sqlState, args := s.buildStatement(keys...)
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, 0, err
+	}
+
+	release := s.db.throttle(keys...)
+	defer release()
+	defer s.db.observe("find", s.factory().TABLE(), 0, time.Now(), nil, &err)
 
-	statement, e := s.db.pgDb.Prepare(sqlState)
-	if e != nil {
-		return nil, 0, e
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, 0, err
 	}
+	defer admitted()
 
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
+	if s.isAcross() {
+		return s.findAcross(keys...)
+	}
+
+	sqlState, args := s.buildStatement(keys...)
 
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), sqlState, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return nil, 0, e
+		return nil, 0, fe
 	}
 
 	// Scan row by row and fetch entities
@@ -174,6 +248,8 @@ func (s *mSqlDatabaseQuery) Find(keys ...string) (out []Entity, total int64, err
 	}
 
 	_ = rows.Close()
+	release()
+	admitted()
 
 	// Get the rows count
 	total, err = s.Count(keys...)
@@ -184,14 +260,14 @@ func (s *mSqlDatabaseQuery) Find(keys ...string) (out []Entity, total int64, err
 func (s *mSqlDatabaseQuery) Select(fields ...string) ([]Json, error) {
 
 	// Build the SQL select
-	tblName := tableName(s.factory().TABLE())
+	tblName := s.tableName()
 
 	// Build the WHERE clause
 	where, args := s.buildCriteria()
 	order := s.buildOrder()
 	limit := s.buildLimit()
 
-	SQL := fmt.Sprintf(`SELECT id FROM "%s" %s %s %s`, tblName, where, order, limit)
+	SQL := fmt.Sprintf(`SELECT id FROM "%s"%s %s %s %s`, tblName, s.buildIndexHints(), where, order, limit)
 
 	if len(fields) > 0 {
 		fieldArr := make([]string, 0)
@@ -203,27 +279,13 @@ func (s *mSqlDatabaseQuery) Select(fields ...string) ([]Json, error) {
 			}
 		}
 		selectFields := strings.Join(fieldArr, ",")
-		SQL = fmt.Sprintf(`SELECT %s FROM "%s" %s %s %s`, selectFields, tblName, where, order, limit)
+		SQL = fmt.Sprintf(`SELECT %s FROM "%s"%s %s %s %s`, selectFields, tblName, s.buildIndexHints(), where, order, limit)
 	}
 
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return nil, e
-	}
-
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
-
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, tblName, "", SQL, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return nil, e
+		return nil, fe
 	}
 
 	result := make([]Json, 0)
@@ -266,26 +328,29 @@ func (s *mSqlDatabaseQuery) Select(fields ...string) ([]Json, error) {
 // returns only the count of matching rows
 func (s *mSqlDatabaseQuery) Count(keys ...string) (total int64, err error) {
 
-	SQL, args := s.buildCountStatement("", "count", keys...)
+	if err := s.validateKeys(keys...); err != nil {
+		return 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("count", s.factory().TABLE(), 0, time.Now(), &total, &err)
 
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return 0, e
+	admitted, err := s.admit()
+	if err != nil {
+		return 0, err
 	}
+	defer admitted()
 
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
+	if s.isAcross() {
+		return s.countAcross(keys...)
+	}
+
+	SQL, args := s.buildCountStatement("", "count", keys...)
 
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), SQL, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return 0, e
+		return 0, fe
 	}
 
 	if rows.Next() {
@@ -300,29 +365,31 @@ func (s *mSqlDatabaseQuery) Count(keys ...string) (total int64, err error) {
 // supported functions: count ,avg, sum, min, max
 func (s *mSqlDatabaseQuery) Aggregation(field string, function database.AggFunc, keys ...string) (value float64, err error) {
 
-	if !collections.Include(functions, string(function)) {
-		return 0, fmt.Errorf("function %s not supported", function)
+	if err := s.validateKeys(keys...); err != nil {
+		return 0, err
 	}
-	SQL, args := s.buildCountStatement(field, string(function), keys...)
 
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return 0, e
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("aggregation", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return 0, err
 	}
+	defer admitted()
 
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
+	if !collections.Include(functions, string(function)) {
+		return 0, fmt.Errorf("function %s not supported", function)
+	}
+	if s.isAcross() {
+		return s.aggregationAcross(field, function, keys...)
+	}
+	SQL, args := s.buildCountStatement(field, string(function), keys...)
 
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), SQL, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return 0, e
+		return 0, fe
 	}
 
 	if rows.Next() {
@@ -334,29 +401,35 @@ func (s *mSqlDatabaseQuery) Aggregation(field string, function database.AggFunc,
 }
 
 // GroupCount Execute the query based on the criteria, grouped by field and return count per group
-func (s *mSqlDatabaseQuery) GroupCount(field string, keys ...string) (map[any]int64, int64, error) {
+func (s *mSqlDatabaseQuery) GroupCount(field string, keys ...string) (_ map[any]int64, _ int64, err error) {
+
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("group_count", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer admitted()
+
+	if s.isAcross() {
+		return s.groupCountAcross(field, keys...)
+	}
 
 	result := make(map[any]int64)
 
 	// Build the group count statement
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 	args := make([]any, 0)
 	where, args := s.buildCriteria()
-	SQL := fmt.Sprintf(`SELECT count(*) cnt , data->>'%s' grp FROM "%s" %s GROUP BY grp`, field, tblName, where)
-
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return result, 0, e
-	}
+	SQL := fmt.Sprintf(`SELECT count(*) cnt , data->>'%s' grp FROM "%s"%s %s GROUP BY grp`, field, tblName, s.buildIndexHints(), where)
 
 	// Execute the query
-	rows, err := statement.Query(args...)
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
-
+	rows, err := s.db.query(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...)
 	if err != nil {
 		return result, 0, err
 	}
@@ -383,7 +456,20 @@ func (s *mSqlDatabaseQuery) GroupCount(field string, keys ...string) (map[any]in
 // the data point is a calculation of the provided function on the selected field, each data point includes the number of documents and the calculated value
 // the total is the sum of all calculated values in all the buckets
 // supported functions: count : avg, sum, min, max
-func (s *mSqlDatabaseQuery) GroupAggregation(field string, function database.AggFunc, keys ...string) (map[any]Tuple[int64, float64], float64, error) {
+func (s *mSqlDatabaseQuery) GroupAggregation(field string, function database.AggFunc, keys ...string) (_ map[any]Tuple[int64, float64], _ float64, err error) {
+
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("group_aggregation", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer admitted()
 
 	if !collections.Include(functions, string(function)) {
 		return nil, 0, fmt.Errorf("function %s not supported", function)
@@ -392,7 +478,7 @@ func (s *mSqlDatabaseQuery) GroupAggregation(field string, function database.Agg
 	total := float64(0)
 
 	// Build the group count statement
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 	args := make([]any, 0)
 	where, args := s.buildCriteria()
 
@@ -400,20 +486,9 @@ func (s *mSqlDatabaseQuery) GroupAggregation(field string, function database.Agg
 	if function != "count" {
 		aggr = fmt.Sprintf("(data->>'%s')::FLOAT", field)
 	}
-	SQL := fmt.Sprintf(`SELECT %s(%s) cnt , data->>'%s' grp FROM "%s" %s GROUP BY grp`, function, aggr, field, tblName, where)
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return result, total, e
-	}
-
+	SQL := fmt.Sprintf(`SELECT %s(%s) cnt , data->>'%s' grp FROM "%s"%s %s GROUP BY grp`, function, aggr, field, tblName, s.buildIndexHints(), where)
 	// Execute the query
-	rows, err := statement.Query(args...)
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
-
+	rows, err := s.db.query(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...)
 	if err != nil {
 		return result, total, err
 	}
@@ -440,7 +515,20 @@ func (s *mSqlDatabaseQuery) GroupAggregation(field string, function database.Agg
 // the data point is a calculation of the provided function on the selected field, each data point includes the number of documents and the calculated value
 // the total is the sum of all calculated values in all the buckets
 // supported functions: count : avg, sum, min, max
-func (s *mSqlDatabaseQuery) Histogram(field string, function database.AggFunc, timeField string, interval time.Duration, keys ...string) (map[Timestamp]Tuple[int64, float64], float64, error) {
+func (s *mSqlDatabaseQuery) Histogram(field string, function database.AggFunc, timeField string, interval time.Duration, keys ...string) (_ map[Timestamp]Tuple[int64, float64], _ float64, err error) {
+
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("histogram", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer admitted()
 
 	if !collections.Include(functions, string(function)) {
 		return nil, 0, fmt.Errorf("function %s not supported", function)
@@ -448,7 +536,7 @@ func (s *mSqlDatabaseQuery) Histogram(field string, function database.AggFunc, t
 	result := make(map[Timestamp]Tuple[int64, float64])
 
 	// Build the group count statement
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 	args := make([]any, 0)
 	where, args := s.buildCriteria()
 
@@ -463,21 +551,10 @@ func (s *mSqlDatabaseQuery) Histogram(field string, function database.AggFunc, t
 	SQL := fmt.Sprintf(
 		`SELECT %s(%s) cnt, 
 				date_trunc('%s', to_timestamp((data->>'%s')::bigint / 1000)) dp 
-				FROM "%s" %s GROUP BY dp ORDER BY dp`, function, aggr, dp, timeField, tblName, where)
-
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return result, 0, e
-	}
+				FROM "%s"%s %s GROUP BY dp ORDER BY dp`, function, aggr, dp, timeField, tblName, s.buildIndexHints(), where)
 
 	// Execute the query
-	rows, err := statement.Query(args...)
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
-
+	rows, err := s.db.query(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...)
 	if err != nil {
 		return result, 0, err
 	}
@@ -499,14 +576,27 @@ func (s *mSqlDatabaseQuery) Histogram(field string, function database.AggFunc, t
 // Histogram2D returns a two-dimensional time series data points based on the time field, supported intervals: Minute, Hour, Day, week, month
 // the data point is a calculation of the provided function on the selected field
 // supported functions: count : avg, sum, min, max
-func (s *mSqlDatabaseQuery) Histogram2D(field string, function database.AggFunc, dim, timeField string, interval time.Duration, keys ...string) (map[Timestamp]map[any]Tuple[int64, float64], float64, error) {
+func (s *mSqlDatabaseQuery) Histogram2D(field string, function database.AggFunc, dim, timeField string, interval time.Duration, keys ...string) (_ map[Timestamp]map[any]Tuple[int64, float64], _ float64, err error) {
+
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("histogram_2d", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer admitted()
 	if !collections.Include(functions, string(function)) {
 		return nil, 0, fmt.Errorf("function %s not supported", function)
 	}
 	result := make(map[Timestamp]map[any]Tuple[int64, float64])
 
 	// Build the group count statement
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 	args := make([]any, 0)
 	where, args := s.buildCriteria()
 
@@ -521,21 +611,10 @@ func (s *mSqlDatabaseQuery) Histogram2D(field string, function database.AggFunc,
 	SQL := fmt.Sprintf(
 		`SELECT %s(%s) cnt, (data->>'%s') dim,
 				date_trunc('%s', to_timestamp((data->>'%s')::bigint / 1000)) dp 
-				FROM "%s" %s GROUP BY dp, dim ORDER BY dp`, function, aggr, dim, dp, timeField, tblName, where)
-
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return result, 0, e
-	}
+				FROM "%s"%s %s GROUP BY dp, dim ORDER BY dp`, function, aggr, dim, dp, timeField, tblName, s.buildIndexHints(), where)
 
 	// Execute the query
-	rows, err := statement.Query(args...)
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
-
+	rows, err := s.db.query(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...)
 	if err != nil {
 		return result, 0, err
 	}
@@ -563,27 +642,20 @@ func (s *mSqlDatabaseQuery) Histogram2D(field string, function database.AggFunc,
 // After the marshaling the result shall be transformed via the query callback chain
 func (s *mSqlDatabaseQuery) FindSingle(keys ...string) (entity Entity, err error) {
 
-	s.limit = 1
-	sqlState, args := s.buildStatement(keys...)
-
-	statement, e := s.db.pgDb.Prepare(sqlState)
-	if e != nil {
-		return nil, e
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, err
 	}
 
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("find_single", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	s.limit = 1
+	sqlState, args := s.buildStatement(keys...)
 
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), sqlState, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return nil, e
+		return nil, fe
 	}
 
 	// Scan first row by row and fetch entities
@@ -603,27 +675,20 @@ func (s *mSqlDatabaseQuery) FindSingle(keys ...string) (entity Entity, err error
 
 // GetMap Execute query based on the criteria, order and pagination and return the results as a map of id->Entity
 func (s *mSqlDatabaseQuery) GetMap(keys ...string) (out map[string]Entity, err error) {
-	out = make(map[string]Entity)
 
-	SQL, args := s.buildStatement(keys...)
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return nil, e
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, err
 	}
 
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("get_map", s.factory().TABLE(), 0, time.Now(), nil, &err)
+	out = make(map[string]Entity)
 
+	SQL, args := s.buildStatement(keys...)
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), SQL, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return nil, e
+		return nil, fe
 	}
 
 	// Scan row by row and fetch entities
@@ -646,27 +711,20 @@ func (s *mSqlDatabaseQuery) GetMap(keys ...string) (out map[string]Entity, err e
 // GetIDs Execute query based on the where criteria, order and pagination and return the results as a list of Ids
 func (s *mSqlDatabaseQuery) GetIDs(keys ...string) (out []string, err error) {
 
-	out = make([]string, 0)
-
-	SQL, args := s.buildIdStatement(keys...)
-	statement, e := s.db.pgDb.Prepare(SQL)
-	if e != nil {
-		return nil, e
+	if err := s.validateKeys(keys...); err != nil {
+		return nil, err
 	}
 
-	defer func() {
-		if statement != nil {
-			_ = statement.Close()
-		}
-	}()
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("get_ids", s.factory().TABLE(), 0, time.Now(), nil, &err)
 
+	out = make([]string, 0)
+
+	SQL, args := s.buildIdStatement(keys...)
 	// Execute the query
-	rows, fe := statement.Query(args...)
+	rows, fe := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), SQL, args...)
 	if fe != nil {
-		if rows != nil {
-			_ = rows.Close()
-		}
-		return nil, e
+		return nil, fe
 	}
 
 	// Scan row by row and fetch ID
@@ -683,19 +741,31 @@ func (s *mSqlDatabaseQuery) GetIDs(keys ...string) (out []string, err error) {
 // Delete Execute delete command based on the where criteria
 func (s *mSqlDatabaseQuery) Delete(keys ...string) (total int64, err error) {
 
-	tblName := tableName(s.factory().TABLE(), keys...)
+	if err := s.validateKeys(keys...); err != nil {
+		return 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("query_delete", s.factory().TABLE(), 0, time.Now(), &total, &err)
+
+	if err = s.db.admitWrite(s.factory().TABLE(), 1); err != nil {
+		return 0, err
+	}
+
+	tblName := s.tableName(keys...)
 	where, args := s.buildCriteria()
 	limit := s.buildLimit()
 
 	// Build the SQL
 	SQL := fmt.Sprintf(`DELETE FROM "%s" %s %s`, tblName, where, limit)
 
-	if res, ser := s.db.pgDb.Exec(SQL, args...); err != nil {
+	if res, ser := s.db.exec(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...); ser != nil {
 		return 0, ser
 	} else {
 		if rows, er := res.RowsAffected(); er != nil {
 			return 0, er
 		} else {
+			s.db.chargeWrite(s.factory().TABLE(), rows)
 			return rows, nil
 		}
 	}
@@ -711,14 +781,40 @@ func (s *mSqlDatabaseQuery) SetField(field string, value any, keys ...string) (t
 // SetFields Update multiple fields of all the documents meeting the criteria in a single transaction
 func (s *mSqlDatabaseQuery) SetFields(fields map[string]any, keys ...string) (total int64, err error) {
 
+	if err := s.validateKeys(keys...); err != nil {
+		return 0, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("query_set_fields", s.factory().TABLE(), 0, time.Now(), &total, &err)
+
+	if err = s.db.admitWrite(s.factory().TABLE(), 1); err != nil {
+		return 0, err
+	}
+
+	for f := range fields {
+		if err = validateFields(f); err != nil {
+			return 0, err
+		}
+	}
+	if s.db.envelope(s.factory().TABLE()) != nil {
+		return 0, fmt.Errorf("set fields is not supported for encrypted documents")
+	}
+	if s.db.overflowStorage(s.factory().TABLE()) != nil {
+		return 0, fmt.Errorf("set fields is not supported for overflowed documents")
+	}
+
 	allArgs := make([]any, 0)
 
-	entity := s.factory()
-	tblName := tableName(entity.TABLE(), keys...)
+	tblName := s.tableName(keys...)
 
 	parts := make([]string, 0)
 	i := 1
 	for f, v := range fields {
+		// Encrypt the value of encrypted field
+		if v, err = s.db.encryptField(s.factory, f, v); err != nil {
+			return 0, err
+		}
 		part := fmt.Sprintf(`"%s": $%d`, f, i)
 		allArgs = append(allArgs, v)
 		parts = append(parts, part)
@@ -732,12 +828,13 @@ func (s *mSqlDatabaseQuery) SetFields(fields map[string]any, keys ...string) (to
 	allArgs = append(allArgs, args)
 	SQL := fmt.Sprintf(`UPDATE "%s" SET data = data || '{%s}' %s`, tblName, fieldsList, where)
 
-	if res, er := s.db.pgDb.Exec(SQL, allArgs...); er != nil {
-		return 0, err
+	if res, er := s.db.exec(s.db.pgDb, tblName, tenantOf(keys...), SQL, allArgs...); er != nil {
+		return 0, er
 	} else {
 		if rows, ser := res.RowsAffected(); ser != nil {
 			return 0, ser
 		} else {
+			s.db.chargeWrite(s.factory().TABLE(), rows)
 			return rows, nil
 		}
 	}
@@ -761,6 +858,33 @@ func (s *mSqlDatabaseQuery) ToString() string {
 
 // region Query Internal Methods ---------------------------------------------------------------------------------------
 
+// Resolve the physical table name of the query
+func (s *mSqlDatabaseQuery) tableName(keys ...string) string {
+	if s.table != "" {
+		return s.table
+	}
+	if tblName, err := s.db.resolveTable(s.factory().TABLE(), keys...); err == nil {
+		return tblName
+	}
+	return s.db.tableName(s.factory().TABLE(), keys...)
+}
+
+// Validate the related and geo filters and that all the shard keys required by the entity table are provided
+func (s *mSqlDatabaseQuery) validateKeys(keys ...string) error {
+	if err := s.validateRelated(); err != nil {
+		return err
+	}
+	if err := s.validateGeo(); err != nil {
+		return err
+	}
+	if s.table != "" || len(s.shards) > 0 {
+		return nil
+	}
+	// queries across periods require the shard keys as well, so they do not fan out to the other tenants tables
+	_, err := s.db.resolveTable(s.factory().TABLE(), keys...)
+	return err
+}
+
 // Scan single database row into Json document
 func (s *mSqlDatabaseQuery) scanRow(rows *sql.Rows) (*JsonDoc, error) {
 
@@ -778,11 +902,10 @@ func (s *mSqlDatabaseQuery) unMarshal(jsonDoc *JsonDoc, errIn error) (Entity, er
 		return nil, errIn
 	}
 
-	entity := s.factory()
-	if err := Unmarshal([]byte(jsonDoc.Data), &entity); err != nil {
+	if entity, err := s.db.unmarshal(s.factory, []byte(jsonDoc.Data)); err != nil {
 		return nil, err
 	} else {
-		return entity, nil
+		return s.db.maskEntity(s.factory, entity)
 	}
 }
 
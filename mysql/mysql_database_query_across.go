@@ -0,0 +1,499 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+var placeholderRegex = regexp.MustCompile(`\$(\d+)`)
+
+// region Cross-shard query construction methods -----------------------------------------------------------------------
+
+// Across execute the query against multiple shard tables (one per shard key) and merge the results
+// By default, the shards are queried concurrently and the results are merged, sorted and limited on the client side
+func (s *mSqlDatabaseQuery) Across(keys ...string) IMySqlQuery {
+	s.shards = append(s.shards, keys...)
+	return s
+}
+
+// MergeOnServer merge the cross-shard results in a single UNION ALL statement instead of concurrent queries
+func (s *mSqlDatabaseQuery) MergeOnServer() IMySqlQuery {
+	s.serverSide = true
+	return s
+}
+
+// endregion
+
+// region Cross-shard query execution methods --------------------------------------------------------------------------
+
+// findAcross execute the query on all the shards and merge the results
+func (s *mSqlDatabaseQuery) findAcross(keys ...string) (out []Entity, total int64, err error) {
+	if s.serverSide {
+		return s.findAcrossOnServer(keys...)
+	}
+	return s.findAcrossOnClient(keys...)
+}
+
+// findAcrossOnClient query all the shards concurrently, then merge, sort and paginate the results
+func (s *mSqlDatabaseQuery) findAcrossOnClient(keys ...string) (out []Entity, total int64, err error) {
+
+	// Each shard must return enough rows to fill the requested page after merging
+	shardLimit := 0
+	if s.limit > 0 {
+		shardLimit = s.limit
+		if s.page > 1 {
+			shardLimit = s.page * s.limit
+		}
+	}
+
+	merged := make([]Entity, 0)
+	mu := sync.Mutex{}
+
+	err = s.forEachShard(keys, func(q *mSqlDatabaseQuery) error {
+		q.page = 1
+		q.limit = shardLimit
+		list, cnt, er := q.Find()
+		if er != nil {
+			return er
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		merged = append(merged, list...)
+		total += cnt
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.sortEntities(merged)
+	return s.paginate(merged), total, nil
+}
+
+// findAcrossOnServer query all the shards using a single UNION ALL statement
+func (s *mSqlDatabaseQuery) findAcrossOnServer(keys ...string) (out []Entity, total int64, err error) {
+
+	union, args, err := s.buildUnion(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The UNION ALL statement is a single heavy query
+	admitted, err := s.db.admitQuery()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer admitted()
+	SQL := fmt.Sprintf(`SELECT id, data FROM (%s) AS u %s %s`, union, s.buildOrder(), s.buildLimit())
+
+	rows, err := s.db.query(s.db.pgDb, "", "", SQL, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out = make([]Entity, 0)
+	for rows.Next() {
+		entity, fe := s.unMarshal(s.scanRow(rows))
+		if fe != nil {
+			_ = rows.Close()
+			return nil, 0, fe
+		}
+		if transformed := s.processCallbacks(entity); transformed != nil {
+			out = append(out, transformed)
+		}
+	}
+	_ = rows.Close()
+
+	SQL = fmt.Sprintf(`SELECT count(*) FROM (%s) AS u`, union)
+	err = s.db.scalar("", SQL, args, &total)
+	return
+}
+
+// buildUnion build UNION ALL statement of the query criteria on all the shard tables
+func (s *mSqlDatabaseQuery) buildUnion(keys ...string) (SQL string, args []any, err error) {
+	parts := make([]string, 0)
+	args = make([]any, 0)
+
+	tables, err := s.shardTables(keys...)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(tables) == 0 {
+		return "", nil, fmt.Errorf("no table found for query on %s", s.factory().TABLE())
+	}
+
+	columns := s.unionColumns()
+	for _, tblName := range tables {
+		where, whereArgs := s.shardQuery(tblName).buildCriteria()
+		parts = append(parts, fmt.Sprintf(`SELECT %s FROM "%s"%s %s`, columns, tblName, s.buildIndexHints(), shiftPlaceholders(where, len(args))))
+		args = append(args, whereArgs...)
+	}
+	return strings.Join(parts, " UNION ALL "), args, nil
+}
+
+// unionColumns returns the columns selected from every shard table: the id, the document and the typed columns the
+// merged rows are sorted by (timestamp, promoted and geo columns)
+func (s *mSqlDatabaseQuery) unionColumns() string {
+	columns := []string{"id", "data"}
+	added := make(map[string]bool)
+	add := func(column string) {
+		if !added[column] {
+			added[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	if s.geoOrder != nil {
+		add(fmt.Sprintf(`"%s"`, s.geoOrder.column))
+	}
+	for _, field := range append(append([]any{}, s.ascOrders...), s.descOrders...) {
+		if name := fmt.Sprintf("%v", field); name != "id" {
+			if expr := s.fieldExpr(name); !strings.HasPrefix(expr, "data->>") {
+				add(expr)
+			}
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// shardTables returns the physical tables of all the shards:
+// one table per shard key (Across) and, for time based tables with range filter, one table per period in the range
+func (s *mSqlDatabaseQuery) shardTables(keys ...string) ([]string, error) {
+	template := s.factory().TABLE()
+
+	keySets := [][]string{keys}
+	if len(s.shards) > 0 {
+		keySets = make([][]string, 0, len(s.shards))
+		for _, key := range s.shards {
+			keySets = append(keySets, []string{key})
+		}
+	}
+
+	if !s.isPeriodRange() {
+		tables := make([]string, 0, len(keySets))
+		for _, keySet := range keySets {
+			tables = append(tables, s.db.tableName(template, keySet...))
+		}
+		return tables, nil
+	}
+
+	// Target only the existing period tables within the range
+	existing, err := s.db.listTables(templatePattern(template))
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	for _, table := range existing {
+		exists[table] = true
+	}
+
+	period := templatePeriod(template)
+	from := time.UnixMilli(int64(s.rangeFrom))
+	to := time.UnixMilli(int64(s.rangeTo))
+
+	tables := make([]string, 0)
+	added := make(map[string]bool)
+	resolver := s.db.tableNameResolver()
+	for _, keySet := range keySets {
+		for t := periodStart(from, period); !t.After(to); t = addPeriods(t, period, 1) {
+			table := resolver.Resolve(template, t, keySet...)
+			if exists[table] && !added[table] {
+				added[table] = true
+				tables = append(tables, table)
+			}
+		}
+	}
+	return tables, nil
+}
+
+// isAcross returns true if the query should be executed on multiple shards
+func (s *mSqlDatabaseQuery) isAcross() bool {
+	return len(s.shards) > 0 || s.isPeriodRange()
+}
+
+// isPeriodRange returns true if the query has range filter on time based entity table (e.g. monthly tables)
+func (s *mSqlDatabaseQuery) isPeriodRange() bool {
+	return s.table == "" && s.rangeField != "" && templatePeriod(s.factory().TABLE()) != ""
+}
+
+// shardQuery returns a copy of the query to execute on a single shard table
+func (s *mSqlDatabaseQuery) shardQuery(table string) *mSqlDatabaseQuery {
+	q := *s
+	q.table = table
+	q.shards = nil
+	q.allFilters = append([][]database.QueryFilter{}, s.allFilters...)
+	q.anyFilters = append([][]database.QueryFilter{}, s.anyFilters...)
+	return &q
+}
+
+// forEachShard execute the function concurrently on a copy of the query per shard table, returns the first error
+// When the query concurrency limit is set, no more shard queries than the limit run at once, so the shard queries of
+// the same cross-shard query do not reject each other (see SetQueryLimit)
+func (s *mSqlDatabaseQuery) forEachShard(keys []string, fn func(q *mSqlDatabaseQuery) error) error {
+	tables, err := s.shardTables(keys...)
+	if err != nil {
+		return err
+	}
+	errs := make([]error, len(tables))
+
+	parallel := len(tables)
+	if limit := s.db.queryLimit(); limit > 0 && limit < parallel {
+		parallel = limit
+	}
+	slots := make(chan struct{}, parallel)
+
+	wg := sync.WaitGroup{}
+	for i, table := range tables {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(idx int, q *mSqlDatabaseQuery) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			errs[idx] = fn(q)
+		}(i, s.shardQuery(table))
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortEntities sort the merged entities by the query order fields
+func (s *mSqlDatabaseQuery) sortEntities(list []Entity) {
+
+	type order struct {
+		field string
+		desc  bool
+	}
+	orders := make([]order, 0, len(s.ascOrders)+len(s.descOrders))
+	for _, field := range s.ascOrders {
+		orders = append(orders, order{field: fmt.Sprintf("%v", field)})
+	}
+	for _, field := range s.descOrders {
+		orders = append(orders, order{field: fmt.Sprintf("%v", field), desc: true})
+	}
+	if len(orders) == 0 {
+		return
+	}
+
+	// Convert entities to json documents once, to compare field values
+	docs := make(map[Entity]Json, len(list))
+	for _, entity := range list {
+		doc := Json{}
+		if bytes, err := Marshal(entity); err == nil {
+			_ = Unmarshal(bytes, &doc)
+		}
+		docs[entity] = doc
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		for _, o := range orders {
+			var a, b any
+			if o.field == "id" {
+				a, b = list[i].ID(), list[j].ID()
+			} else {
+				a, b = docs[list[i]][o.field], docs[list[j]][o.field]
+			}
+			if c := compareValues(a, b); c != 0 {
+				return (c < 0) != o.desc
+			}
+		}
+		return false
+	})
+}
+
+// paginate returns the requested page of the merged results
+func (s *mSqlDatabaseQuery) paginate(list []Entity) []Entity {
+	if s.limit <= 0 {
+		return list
+	}
+	offset := 0
+	if s.page > 1 {
+		offset = (s.page - 1) * s.limit
+	}
+	if offset >= len(list) {
+		return make([]Entity, 0)
+	}
+	end := offset + s.limit
+	if end > len(list) {
+		end = len(list)
+	}
+	return list[offset:end]
+}
+
+// compareValues compare two json values: numbers are compared numerically, other values by their string representation
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0
+		case a == nil:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	fa, aErr := strconv.ParseFloat(fmt.Sprintf("%v", a), 64)
+	fb, bErr := strconv.ParseFloat(fmt.Sprintf("%v", b), 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+// shiftPlaceholders shift the positional placeholders ($1..$n) by offset
+func shiftPlaceholders(SQL string, offset int) string {
+	if offset == 0 {
+		return SQL
+	}
+	return placeholderRegex.ReplaceAllStringFunc(SQL, func(p string) string {
+		idx, _ := strconv.Atoi(p[1:])
+		return fmt.Sprintf("$%d", idx+offset)
+	})
+}
+
+// endregion
+
+// region Cross-shard aggregation methods ------------------------------------------------------------------------------
+
+// countAcross sum the count of matching rows in all the shards
+func (s *mSqlDatabaseQuery) countAcross(keys ...string) (total int64, err error) {
+	mu := sync.Mutex{}
+	err = s.forEachShard(keys, func(q *mSqlDatabaseQuery) error {
+		cnt, er := q.Count()
+		if er != nil {
+			return er
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		total += cnt
+		return nil
+	})
+	return
+}
+
+// aggregationAcross combine the partial aggregations of all the shards:
+// count and sum are summed, min and max are compared and avg is calculated from the total sum and count of the field values
+func (s *mSqlDatabaseQuery) aggregationAcross(field string, function database.AggFunc, keys ...string) (value float64, err error) {
+
+	var (
+		mu       sync.Mutex
+		sum      float64
+		count    float64
+		hasValue bool
+	)
+
+	err = s.forEachShard(keys, func(q *mSqlDatabaseQuery) error {
+		var (
+			partial sql.NullFloat64
+			cnt     int64
+			er      error
+		)
+		if function == database.AVG {
+			partial, cnt, er = q.partialAverage(field)
+		} else {
+			partial, er = q.partialAggregation(field, function)
+		}
+		if er != nil {
+			return er
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Shards without matching rows return NULL for sum, avg, min and max
+		if !partial.Valid {
+			return nil
+		}
+		switch function {
+		case database.MIN:
+			if !hasValue || partial.Float64 < value {
+				value = partial.Float64
+			}
+		case database.MAX:
+			if !hasValue || partial.Float64 > value {
+				value = partial.Float64
+			}
+		default:
+			sum += partial.Float64
+			count += float64(cnt)
+		}
+		hasValue = true
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	switch function {
+	case database.MIN, database.MAX:
+		return value, nil
+	case database.AVG:
+		if count == 0 {
+			return 0, nil
+		}
+		return sum / count, nil
+	default:
+		return sum, nil
+	}
+}
+
+// partialAggregation execute the aggregation function on a single shard
+func (s *mSqlDatabaseQuery) partialAggregation(field string, function database.AggFunc) (value sql.NullFloat64, err error) {
+	SQL, args := s.buildCountStatement(field, string(function))
+	err = s.db.scalar(s.tableName(), SQL, args, &value)
+	return
+}
+
+// partialAverage execute the sum and the count of the field values on a single shard (rows without the field are not counted)
+func (s *mSqlDatabaseQuery) partialAverage(field string) (sum sql.NullFloat64, count int64, err error) {
+	where, args := s.buildCriteria()
+	value := fmt.Sprintf("(data->>'%s')::FLOAT", field)
+	SQL := fmt.Sprintf(`SELECT SUM(%s) as aggr, COUNT(%s) as cnt FROM "%s"%s %s`, value, value, s.tableName(), s.buildIndexHints(), where)
+	err = s.db.scalar(s.tableName(), SQL, args, &sum, &count)
+	return
+}
+
+// groupCountAcross sum the count per group of all the shards
+func (s *mSqlDatabaseQuery) groupCountAcross(field string, keys ...string) (result map[any]int64, total int64, err error) {
+	result = make(map[any]int64)
+	mu := sync.Mutex{}
+
+	err = s.forEachShard(keys, func(q *mSqlDatabaseQuery) error {
+		groups, cnt, er := q.GroupCount(field)
+		if er != nil {
+			return er
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for group, groupCount := range groups {
+			result[group] += groupCount
+		}
+		total += cnt
+		return nil
+	})
+	return
+}
+
+// endregion
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// asyncBufferSize is the number of entities read ahead of the FindAsync consumer
+const asyncBufferSize = 100
+
+// region Asynchronous query methods -----------------------------------------------------------------------------------
+
+// FindAsync execute the query based on the criteria, order and pagination and stream the result entities over the
+// entities channel while the rows are read from the server, so the consumer can process the results before the query
+// completes. The entities channel is closed when the query completes, then the error channel delivers the query error
+// (if any) and is closed. Canceling the context stops the query.
+// The results of cross-shard query are streamed shard after shard (not merged by the sort order).
+//
+// param: ctx - Context to cancel the query
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Entities channel, error channel
+func (s *mSqlDatabaseQuery) FindAsync(ctx context.Context, keys ...string) (<-chan Entity, <-chan error) {
+	entities := make(chan Entity, asyncBufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(entities)
+		if err := s.findAsync(ctx, entities, keys...); err != nil {
+			errs <- err
+		}
+	}()
+	return entities, errs
+}
+
+// findAsync execute the query (on every shard table of cross-shard query) and send the entities to the channel
+func (s *mSqlDatabaseQuery) findAsync(ctx context.Context, entities chan<- Entity, keys ...string) (err error) {
+	if err = s.validateKeys(keys...); err != nil {
+		return
+	}
+
+	var count int64
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("find_async", s.factory().TABLE(), 0, time.Now(), &count, &err)
+
+	// The shard tables are streamed one after the other, so the query takes a single slot
+	admitted, err := s.db.admitQuery()
+	if err != nil {
+		return
+	}
+	defer admitted()
+
+	tables := []string{s.tableName(keys...)}
+	if s.isAcross() {
+		if tables, err = s.shardTables(keys...); err != nil {
+			return
+		}
+	}
+
+	for _, table := range tables {
+		err = s.shardQuery(table).stream(tenantOf(keys...), func(entity Entity) error {
+			select {
+			case entities <- entity:
+				count++
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// endregion
@@ -0,0 +1,112 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/go-yaaf/yaaf-common/utils/collections"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Downsampling definitions -------------------------------------------------------------------------------------
+
+// Downsampling defines single aggregated value of the bucket
+type Downsampling struct {
+	Name     string           // The name of the value in the data point
+	Field    string           // The numeric field
+	Function database.AggFunc // The aggregation function: count, avg, sum, min, max
+}
+
+// DataPoint is the aggregated values of single time bucket, null values (e.g. avg of missing field) are omitted
+type DataPoint struct {
+	Timestamp Timestamp          // The bucket start time (epoch milliseconds)
+	Count     int64              // The number of entities in the bucket
+	Values    map[string]float64 // Map of the downsampling name to its value
+}
+
+// endregion
+
+// region Downsampling methods -----------------------------------------------------------------------------------------
+
+// Downsample bucket the entities matching the query criteria into fixed time intervals (aligned to the epoch) and returns
+// the aggregated values per bucket sorted by time, unlike Histogram any interval is supported (e.g. 5 minutes)
+// and multiple aggregations are calculated in a single statement. Empty buckets are not returned.
+//
+// param: timeField - The timestamp field (epoch milliseconds)
+// param: interval - The bucket size (at least 1 millisecond)
+// param: aggregations - The aggregated values of each bucket
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: List of data points, error
+func (s *mSqlDatabaseQuery) Downsample(timeField string, interval time.Duration, aggregations []Downsampling, keys ...string) (out []DataPoint, err error) {
+
+	if err = s.validateKeys(keys...); err != nil {
+		return nil, err
+	}
+	if err = validateFields(timeField); err != nil {
+		return nil, err
+	}
+	bucket := interval.Milliseconds()
+	if bucket < 1 {
+		return nil, fmt.Errorf("invalid downsampling interval: %s", interval)
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("downsample", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, err
+	}
+	defer admitted()
+
+	exprs := make([]string, 0, len(aggregations))
+	for i, agg := range aggregations {
+		if !collections.Include(functions, string(agg.Function)) {
+			return nil, fmt.Errorf("function %s not supported", agg.Function)
+		}
+		aggr := "*"
+		if agg.Function != database.COUNT {
+			if err = validateFields(agg.Field); err != nil {
+				return nil, err
+			}
+			aggr = fmt.Sprintf("(%s)::FLOAT", s.fieldExpr(agg.Field))
+		}
+		exprs = append(exprs, fmt.Sprintf(", %s(%s) AS a%d", agg.Function, aggr, i))
+	}
+
+	tblName := s.tableName(keys...)
+	where, args := s.buildCriteria()
+	SQL := fmt.Sprintf(`SELECT FLOOR((%s)::BIGINT / %d) * %d AS bucket, COUNT(*) AS cnt%s FROM "%s"%s %s GROUP BY bucket ORDER BY bucket`,
+		s.fieldExpr(timeField), bucket, bucket, strings.Join(exprs, ""), tblName, s.buildIndexHints(), where)
+
+	rows, err := s.db.query(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	values := make([]sql.NullFloat64, len(aggregations))
+	for rows.Next() {
+		point := DataPoint{Values: make(map[string]float64)}
+		dest := []any{&point.Timestamp, &point.Count}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		for i, agg := range aggregations {
+			if values[i].Valid {
+				point.Values[agg.Name] = values[i].Float64
+			}
+		}
+		out = append(out, point)
+	}
+	return out, rows.Err()
+}
+
+// endregion
@@ -0,0 +1,97 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-yaaf/yaaf-common/database"
+)
+
+// region Related filter definitions -----------------------------------------------------------------------------------
+
+// relatedFilter is a filter on the related entity table, the entity matches if it has (or has not) a related entity
+// matching the filters
+type relatedFilter struct {
+	relation Relation
+	filters  []database.QueryFilter
+	negate   bool
+}
+
+// endregion
+
+// region Related filter methods ---------------------------------------------------------------------------------------
+
+// Exists filter entities having at least one related entity matching the filters (e.g. accounts with open alerts),
+// the relation is evaluated by the database as semi-join sub query without loading the related entities
+func (s *mSqlDatabaseQuery) Exists(relation Relation, filters ...database.QueryFilter) IMySqlQuery {
+	s.relFilters = append(s.relFilters, relatedFilter{relation: relation, filters: filters})
+	return s
+}
+
+// NotExists filter entities having no related entity matching the filters (e.g. accounts without open alerts)
+func (s *mSqlDatabaseQuery) NotExists(relation Relation, filters ...database.QueryFilter) IMySqlQuery {
+	s.relFilters = append(s.relFilters, relatedFilter{relation: relation, filters: filters, negate: true})
+	return s
+}
+
+// validateRelated validate the reference fields of the related filters
+func (s *mSqlDatabaseQuery) validateRelated() error {
+	for _, rf := range s.relFilters {
+		if rf.relation.Factory == nil {
+			return fmt.Errorf("related filter %s requires entity factory", rf.relation.Name)
+		}
+		for _, field := range []string{rf.relation.LocalField, rf.relation.ForeignField} {
+			if field == "" {
+				continue
+			}
+			if err := validateFields(field); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// buildRelatedCriteria build the related filters conditions: the reference of the entity IN (the references of the
+// matching related entities), which MySQL executes as semi-join (EXISTS) or anti-join (NOT EXISTS)
+func (s *mSqlDatabaseQuery) buildRelatedCriteria(varIndex int) (parts []string, args []any) {
+	for _, rf := range s.relFilters {
+		rel := &mSqlDatabaseQuery{db: s.db, factory: rf.relation.Factory}
+
+		// The related entity table conditions
+		conditions := make([]string, 0, len(rf.filters)+1)
+		foreign := "id"
+		if rf.relation.ForeignField != "" {
+			foreign = rel.fieldExpr(rf.relation.ForeignField)
+			conditions = append(conditions, fmt.Sprintf("%s IS NOT NULL", foreign))
+		}
+		for _, qf := range rf.filters {
+			if !qf.IsActive() {
+				continue
+			}
+			part, partArgs := rel.buildFilter(qf, varIndex)
+			if len(part) > 0 {
+				conditions = append(conditions, part)
+				args = append(args, partArgs...)
+				varIndex += len(partArgs)
+			}
+		}
+		where := ""
+		if len(conditions) > 0 {
+			where = fmt.Sprintf(" WHERE %s", strings.Join(conditions, " AND "))
+		}
+
+		local := "id"
+		if rf.relation.LocalField != "" {
+			local = s.fieldExpr(rf.relation.LocalField)
+		}
+		operator := "IN"
+		if rf.negate {
+			operator = "NOT IN"
+		}
+		parts = append(parts, fmt.Sprintf(`%s %s (SELECT %s FROM "%s"%s)`, local, operator, foreign, rel.tableName(rf.relation.Keys...), where))
+	}
+	return
+}
+
+// endregion
@@ -16,14 +16,14 @@ func (s *mSqlDatabaseQuery) buildStatement(keys ...string) (SQL string, args []a
 	args = make([]any, 0)
 
 	// Build the SQL select
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 
 	// Build the WHERE clause
 	where, args := s.buildCriteria()
 	order := s.buildOrder()
 	limit := s.buildLimit()
 
-	SQL = fmt.Sprintf(`SELECT id, data FROM "%s" %s %s %s`, tblName, where, order, limit)
+	SQL = fmt.Sprintf(`SELECT id, data FROM "%s"%s %s %s %s`, tblName, s.buildIndexHints(), where, order, limit)
 	return
 }
 
@@ -34,7 +34,7 @@ func (s *mSqlDatabaseQuery) buildCountStatement(field, function string, keys ...
 	args = make([]any, 0)
 
 	// Build the SQL select
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 
 	// Build the WHERE clause
 	where, args := s.buildCriteria()
@@ -43,7 +43,7 @@ func (s *mSqlDatabaseQuery) buildCountStatement(field, function string, keys ...
 	if function != "count" {
 		aggr = fmt.Sprintf("(data->>'%s')::FLOAT", field)
 	}
-	SQL = fmt.Sprintf(`SELECT %s(%s) as aggr FROM "%s" %s`, function, aggr, tblName, where)
+	SQL = fmt.Sprintf(`SELECT %s(%s) as aggr FROM "%s"%s %s`, function, aggr, tblName, s.buildIndexHints(), where)
 	return
 }
 
@@ -53,14 +53,14 @@ func (s *mSqlDatabaseQuery) buildIdStatement(keys ...string) (SQL string, args [
 	args = make([]any, 0)
 
 	// Build the SQL select
-	tblName := tableName(s.factory().TABLE(), keys...)
+	tblName := s.tableName(keys...)
 
 	// Build the WHERE clause
 	where, args := s.buildCriteria()
 	order := s.buildOrder()
 	limit := s.buildLimit()
 
-	SQL = fmt.Sprintf(`SELECT id FROM "%s" %s %s %s`, tblName, where, order, limit)
+	SQL = fmt.Sprintf(`SELECT id FROM "%s"%s %s %s %s`, tblName, s.buildIndexHints(), where, order, limit)
 	return
 }
 
@@ -97,18 +97,33 @@ func (s *mSqlDatabaseQuery) buildCriteria() (where string, args []any) {
 			}
 		}
 
-		// If range is defined, add it to the filters
-		if len(s.rangeField) > 0 {
-			rangeFilter := []database.QueryFilter{database.F(s.rangeField).Between(s.rangeFrom, s.rangeTo)}
-			s.allFilters = append(s.allFilters, rangeFilter)
-		}
-
 		if len(orParts) > 0 {
 			orConditions := fmt.Sprintf("(%s)", strings.Join(orParts, " OR "))
 			parts = append(parts, orConditions)
 		}
 	}
 
+	// If range is defined, add it to the filters
+	if len(s.rangeField) > 0 {
+		part, partArgs := s.buildFilter(database.F(s.rangeField).Between(s.rangeFrom, s.rangeTo), varIndex)
+		if len(part) > 0 {
+			parts = append(parts, part)
+			args = append(args, partArgs...)
+			varIndex += len(partArgs)
+		}
+	}
+
+	// Add the geo filters
+	geoParts, geoArgs := s.buildGeoCriteria(varIndex)
+	parts = append(parts, geoParts...)
+	args = append(args, geoArgs...)
+	varIndex += len(geoArgs)
+
+	// Add the related entity filters
+	relParts, relArgs := s.buildRelatedCriteria(varIndex)
+	parts = append(parts, relParts...)
+	args = append(args, relArgs...)
+
 	if len(parts) > 0 {
 		where = fmt.Sprintf("WHERE %s", strings.Join(parts, " AND "))
 	}
@@ -120,22 +135,25 @@ func (s *mSqlDatabaseQuery) buildCriteria() (where string, args []any) {
 func (s *mSqlDatabaseQuery) buildOrder() string {
 
 	l := len(s.ascOrders) + len(s.descOrders)
-	if l == 0 {
+	if l == 0 && s.geoOrder == nil {
 		return ""
 	}
-	fields := make([]string, 0, l)
+	fields := make([]string, 0, l+1)
+	if s.geoOrder != nil {
+		fields = append(fields, fmt.Sprintf("%s ASC", s.distanceExpr(s.geoOrder.column, s.geoOrder.lat, s.geoOrder.lng)))
+	}
 	for _, field := range s.ascOrders {
 		if field == "id" {
 			fields = append(fields, fmt.Sprintf("id ASC"))
 		} else {
-			fields = append(fields, fmt.Sprintf("data->>'%s' ASC", field))
+			fields = append(fields, fmt.Sprintf("%s ASC", s.fieldExpr(fmt.Sprintf("%v", field))))
 		}
 	}
 	for _, field := range s.descOrders {
 		if field == "id" {
 			fields = append(fields, fmt.Sprintf("id DESC"))
 		} else {
-			fields = append(fields, fmt.Sprintf("data->>'%s' DESC", field))
+			fields = append(fields, fmt.Sprintf("%s DESC", s.fieldExpr(fmt.Sprintf("%v", field))))
 		}
 	}
 
@@ -175,6 +193,16 @@ func (s *mSqlDatabaseQuery) buildFilter(qf database.QueryFilter, varIndex int) (
 		fieldName = s.getCastField(qf)
 	}
 
+	// Timestamp columns are compared with time values
+	if column, ok := s.db.timestampColumn(s.factory().TABLE(), qf.GetField()); ok {
+		sqlPart, args = s.buildOperator(column, qf, varIndex)
+		return sqlPart, timestampArgs(args)
+	}
+	return s.buildOperator(fieldName, qf, varIndex)
+}
+
+// Build the filter operator on the field expression
+func (s *mSqlDatabaseQuery) buildOperator(fieldName string, qf database.QueryFilter, varIndex int) (sqlPart string, args []any) {
 	switch qf.GetOperator() {
 	case database.Eq:
 		return fmt.Sprintf("(%s = $%d)", fieldName, varIndex), qf.GetValues()
@@ -269,8 +297,24 @@ func (s *mSqlDatabaseQuery) buildFilterNotIn(fieldName string, qf database.Query
 	return fmt.Sprintf("NOT (%s = ANY ($%d))", fieldName, varIndex), []any{list}
 }
 
+// Resolve the SQL expression of the field: the timestamp column, the generated column for promoted fields, otherwise the json extraction
+func (s *mSqlDatabaseQuery) fieldExpr(field string) string {
+	if column, ok := s.db.timestampColumn(s.factory().TABLE(), field); ok {
+		return column
+	}
+	if column, ok := s.db.promotedColumn(s.factory().TABLE(), field); ok {
+		return column
+	}
+	return fmt.Sprintf("data->>'%s'", field)
+}
+
 // Build the cast
 func (s *mSqlDatabaseQuery) getCastField(qf database.QueryFilter) (result string) {
+	// Promoted fields are typed columns, no cast is required
+	if column, ok := s.db.promotedColumn(s.factory().TABLE(), qf.GetField()); ok {
+		return column
+	}
+
 	result = fmt.Sprintf("data->>'%s'", qf.GetField())
 
 	values := qf.GetValues()
@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// region Index hints definitions --------------------------------------------------------------------------------------
+
+// Index hint kinds
+const (
+	hintUse    = "USE"
+	hintForce  = "FORCE"
+	hintIgnore = "IGNORE"
+)
+
+// indexHint is a single index hint of the query table
+type indexHint struct {
+	kind    string   // USE, FORCE or IGNORE
+	indexes []string // The index names
+}
+
+// endregion
+
+// region Index hints methods ------------------------------------------------------------------------------------------
+
+// UseIndex hint the optimizer to consider only the listed indexes (USE INDEX)
+func (s *mSqlDatabaseQuery) UseIndex(indexes ...string) IMySqlQuery {
+	return s.addIndexHint(hintUse, indexes)
+}
+
+// ForceIndex hint the optimizer to use the listed indexes, table scan is used only if the indexes can not be used (FORCE INDEX)
+func (s *mSqlDatabaseQuery) ForceIndex(indexes ...string) IMySqlQuery {
+	return s.addIndexHint(hintForce, indexes)
+}
+
+// IgnoreIndex hint the optimizer not to use the listed indexes (IGNORE INDEX)
+func (s *mSqlDatabaseQuery) IgnoreIndex(indexes ...string) IMySqlQuery {
+	return s.addIndexHint(hintIgnore, indexes)
+}
+
+// addIndexHint add the index hint to the query (empty list is ignored)
+func (s *mSqlDatabaseQuery) addIndexHint(kind string, indexes []string) IMySqlQuery {
+	if len(indexes) > 0 {
+		s.indexHints = append(s.indexHints, indexHint{kind: kind, indexes: indexes})
+	}
+	return s
+}
+
+// buildIndexHints returns the index hints clause of the query table (empty if no hints)
+// The clause is applied to the SELECT statements only (MySQL does not support index hints in single table DELETE)
+func (s *mSqlDatabaseQuery) buildIndexHints() string {
+	if len(s.indexHints) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(s.indexHints))
+	for _, hint := range s.indexHints {
+		names := make([]string, 0, len(hint.indexes))
+		for _, index := range hint.indexes {
+			names = append(names, fmt.Sprintf(`"%s"`, strings.ReplaceAll(index, `"`, `""`)))
+		}
+		parts = append(parts, fmt.Sprintf("%s INDEX (%s)", hint.kind, strings.Join(names, ", ")))
+	}
+	return " " + strings.Join(parts, " ")
+}
+
+// endregion
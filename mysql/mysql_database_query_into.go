@@ -0,0 +1,272 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Query into definitions ---------------------------------------------------------------------------------------
+
+var (
+	entityType = reflect.TypeOf((*Entity)(nil)).Elem()
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+// endregion
+
+// region Query into methods -------------------------------------------------------------------------------------------
+
+// ExecuteQueryInto execute native SQL query and scan the rows into the destination slice of structs, for example:
+//
+//	var report []struct {
+//		AccountId string  `db:"account_id"`
+//		Total     float64 `db:"total"`
+//	}
+//	err := db.ExecuteQueryInto(&report, "SELECT account_id, SUM(amount) AS total FROM ...")
+//
+// Columns are mapped to fields by the db tag, the json tag or the field name (case-insensitive), unmapped columns are
+// ignored and Json columns are decoded into struct, map and slice fields. When the element type is entity and the query
+// returns id and data columns, the data is decoded as the entity document (see Get)
+//
+// param: dest - Pointer to slice of structs (or pointers to structs)
+// param: sql - The SQL query
+// param: args - Statement arguments (or single map of :name parameters, see BindNamed)
+// return: error
+func (dbs *MySqlDatabase) ExecuteQueryInto(dest any, sql string, args ...any) error {
+
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Pointer || target.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("destination must be pointer to slice, got %T", dest)
+	}
+	slice := target.Elem()
+	elemType := slice.Type().Elem()
+	baseType := elemType
+	if baseType.Kind() == reflect.Pointer {
+		baseType = baseType.Elem()
+	}
+	if baseType.Kind() != reflect.Struct {
+		return fmt.Errorf("destination element must be struct or pointer to struct, got %s", elemType)
+	}
+
+	sql, args, err := namedArgs(sql, args)
+	if err != nil {
+		return err
+	}
+	if sql, err = dbs.guardStatement(sql, true); err != nil {
+		return err
+	}
+	rows, err := dbs.query(dbs.pgDb, "", "", sql, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	if (elemType.Implements(entityType) || reflect.PointerTo(elemType).Implements(entityType)) && isDocumentColumns(columns) {
+		return dbs.scanEntitiesInto(rows, slice, elemType)
+	}
+	return dbs.scanStructsInto(rows, columns, slice, elemType)
+}
+
+// scanEntitiesInto scan id/data rows as entity documents
+func (dbs *MySqlDatabase) scanEntitiesInto(rows *sql.Rows, slice reflect.Value, elemType reflect.Type) error {
+	factory := func() Entity {
+		if elemType.Kind() == reflect.Pointer {
+			return reflect.New(elemType.Elem()).Interface().(Entity)
+		}
+		return reflect.New(elemType).Interface().(Entity)
+	}
+
+	list := make([]Entity, 0)
+	for rows.Next() {
+		jsonDoc := JsonDoc{}
+		if err := rows.Scan(&jsonDoc.Id, &jsonDoc.Data); err != nil {
+			return err
+		}
+		entity, err := dbs.unmarshal(factory, []byte(jsonDoc.Data))
+		if err != nil {
+			return err
+		}
+		list = append(list, entity)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	list, err := dbs.maskEntities(factory, list)
+	if err != nil {
+		return err
+	}
+	for _, entity := range list {
+		value := reflect.ValueOf(entity)
+		if elemType.Kind() != reflect.Pointer {
+			value = value.Elem()
+		}
+		slice.Set(reflect.Append(slice, value))
+	}
+	return nil
+}
+
+// scanStructsInto scan the rows into structs by the column to field mapping
+func (dbs *MySqlDatabase) scanStructsInto(rows *sql.Rows, columns []string, slice reflect.Value, elemType reflect.Type) error {
+	baseType := elemType
+	if baseType.Kind() == reflect.Pointer {
+		baseType = baseType.Elem()
+	}
+
+	fields := structFields(baseType)
+	rules := dbs.maskingRules()
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		item := reflect.New(baseType).Elem()
+		for i, column := range columns {
+			index, ok := fields[strings.ToLower(column)]
+			if !ok {
+				continue
+			}
+			value := values[i]
+			if mask, masked := rules[column]; masked && value != nil {
+				if b, isBytes := value.([]byte); isBytes {
+					value = string(b)
+				}
+				value = mask(value)
+			}
+			if err := assignColumn(item.FieldByIndex(index), value); err != nil {
+				return fmt.Errorf("column %s: %s", column, err.Error())
+			}
+		}
+		if elemType.Kind() == reflect.Pointer {
+			item = item.Addr()
+		}
+		slice.Set(reflect.Append(slice, item))
+	}
+	return rows.Err()
+}
+
+// isDocumentColumns returns true if the columns are the entity document columns (id, data)
+func isDocumentColumns(columns []string) bool {
+	return len(columns) == 2 && strings.EqualFold(columns[0], "id") && strings.EqualFold(columns[1], "data")
+}
+
+// structFields returns the map of the lower case column name to the field index (db tag, json tag or field name)
+func structFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+		name := field.Name
+		if tag, _, _ := strings.Cut(field.Tag.Get("json"), ","); tag != "" {
+			name = tag
+		}
+		if tag, _, _ := strings.Cut(field.Tag.Get("db"), ","); tag != "" {
+			name = tag
+		}
+		if name == "-" {
+			continue
+		}
+		fields[strings.ToLower(name)] = field.Index
+	}
+	return fields
+}
+
+// assignColumn assign the column value to the field with type conversion (NULL keeps the zero value)
+func assignColumn(field reflect.Value, value any) error {
+	if value == nil {
+		return nil
+	}
+	if field.Kind() == reflect.Pointer {
+		elem := reflect.New(field.Type().Elem())
+		if err := assignColumn(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if b, ok := value.([]byte); ok {
+		return assignText(field, b)
+	}
+	if s, ok := value.(string); ok {
+		return assignText(field, []byte(s))
+	}
+
+	v := reflect.ValueOf(value)
+	if field.Kind() == reflect.String {
+		field.SetString(fmt.Sprintf("%v", value))
+		return nil
+	}
+	if v.Type().ConvertibleTo(field.Type()) {
+		field.Set(v.Convert(field.Type()))
+		return nil
+	}
+	return fmt.Errorf("can't assign %T to %s", value, field.Type())
+}
+
+// assignText assign textual column value to the field
+func assignText(field reflect.Value, text []byte) (err error) {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(string(text))
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(string(text)); err == nil {
+			field.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(string(text), 10, 64); err == nil {
+			field.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		if u, err = strconv.ParseUint(string(text), 10, 64); err == nil {
+			field.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(string(text), 64); err == nil {
+			field.SetFloat(f)
+		}
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.Uint8 {
+			field.SetBytes(append([]byte{}, text...))
+			return nil
+		}
+		return json.Unmarshal(text, field.Addr().Interface())
+	case reflect.Struct:
+		if field.Type() == timeType {
+			var t time.Time
+			if t, err = time.Parse(time.DateTime, string(text)); err == nil {
+				field.Set(reflect.ValueOf(t))
+			}
+			return
+		}
+		return json.Unmarshal(text, field.Addr().Interface())
+	default:
+		return json.Unmarshal(text, field.Addr().Interface())
+	}
+	return
+}
+
+// endregion
@@ -0,0 +1,144 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// region Query concurrency limit definitions --------------------------------------------------------------------------
+
+// ErrTooManyQueries is the sentinel of QueryLimitError (use errors.Is)
+var ErrTooManyQueries = errors.New("too many concurrent queries")
+
+// QueryLimitError is returned by heavy queries (Find, Count, aggregations) rejected by the query concurrency limit: the
+// waiting queue is full or no slot was freed within the queue timeout
+type QueryLimitError struct {
+	Limit  int           // The maximum number of concurrent heavy queries
+	Queued int           // The number of queries waiting for a slot
+	Waited time.Duration // The time the query waited for a slot (0 if rejected immediately)
+}
+
+// Error returns the error message
+func (e *QueryLimitError) Error() string {
+	if e.Waited > 0 {
+		return fmt.Sprintf("%s: no free slot of %d within %s", ErrTooManyQueries.Error(), e.Limit, e.Waited)
+	}
+	return fmt.Sprintf("%s: %d running and %d queued", ErrTooManyQueries.Error(), e.Limit, e.Queued)
+}
+
+// Unwrap returns the ErrTooManyQueries sentinel
+func (e *QueryLimitError) Unwrap() error {
+	return ErrTooManyQueries
+}
+
+// queryLimiter limits the number of concurrent heavy queries of the database handle
+type queryLimiter struct {
+	mu      sync.Mutex    // Protect the limiter state
+	sem     chan struct{} // The query slots (nil for unlimited)
+	queue   int           // Maximum number of queries waiting for a slot
+	waiting int           // Number of queries waiting for a slot
+	timeout time.Duration // Maximum wait for a slot (0 to wait until a slot is freed)
+}
+
+// endregion
+
+// region Query concurrency limit methods ------------------------------------------------------------------------------
+
+// SetQueryLimit limit the number of concurrent heavy queries (Find, Count, aggregations, histograms, window and
+// downsampling) of the database handle, protecting the database from dashboard stampedes. Queries exceeding the limit
+// wait in queue for a free slot, queries exceeding the queue or the timeout fail with QueryLimitError.
+// Cross-shard queries are limited per shard query, and no more shard queries than the limit of the same cross-shard
+// query run at once, so with queue of 0 the shard queries are rejected only by other queries holding the slots.
+// The UNION ALL statement of MergeOnServer and the sequential streaming of FindAsync take a single slot.
+//
+// param: limit - Maximum number of concurrent heavy queries (0 for unlimited)
+// param: queue - Maximum number of queries waiting for a slot (0 to reject immediately)
+// param: timeout - Maximum wait for a slot (0 to wait until a slot is freed)
+func (dbs *MySqlDatabase) SetQueryLimit(limit, queue int, timeout time.Duration) {
+	l := &dbs.queries
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sem = nil
+	if limit > 0 {
+		l.sem = make(chan struct{}, limit)
+	}
+	l.queue = queue
+	l.timeout = timeout
+}
+
+// admitQuery wait for a free heavy query slot and returns the function to release it
+// the release function may be called more than once
+func (dbs *MySqlDatabase) admitQuery() (release func(), err error) {
+	l := &dbs.queries
+	l.mu.Lock()
+	sem, timeout := l.sem, l.timeout
+	if sem == nil {
+		l.mu.Unlock()
+		return func() {}, nil
+	}
+
+	select {
+	case sem <- struct{}{}:
+		l.mu.Unlock()
+		return releaseSlot(sem), nil
+	default:
+	}
+
+	if l.waiting >= l.queue {
+		queued := l.waiting
+		l.mu.Unlock()
+		return nil, &QueryLimitError{Limit: cap(sem), Queued: queued}
+	}
+	l.waiting++
+	l.mu.Unlock()
+
+	defer func() {
+		l.mu.Lock()
+		l.waiting--
+		l.mu.Unlock()
+	}()
+
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case sem <- struct{}{}:
+		return releaseSlot(sem), nil
+	case <-expired:
+		return nil, &QueryLimitError{Limit: cap(sem), Waited: timeout}
+	}
+}
+
+// queryLimit returns the maximum number of concurrent heavy queries (0 for unlimited)
+func (dbs *MySqlDatabase) queryLimit() int {
+	l := &dbs.queries
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return cap(l.sem)
+}
+
+// releaseSlot returns the function to free the slot of the semaphore (once)
+func releaseSlot(sem chan struct{}) func() {
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { <-sem })
+	}
+}
+
+// admit wait for a free heavy query slot, cross-shard queries fanned out to the shards are admitted per shard query
+// (the UNION ALL statement of MergeOnServer is admitted as a single query)
+func (s *mSqlDatabaseQuery) admit() (release func(), err error) {
+	if s.isAcross() {
+		return func() {}, nil
+	}
+	return s.db.admitQuery()
+}
+
+// endregion
@@ -0,0 +1,183 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Related entities definitions ---------------------------------------------------------------------------------
+
+// Relation describes the reference between the queried entity and a related entity table, for example:
+//
+//	// order.customerId -> customer.id
+//	Relation{Name: "customer", Factory: NewCustomer, LocalField: "customerId"}
+//	// customer.id <- order.customerId
+//	Relation{Name: "orders", Factory: NewOrder, ForeignField: "customerId"}
+type Relation struct {
+	Name         string        // The relation name (the key of the related entities in the result)
+	Factory      EntityFactory // The related entity factory
+	LocalField   string        // The reference field of the queried entity (empty for the entity id)
+	ForeignField string        // The reference field of the related entity (empty for the entity id)
+	Keys         []string      // Sharding key(s) of the related entity table
+}
+
+// RelatedEntity is the query result entity with its related entities populated
+type RelatedEntity struct {
+	Entity  Entity              // The entity
+	Related map[string][]Entity // The related entities by relation name
+}
+
+const sqlRelatedByField = `SELECT id, data FROM "%s" WHERE data->>'%s' = ANY($1)`
+
+// endregion
+
+// region Related entities methods -------------------------------------------------------------------------------------
+
+// Include load the related entities of the relation with the results of FindRelated
+func (s *mSqlDatabaseQuery) Include(relation Relation) IMySqlQuery {
+	s.relations = append(s.relations, relation)
+	return s
+}
+
+// FindRelated execute the query (see Find) and populate the related entities of the included relations, the related
+// entities of each relation are loaded by a single query (instead of a Get per entity)
+func (s *mSqlDatabaseQuery) FindRelated(keys ...string) (out []RelatedEntity, total int64, err error) {
+
+	for _, rel := range s.relations {
+		for _, field := range []string{rel.LocalField, rel.ForeignField} {
+			if field == "" {
+				continue
+			}
+			if err = validateFields(field); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	entities, total, err := s.Find(keys...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out = make([]RelatedEntity, 0, len(entities))
+	for _, entity := range entities {
+		out = append(out, RelatedEntity{Entity: entity, Related: make(map[string][]Entity, len(s.relations))})
+	}
+	if len(out) == 0 {
+		return
+	}
+
+	for _, rel := range s.relations {
+		if err = s.loadRelated(rel, out); err != nil {
+			return nil, 0, err
+		}
+	}
+	return
+}
+
+// loadRelated load the related entities of the relation and assign them to the entities
+func (s *mSqlDatabaseQuery) loadRelated(rel Relation, out []RelatedEntity) (err error) {
+
+	defer s.db.observe("find_related", rel.Factory().TABLE(), len(out), time.Now(), nil, &err)
+
+	// Collect the distinct reference values
+	refs := make([]string, len(out))
+	values := make([]string, 0, len(out))
+	seen := make(map[string]bool, len(out))
+	for i, item := range out {
+		if refs[i], err = referenceValue(item.Entity, rel.LocalField); err != nil {
+			return
+		}
+		if refs[i] != "" && !seen[refs[i]] {
+			seen[refs[i]] = true
+			values = append(values, refs[i])
+		}
+	}
+
+	// Load the related entities and group them by the reference value
+	var related []Entity
+	if rel.ForeignField == "" {
+		related, err = s.db.list(rel.Factory, values, rel.Keys...)
+	} else {
+		related, err = s.db.listByField(rel.Factory, rel.ForeignField, values, rel.Keys...)
+	}
+	if err != nil {
+		return
+	}
+
+	// The related entities are grouped by their stored reference value and then masked (see SetMaskingRules)
+	masked, err := s.db.maskEntities(rel.Factory, related)
+	if err != nil {
+		return
+	}
+	groups := make(map[string][]Entity)
+	for i, entity := range related {
+		ref, er := referenceValue(entity, rel.ForeignField)
+		if er != nil {
+			return er
+		}
+		groups[ref] = append(groups[ref], masked[i])
+	}
+	for i := range out {
+		out[i].Related[rel.Name] = groups[refs[i]]
+	}
+	return nil
+}
+
+// listByField get the entities whose field value is one of the values
+func (dbs *MySqlDatabase) listByField(factory EntityFactory, field string, values []string, keys ...string) (list []Entity, err error) {
+	list = make([]Entity, 0)
+	if len(values) == 0 {
+		return
+	}
+
+	table, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return
+	}
+	rows, err := dbs.query(dbs.pgDb, table, tenantOf(keys...), fmt.Sprintf(sqlRelatedByField, table, field), values)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		jsonDoc := JsonDoc{}
+		if err = rows.Scan(&jsonDoc.Id, &jsonDoc.Data); err != nil {
+			return
+		}
+		var entity Entity
+		if entity, err = dbs.unmarshal(factory, []byte(jsonDoc.Data)); err != nil {
+			return
+		}
+		list = append(list, entity)
+	}
+	return list, rows.Err()
+}
+
+// referenceValue returns the text value of the entity field (the entity id for empty field)
+func referenceValue(entity Entity, field string) (string, error) {
+	if field == "" {
+		return entity.ID(), nil
+	}
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return "", err
+	}
+	doc := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&doc); err != nil {
+		return "", err
+	}
+	if value, ok := doc[field]; ok && value != nil {
+		return fmt.Sprintf("%v", value), nil
+	}
+	return "", nil
+}
+
+// endregion
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Query with total methods -------------------------------------------------------------------------------------
+
+// FindWithTotal execute the query and returns the page of entities with the exact total of matching rows (ignoring the
+// pagination), the total is calculated by the same statement using COUNT(*) OVER() instead of a second COUNT query.
+// When the page is beyond the last row no row carries the total, so it falls back to COUNT query.
+//
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Page of entities, total matching rows, error
+func (s *mSqlDatabaseQuery) FindWithTotal(keys ...string) (out []Entity, total int64, err error) {
+
+	if err = s.validateKeys(keys...); err != nil {
+		return nil, 0, err
+	}
+	if s.isAcross() {
+		return s.Find(keys...)
+	}
+
+	release := s.db.throttle(keys...)
+	defer release()
+	defer s.db.observe("find", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer admitted()
+
+	sqlState, args := s.buildTotalStatement(keys...)
+	rows, err := s.db.query(s.db.pgDb, s.tableName(keys...), tenantOf(keys...), sqlState, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	scanned := 0
+	for rows.Next() {
+		jsonDoc := JsonDoc{}
+		if err = rows.Scan(&jsonDoc.Id, &jsonDoc.Data, &total); err != nil {
+			_ = rows.Close()
+			return nil, 0, err
+		}
+		scanned++
+
+		entity, er := s.unMarshal(&jsonDoc, nil)
+		if er != nil {
+			_ = rows.Close()
+			return nil, 0, er
+		}
+		if transformed := s.processCallbacks(entity); transformed != nil {
+			out = append(out, transformed)
+		}
+	}
+	_ = rows.Close()
+	release()
+	admitted()
+
+	if scanned == 0 && s.page > 1 && s.limit > 0 {
+		total, err = s.Count(keys...)
+	}
+	return
+}
+
+// buildTotalStatement build the SQL statement of the page with the total of matching rows in every row
+func (s *mSqlDatabaseQuery) buildTotalStatement(keys ...string) (SQL string, args []any) {
+	where, args := s.buildCriteria()
+	SQL = fmt.Sprintf(`SELECT id, data, COUNT(*) OVER() AS total FROM "%s"%s %s %s %s`, s.tableName(keys...), s.buildIndexHints(), where, s.buildOrder(), s.buildLimit())
+	return
+}
+
+// endregion
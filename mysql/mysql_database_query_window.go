@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Window functions definitions ---------------------------------------------------------------------------------
+
+// WindowFunc is the analytic function computed over the sorted entities
+type WindowFunc string
+
+const (
+	WindowRunningTotal WindowFunc = "running_total" // Cumulative sum of the field
+	WindowRunningAvg   WindowFunc = "running_avg"   // Cumulative average of the field
+	WindowRank         WindowFunc = "rank"          // Rank of the entity (with gaps)
+	WindowDenseRank    WindowFunc = "dense_rank"    // Rank of the entity (without gaps)
+	WindowRowNumber    WindowFunc = "row_number"    // Sequential number of the entity
+	WindowLag          WindowFunc = "lag"           // The field value of the previous entity (by offset)
+	WindowLead         WindowFunc = "lead"          // The field value of the next entity (by offset)
+	WindowDelta        WindowFunc = "delta"         // The field value minus the field value of the previous entity (by offset)
+)
+
+// WindowColumn defines single window function column
+type WindowColumn struct {
+	Name        string     // The name of the value in the results
+	Function    WindowFunc // The window function
+	Field       string     // The numeric field (not used by rank functions)
+	PartitionBy string     // Optional field to partition by (e.g. the series id)
+	OrderBy     string     // The field to sort the window by (field_name- for descending), the query sort order if empty
+	Offset      int        // The offset of lag, lead and delta (default 1)
+}
+
+// WindowResult is the entity with its window function values, null values (e.g. lag of the first entity) are omitted
+type WindowResult struct {
+	Entity Entity             // The entity
+	Values map[string]float64 // Map of the window column name to its value
+}
+
+// endregion
+
+// region Window functions methods -------------------------------------------------------------------------------------
+
+// Window execute the query based on the criteria, order and pagination and returns the entities with the values of the
+// window functions (MySQL 8), computed over the matching entities sorted by the window order, e.g. deltas of time series
+//
+// param: columns - The window function columns
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: List of entities with the window values, error
+func (s *mSqlDatabaseQuery) Window(columns []WindowColumn, keys ...string) (out []WindowResult, err error) {
+
+	if err = s.validateKeys(keys...); err != nil {
+		return nil, err
+	}
+
+	defer s.db.throttle(keys...)()
+	defer s.db.observe("window", s.factory().TABLE(), 0, time.Now(), nil, &err)
+
+	admitted, err := s.admit()
+	if err != nil {
+		return nil, err
+	}
+	defer admitted()
+
+	exprs := make([]string, 0, len(columns))
+	for i, col := range columns {
+		expr, er := s.windowExpr(col)
+		if er != nil {
+			return nil, er
+		}
+		exprs = append(exprs, fmt.Sprintf("%s AS w%d", expr, i))
+	}
+
+	tblName := s.tableName(keys...)
+	where, args := s.buildCriteria()
+	SQL := fmt.Sprintf(`SELECT id, data, %s FROM "%s"%s %s %s %s`, strings.Join(exprs, ", "), tblName, s.buildIndexHints(), where, s.buildOrder(), s.buildLimit())
+
+	rows, err := s.db.query(s.db.pgDb, tblName, tenantOf(keys...), SQL, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	values := make([]sql.NullFloat64, len(columns))
+	for rows.Next() {
+		jsonDoc := JsonDoc{}
+		dest := []any{&jsonDoc.Id, &jsonDoc.Data}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		entity, er := s.unMarshal(&jsonDoc, nil)
+		if er != nil {
+			return nil, er
+		}
+		if entity = s.processCallbacks(entity); entity == nil {
+			continue
+		}
+
+		result := WindowResult{Entity: entity, Values: make(map[string]float64)}
+		for i, col := range columns {
+			if values[i].Valid {
+				result.Values[col.Name] = values[i].Float64
+			}
+		}
+		out = append(out, result)
+	}
+	return out, rows.Err()
+}
+
+// windowExpr build the SQL expression of the window column
+func (s *mSqlDatabaseQuery) windowExpr(col WindowColumn) (string, error) {
+	if col.Name == "" {
+		return "", fmt.Errorf("window column name is required")
+	}
+
+	over, err := s.windowSpec(col)
+	if err != nil {
+		return "", err
+	}
+
+	offset := col.Offset
+	if offset < 1 {
+		offset = 1
+	}
+	value := fmt.Sprintf("(%s)::FLOAT", s.fieldExpr(col.Field))
+
+	switch col.Function {
+	case WindowRank:
+		return fmt.Sprintf("RANK() OVER (%s)", over), nil
+	case WindowDenseRank:
+		return fmt.Sprintf("DENSE_RANK() OVER (%s)", over), nil
+	case WindowRowNumber:
+		return fmt.Sprintf("ROW_NUMBER() OVER (%s)", over), nil
+	}
+
+	if col.Field == "" {
+		return "", fmt.Errorf("window function %s of column %s requires field", col.Function, col.Name)
+	}
+	if err = validateFields(col.Field); err != nil {
+		return "", err
+	}
+
+	switch col.Function {
+	case WindowRunningTotal:
+		return fmt.Sprintf("SUM(%s) OVER (%s ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)", value, over), nil
+	case WindowRunningAvg:
+		return fmt.Sprintf("AVG(%s) OVER (%s ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW)", value, over), nil
+	case WindowLag:
+		return fmt.Sprintf("LAG(%s, %d) OVER (%s)", value, offset, over), nil
+	case WindowLead:
+		return fmt.Sprintf("LEAD(%s, %d) OVER (%s)", value, offset, over), nil
+	case WindowDelta:
+		return fmt.Sprintf("%s - LAG(%s, %d) OVER (%s)", value, value, offset, over), nil
+	default:
+		return "", fmt.Errorf("window function %s not supported", col.Function)
+	}
+}
+
+// windowSpec build the PARTITION BY and ORDER BY of the window
+func (s *mSqlDatabaseQuery) windowSpec(col WindowColumn) (string, error) {
+	parts := make([]string, 0, 2)
+	if col.PartitionBy != "" {
+		if err := validateFields(col.PartitionBy); err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("PARTITION BY %s", s.fieldExpr(col.PartitionBy)))
+	}
+
+	if col.OrderBy == "" {
+		if order := s.buildOrder(); order != "" {
+			parts = append(parts, order)
+		}
+		return strings.Join(parts, " "), nil
+	}
+
+	field, direction := strings.TrimSuffix(col.OrderBy, "+"), "ASC"
+	if strings.HasSuffix(field, "-") {
+		field, direction = field[:len(field)-1], "DESC"
+	}
+	if err := validateFields(field); err != nil {
+		return "", err
+	}
+	parts = append(parts, fmt.Sprintf("ORDER BY %s %s", s.fieldExpr(field), direction))
+	return strings.Join(parts, " "), nil
+}
+
+// endregion
@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// region Statement recorder definitions -------------------------------------------------------------------------------
+
+// StatementRecorder captures the statements executed by the database (SQL and arguments), used for golden-file
+// assertions on the generated SQL
+type StatementRecorder struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+// NewStatementRecorder create statement recorder
+func NewStatementRecorder() *StatementRecorder {
+	return &StatementRecorder{statements: make([]Statement, 0)}
+}
+
+// endregion
+
+// region Statement recorder methods -----------------------------------------------------------------------------------
+
+// NewRecordingDatabase create database which records the statements without hitting a database server, all the
+// statements succeed: queries return no rows and commands report single affected row
+//
+// param: recorder - The statement recorder
+// return: Recording database
+func NewRecordingDatabase(recorder *StatementRecorder) *MySqlDatabase {
+	dbs := &MySqlDatabase{pgDb: sql.OpenDB(recorderConnector{}), uri: "mysql://recorder"}
+	dbs.Use(recorder.Middleware())
+	return dbs
+}
+
+// Middleware returns the middleware recording the statements, to record the statements of a real database use:
+// db.Use(recorder.Middleware())
+func (r *StatementRecorder) Middleware() Middleware {
+	return func(next Executor) Executor {
+		return func(stmt *Statement) (*StatementResult, error) {
+			r.mu.Lock()
+			recorded := *stmt
+			recorded.Args = append([]any{}, stmt.Args...)
+			r.statements = append(r.statements, recorded)
+			r.mu.Unlock()
+			return next(stmt)
+		}
+	}
+}
+
+// Statements returns the recorded statements
+func (r *StatementRecorder) Statements() []Statement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Statement{}, r.statements...)
+}
+
+// Reset clear the recorded statements
+func (r *StatementRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = make([]Statement, 0)
+}
+
+// String returns the recorded statements, one normalized statement per line followed by its arguments
+func (r *StatementRecorder) String() string {
+	sb := strings.Builder{}
+	_ = r.Write(&sb)
+	return sb.String()
+}
+
+// Write the recorded statements (see String) to the writer, e.g. a golden file
+//
+// param: w - The writer
+// return: error
+func (r *StatementRecorder) Write(w io.Writer) error {
+	for _, stmt := range r.Statements() {
+		args := make([]string, 0, len(stmt.Args))
+		for _, arg := range stmt.Args {
+			if b, ok := arg.([]byte); ok {
+				arg = string(b)
+			}
+			args = append(args, fmt.Sprintf("%v", arg))
+		}
+		if _, err := fmt.Fprintf(w, "%s [%s]\n", normalizeSQL(stmt.SQL), strings.Join(args, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// endregion
+
+// region Recorder driver ----------------------------------------------------------------------------------------------
+
+// recorderConnector is a driver connector of connections which do not execute the statements
+type recorderConnector struct{}
+
+func (c recorderConnector) Connect(context.Context) (driver.Conn, error) { return recorderConn{}, nil }
+func (c recorderConnector) Driver() driver.Driver                        { return recorderDriver{} }
+
+type recorderDriver struct{}
+
+func (d recorderDriver) Open(string) (driver.Conn, error) { return recorderConn{}, nil }
+
+type recorderConn struct{}
+
+func (c recorderConn) Prepare(string) (driver.Stmt, error) { return recorderStmt{}, nil }
+func (c recorderConn) Close() error                        { return nil }
+func (c recorderConn) Begin() (driver.Tx, error)           { return recorderTx{}, nil }
+func (c recorderConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return recorderTx{}, nil
+}
+func (c recorderConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type recorderTx struct{}
+
+func (t recorderTx) Commit() error   { return nil }
+func (t recorderTx) Rollback() error { return nil }
+
+type recorderStmt struct{}
+
+func (s recorderStmt) Close() error                               { return nil }
+func (s recorderStmt) NumInput() int                              { return -1 }
+func (s recorderStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (s recorderStmt) Query([]driver.Value) (driver.Rows, error)  { return recorderRows{}, nil }
+
+type recorderRows struct{}
+
+func (r recorderRows) Columns() []string         { return []string{} }
+func (r recorderRows) Close() error              { return nil }
+func (r recorderRows) Next([]driver.Value) error { return io.EOF }
+
+// endregion
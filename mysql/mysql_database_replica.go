@@ -0,0 +1,276 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var readStatementRegex = regexp.MustCompile(`(?is)^\s*(/\*.*?\*/\s*)?SELECT\s`)
+var systemSchemaRegex = regexp.MustCompile(`(?i)\b(information_schema|performance_schema|sys)\.`)
+
+// region Read replicas definitions ------------------------------------------------------------------------------------
+
+// Routing sources of native queries (see ExecuteQuery), any other source is a label routed by the default policy
+const (
+	SourcePrimary = "primary" // Always read from the primary database
+	SourceReplica = "replica" // Read from a healthy replica, ignoring the read-your-writes window
+)
+
+// replica is a single read replica connection
+type replica struct {
+	uri     string        // Replica connection URI
+	db      *sql.DB       // The sql connection
+	ssh     *ssh.Client   // SSH client (in case of connection over SSH)
+	tunnel  net.Listener  // SSH tunnel (in case of connection over SSH)
+	lag     time.Duration // Last probed replication lag
+	healthy bool          // Last probe succeeded and replication is running
+	probed  time.Time     // Time of the last probe
+}
+
+// replicaSet routes the read statements to the read replicas
+type replicaSet struct {
+	mu             sync.Mutex    // Protect the replicas state
+	replicas       []*replica    // List of read replicas
+	next           int           // Round-robin index
+	maxLag         time.Duration // Skip replicas whose lag exceeds the threshold (0 for no threshold)
+	readYourWrites time.Duration // Read from the primary for this time window after a tenant write (0 to disable)
+	probeInterval  time.Duration // Time interval between replication lag probes
+	writes         sync.Map      // Map of tenant to the time of its last write
+}
+
+// defaultProbeInterval is the default time interval between replication lag probes
+const defaultProbeInterval = 5 * time.Second
+
+// endregion
+
+// region Read replicas methods ----------------------------------------------------------------------------------------
+
+// AddReplica add read replica, read statements (SELECT) executed outside of transactions are distributed (round-robin)
+// between the healthy replicas
+//
+// param: URI - The replica connection string (same format of the primary database URI)
+// return: error
+func (dbs *MySqlDatabase) AddReplica(URI string) error {
+	db, sshCli, tunnel, err := openConnection(URI)
+	if err != nil {
+		return err
+	}
+
+	rs := &dbs.replicas
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.replicas = append(rs.replicas, &replica{uri: URI, db: db, ssh: sshCli, tunnel: tunnel})
+	return nil
+}
+
+// SetReplicaPolicy configure the read replicas routing policy
+//
+// param: maxLag - Skip replicas whose replication lag exceeds the threshold (0 for no threshold)
+// param: readYourWrites - Read from the primary for this time window after a write of the same tenant (0 to disable)
+// param: probeInterval - Time interval between replication lag probes (0 for the default of 5 seconds)
+func (dbs *MySqlDatabase) SetReplicaPolicy(maxLag, readYourWrites, probeInterval time.Duration) {
+	rs := &dbs.replicas
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	rs.maxLag = maxLag
+	rs.readYourWrites = readYourWrites
+	rs.probeInterval = probeInterval
+}
+
+// ReplicationLag probe the replication lag of the database (Seconds_Behind_Source of the replica status)
+// Returns zero lag if the database is not a replica, and error if the replication is not running
+//
+// return: Replication lag, error
+func (dbs *MySqlDatabase) ReplicationLag() (time.Duration, error) {
+	return dbs.replicationLag(dbs.pgDb)
+}
+
+// replicationLag probe the replication lag of the connection
+func (dbs *MySqlDatabase) replicationLag(db *sql.DB) (lag time.Duration, err error) {
+	var rows *sql.Rows
+	for _, SQL := range []string{"SHOW REPLICA STATUS", "SHOW SLAVE STATUS"} {
+		if rows, err = dbs.query(db, "", "", SQL); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	// Not a replica
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, fmt.Errorf("replication is not running")
+		}
+		seconds, er := strconv.ParseInt(values[i].String, 10, 64)
+		if er != nil {
+			return 0, er
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, fmt.Errorf("replication lag is not reported")
+}
+
+// readRunner returns the runner of the statement: healthy replica for read statements, otherwise the primary
+func (dbs *MySqlDatabase) readRunner(runner sqlRunner, stmt *Statement) sqlRunner {
+	rs := &dbs.replicas
+
+	// Writes in transactions are recorded as well, so the read-your-writes window covers them
+	if runner != dbs.pgDb {
+		rs.markWrite(stmt)
+		return runner
+	}
+
+	if !stmt.Query || !readStatementRegex.MatchString(stmt.SQL) || systemSchemaRegex.MatchString(stmt.SQL) {
+		rs.markWrite(stmt)
+		return runner
+	}
+
+	if stmt.Source == SourcePrimary {
+		return runner
+	}
+	if db := dbs.pickReplica(stmt.Tenant, stmt.Source == SourceReplica); db != nil {
+		return db
+	}
+	return runner
+}
+
+// markWrite record the time of the tenant last write (for read-your-writes consistency)
+func (rs *replicaSet) markWrite(stmt *Statement) {
+	if stmt.Query {
+		return
+	}
+	rs.mu.Lock()
+	enabled := len(rs.replicas) > 0 && rs.readYourWrites > 0
+	rs.mu.Unlock()
+
+	if enabled {
+		rs.writes.Store(stmt.Tenant, time.Now())
+	}
+}
+
+// pickReplica returns the next healthy replica (nil to read from the primary), the read-your-writes window is ignored
+// when the replica is requested explicitly. The replication lag probe runs outside of the replicas lock, so a slow
+// replica does not block the routing of the other statements
+func (dbs *MySqlDatabase) pickReplica(tenant string, explicit bool) *sql.DB {
+	rs := &dbs.replicas
+	rs.mu.Lock()
+	if len(rs.replicas) == 0 {
+		rs.mu.Unlock()
+		return nil
+	}
+
+	// Read your writes: read from the primary within the consistency window after the tenant (or global) write
+	if rs.readYourWrites > 0 && !explicit {
+		for _, key := range []string{tenant, ""} {
+			if last, ok := rs.writes.Load(key); ok && time.Since(last.(time.Time)) < rs.readYourWrites {
+				rs.mu.Unlock()
+				return nil
+			}
+		}
+	}
+
+	interval := rs.probeInterval
+	if interval <= 0 {
+		interval = defaultProbeInterval
+	}
+
+	// Take the round-robin order under the lock
+	candidates := make([]*replica, 0, len(rs.replicas))
+	for i := 0; i < len(rs.replicas); i++ {
+		candidates = append(candidates, rs.replicas[(rs.next+i)%len(rs.replicas)])
+	}
+	rs.next++
+	maxLag := rs.maxLag
+	rs.mu.Unlock()
+
+	for _, r := range candidates {
+		if !dbs.probeReplica(r, interval) {
+			continue
+		}
+		rs.mu.Lock()
+		usable := r.healthy && (maxLag <= 0 || r.lag <= maxLag)
+		rs.mu.Unlock()
+		if usable {
+			return r.db
+		}
+	}
+	return nil
+}
+
+// probeReplica probe the replication lag of the replica when the probe interval has elapsed (the probe itself runs
+// outside of the replicas lock), returns false if the last probe failed
+func (dbs *MySqlDatabase) probeReplica(r *replica, interval time.Duration) bool {
+	rs := &dbs.replicas
+	rs.mu.Lock()
+	if time.Since(r.probed) < interval {
+		healthy := r.healthy
+		rs.mu.Unlock()
+		return healthy
+	}
+	// Claim the probe, concurrent readers keep using the last known state meanwhile
+	r.probed = time.Now()
+	rs.mu.Unlock()
+
+	lag, err := dbs.replicationLag(r.db)
+
+	rs.mu.Lock()
+	r.probed = time.Now()
+	r.healthy = err == nil
+	r.lag = lag
+	rs.mu.Unlock()
+
+	if err != nil {
+		dbs.log().Warn("replica probe failed: %s", err.Error())
+	}
+	return err == nil
+}
+
+// closeReplicas close all the replicas connections
+func (rs *replicaSet) closeReplicas() {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+
+	for _, r := range rs.replicas {
+		if r.tunnel != nil {
+			_ = r.tunnel.Close()
+		}
+		if r.ssh != nil {
+			_ = r.ssh.Close()
+		}
+		_ = r.db.Close()
+	}
+	rs.replicas = nil
+}
+
+// endregion
@@ -0,0 +1,235 @@
+package mysql
+
+import (
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Typed repository definitions ---------------------------------------------------------------------------------
+
+// Repo is a typed repository of single entity type over the database, the results are returned as the concrete entity
+// type instead of Entity, for example:
+//
+//	heroes := mysql.NewRepo[*Hero](db, NewHero)
+//	list, total, err := heroes.Query().Filter(database.F("name").Like("man")).Find()
+type Repo[T Entity] struct {
+	db      database.IDatabase
+	factory EntityFactory
+}
+
+// TypedQuery is a typed query of the repository entity type
+type TypedQuery[T Entity] struct {
+	query database.IQuery
+}
+
+// NewRepo factory method for typed repository
+//
+// param: db - The database (any IDatabase implementation, e.g. MySqlDatabase or FakeDatabase)
+// param: factory - Entity factory (must create entities of type T)
+// return: Typed repository
+func NewRepo[T Entity](db database.IDatabase, factory EntityFactory) *Repo[T] {
+	return &Repo[T]{db: db, factory: factory}
+}
+
+// endregion
+
+// region Typed repository methods -------------------------------------------------------------------------------------
+
+// Get a single entity by ID
+func (r *Repo[T]) Get(entityID string, keys ...string) (result T, err error) {
+	entity, err := r.db.Get(r.factory, entityID, keys...)
+	if err != nil {
+		return
+	}
+	return entity.(T), nil
+}
+
+// Exists checks if entity exists by ID
+func (r *Repo[T]) Exists(entityID string, keys ...string) (bool, error) {
+	return r.db.Exists(r.factory, entityID, keys...)
+}
+
+// List gets multiple entities by IDs
+func (r *Repo[T]) List(entityIDs []string, keys ...string) ([]T, error) {
+	list, err := r.db.List(r.factory, entityIDs, keys...)
+	return typedList[T](list), err
+}
+
+// Insert new entity
+func (r *Repo[T]) Insert(entity T) (result T, err error) {
+	return typed[T](r.db.Insert(entity))
+}
+
+// Update existing entity
+func (r *Repo[T]) Update(entity T) (result T, err error) {
+	return typed[T](r.db.Update(entity))
+}
+
+// Upsert update entity or insert it if it does not exist
+func (r *Repo[T]) Upsert(entity T) (result T, err error) {
+	return typed[T](r.db.Upsert(entity))
+}
+
+// Delete entity by ID
+func (r *Repo[T]) Delete(entityID string, keys ...string) error {
+	return r.db.Delete(r.factory, entityID, keys...)
+}
+
+// BulkInsert insert multiple entities in a single transaction
+func (r *Repo[T]) BulkInsert(entities []T) (int64, error) {
+	return r.db.BulkInsert(entityList(entities))
+}
+
+// BulkUpdate update multiple entities in a single transaction
+func (r *Repo[T]) BulkUpdate(entities []T) (int64, error) {
+	return r.db.BulkUpdate(entityList(entities))
+}
+
+// BulkUpsert upsert multiple entities in a single transaction
+func (r *Repo[T]) BulkUpsert(entities []T) (int64, error) {
+	return r.db.BulkUpsert(entityList(entities))
+}
+
+// BulkDelete delete multiple entities by IDs in a single transaction
+func (r *Repo[T]) BulkDelete(entityIDs []string, keys ...string) (int64, error) {
+	return r.db.BulkDelete(r.factory, entityIDs, keys...)
+}
+
+// SetField update a single field of the entity
+func (r *Repo[T]) SetField(entityID string, field string, value any, keys ...string) error {
+	return r.db.SetField(r.factory, entityID, field, value, keys...)
+}
+
+// SetFields update some fields of the entity
+func (r *Repo[T]) SetFields(entityID string, fields map[string]any, keys ...string) error {
+	return r.db.SetFields(r.factory, entityID, fields, keys...)
+}
+
+// Query returns typed query builder of the entity
+func (r *Repo[T]) Query() *TypedQuery[T] {
+	return &TypedQuery[T]{query: r.db.Query(r.factory)}
+}
+
+// endregion
+
+// region Typed query methods ------------------------------------------------------------------------------------------
+
+// Filter adds a single field filter
+func (q *TypedQuery[T]) Filter(filter database.QueryFilter) *TypedQuery[T] {
+	q.query = q.query.Filter(filter)
+	return q
+}
+
+// Range adds time range filter on timestamp field
+func (q *TypedQuery[T]) Range(field string, from Timestamp, to Timestamp) *TypedQuery[T] {
+	q.query = q.query.Range(field, from, to)
+	return q
+}
+
+// MatchAll adds list of filters, all of them should be satisfied (AND)
+func (q *TypedQuery[T]) MatchAll(filters ...database.QueryFilter) *TypedQuery[T] {
+	q.query = q.query.MatchAll(filters...)
+	return q
+}
+
+// MatchAny adds list of filters, any of them should be satisfied (OR)
+func (q *TypedQuery[T]) MatchAny(filters ...database.QueryFilter) *TypedQuery[T] {
+	q.query = q.query.MatchAny(filters...)
+	return q
+}
+
+// Sort adds sort order by field: field_name (Ascending) or field_name- (Descending)
+func (q *TypedQuery[T]) Sort(sort string) *TypedQuery[T] {
+	q.query = q.query.Sort(sort)
+	return q
+}
+
+// Page sets the requested page number (used for pagination)
+func (q *TypedQuery[T]) Page(page int) *TypedQuery[T] {
+	q.query = q.query.Page(page)
+	return q
+}
+
+// Limit sets the page size limit (used for pagination)
+func (q *TypedQuery[T]) Limit(limit int) *TypedQuery[T] {
+	q.query = q.query.Limit(limit)
+	return q
+}
+
+// Query returns the underlying (untyped) query, e.g. for aggregations
+func (q *TypedQuery[T]) Query() database.IQuery {
+	return q.query
+}
+
+// Find executes the query and returns the entities and the total number of matching entities
+func (q *TypedQuery[T]) Find(keys ...string) ([]T, int64, error) {
+	list, total, err := q.query.Find(keys...)
+	return typedList[T](list), total, err
+}
+
+// FindSingle executes the query and returns the first matching entity
+func (q *TypedQuery[T]) FindSingle(keys ...string) (result T, err error) {
+	return typed[T](q.query.FindSingle(keys...))
+}
+
+// List executes the query on the list of IDs
+func (q *TypedQuery[T]) List(entityIDs []string, keys ...string) ([]T, error) {
+	list, err := q.query.List(entityIDs, keys...)
+	return typedList[T](list), err
+}
+
+// GetMap executes the query and returns map of entity ID to entity
+func (q *TypedQuery[T]) GetMap(keys ...string) (map[string]T, error) {
+	out, err := q.query.GetMap(keys...)
+	result := make(map[string]T, len(out))
+	for id, entity := range out {
+		if t, ok := entity.(T); ok {
+			result[id] = t
+		}
+	}
+	return result, err
+}
+
+// Count executes the query and returns the number of matching entities
+func (q *TypedQuery[T]) Count(keys ...string) (int64, error) {
+	return q.query.Count(keys...)
+}
+
+// Delete executes delete of the matching entities
+func (q *TypedQuery[T]) Delete(keys ...string) (int64, error) {
+	return q.query.Delete(keys...)
+}
+
+// endregion
+
+// region Typed repository helpers -------------------------------------------------------------------------------------
+
+// typed cast the operation result to the entity type
+func typed[T Entity](entity Entity, err error) (result T, _ error) {
+	if err != nil || entity == nil {
+		return result, err
+	}
+	return entity.(T), nil
+}
+
+// typedList cast the list of entities to the entity type (entities of other types are skipped)
+func typedList[T Entity](list []Entity) []T {
+	result := make([]T, 0, len(list))
+	for _, entity := range list {
+		if t, ok := entity.(T); ok {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// entityList convert typed list to list of entities
+func entityList[T Entity](list []T) []Entity {
+	result := make([]Entity, 0, len(list))
+	for _, entity := range list {
+		result = append(result, entity)
+	}
+	return result
+}
+
+// endregion
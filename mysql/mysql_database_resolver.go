@@ -0,0 +1,129 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var keyPlaceholderRegex = regexp.MustCompile(`\{\{(\d+)\}\}`)
+
+// region Table name resolver definitions ------------------------------------------------------------------------------
+
+// ITableNameResolver resolves the physical table name from the entity table template, shard keys and reference time
+type ITableNameResolver interface {
+
+	// Resolve returns the physical table name
+	Resolve(template string, now time.Time, keys ...string) string
+}
+
+// TableNameResolverFunc is an adapter to use ordinary function as table name resolver
+type TableNameResolverFunc func(template string, now time.Time, keys ...string) string
+
+// Resolve returns the physical table name
+func (f TableNameResolverFunc) Resolve(template string, now time.Time, keys ...string) string {
+	return f(template, now, keys...)
+}
+
+// DefaultTableNameResolver is the built-in resolver replacing the template placeholders:
+// {{0}}..{{n}} (shard keys), {{accountId}} (first key), {{year}}, {{month}}, {{week}}, {{day}} and {{hour}}
+// Custom resolvers may delegate to it and decorate the result (e.g. add region prefix)
+type DefaultTableNameResolver struct{}
+
+// Resolve returns the physical table name
+func (r DefaultTableNameResolver) Resolve(template string, now time.Time, keys ...string) string {
+	return resolveTableName(template, now, keys...)
+}
+
+// MissingShardKeyError is returned when an operation on a sharded entity is called without the required shard keys
+type MissingShardKeyError struct {
+	Template string // The entity table template
+	Required int    // Number of required shard keys
+	Provided int    // Number of provided (non-empty) shard keys
+}
+
+// Error returns the error message
+func (e *MissingShardKeyError) Error() string {
+	return fmt.Sprintf("table %s requires %d shard key(s), %d provided", e.Template, e.Required, e.Provided)
+}
+
+// endregion
+
+// region Table name resolver methods ----------------------------------------------------------------------------------
+
+// SetTableNameResolver set the strategy used to resolve physical table names (nil resets to the default resolver)
+//
+// param: resolver - Table name resolver
+func (dbs *MySqlDatabase) SetTableNameResolver(resolver ITableNameResolver) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.resolver = resolver
+}
+
+// SetDefaultShardKey set the shard key used when a sharded entity operation is called without the required keys
+// (empty string resets to strict mode, where missing keys are rejected with MissingShardKeyError)
+//
+// param: key - The default shard key
+func (dbs *MySqlDatabase) SetDefaultShardKey(key string) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.defaultKey = key
+}
+
+// resolveTable resolve the physical table name after validating that all the shard keys required by the template are provided
+// missing keys are mapped to the default shard key (if configured)
+func (dbs *MySqlDatabase) resolveTable(template string, keys ...string) (string, error) {
+
+	now, keys := dbs.referenceTime(keys...)
+	required := requiredKeys(template)
+	if required == 0 {
+		return dbs.resolveName(template, now, keys...), nil
+	}
+
+	dbs.mu.RLock()
+	defaultKey := dbs.defaultKey
+	dbs.mu.RUnlock()
+
+	resolved := make([]string, required)
+	provided := 0
+	for i := 0; i < required; i++ {
+		if i < len(keys) && keys[i] != "" {
+			resolved[i] = keys[i]
+			provided++
+		} else if defaultKey != "" {
+			resolved[i] = defaultKey
+		} else {
+			return "", &MissingShardKeyError{Template: template, Required: required, Provided: provided}
+		}
+	}
+	if len(keys) > required {
+		resolved = append(resolved, keys[required:]...)
+	}
+	return dbs.resolveName(template, now, resolved...), nil
+}
+
+// requiredKeys returns the number of shard keys required by the table template
+func requiredKeys(template string) (required int) {
+	template = strings.Replace(template, "{{accountId}}", "{{0}}", -1)
+	for _, match := range keyPlaceholderRegex.FindAllStringSubmatch(template, -1) {
+		if idx, err := strconv.Atoi(match[1]); err == nil && idx+1 > required {
+			required = idx + 1
+		}
+	}
+	return
+}
+
+// tableNameResolver returns the configured table name resolver
+func (dbs *MySqlDatabase) tableNameResolver() ITableNameResolver {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+
+	if dbs.resolver == nil {
+		return DefaultTableNameResolver{}
+	}
+	return dbs.resolver
+}
+
+// endregion
@@ -0,0 +1,214 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// region Retention manager definitions --------------------------------------------------------------------------------
+
+// RetentionPolicy configures the retention of the documents of entity table (all its shards for table templates)
+type RetentionPolicy struct {
+	Template  string        // The entity table template (e.g. event-{{accountId}}-{{year}}{{month}})
+	Field     string        // Timestamp field (epoch milliseconds) ordering the documents (default: createdOn)
+	MaxAge    time.Duration // Delete documents older than the max age, period tables which ended before are dropped (0 for no age limit)
+	MaxRows   int64         // Keep only the newest documents of every table or shard (0 for no rows limit)
+	BatchSize int           // Max number of rows deleted by a single statement (default: 1000)
+}
+
+// RetentionResult is the outcome of enforcing retention policy on single table
+type RetentionResult struct {
+	Table   string // The physical table name
+	Rows    int64  // Number of reclaimed rows
+	Dropped bool   // The whole table was dropped
+}
+
+// RetentionManager is a background scheduler enforcing the retention policies, the reclaimed rows are reported to the
+// metrics hook as "retention" operations. Documents are removed without change notifications.
+type RetentionManager struct {
+	db       *MySqlDatabase    // The database
+	interval time.Duration     // Time interval between retention runs
+	policies []RetentionPolicy // List of retention policies
+	stop     chan struct{}     // Stop signal
+	wg       sync.WaitGroup    // Wait for the background worker to exit
+}
+
+const (
+	sqlRetentionCount     = `SELECT COUNT(*) FROM "%s"`
+	sqlRetentionDelete    = `DELETE FROM "%s" WHERE CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED) < $1 LIMIT %d`
+	sqlRetentionThreshold = `SELECT CAST(JSON_EXTRACT(data, '$.%s') AS SIGNED) AS ts FROM "%s" ORDER BY ts DESC LIMIT 1 OFFSET %d`
+)
+
+// NewRetentionManager factory method for retention manager
+//
+// param: db - The MySQL database
+// param: interval - Time interval between retention runs
+// param: policies - List of retention policies
+// return: Retention manager (call Start() to run it in the background)
+func NewRetentionManager(db *MySqlDatabase, interval time.Duration, policies ...RetentionPolicy) *RetentionManager {
+	return &RetentionManager{
+		db:       db,
+		interval: interval,
+		policies: policies,
+	}
+}
+
+// endregion
+
+// region Retention manager methods ------------------------------------------------------------------------------------
+
+// Start run the retention periodically in the background (the first run is executed immediately)
+func (m *RetentionManager) Start() {
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := m.RunOnce(); err != nil {
+				m.db.log().Warn("retention failed: %s", err.Error())
+			}
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the background retention and wait for the running retention to complete
+func (m *RetentionManager) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.wg.Wait()
+	m.stop = nil
+}
+
+// RunOnce enforce all the retention policies once
+//
+// return: List of tables with reclaimed rows, error (the last error, the other policies are still enforced)
+func (m *RetentionManager) RunOnce() (results []RetentionResult, err error) {
+	results = make([]RetentionResult, 0)
+	for _, policy := range m.policies {
+		list, er := m.retain(policy)
+		results = append(results, list...)
+		if er != nil {
+			err = er
+		}
+	}
+	return
+}
+
+// retain enforce single retention policy on all the tables of the template
+func (m *RetentionManager) retain(policy RetentionPolicy) (results []RetentionResult, err error) {
+
+	if policy.Field == "" {
+		policy.Field = "createdOn"
+	}
+	if err = validateFields(policy.Field); err != nil {
+		return nil, err
+	}
+	if policy.BatchSize <= 0 {
+		policy.BatchSize = 1000
+	}
+
+	template := strings.Replace(policy.Template, "{{accountId}}", "{{0}}", -1)
+	shards := []ShardInfo{{Table: template}}
+	if strings.Contains(template, "{{") {
+		if shards, err = m.db.listShards(template); err != nil {
+			return nil, err
+		}
+	}
+
+	results = make([]RetentionResult, 0)
+	for _, shard := range shards {
+		result, er := m.retainTable(policy, shard)
+		if er != nil {
+			return results, er
+		}
+		if result.Rows > 0 || result.Dropped {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// retainTable enforce the retention policy on single table
+func (m *RetentionManager) retainTable(policy RetentionPolicy, shard ShardInfo) (result RetentionResult, err error) {
+
+	result.Table = shard.Table
+	tenant := tenantOf(shard.Keys...)
+	defer m.db.observe("retention", policy.Template, 0, time.Now(), &result.Rows, &err)
+
+	now := m.db.now()
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge)
+
+		// Drop period tables which ended before the retention window
+		if period := templatePeriod(policy.Template); period != "" {
+			if start, ok := shardTime(shard); ok && addPeriods(start, period, 1).Before(cutoff) {
+				if err = m.db.scalar(shard.Table, fmt.Sprintf(sqlRetentionCount, shard.Table), nil, &result.Rows); err != nil {
+					return
+				}
+				if _, err = m.db.exec(m.db.pgDb, shard.Table, tenant, fmt.Sprintf(ddlDropTableMySql, shard.Table)); err != nil {
+					return
+				}
+				result.Dropped = true
+				return
+			}
+		}
+
+		if err = m.deleteBefore(policy, shard.Table, tenant, cutoff.UnixMilli(), &result.Rows); err != nil {
+			return
+		}
+	}
+
+	if policy.MaxRows > 0 {
+		// Find the timestamp of the oldest document to keep
+		var threshold int64
+		SQL := fmt.Sprintf(sqlRetentionThreshold, policy.Field, shard.Table, policy.MaxRows-1)
+		if err = m.db.scalar(shard.Table, SQL, nil, &threshold); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = nil
+			}
+			return
+		}
+		err = m.deleteBefore(policy, shard.Table, tenant, threshold, &result.Rows)
+	}
+	return
+}
+
+// deleteBefore delete the documents of the table older than the timestamp in batches
+func (m *RetentionManager) deleteBefore(policy RetentionPolicy, table, tenant string, before int64, rows *int64) error {
+	SQL := fmt.Sprintf(sqlRetentionDelete, table, policy.Field, policy.BatchSize)
+	for {
+		result, err := m.db.exec(m.db.pgDb, table, tenant, SQL, before)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		*rows += affected
+		if affected < int64(policy.BatchSize) {
+			return nil
+		}
+	}
+}
+
+// endregion
@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// region Transient retry definitions ----------------------------------------------------------------------------------
+
+// TransientRetryOptions configures the retry of idempotent statements failed by transient connection errors
+type TransientRetryOptions struct {
+	Attempts int           // Maximum number of retries (default 3)
+	Backoff  time.Duration // The wait before the first retry, doubled on every retry (default 50 milliseconds)
+}
+
+// endregion
+
+// region Transient retry methods --------------------------------------------------------------------------------------
+
+// SetTransientRetry enable the transparent retry of idempotent statements (SELECT queries and statements which replace
+// a value, e.g. Upsert, executed outside of transaction) failed by transient connection errors, e.g. connections closed by the server wait_timeout or by failover
+// (nil to disable). Every retry is reported to the metrics hook as transient_retry operation with the error.
+//
+// param: options - Retry options
+func (dbs *MySqlDatabase) SetTransientRetry(options *TransientRetryOptions) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if options == nil {
+		dbs.retry = nil
+		return
+	}
+	opts := *options
+	if opts.Attempts <= 0 {
+		opts.Attempts = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 50 * time.Millisecond
+	}
+	dbs.retry = &opts
+}
+
+// IsTransientError check if the error is a transient connection error (invalid connection, broken pipe, connection
+// reset or server gone away), the statement may succeed on another connection
+//
+// param: err - The error
+// return: true if the error is transient
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1053, 1927, 2006, 2013:
+			// server shutdown, connection killed, server gone away and lost connection
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, text := range []string{"invalid connection", "broken pipe", "connection reset", "server has gone away", "bad connection"} {
+		if strings.Contains(msg, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicy returns the transient retry options (nil if disabled)
+func (dbs *MySqlDatabase) retryPolicy() *TransientRetryOptions {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.retry
+}
+
+// retryTransient check if the failed statement should be retried (attempt is the number of the retry), waits the
+// backoff and reports the retry
+func (dbs *MySqlDatabase) retryTransient(stmt *Statement, err error, attempt int) bool {
+	policy := dbs.retryPolicy()
+	if policy == nil || attempt > policy.Attempts || !isIdempotent(stmt) || !IsTransientError(err) {
+		return false
+	}
+
+	backoff := policy.Backoff << (attempt - 1)
+	dbs.log().Warn("retry %d of statement on table %s after transient error: %s", attempt, stmt.Table, err.Error())
+	dbs.observe("transient_retry", "", attempt, time.Now(), nil, &err)
+	time.Sleep(backoff)
+	return true
+}
+
+// isIdempotent check if the statement can be safely executed again: SELECT queries and statements marked as idempotent
+// outside of transaction (the connection of failed transaction is lost, so the transaction can't be retried by
+// statement). Other statements may have been committed before the response was lost (e.g. list append or sequence
+// increment), so they are not retried
+func isIdempotent(stmt *Statement) bool {
+	if stmt.InTx {
+		return false
+	}
+	return stmt.Idempotent || (stmt.Query && readStatementRegex.MatchString(stmt.SQL))
+}
+
+// endregion
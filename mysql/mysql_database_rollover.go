@@ -0,0 +1,250 @@
+package mysql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// region Rollover manager definitions ---------------------------------------------------------------------------------
+
+// RolloverPolicy configures the rollover of time based tables (templates including {{year}}, {{month}}, {{week}}, {{day}} or {{hour}})
+type RolloverPolicy struct {
+	Template      string        // The entity table template (e.g. event-{{accountId}}-{{year}}{{month}})
+	Fields        []string      // List of fields to index in the new tables
+	Keys          []string      // Shard keys of the tables to create (empty to discover the keys from the existing tables)
+	Ahead         int           // Number of future periods to create ahead of time (default: 1)
+	Retention     time.Duration // Drop (or archive) tables whose period ended before the retention window (0 to keep all tables)
+	ArchivePrefix string        // Rename expired tables with this prefix instead of dropping them (empty to drop)
+}
+
+// RolloverManager is a background manager creating the next period tables ahead of time and expiring old tables
+type RolloverManager struct {
+	db       *MySqlDatabase   // The database
+	interval time.Duration    // Time interval between rollover runs
+	policies []RolloverPolicy // List of rollover policies
+	stop     chan struct{}    // Stop signal
+	wg       sync.WaitGroup   // Wait for the background worker to exit
+}
+
+// NewRolloverManager factory method for rollover manager
+//
+// param: db - The MySQL database
+// param: interval - Time interval between rollover runs
+// param: policies - List of rollover policies
+// return: Rollover manager (call Start() to run it in the background)
+func NewRolloverManager(db *MySqlDatabase, interval time.Duration, policies ...RolloverPolicy) *RolloverManager {
+	return &RolloverManager{
+		db:       db,
+		interval: interval,
+		policies: policies,
+	}
+}
+
+// endregion
+
+// region Rollover manager methods -------------------------------------------------------------------------------------
+
+// Start run the rollover periodically in the background (the first run is executed immediately)
+func (m *RolloverManager) Start() {
+	if m.stop != nil {
+		return
+	}
+	m.stop = make(chan struct{})
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := m.RunOnce(); err != nil {
+				m.db.log().Warn("table rollover failed: %s", err.Error())
+			}
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop the background rollover and wait for the running rollover to complete
+func (m *RolloverManager) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.wg.Wait()
+	m.stop = nil
+}
+
+// RunOnce execute all the rollover policies once: create the next periods tables and expire old tables
+func (m *RolloverManager) RunOnce() (err error) {
+	for _, policy := range m.policies {
+		if er := m.rollover(policy); er != nil {
+			err = er
+		}
+	}
+	return
+}
+
+// rollover execute single rollover policy
+func (m *RolloverManager) rollover(policy RolloverPolicy) error {
+
+	template := strings.Replace(policy.Template, "{{accountId}}", "{{0}}", -1)
+	period := templatePeriod(template)
+	if period == "" {
+		return fmt.Errorf("table template %s has no time placeholder", policy.Template)
+	}
+
+	shards, err := m.db.listShards(template)
+	if err != nil {
+		return err
+	}
+
+	// Create the tables of the current and next periods
+	ahead := policy.Ahead
+	if ahead < 1 {
+		ahead = 1
+	}
+	now := m.db.now()
+	start := periodStart(now, period)
+	for _, keys := range m.shardKeys(policy, template, shards) {
+		for i := 0; i <= ahead; i++ {
+			table := m.db.resolveName(template, addPeriods(start, period, i), keys...)
+			if err = m.db.ExecuteDDL(map[string][]string{table: policy.Fields}); err != nil {
+				return err
+			}
+			if err = m.db.createPromotedColumns(template, table); err != nil {
+				return err
+			}
+		}
+	}
+
+	if policy.Retention <= 0 {
+		return nil
+	}
+
+	// Expire tables whose period ended before the retention window
+	cutoff := now.Add(-policy.Retention)
+	for _, shard := range shards {
+		start, ok := shardTime(shard)
+		if !ok || !addPeriods(start, period, 1).Before(cutoff) {
+			continue
+		}
+
+		SQL := fmt.Sprintf(ddlDropTableMySql, shard.Table)
+		if policy.ArchivePrefix != "" {
+			SQL = fmt.Sprintf(ddlRenameTable, shard.Table, policy.ArchivePrefix+shard.Table)
+		}
+		if _, err = m.db.exec(m.db.pgDb, shard.Table, tenantOf(shard.Keys...), SQL); err != nil {
+			m.db.log().Error("%s error: %s", SQL, err.Error())
+			return err
+		}
+		m.db.log().Info("table %s expired: %s", shard.Table, SQL)
+	}
+	return nil
+}
+
+// shardKeys returns the list of shard keys to create tables for
+func (m *RolloverManager) shardKeys(policy RolloverPolicy, template string, shards []ShardInfo) [][]string {
+
+	if requiredKeys(template) == 0 {
+		return [][]string{{}}
+	}
+
+	result := make([][]string, 0)
+	if len(policy.Keys) > 0 {
+		for _, key := range policy.Keys {
+			result = append(result, []string{key})
+		}
+		return result
+	}
+
+	// Discover the shard keys from the existing tables
+	exists := make(map[string]bool)
+	for _, shard := range shards {
+		id := strings.Join(shard.Keys, "/")
+		if !exists[id] {
+			exists[id] = true
+			result = append(result, shard.Keys)
+		}
+	}
+	return result
+}
+
+// templatePeriod returns the finest time placeholder of the template (hour, day, week, month or year)
+func templatePeriod(template string) string {
+	for _, period := range []string{"hour", "day", "week", "month", "year"} {
+		if strings.Contains(template, fmt.Sprintf("{{%s}}", period)) {
+			return period
+		}
+	}
+	return ""
+}
+
+// periodStart returns the start time of the period containing the time
+func periodStart(t time.Time, period string) time.Time {
+	switch period {
+	case "hour":
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	case "day":
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	}
+}
+
+// addPeriods add n periods to the time (the time is expected to be the start of a period)
+func addPeriods(t time.Time, period string, n int) time.Time {
+	switch period {
+	case "hour":
+		return t.Add(time.Duration(n) * time.Hour)
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	default:
+		return t.AddDate(n, 0, 0)
+	}
+}
+
+// shardTime returns the start time of the shard period
+func shardTime(shard ShardInfo) (time.Time, bool) {
+	part := func(name string, def int) int {
+		if v, ok := shard.Time[name]; ok {
+			if n, err := strconv.Atoi(v); err == nil {
+				return n
+			}
+		}
+		return def
+	}
+
+	year := part("year", -1)
+	if year < 0 {
+		return time.Time{}, false
+	}
+
+	// ISO week: week 1 is the week containing January 4th
+	if week := part("week", 0); week > 0 {
+		jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)
+		offset := (int(jan4.Weekday()) + 6) % 7
+		return jan4.AddDate(0, 0, (week-1)*7-offset), true
+	}
+	return time.Date(year, time.Month(part("month", 1)), part("day", 1), part("hour", 0), 0, 0, 0, time.UTC), true
+}
+
+// endregion
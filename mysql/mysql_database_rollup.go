@@ -0,0 +1,228 @@
+package mysql
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Rollup definitions -------------------------------------------------------------------------------------------
+
+// Rollup declares materialized aggregate table of entity, maintained incrementally by Insert, Update, Upsert and Delete
+// in the transaction of the mutation (bulk, set field and query operations do not update the rollup), for example:
+//
+//	// daily count and total amount of orders per account
+//	db.DefineRollup(&Rollup{Name: "order_daily", Factory: NewOrder, Dimensions: []string{"accountId"},
+//		TimeField: "createdOn", Period: 24 * time.Hour, Sums: []string{"amount"}})
+type Rollup struct {
+	Name       string        // The rollup table name
+	Factory    EntityFactory // The source entity factory
+	Dimensions []string      // The group by fields
+	TimeField  string        // The timestamp field of the time bucket (empty for no time bucket)
+	Period     time.Duration // The time bucket size (e.g. 24h for daily rollup)
+	Sums       []string      // The numeric fields to sum
+}
+
+// RollupRow is a single aggregate row of the rollup
+type RollupRow struct {
+	Dimensions map[string]any     // The group by fields values
+	Bucket     Timestamp          // The start of the time bucket (zero for no time bucket)
+	Count      int64              // Number of entities
+	Sums       map[string]float64 // Sum of every numeric field
+}
+
+const (
+	ddlRollupTable = `CREATE TABLE IF NOT EXISTS "%s" (rollup_key CHAR(64) PRIMARY KEY NOT NULL, dimensions JSON NOT NULL, ` +
+		`bucket BIGINT NOT NULL, count BIGINT NOT NULL%s, INDEX "%s_bucket_idx" (bucket))`
+	sqlRollupApply = `INSERT INTO "%s" (rollup_key, dimensions, bucket, count%s) VALUES ($1, $2, $3, $4%s) ` +
+		`ON DUPLICATE KEY UPDATE count = count + VALUES(count)%s`
+	sqlRollupQuery = `SELECT dimensions, bucket, count%s FROM "%s" WHERE bucket >= $1 AND bucket < $2 AND count > 0%s ORDER BY bucket`
+)
+
+// sumColumn returns the column of the summed field
+func sumColumn(field string) string {
+	return fmt.Sprintf(`"sum_%s"`, field)
+}
+
+// endregion
+
+// region Rollup methods -----------------------------------------------------------------------------------------------
+
+// DefineRollup create the rollup table and register the hooks maintaining it, the rollup reflects the mutations
+// executed after its definition
+//
+// param: rollup - The rollup declaration
+// return: error
+func (dbs *MySqlDatabase) DefineRollup(rollup *Rollup) (err error) {
+	if rollup == nil || rollup.Factory == nil {
+		return fmt.Errorf("rollup entity factory is required")
+	}
+	if err = validateFields(rollup.Name); err != nil {
+		return
+	}
+	if err = validateFields(append(append([]string{}, rollup.Dimensions...), rollup.Sums...)...); err != nil {
+		return
+	}
+	if rollup.TimeField != "" {
+		if err = validateFields(rollup.TimeField); err != nil {
+			return
+		}
+		if rollup.Period <= 0 {
+			return fmt.Errorf("rollup %s time bucket period is required", rollup.Name)
+		}
+	}
+
+	columns := make([]string, 0, len(rollup.Sums))
+	for _, field := range rollup.Sums {
+		columns = append(columns, fmt.Sprintf(", %s DOUBLE NOT NULL DEFAULT 0", sumColumn(field)))
+	}
+	if _, err = dbs.exec(dbs.pgDb, rollup.Name, "", fmt.Sprintf(ddlRollupTable, rollup.Name, strings.Join(columns, ""), rollup.Name)); err != nil {
+		return
+	}
+
+	dbs.mu.Lock()
+	if dbs.rollups == nil {
+		dbs.rollups = make(map[string]*Rollup)
+	}
+	dbs.rollups[rollup.Name] = rollup
+	dbs.mu.Unlock()
+
+	template := rollup.Factory().TABLE()
+	for _, event := range []HookEvent{AfterInsert, AfterUpdate, AfterUpsert, AfterDelete} {
+		dbs.RegisterHook(template, event, func(ctx *HookContext) error {
+			return dbs.applyRollup(rollup, ctx)
+		})
+	}
+	return nil
+}
+
+// QueryRollup returns the rollup rows of the time range, optionally filtered by dimension values
+//
+// param: name - The rollup name
+// param: from - Start of the time range (inclusive)
+// param: to - End of the time range (exclusive)
+// param: dimensions - Dimension values to match (nil for all)
+// return: Rollup rows ordered by time bucket, error
+func (dbs *MySqlDatabase) QueryRollup(name string, from, to Timestamp, dimensions map[string]any) (list []RollupRow, err error) {
+	defer dbs.observe("query_rollup", name, 0, time.Now(), nil, &err)
+
+	dbs.mu.RLock()
+	rollup := dbs.rollups[name]
+	dbs.mu.RUnlock()
+	if rollup == nil {
+		return nil, fmt.Errorf("rollup %s is not defined", name)
+	}
+
+	columns := make([]string, 0, len(rollup.Sums))
+	for _, field := range rollup.Sums {
+		columns = append(columns, ", "+sumColumn(field))
+	}
+	where := make([]string, 0, len(dimensions))
+	args := []any{int64(from), int64(to)}
+	for field, value := range dimensions {
+		if err = validateFields(field); err != nil {
+			return
+		}
+		args = append(args, fmt.Sprintf("%v", value))
+		where = append(where, fmt.Sprintf(" AND JSON_UNQUOTE(JSON_EXTRACT(dimensions, '$.%s')) = $%d", field, len(args)))
+	}
+
+	SQL := fmt.Sprintf(sqlRollupQuery, strings.Join(columns, ""), name, strings.Join(where, ""))
+	rows, err := dbs.query(dbs.pgDb, name, "", SQL, args...)
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	list = make([]RollupRow, 0)
+	for rows.Next() {
+		var (
+			dims   []byte
+			bucket int64
+			row    = RollupRow{Sums: make(map[string]float64, len(rollup.Sums))}
+			sums   = make([]float64, len(rollup.Sums))
+		)
+		dest := []any{&dims, &bucket, &row.Count}
+		for i := range sums {
+			dest = append(dest, &sums[i])
+		}
+		if err = rows.Scan(dest...); err != nil {
+			return
+		}
+		if err = json.Unmarshal(dims, &row.Dimensions); err != nil {
+			return
+		}
+		row.Bucket = Timestamp(bucket)
+		for i, field := range rollup.Sums {
+			row.Sums[field] = sums[i]
+		}
+		list = append(list, row)
+	}
+	return list, rows.Err()
+}
+
+// applyRollup apply the mutation delta to the rollup: subtract the previous document and add the new one
+func (dbs *MySqlDatabase) applyRollup(rollup *Rollup, ctx *HookContext) error {
+	if len(ctx.Before) > 0 {
+		entity, err := dbs.unmarshal(rollup.Factory, ctx.Before)
+		if err != nil {
+			return err
+		}
+		if err = dbs.applyRollupDelta(rollup, ctx, entity, -1); err != nil {
+			return err
+		}
+	}
+	if ctx.Event != AfterDelete && ctx.Entity != nil {
+		return dbs.applyRollupDelta(rollup, ctx, ctx.Entity, 1)
+	}
+	return nil
+}
+
+// applyRollupDelta add (sign 1) or subtract (sign -1) the entity to its rollup row
+func (dbs *MySqlDatabase) applyRollupDelta(rollup *Rollup, ctx *HookContext, entity Entity, sign int64) error {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return err
+	}
+	doc := make(map[string]any)
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	dims := make(map[string]any, len(rollup.Dimensions))
+	for _, field := range rollup.Dimensions {
+		dims[field] = doc[field]
+	}
+	var bucket int64
+	if rollup.TimeField != "" {
+		ts, _ := doc[rollup.TimeField].(float64)
+		period := rollup.Period.Milliseconds()
+		bucket = int64(ts) - int64(ts)%period
+	}
+
+	dimsJson, err := json.Marshal(dims)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", bucket, dimsJson)))
+
+	columns, values, updates := "", "", ""
+	args := []any{hex.EncodeToString(hash[:]), string(dimsJson), bucket, sign}
+	for _, field := range rollup.Sums {
+		value, _ := doc[field].(float64)
+		columns += ", " + sumColumn(field)
+		args = append(args, float64(sign)*value)
+		values += fmt.Sprintf(", $%d", len(args))
+		updates += fmt.Sprintf(", %[1]s = %[1]s + VALUES(%[1]s)", sumColumn(field))
+	}
+
+	_, err = dbs.exec(ctx.Tx, rollup.Name, ctx.Tenant, fmt.Sprintf(sqlRollupApply, rollup.Name, columns, values, updates), args...)
+	return err
+}
+
+// endregion
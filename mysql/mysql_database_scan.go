@@ -0,0 +1,238 @@
+package mysql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Table scan definitions ---------------------------------------------------------------------------------------
+
+const (
+	sqlScanRange    = `SELECT id, data FROM "%s" WHERE id > $1 AND id <= $2 ORDER BY id LIMIT %d`
+	sqlScanSegments = `SELECT MAX(id) FROM (SELECT id, NTILE(%d) OVER (ORDER BY id) AS segment FROM "%s") AS t GROUP BY segment ORDER BY segment`
+)
+
+// ScanIterator pages through an entire entity table by primary key ranges (keyset pagination, so every batch is an
+// index range read regardless of the table size). The iterator is not safe for concurrent use
+type ScanIterator struct {
+	dbs     *MySqlDatabase
+	factory EntityFactory
+	table   string
+	keys    []string
+	batch   int
+	lastId  string
+	upper   string
+	buffer  []Entity
+	current Entity
+	done    bool
+	err     error
+}
+
+// ScanSegment is a range of ids of the table scanned by a single worker of a parallel scan
+type ScanSegment struct {
+	Segment int    `json:"segment"` // The segment number (zero based)
+	From    string `json:"from"`    // The segment starts after this id (empty for the first segment)
+	To      string `json:"to"`      // The last id of the segment (empty for the last segment, which is not bounded)
+}
+
+// scanToken is the content of the resume token
+type scanToken struct {
+	Table  string `json:"table"`  // The physical table
+	LastId string `json:"lastId"` // The id of the last returned entity
+}
+
+// endregion
+
+// region Table scan methods -------------------------------------------------------------------------------------------
+
+// Scan returns an iterator over all the entities of the table ordered by id, fetching batchSize entities at a time.
+// The resume token of the iterator can be persisted so long-running backfills restart after the last processed entity
+//
+// param: factory - Entity factory
+// param: batchSize - Number of entities fetched in each batch (default: 500)
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Scan iterator
+func (dbs *MySqlDatabase) Scan(factory EntityFactory, batchSize int, keys ...string) *ScanIterator {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	it := &ScanIterator{dbs: dbs, factory: factory, batch: batchSize, keys: keys}
+	it.table, it.err = dbs.resolveTable(factory().TABLE(), keys...)
+	return it
+}
+
+// ScanSegments split the table into (up to) n segments of about the same number of entities by id ranges, so the
+// workers of a parallel backfill can divide the table deterministically: the segments are computed once by the
+// coordinator and every worker scans its segment (see ScanIterator.Segment). Tables with fewer entities than segments
+// are split into fewer segments, and entities inserted after the split with ids beyond the last boundary belong to
+// the last segment
+//
+// param: factory - Entity factory
+// param: n - Number of segments
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: List of segments ordered by id range, error
+func (dbs *MySqlDatabase) ScanSegments(factory EntityFactory, n int, keys ...string) (segments []ScanSegment, err error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid number of scan segments: %d", n)
+	}
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("scan_segments", factory().TABLE(), n, time.Now(), nil, &err)
+
+	table, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := dbs.query(dbs.pgDb, table, tenantOf(keys...), fmt.Sprintf(sqlScanSegments, n, table))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	bounds := make([]string, 0, n)
+	for rows.Next() {
+		var bound string
+		if err = rows.Scan(&bound); err != nil {
+			return nil, err
+		}
+		bounds = append(bounds, bound)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	segments = make([]ScanSegment, 0, len(bounds)+1)
+	from := ""
+	for i, bound := range bounds {
+		segments = append(segments, ScanSegment{Segment: i, From: from, To: bound})
+		from = bound
+	}
+	if len(segments) == 0 {
+		return []ScanSegment{{Segment: 0}}, nil
+	}
+	segments[len(segments)-1].To = ""
+	return segments, nil
+}
+
+// Segment limit the scan to the id range of the segment, must be called before Resume and the first call to Next
+//
+// param: segment - The segment to scan (see ScanSegments)
+// return: The iterator
+func (it *ScanIterator) Segment(segment ScanSegment) *ScanIterator {
+	it.lastId, it.upper = segment.From, segment.To
+	return it
+}
+
+// Resume continue the scan after the entity of the resume token, must be called before the first call to Next
+//
+// param: token - Resume token of previous scan of the same table (empty to scan from the start)
+// return: The iterator, error if the token is invalid or was issued for another table
+func (it *ScanIterator) Resume(token string) (*ScanIterator, error) {
+	if it.err != nil || token == "" {
+		return it, it.err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return it, fmt.Errorf("invalid scan resume token: %w", err)
+	}
+	st := scanToken{}
+	if err = json.Unmarshal(data, &st); err != nil {
+		return it, fmt.Errorf("invalid scan resume token: %w", err)
+	}
+	if st.Table != it.table {
+		return it, fmt.Errorf("scan resume token of %s does not match %s", st.Table, it.table)
+	}
+	it.lastId = st.LastId
+	return it, nil
+}
+
+// Next advance the iterator to the next entity, returns false when the scan is done or failed (see Err)
+func (it *ScanIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if len(it.buffer) == 0 {
+		if it.done {
+			it.current = nil
+			return false
+		}
+		if it.err = it.fetch(); it.err != nil || len(it.buffer) == 0 {
+			it.current = nil
+			return false
+		}
+	}
+	it.current, it.buffer = it.buffer[0], it.buffer[1:]
+	it.lastId = it.current.ID()
+	return true
+}
+
+// Entity returns the current entity
+func (it *ScanIterator) Entity() Entity {
+	return it.current
+}
+
+// Err returns the error which stopped the scan (nil if the scan is done or still running)
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+// ResumeToken returns opaque token of the scan position after the current entity
+func (it *ScanIterator) ResumeToken() string {
+	data, _ := json.Marshal(scanToken{Table: it.table, LastId: it.lastId})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// fetch the next batch of entities after the last id
+func (it *ScanIterator) fetch() (err error) {
+	dbs := it.dbs
+	defer dbs.throttle(it.keys...)()
+	defer dbs.observe("scan", it.factory().TABLE(), it.batch, time.Now(), nil, &err)
+
+	docs, err := it.batchDocs()
+	if err != nil {
+		return err
+	}
+	it.done = len(docs) < it.batch
+
+	it.buffer = make([]Entity, 0, len(docs))
+	for _, doc := range docs {
+		entity, er := dbs.unmarshal(it.factory, []byte(doc.Data))
+		if er != nil {
+			return fmt.Errorf("scan entity %s error: %w", doc.Id, er)
+		}
+		it.buffer = append(it.buffer, entity)
+	}
+	it.buffer, err = dbs.maskEntities(it.factory, it.buffer)
+	return err
+}
+
+// batchDocs fetch the documents of the next batch (bounded by the segment upper id, if set)
+func (it *ScanIterator) batchDocs() ([]JsonDoc, error) {
+	if it.upper == "" {
+		return it.dbs.verifyBatch(it.table, tenantOf(it.keys...), it.lastId, it.batch)
+	}
+
+	SQL := fmt.Sprintf(sqlScanRange, it.table, it.batch)
+	rows, err := it.dbs.query(it.dbs.pgDb, it.table, tenantOf(it.keys...), SQL, it.lastId, it.upper)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	docs := make([]JsonDoc, 0, it.batch)
+	for rows.Next() {
+		doc := JsonDoc{}
+		if err = rows.Scan(&doc.Id, &doc.Data); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// endregion
@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// region Schema change executor definitions ---------------------------------------------------------------------------
+
+// ISchemaChangeExecutor executes ALTER TABLE statements on behalf of the database (e.g. using online schema change tools)
+type ISchemaChangeExecutor interface {
+
+	// Alter apply the alter specification (e.g. ADD INDEX ...) on the table
+	Alter(db *sql.DB, cfg *DBConfig, table, alter string) error
+}
+
+// Supported online schema change tools
+const (
+	GhOst          = "gh-ost"
+	PtOnlineSchema = "pt-online-schema-change"
+)
+
+const (
+	ddlAlterTable      = `ALTER TABLE "%s" %s`
+	ddlAddJsonIndex    = `ADD INDEX "%s_%s_idx" ((CAST(JSON_UNQUOTE(JSON_EXTRACT(data, '$.%s')) AS CHAR(255))))`
+	sqlTableRowsApprox = `SELECT IFNULL(TABLE_ROWS, 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), DATABASE()) AND TABLE_NAME = $2`
+)
+
+// directSchemaChange executes the ALTER TABLE statement directly on the connection
+type directSchemaChange struct{}
+
+// Alter apply the alter specification using plain ALTER TABLE statement
+func (d directSchemaChange) Alter(db *sql.DB, cfg *DBConfig, table, alter string) error {
+	SQL := qualifyNames(fmt.Sprintf(ddlAlterTable, table, alter))
+	if _, err := db.Exec(SQL); err != nil {
+		return fmt.Errorf("%s error: %s", SQL, err.Error())
+	}
+	return nil
+}
+
+// OnlineSchemaChange delegates ALTER TABLE statements to gh-ost or pt-online-schema-change
+// Tables smaller than MinRows are altered directly since the online tools overhead is not justified
+type OnlineSchemaChange struct {
+	Tool    string   // The tool to use: gh-ost or pt-online-schema-change
+	Path    string   // Path to the tool executable (default: the tool name, resolved from PATH)
+	Args    []string // Additional command line arguments (e.g. --max-load, --chunk-size)
+	MinRows int64    // Minimal (estimated) table rows to delegate the change to the tool
+}
+
+// Alter apply the alter specification using the online schema change tool
+func (o OnlineSchemaChange) Alter(db *sql.DB, cfg *DBConfig, table, alter string) error {
+
+	if o.MinRows > 0 {
+		var rows int64
+		if err := db.QueryRow(sqlTableRowsApprox, schemaArgs(table)...).Scan(&rows); err != nil {
+			return err
+		}
+		if rows < o.MinRows {
+			return directSchemaChange{}.Alter(db, cfg, table, alter)
+		}
+	}
+
+	path := o.Path
+	if path == "" {
+		path = o.Tool
+	}
+
+	// The tools take the database and table names separately
+	database, name := splitCatalog(table)
+	if database == "" {
+		database = cfg.DBName
+	}
+
+	var args []string
+	switch o.Tool {
+	case GhOst:
+		args = []string{
+			"--host=" + cfg.Host,
+			"--port=" + strconv.Itoa(cfg.Port),
+			"--user=" + cfg.Username,
+			"--password=" + cfg.Password,
+			"--database=" + database,
+			"--table=" + name,
+			"--alter=" + alter,
+			"--execute",
+		}
+	case PtOnlineSchema:
+		dsn := fmt.Sprintf("h=%s,P=%d,u=%s,p=%s,D=%s,t=%s", cfg.Host, cfg.Port, cfg.Username, cfg.Password, database, name)
+		args = []string{"--alter", alter, dsn, "--execute"}
+	default:
+		return fmt.Errorf("online schema change tool not supported: %s", o.Tool)
+	}
+	args = append(args, o.Args...)
+
+	cmd := exec.Command(path, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s on table %s failed: %s\n%s", o.Tool, qualifyNames(table), err.Error(), string(output))
+	}
+	return nil
+}
+
+// endregion
+
+// region Schema change methods ----------------------------------------------------------------------------------------
+
+// SetSchemaChangeExecutor set the executor used for ALTER TABLE statements (nil resets to direct ALTER TABLE)
+//
+// param: executor - Schema change executor
+func (dbs *MySqlDatabase) SetSchemaChangeExecutor(executor ISchemaChangeExecutor) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.schemaChange = executor
+}
+
+// schemaChangeExecutor returns the configured schema change executor (nil for direct ALTER TABLE)
+func (dbs *MySqlDatabase) schemaChangeExecutor() ISchemaChangeExecutor {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.schemaChange
+}
+
+// AlterTable Apply alter specification on the table using the configured schema change executor
+//
+// param: table - Table name
+// param: alter - The alter specification (e.g. ADD COLUMN ..., ADD INDEX ...)
+// return: error
+func (dbs *MySqlDatabase) AlterTable(table, alter string) (err error) {
+	executor := dbs.schemaChangeExecutor()
+
+	// Plain ALTER TABLE statement is executed (and logged) as any other statement
+	if executor == nil {
+		SQL := fmt.Sprintf(ddlAlterTable, table, alter)
+		if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+			err = fmt.Errorf("%s error: %s", qualifyNames(SQL), err.Error())
+			dbs.log().Error(err.Error())
+		}
+		return err
+	}
+
+	var cfg *DBConfig
+	if cfg, _, err = parseConnectionString(dbs.uri); err != nil {
+		return err
+	}
+
+	if err = executor.Alter(dbs.pgDb, cfg, table, alter); err != nil {
+		dbs.log().Error(err.Error())
+	}
+	return err
+}
+
+// endregion
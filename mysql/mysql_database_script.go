@@ -0,0 +1,130 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// region Script methods -----------------------------------------------------------------------------------------------
+
+// ExecuteScript split the multi-statement SQL script (see SplitScript) and execute the statements in order, optionally
+// inside a single transaction (note that MySQL DDL statements commit the transaction implicitly)
+//
+// param: script - The SQL script
+// param: inTx - Execute the statements in a single transaction
+// return: Number of executed statements, error
+func (dbs *MySqlDatabase) ExecuteScript(script string, inTx bool) (executed int, err error) {
+	defer dbs.observe("execute_script", "", 0, time.Now(), nil, &err)
+
+	statements, err := SplitScript(script)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		runner sqlRunner = dbs.pgDb
+		tx     *sql.Tx
+	)
+	if inTx {
+		if tx, err = dbs.pgDb.Begin(); err != nil {
+			return 0, err
+		}
+		runner = tx
+	}
+
+	for i, stmt := range statements {
+		if stmt, err = dbs.guardStatement(stmt, false); err == nil {
+			_, err = dbs.exec(runner, "", "", stmt)
+		}
+		if err != nil {
+			if tx != nil {
+				_ = tx.Rollback()
+				executed = 0
+			}
+			return executed, fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		executed++
+	}
+
+	if tx != nil {
+		if err = tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	return executed, nil
+}
+
+// SplitScript split the SQL script to statements by the delimiter (default: semicolon), the DELIMITER command changes
+// the delimiter (e.g. for stored procedures body). Delimiters inside string literals, quoted identifiers and comments are
+// ignored, line comments are removed
+//
+// param: script - The SQL script
+// return: List of statements, error
+func SplitScript(script string) ([]string, error) {
+	statements := make([]string, 0)
+	delimiter := ";"
+	current := strings.Builder{}
+	lineStart := true
+
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			statements = append(statements, stmt)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+
+		// The DELIMITER command must be the first word of the line
+		if lineStart {
+			rest := strings.TrimLeft(script[i:], " \t")
+			if len(rest) > 10 && strings.EqualFold(rest[:10], "DELIMITER ") {
+				end := strings.IndexByte(rest, '\n')
+				if end < 0 {
+					end = len(rest)
+				}
+				if delimiter = strings.TrimSpace(rest[10:end]); delimiter == "" {
+					return nil, fmt.Errorf("empty delimiter")
+				}
+				flush()
+				i += len(script[i:]) - len(rest) + end
+				continue
+			}
+		}
+		lineStart = c == '\n'
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			end := skipQuoted(script, i)
+			current.WriteString(script[i:end])
+			i = end - 1
+			lineStart = false
+		case c == '#' || (c == '-' && strings.HasPrefix(script[i:], "-- ")):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end - 1
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			current.WriteString(script[i : i+end+4])
+			i += end + 3
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter) - 1
+		default:
+			current.WriteByte(c)
+		}
+	}
+	flush()
+	return statements, nil
+}
+
+// endregion
@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// region Sequence definitions -----------------------------------------------------------------------------------------
+
+const (
+	sequenceTable = "sequences"
+	ddlSequences  = `CREATE TABLE IF NOT EXISTS "sequences" (name VARCHAR(255) PRIMARY KEY NOT NULL, value BIGINT NOT NULL)`
+
+	// sqlReserveIds advance the sequence by the block size, the new value is returned as the statement last insert id
+	sqlReserveIds = `INSERT INTO "sequences" (name, value) VALUES ($1, LAST_INSERT_ID($2)) ON DUPLICATE KEY UPDATE value = LAST_INSERT_ID(value + $2)`
+)
+
+// sequenceGenerator holds the reserved (not yet assigned) blocks of the sequences
+type sequenceGenerator struct {
+	mu     sync.Mutex
+	ready  bool
+	blocks map[string]*idBlock
+}
+
+// idBlock is a reserved range of ids
+type idBlock struct {
+	next int64 // The next id to assign
+	last int64 // The last id of the block (inclusive)
+}
+
+// endregion
+
+// region Sequence methods ---------------------------------------------------------------------------------------------
+
+// NextID returns the next id of the named sequence, the ids are monotonically increasing per database instance and
+// unique across the cluster. The ids are reserved from the sequences table in blocks and assigned from memory, so
+// unused ids of the block are lost when the process exits (gaps are expected)
+//
+// param: name - The sequence name
+// param: block - Number of ids to reserve on each round-trip (minimum 1)
+// return: The next id, error
+func (dbs *MySqlDatabase) NextID(name string, block int) (int64, error) {
+	dbs.sequences.mu.Lock()
+	defer dbs.sequences.mu.Unlock()
+
+	if b := dbs.sequences.blocks[name]; b != nil && b.next <= b.last {
+		b.next++
+		return b.next - 1, nil
+	}
+
+	first, last, err := dbs.reserveIDs(name, block)
+	if err != nil {
+		return 0, err
+	}
+	if dbs.sequences.blocks == nil {
+		dbs.sequences.blocks = make(map[string]*idBlock)
+	}
+	dbs.sequences.blocks[name] = &idBlock{next: first + 1, last: last}
+	return first, nil
+}
+
+// ReserveIDs reserve a block of ids of the named sequence for client side assignment
+//
+// param: name - The sequence name
+// param: count - Number of ids to reserve (minimum 1)
+// return: The first and the last id of the block (inclusive), error
+func (dbs *MySqlDatabase) ReserveIDs(name string, count int) (first, last int64, err error) {
+	dbs.sequences.mu.Lock()
+	defer dbs.sequences.mu.Unlock()
+	return dbs.reserveIDs(name, count)
+}
+
+// reserveIDs advance the sequence by the block size (the caller holds the sequences lock)
+func (dbs *MySqlDatabase) reserveIDs(name string, count int) (first, last int64, err error) {
+	defer dbs.observe("reserve_ids", sequenceTable, count, time.Now(), nil, &err)
+
+	if name == "" {
+		return 0, 0, fmt.Errorf("empty sequence name")
+	}
+	if count < 1 {
+		count = 1
+	}
+
+	if !dbs.sequences.ready {
+		if _, err = dbs.exec(dbs.pgDb, sequenceTable, "", ddlSequences); err != nil {
+			return 0, 0, err
+		}
+		dbs.sequences.ready = true
+	}
+
+	result, err := dbs.exec(dbs.pgDb, sequenceTable, "", sqlReserveIds, name, count)
+	if err != nil {
+		return 0, 0, err
+	}
+	if last, err = result.LastInsertId(); err != nil {
+		return 0, 0, err
+	}
+	return last - int64(count) + 1, last, nil
+}
+
+// endregion
@@ -0,0 +1,146 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Serialization definitions ------------------------------------------------------------------------------------
+
+// ISerializer converts entities to Json documents and back, overrides the default Marshal / Unmarshal of the entity type
+type ISerializer interface {
+
+	// Marshal convert the entity to Json document
+	Marshal(entity Entity) ([]byte, error)
+
+	// Unmarshal convert the Json document to the entity (the entity is created by the entity factory)
+	Unmarshal(data []byte, entity Entity) error
+}
+
+// SerializerOptions configures the built-in Json serializer
+type SerializerOptions struct {
+	Canonical bool              // Store canonical Json (sorted keys, no white spaces, numbers as is)
+	OmitNulls bool              // Remove top level fields with null value
+	Aliases   map[string]string // Map of legacy field name to current field name, applied on read (if the current field is missing)
+}
+
+// jsonSerializer is the built-in configurable Json serializer
+type jsonSerializer struct {
+	options SerializerOptions
+}
+
+// endregion
+
+// region Serialization methods ----------------------------------------------------------------------------------------
+
+// NewSerializer create the built-in Json serializer
+//
+// param: options - Serializer options
+// return: Serializer
+func NewSerializer(options SerializerOptions) ISerializer {
+	return &jsonSerializer{options: options}
+}
+
+// SetSerializer override the Marshal / Unmarshal of the entity type (nil to restore the default), the serializer is
+// applied before the document validation and encryption on write, and after the decryption on read
+//
+// param: factory - Entity factory
+// param: serializer - The entity serializer
+func (dbs *MySqlDatabase) SetSerializer(factory EntityFactory, serializer ISerializer) {
+	template := factory().TABLE()
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if serializer == nil {
+		delete(dbs.serializers, template)
+		return
+	}
+	if dbs.serializers == nil {
+		dbs.serializers = make(map[string]ISerializer)
+	}
+	dbs.serializers[template] = serializer
+}
+
+// serializer returns the custom serializer of the entity table template (nil for the default)
+func (dbs *MySqlDatabase) serializer(template string) ISerializer {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.serializers[template]
+}
+
+// serialize convert the entity to Json document using the serializer of the entity type
+func (dbs *MySqlDatabase) serialize(entity Entity) ([]byte, error) {
+	if s := dbs.serializer(entity.TABLE()); s != nil {
+		return s.Marshal(entity)
+	}
+	return Marshal(entity)
+}
+
+// deserialize convert the Json document to the entity using the serializer of the entity type
+func (dbs *MySqlDatabase) deserialize(data []byte, entity Entity) error {
+	if s := dbs.serializer(entity.TABLE()); s != nil {
+		return s.Unmarshal(data, entity)
+	}
+	return Unmarshal(data, &entity)
+}
+
+// Marshal convert the entity to Json document
+func (s *jsonSerializer) Marshal(entity Entity) ([]byte, error) {
+	data, err := json.Marshal(entity)
+	if err != nil || (!s.options.Canonical && !s.options.OmitNulls) {
+		return data, err
+	}
+
+	doc, err := decodeDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if s.options.OmitNulls {
+		for field, value := range doc {
+			if value == nil {
+				delete(doc, field)
+			}
+		}
+	}
+	// encoding of map sorts the keys and removes the white spaces
+	return json.Marshal(doc)
+}
+
+// Unmarshal convert the Json document to the entity, legacy field names are mapped to the current names
+func (s *jsonSerializer) Unmarshal(data []byte, entity Entity) error {
+	if len(s.options.Aliases) > 0 {
+		doc, err := decodeDocument(data)
+		if err != nil {
+			return err
+		}
+		for legacy, current := range s.options.Aliases {
+			value, ok := doc[legacy]
+			if !ok {
+				continue
+			}
+			if _, exists := doc[current]; !exists {
+				doc[current] = value
+			}
+			delete(doc, legacy)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, entity)
+}
+
+// decodeDocument decode the Json document preserving the numbers as is
+func decodeDocument(data []byte) (map[string]any, error) {
+	doc := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// endregion
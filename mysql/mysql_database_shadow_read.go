@@ -0,0 +1,425 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Shadow read definitions --------------------------------------------------------------------------------------
+
+// ErrShadowMismatch is the error reported to the metrics hook when the secondary result differs from the primary result
+var ErrShadowMismatch = errors.New("shadow read mismatch")
+
+// ShadowReadOptions configures the shadow read database
+type ShadowReadOptions struct {
+	SampleRate float64                       // Fraction of the reads to shadow (0 < rate <= 1, default: 1)
+	Sync       bool                          // Compare in the caller goroutine (default: compare in background)
+	OnMismatch func(mismatch ShadowMismatch) // Called on every mismatch (optional)
+	Metrics    IMetricsHook                  // Metrics hook of the comparisons: operation shadow_{op}, ErrShadowMismatch on mismatch (optional)
+	Logger     ILogger                       // Logger (default: yaaf-common logger)
+}
+
+// ShadowMismatch describes read which returned different results from the primary and the secondary databases
+type ShadowMismatch struct {
+	Operation string // The read operation (e.g. get, list, find, count)
+	Table     string // The entity table (template)
+	Query     string // The query description (entity ids or query string)
+	Primary   string // The primary result (Json)
+	Secondary string // The secondary result (Json), or the secondary error
+}
+
+// ShadowReadStatus is the comparison status of the shadow read database
+type ShadowReadStatus struct {
+	Compared   int64 // Number of compared reads
+	Mismatched int64 // Number of reads with different results
+	Errors     int64 // Number of reads failed in the secondary database only
+}
+
+// ShadowReadDatabase is IDatabase which serves all the operations from the primary database, and executes the reads
+// (Get, List, Exists and the query reads) against the secondary database as well. The results are compared, mismatches
+// are logged, counted and reported without affecting the caller (the caller always gets the primary result).
+// Mutations are passed to the primary database only (wrap DualWriteDatabase to mirror them).
+type ShadowReadDatabase struct {
+	database.IDatabase
+	secondary database.IDatabase
+	options   ShadowReadOptions
+	pending   sync.WaitGroup
+
+	compared   atomic.Int64
+	mismatched atomic.Int64
+	errors     atomic.Int64
+}
+
+// shadowQuery is query built against both databases, reads are compared and mutations run on the primary only
+type shadowQuery struct {
+	db        *ShadowReadDatabase
+	table     string
+	primary   database.IQuery
+	secondary database.IQuery
+}
+
+// endregion
+
+// region Shadow read factory methods ----------------------------------------------------------------------------------
+
+// NewShadowReadDatabase create database which shadows the reads of the primary database to the secondary database
+//
+// param: primary - The primary database (serves all the operations)
+// param: secondary - The secondary database (e.g. the migration target)
+// param: options - Shadow read options
+// return: Shadow read database
+func NewShadowReadDatabase(primary, secondary database.IDatabase, options ShadowReadOptions) *ShadowReadDatabase {
+	if options.SampleRate <= 0 || options.SampleRate > 1 {
+		options.SampleRate = 1
+	}
+	if options.Logger == nil {
+		options.Logger = defaultLogger{}
+	}
+	return &ShadowReadDatabase{IDatabase: primary, secondary: secondary, options: options}
+}
+
+// CloneDatabase Returns shadow read database of the clones of both databases
+func (s *ShadowReadDatabase) CloneDatabase() (database.IDatabase, error) {
+	primary, err := s.IDatabase.CloneDatabase()
+	if err != nil {
+		return nil, err
+	}
+	secondary, err := s.secondary.CloneDatabase()
+	if err != nil {
+		return nil, err
+	}
+	return NewShadowReadDatabase(primary, secondary, s.options), nil
+}
+
+// Close wait for the background comparisons and close both databases
+func (s *ShadowReadDatabase) Close() error {
+	s.pending.Wait()
+	err := s.IDatabase.Close()
+	if er := s.secondary.Close(); err == nil {
+		err = er
+	}
+	return err
+}
+
+// Wait for the background comparisons to complete
+func (s *ShadowReadDatabase) Wait() {
+	s.pending.Wait()
+}
+
+// Status returns the comparison status
+func (s *ShadowReadDatabase) Status() ShadowReadStatus {
+	return ShadowReadStatus{Compared: s.compared.Load(), Mismatched: s.mismatched.Load(), Errors: s.errors.Load()}
+}
+
+// endregion
+
+// region Shadow read methods ------------------------------------------------------------------------------------------
+
+// Get a single entity by ID
+func (s *ShadowReadDatabase) Get(factory EntityFactory, entityID string, keys ...string) (Entity, error) {
+	result, err := s.IDatabase.Get(factory, entityID, keys...)
+	s.shadow("get", factory().TABLE(), entityID, result, err, func() (any, error) {
+		return s.secondary.Get(factory, entityID, keys...)
+	})
+	return result, err
+}
+
+// List Get multiple entities by IDs
+func (s *ShadowReadDatabase) List(factory EntityFactory, entityIDs []string, keys ...string) ([]Entity, error) {
+	result, err := s.IDatabase.List(factory, entityIDs, keys...)
+	s.shadow("list", factory().TABLE(), fmt.Sprintf("%v", entityIDs), byId(result), err, func() (any, error) {
+		list, er := s.secondary.List(factory, entityIDs, keys...)
+		return byId(list), er
+	})
+	return result, err
+}
+
+// Exists Check if entity exists by ID
+func (s *ShadowReadDatabase) Exists(factory EntityFactory, entityID string, keys ...string) (bool, error) {
+	result, err := s.IDatabase.Exists(factory, entityID, keys...)
+	s.shadow("exists", factory().TABLE(), entityID, result, err, func() (any, error) {
+		return s.secondary.Exists(factory, entityID, keys...)
+	})
+	return result, err
+}
+
+// Query Utility struct method to build a query (against both databases)
+func (s *ShadowReadDatabase) Query(factory EntityFactory) database.IQuery {
+	return &shadowQuery{db: s, table: factory().TABLE(), primary: s.IDatabase.Query(factory), secondary: s.secondary.Query(factory)}
+}
+
+// shadow execute the read against the secondary database (sampled) and compare the results, reads which failed in the
+// primary database are not compared
+func (s *ShadowReadDatabase) shadow(operation, table, query string, primary any, primaryErr error, read func() (any, error)) {
+	if primaryErr != nil {
+		return
+	}
+	if s.options.SampleRate < 1 && rand.Float64() >= s.options.SampleRate {
+		return
+	}
+
+	// The primary result is encoded before returning to the caller, so later changes of the caller are not compared
+	expected, err := json.Marshal(primary)
+	if err != nil {
+		return
+	}
+	compare := func() {
+		start := time.Now()
+		secondary, er := read()
+		s.compare(operation, table, query, expected, secondary, er, start)
+	}
+	if s.options.Sync {
+		compare()
+		return
+	}
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		compare()
+	}()
+}
+
+// compare the secondary result with the (encoded) primary result and report mismatch
+func (s *ShadowReadDatabase) compare(operation, table, query string, expected []byte, secondary any, err error, start time.Time) {
+	s.compared.Add(1)
+
+	mismatch := ShadowMismatch{Operation: operation, Table: table, Query: query, Primary: string(expected)}
+	if err != nil {
+		s.errors.Add(1)
+		mismatch.Secondary = err.Error()
+	} else if actual, er := json.Marshal(secondary); er != nil {
+		s.errors.Add(1)
+		mismatch.Secondary = er.Error()
+	} else if !bytes.Equal(expected, actual) {
+		s.mismatched.Add(1)
+		mismatch.Secondary = string(actual)
+	} else {
+		s.observe(operation, table, start, nil)
+		return
+	}
+
+	s.options.Logger.Warn("shadow read %s of %s [%s] mismatch: primary: %s secondary: %s", operation, table, query, mismatch.Primary, mismatch.Secondary)
+	if err == nil {
+		err = ErrShadowMismatch
+	}
+	s.observe(operation, table, start, err)
+	if s.options.OnMismatch != nil {
+		s.options.OnMismatch(mismatch)
+	}
+}
+
+// observe report the comparison to the metrics hook
+func (s *ShadowReadDatabase) observe(operation, table string, start time.Time, err error) {
+	if s.options.Metrics == nil {
+		return
+	}
+	s.options.Metrics.ObserveOperation(OperationMetric{Operation: "shadow_" + operation, Table: table, Duration: time.Since(start), Error: err})
+}
+
+// byId returns the entities mapped by id, so lists are compared regardless of the order
+func byId(list []Entity) map[string]Entity {
+	result := make(map[string]Entity, len(list))
+	for _, ent := range list {
+		result[ent.ID()] = ent
+	}
+	return result
+}
+
+// endregion
+
+// region Shadow query methods -----------------------------------------------------------------------------------------
+
+// Apply set callback applied to the results of both queries
+func (q *shadowQuery) Apply(cb func(in Entity) Entity) database.IQuery {
+	q.primary.Apply(cb)
+	q.secondary.Apply(cb)
+	return q
+}
+
+// Filter add filter to both queries
+func (q *shadowQuery) Filter(filter database.QueryFilter) database.IQuery {
+	q.primary.Filter(filter)
+	q.secondary.Filter(filter)
+	return q
+}
+
+// Range add time range filter to both queries
+func (q *shadowQuery) Range(field string, from Timestamp, to Timestamp) database.IQuery {
+	q.primary.Range(field, from, to)
+	q.secondary.Range(field, from, to)
+	return q
+}
+
+// MatchAll add AND filters to both queries
+func (q *shadowQuery) MatchAll(filters ...database.QueryFilter) database.IQuery {
+	q.primary.MatchAll(filters...)
+	q.secondary.MatchAll(filters...)
+	return q
+}
+
+// MatchAny add OR filters to both queries
+func (q *shadowQuery) MatchAny(filters ...database.QueryFilter) database.IQuery {
+	q.primary.MatchAny(filters...)
+	q.secondary.MatchAny(filters...)
+	return q
+}
+
+// Sort set the sort order of both queries
+func (q *shadowQuery) Sort(sort string) database.IQuery {
+	q.primary.Sort(sort)
+	q.secondary.Sort(sort)
+	return q
+}
+
+// Page set the page of both queries
+func (q *shadowQuery) Page(page int) database.IQuery {
+	q.primary.Page(page)
+	q.secondary.Page(page)
+	return q
+}
+
+// Limit set the page size of both queries
+func (q *shadowQuery) Limit(limit int) database.IQuery {
+	q.primary.Limit(limit)
+	q.secondary.Limit(limit)
+	return q
+}
+
+// List Get multiple entities by IDs (compared)
+func (q *shadowQuery) List(entityIDs []string, keys ...string) ([]Entity, error) {
+	out, err := q.primary.List(entityIDs, keys...)
+	q.db.shadow("query_list", q.table, q.primary.ToString(), byId(out), err, func() (any, error) {
+		list, er := q.secondary.List(entityIDs, keys...)
+		return byId(list), er
+	})
+	return out, err
+}
+
+// Find Execute the query (the results and the total are compared)
+func (q *shadowQuery) Find(keys ...string) ([]Entity, int64, error) {
+	out, total, err := q.primary.Find(keys...)
+	q.db.shadow("find", q.table, q.primary.ToString(), Tuple[[]Entity, int64]{Key: out, Value: total}, err, func() (any, error) {
+		list, count, er := q.secondary.Find(keys...)
+		return Tuple[[]Entity, int64]{Key: list, Value: count}, er
+	})
+	return out, total, err
+}
+
+// Select the fields of the matching documents (compared)
+func (q *shadowQuery) Select(fields ...string) ([]Json, error) {
+	out, err := q.primary.Select(fields...)
+	q.db.shadow("select", q.table, q.primary.ToString(), out, err, func() (any, error) {
+		return q.secondary.Select(fields...)
+	})
+	return out, err
+}
+
+// Count the matching documents (compared)
+func (q *shadowQuery) Count(keys ...string) (int64, error) {
+	total, err := q.primary.Count(keys...)
+	q.db.shadow("count", q.table, q.primary.ToString(), total, err, func() (any, error) {
+		return q.secondary.Count(keys...)
+	})
+	return total, err
+}
+
+// Aggregation of the field (compared)
+func (q *shadowQuery) Aggregation(field string, function database.AggFunc, keys ...string) (float64, error) {
+	value, err := q.primary.Aggregation(field, function, keys...)
+	q.db.shadow("aggregation", q.table, q.primary.ToString(), value, err, func() (any, error) {
+		return q.secondary.Aggregation(field, function, keys...)
+	})
+	return value, err
+}
+
+// GroupCount count the matching documents by the field values (compared)
+func (q *shadowQuery) GroupCount(field string, keys ...string) (map[any]int64, int64, error) {
+	out, total, err := q.primary.GroupCount(field, keys...)
+	q.db.shadow("group_count", q.table, q.primary.ToString(), groupKeys(out, total), err, func() (any, error) {
+		m, t, er := q.secondary.GroupCount(field, keys...)
+		return groupKeys(m, t), er
+	})
+	return out, total, err
+}
+
+// GroupAggregation of the field by the field values (primary only)
+func (q *shadowQuery) GroupAggregation(field string, function database.AggFunc, keys ...string) (map[any]Tuple[int64, float64], float64, error) {
+	return q.primary.GroupAggregation(field, function, keys...)
+}
+
+// Histogram time series of the field (primary only)
+func (q *shadowQuery) Histogram(field string, function database.AggFunc, timeField string, interval time.Duration, keys ...string) (map[Timestamp]Tuple[int64, float64], float64, error) {
+	return q.primary.Histogram(field, function, timeField, interval, keys...)
+}
+
+// Histogram2D two-dimensional time series of the field (primary only)
+func (q *shadowQuery) Histogram2D(field string, function database.AggFunc, dim, timeField string, interval time.Duration, keys ...string) (map[Timestamp]map[any]Tuple[int64, float64], float64, error) {
+	return q.primary.Histogram2D(field, function, dim, timeField, interval, keys...)
+}
+
+// FindSingle Execute the query to get the first result (compared)
+func (q *shadowQuery) FindSingle(keys ...string) (Entity, error) {
+	out, err := q.primary.FindSingle(keys...)
+	q.db.shadow("find_single", q.table, q.primary.ToString(), out, err, func() (any, error) {
+		return q.secondary.FindSingle(keys...)
+	})
+	return out, err
+}
+
+// GetMap Execute the query and return map of id to entity (compared)
+func (q *shadowQuery) GetMap(keys ...string) (map[string]Entity, error) {
+	out, err := q.primary.GetMap(keys...)
+	q.db.shadow("get_map", q.table, q.primary.ToString(), out, err, func() (any, error) {
+		return q.secondary.GetMap(keys...)
+	})
+	return out, err
+}
+
+// GetIDs Execute the query and return the ids (compared)
+func (q *shadowQuery) GetIDs(keys ...string) ([]string, error) {
+	out, err := q.primary.GetIDs(keys...)
+	q.db.shadow("get_ids", q.table, q.primary.ToString(), out, err, func() (any, error) {
+		return q.secondary.GetIDs(keys...)
+	})
+	return out, err
+}
+
+// Delete the matching entities (primary only)
+func (q *shadowQuery) Delete(keys ...string) (int64, error) {
+	return q.primary.Delete(keys...)
+}
+
+// SetField Update single field of the matching documents (primary only)
+func (q *shadowQuery) SetField(field string, value any, keys ...string) (int64, error) {
+	return q.primary.SetField(field, value, keys...)
+}
+
+// SetFields Update multiple fields of the matching documents (primary only)
+func (q *shadowQuery) SetFields(fields map[string]any, keys ...string) (int64, error) {
+	return q.primary.SetFields(fields, keys...)
+}
+
+// ToString Get the string representation of the (primary) query
+func (q *shadowQuery) ToString() string {
+	return q.primary.ToString()
+}
+
+// groupKeys returns the group counts keyed by the string form of the group (Json does not support any map keys)
+func groupKeys(groups map[any]int64, total int64) Tuple[map[string]int64, int64] {
+	result := make(map[string]int64, len(groups))
+	for k, v := range groups {
+		result[fmt.Sprintf("%v", k)] = v
+	}
+	return Tuple[map[string]int64, int64]{Key: result, Value: total}
+}
+
+// endregion
@@ -0,0 +1,206 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+const redacted = "***"
+
+// region Statement log definitions ------------------------------------------------------------------------------------
+
+// StatementLogOptions configures the statements log
+type StatementLogOptions struct {
+	Level         string        // Log level of the statements: DEBUG, INFO or WARN (default: DEBUG)
+	SlowThreshold time.Duration // Statements slower than the threshold are logged at WARN level (0 to disable)
+	RedactFields  []string      // Sensitive JSON fields redacted in the document parameters (default: password, secret, token, apiKey)
+	RedactAll     bool          // Redact all the parameter values
+	MaxArgLength  int           // Truncate long parameter values to this length (default: 256)
+
+	sensitive *regexp.Regexp // Matches the sensitive field names in the statement
+}
+
+// defaultRedactFields is the list of sensitive fields redacted by default
+var defaultRedactFields = []string{"password", "secret", "token", "apiKey"}
+
+// endregion
+
+// region Statement log methods ----------------------------------------------------------------------------------------
+
+// SetStatementLog enable logging of all the executed statements: normalized SQL, duration, affected rows and table,
+// with the sensitive parameter values redacted (nil to disable)
+//
+// param: options - Statement log options
+func (dbs *MySqlDatabase) SetStatementLog(options *StatementLogOptions) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if options == nil {
+		dbs.stmtLog = nil
+		return
+	}
+
+	opts := *options
+	if opts.Level == "" {
+		opts.Level = "DEBUG"
+	}
+	if opts.RedactFields == nil {
+		opts.RedactFields = defaultRedactFields
+	}
+	if opts.MaxArgLength <= 0 {
+		opts.MaxArgLength = 256
+	}
+	opts.sensitive = nil
+	if len(opts.RedactFields) > 0 {
+		names := make([]string, 0, len(opts.RedactFields))
+		for _, name := range opts.RedactFields {
+			names = append(names, regexp.QuoteMeta(name))
+		}
+		opts.sensitive = regexp.MustCompile(`(?i)\b(` + strings.Join(names, "|") + `)\b`)
+	}
+	dbs.stmtLog = &opts
+}
+
+// statementLog returns the statement log options (nil if disabled)
+func (dbs *MySqlDatabase) statementLog() *StatementLogOptions {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.stmtLog
+}
+
+// logStatement log the executed statement
+func (dbs *MySqlDatabase) logStatement(table, SQL string, args []any, start time.Time, result sql.Result, err error) {
+	opts := dbs.statementLog()
+	if opts == nil {
+		return
+	}
+
+	duration := time.Since(start)
+	affected := int64(-1)
+	if result != nil {
+		if n, er := result.RowsAffected(); er == nil {
+			affected = n
+		}
+	}
+
+	// The scalar parameters of statements referring to sensitive fields (e.g. SetField of password) are redacted
+	sensitive := opts.sensitive != nil && opts.sensitive.MatchString(SQL)
+	params := make([]string, 0, len(args))
+	for _, arg := range args {
+		params = append(params, opts.redact(arg, sensitive))
+	}
+
+	format := "sql table=%s duration=%s rows=%d statement=%q args=[%s]"
+	values := []any{table, duration, affected, normalizeSQL(SQL), strings.Join(params, ", ")}
+
+	if err != nil {
+		dbs.log().Error(format+" error=%q", append(values, err.Error())...)
+		return
+	}
+	if opts.SlowThreshold > 0 && duration >= opts.SlowThreshold {
+		dbs.log().Warn(format+" slow=true", values...)
+		return
+	}
+
+	switch strings.ToUpper(opts.Level) {
+	case "INFO":
+		dbs.log().Info(format, values...)
+	case "WARN":
+		dbs.log().Warn(format, values...)
+	default:
+		dbs.log().Debug(format, values...)
+	}
+}
+
+// normalizeSQL collapse all the whitespaces of the statement
+func normalizeSQL(SQL string) string {
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(SQL, " "))
+}
+
+// redact returns the loggable representation of the parameter value, the sensitive fields of JSON documents are
+// redacted, and the other values are redacted if the statement refers to sensitive field
+func (opts *StatementLogOptions) redact(arg any, sensitive bool) string {
+	if opts.RedactAll {
+		return redacted
+	}
+
+	var str string
+	document := false
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		str, document = opts.redactDocument(v)
+	case string:
+		str, document = opts.redactDocument([]byte(v))
+	default:
+		str = fmt.Sprintf("%v", v)
+	}
+	if sensitive && !document {
+		return redacted
+	}
+
+	if len(str) > opts.MaxArgLength {
+		str = str[:opts.MaxArgLength] + "..."
+	}
+	return str
+}
+
+// redactDocument redact the sensitive fields of JSON document, returns false if the value is not JSON object (and the
+// value as is)
+func (opts *StatementLogOptions) redactDocument(data []byte) (string, bool) {
+	trimmed := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(trimmed, "{") {
+		return string(data), false
+	}
+
+	doc := make(map[string]any)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return string(data), false
+	}
+	opts.redactMap(doc)
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return redacted, true
+	}
+	return string(out), true
+}
+
+// redactMap redact the sensitive fields of the document recursively
+func (opts *StatementLogOptions) redactMap(doc map[string]any) {
+	for key, value := range doc {
+		if opts.isSensitive(key) {
+			doc[key] = redacted
+			continue
+		}
+		switch v := value.(type) {
+		case map[string]any:
+			opts.redactMap(v)
+		case []any:
+			for _, item := range v {
+				if m, ok := item.(map[string]any); ok {
+					opts.redactMap(m)
+				}
+			}
+		}
+	}
+}
+
+// isSensitive check if the field name is one of the sensitive fields (case-insensitive)
+func (opts *StatementLogOptions) isSensitive(field string) bool {
+	for _, name := range opts.RedactFields {
+		if strings.EqualFold(name, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// endregion
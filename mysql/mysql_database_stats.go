@@ -0,0 +1,224 @@
+package mysql
+
+import (
+	"database/sql"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// region Statement statistics definitions -----------------------------------------------------------------------------
+
+const (
+	maxStatementShapes = 1000      // Max number of tracked shapes, further shapes are counted under otherShape
+	latencySamples     = 256       // Number of recent latencies kept per shape for the percentile
+	otherShape         = "(other)" // The shape of the statements beyond the max number of shapes
+)
+
+// valuesListRegex matches repeated value tuples of multi-row statements (after the placeholders were normalized)
+var valuesListRegex = regexp.MustCompile(`(\(\?\+?\))(?:\s*,\s*\(\?\+?\))+`)
+
+// placeholderListRegex matches list of placeholders (e.g. IN lists)
+var placeholderListRegex = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+
+// StatementStats is the execution statistics of a normalized statement shape (literals and placeholders replaced by ?,
+// lists collapsed), the latency of queries is the time to the first response (not including reading the rows)
+type StatementStats struct {
+	Shape  string        // The normalized statement
+	Count  int64         // Number of executions
+	Errors int64         // Number of failed executions
+	Total  time.Duration // Total execution time
+	Mean   time.Duration // Mean execution time
+	P95    time.Duration // 95th percentile of the recent executions time
+	Rows   int64         // Total number of rows affected by the statement (rows returned by queries are not known when executed)
+}
+
+// shapeCollector collects the statistics per statement shape
+type shapeCollector struct {
+	mu     sync.Mutex
+	shapes map[string]*shapeStats
+}
+
+// shapeStats is the mutable statistics of single shape
+type shapeStats struct {
+	StatementStats
+	samples []time.Duration // Ring of the recent latencies
+	next    int             // Next sample position in the ring
+}
+
+// endregion
+
+// region Statement statistics methods ---------------------------------------------------------------------------------
+
+// SetStatementStats enable (or disable) the collection of execution statistics per statement shape inside the package,
+// to spot regressions without enabling server-side instruments (see Stats). Enabling resets the statistics
+//
+// param: enabled - Enable the statistics collection
+func (dbs *MySqlDatabase) SetStatementStats(enabled bool) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if enabled {
+		dbs.shapes = &shapeCollector{shapes: make(map[string]*shapeStats)}
+	} else {
+		dbs.shapes = nil
+	}
+}
+
+// Stats returns the execution statistics per statement shape (see SetStatementStats), ordered by total time
+//
+// return: List of statement statistics (empty if disabled)
+func (dbs *MySqlDatabase) Stats() []StatementStats {
+	dbs.mu.RLock()
+	collector := dbs.shapes
+	dbs.mu.RUnlock()
+
+	result := make([]StatementStats, 0)
+	if collector == nil {
+		return result
+	}
+
+	collector.mu.Lock()
+	for _, s := range collector.shapes {
+		stats := s.StatementStats
+		stats.Mean = time.Duration(int64(stats.Total) / stats.Count)
+		stats.P95 = percentile(s.samples, 0.95)
+		result = append(result, stats)
+	}
+	collector.mu.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Total != result[j].Total {
+			return result[i].Total > result[j].Total
+		}
+		return result[i].Shape < result[j].Shape
+	})
+	return result
+}
+
+// recordShape add the statement execution to the statistics of its shape (if enabled)
+func (dbs *MySqlDatabase) recordShape(SQL string, start time.Time, result sql.Result, err error) {
+	dbs.mu.RLock()
+	collector := dbs.shapes
+	dbs.mu.RUnlock()
+	if collector == nil {
+		return
+	}
+
+	duration := time.Since(start)
+	var affected int64
+	if result != nil {
+		if n, er := result.RowsAffected(); er == nil {
+			affected = n
+		}
+	}
+	shape := normalizeShape(SQL)
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	s, ok := collector.shapes[shape]
+	if !ok {
+		if len(collector.shapes) >= maxStatementShapes {
+			shape = otherShape
+		}
+		if s, ok = collector.shapes[shape]; !ok {
+			s = &shapeStats{StatementStats: StatementStats{Shape: shape}, samples: make([]time.Duration, 0, latencySamples)}
+			collector.shapes[shape] = s
+		}
+	}
+
+	s.Count++
+	s.Total += duration
+	s.Rows += affected
+	if err != nil {
+		s.Errors++
+	}
+	if len(s.samples) < latencySamples {
+		s.samples = append(s.samples, duration)
+	} else {
+		s.samples[s.next] = duration
+	}
+	s.next = (s.next + 1) % latencySamples
+}
+
+// normalizeShape replace the literals and placeholders of the statement by ?, collapse the lists of placeholders and
+// the whitespaces, quoted identifiers are kept as is
+func normalizeShape(SQL string) string {
+	sb := strings.Builder{}
+	for i := 0; i < len(SQL); i++ {
+		c := SQL[i]
+		switch {
+		case c == '\'':
+			// string literal (quotes are escaped by doubling or by backslash), JSON paths are part of the shape
+			start := i
+			for i++; i < len(SQL); i++ {
+				if SQL[i] == '\\' {
+					i++
+				} else if SQL[i] == '\'' {
+					if i+1 < len(SQL) && SQL[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			prev := strings.TrimSpace(sb.String())
+			if end := i + 1; strings.HasPrefix(SQL[start:], "'$") || strings.HasSuffix(prev, "->") || strings.HasSuffix(prev, "->>") {
+				if end > len(SQL) {
+					end = len(SQL)
+				}
+				sb.WriteString(SQL[start:end])
+			} else {
+				sb.WriteByte('?')
+			}
+		case c == '"' || c == '`':
+			end := strings.IndexByte(SQL[i+1:], c)
+			if end < 0 {
+				sb.WriteString(SQL[i:])
+				i = len(SQL)
+				continue
+			}
+			sb.WriteString(SQL[i : i+end+2])
+			i += end + 1
+		case c == '$' && i+1 < len(SQL) && isDigit(SQL[i+1]):
+			for i+1 < len(SQL) && isDigit(SQL[i+1]) {
+				i++
+			}
+			sb.WriteByte('?')
+		case isDigit(c) && (i == 0 || !isIdentifierChar(SQL[i-1])):
+			for i+1 < len(SQL) && (isDigit(SQL[i+1]) || SQL[i+1] == '.') {
+				i++
+			}
+			sb.WriteByte('?')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	shape := normalizeSQL(sb.String())
+	shape = placeholderListRegex.ReplaceAllString(shape, "?+")
+	return valuesListRegex.ReplaceAllString(shape, "$1, ...")
+}
+
+// percentile returns the percentile of the durations
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// endregion
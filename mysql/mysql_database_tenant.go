@@ -0,0 +1,413 @@
+package mysql
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+var templatePlaceholderRegex = regexp.MustCompile(`\{\{[^}]+\}\}`)
+
+// region Tenant provisioning methods ----------------------------------------------------------------------------------
+
+const (
+	sqlTableExists = `SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), DATABASE()) AND TABLE_NAME = $2`
+)
+
+// ProvisionTenant Create all the sharded tables, indexes and promoted columns of a new tenant (account) in one call
+// Since MySQL DDL statements are not transactional, in case of failure the tables created by this call are dropped
+// (tables which already existed are kept as is), so the provisioning can be safely retried
+//
+// param: tenantKey - The tenant shard key (replaces the {{0}} / {{accountId}} placeholders)
+// param: ddl - Map of table templates (e.g. event-{{accountId}}) to list of fields to index
+// return: List of tables created by this call, error
+func (dbs *MySqlDatabase) ProvisionTenant(tenantKey string, ddl map[string][]string) (created []string, err error) {
+
+	created = make([]string, 0)
+
+	if tenantKey == "" {
+		return created, fmt.Errorf("empty tenant key passed to ProvisionTenant operation")
+	}
+
+	for template, fields := range ddl {
+		table := dbs.tableName(template, tenantKey)
+
+		exists, er := dbs.tableExists(table)
+		if er != nil {
+			err = er
+			break
+		}
+
+		if err = dbs.ExecuteDDL(map[string][]string{table: fields}); err != nil {
+			if !exists {
+				created = append(created, table)
+			}
+			break
+		}
+		if !exists {
+			created = append(created, table)
+		}
+
+		if err = dbs.createPromotedColumns(template, table); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		return created, nil
+	}
+
+	// Compensate: drop the tables created by this call
+	for _, table := range created {
+		SQL := fmt.Sprintf(ddlDropTableMySql, table)
+		if _, er := dbs.exec(dbs.pgDb, table, "", SQL); er != nil {
+			dbs.log().Error("%s error: %s", SQL, er.Error())
+		}
+	}
+	return make([]string, 0), err
+}
+
+// tableExists check if the table exists in the current database
+func (dbs *MySqlDatabase) tableExists(table string) (bool, error) {
+	var count int
+	if err := dbs.scalar(table, sqlTableExists, schemaArgs(table), &count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// endregion
+
+// region Tenant decommission methods ----------------------------------------------------------------------------------
+
+// DecommissionOptions configures the tenant decommission process
+type DecommissionOptions struct {
+	Writer        io.Writer                     // Destination of the JSON-lines dump of the tenant tables (nil to skip the export)
+	ArchivePrefix string                        // Rename the tables with this prefix instead of dropping them (empty to drop)
+	OnAudit       func(record TenantAuditEntry) // Callback invoked for every audit record (e.g. to store it in the compliance log)
+}
+
+// TenantAuditEntry is the audit record of a single decommissioned table
+type TenantAuditEntry struct {
+	Tenant    string    `json:"tenant"`    // The tenant key
+	Table     string    `json:"table"`     // The decommissioned table
+	Action    string    `json:"action"`    // The action taken: dropped or archived
+	Archive   string    `json:"archive"`   // The archive table name (for archived tables)
+	Exported  int64     `json:"exported"`  // Number of exported rows
+	Timestamp Timestamp `json:"timestamp"` // Time of the action
+}
+
+// exportLine is a single line of the JSON-lines tenant dump
+type exportLine struct {
+	Table string          `json:"table"`
+	Id    string          `json:"id"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// DecommissionTenant Export the tenant tables to JSON-lines dump, then drop them or rename them with the archive prefix
+// The tables of each template are resolved for all the time periods (e.g. every {{month}} table of the tenant). The
+// exported documents are decoded (overflowed documents are loaded and encrypted fields are decrypted) so the dump does
+// not depend on the blob store or on the encryption keys. The companion tables of the tables (history and trash) are
+// dropped or archived with them, and the overflow blobs of the dropped tables are deleted
+//
+// param: tenantKey - The tenant shard key (replaces the {{0}} / {{accountId}} placeholders)
+// param: templates - List of table templates (e.g. event-{{accountId}}-{{year}}{{month}})
+// param: opts - Decommission options
+// return: List of audit records, error
+func (dbs *MySqlDatabase) DecommissionTenant(tenantKey string, templates []string, opts DecommissionOptions) (audit []TenantAuditEntry, err error) {
+
+	audit = make([]TenantAuditEntry, 0)
+
+	if tenantKey == "" {
+		return audit, fmt.Errorf("empty tenant key passed to DecommissionTenant operation")
+	}
+
+	var writer *bufio.Writer
+	if opts.Writer != nil {
+		writer = bufio.NewWriter(opts.Writer)
+	}
+
+	for _, template := range templates {
+		tables, er := dbs.tenantTables(template, tenantKey)
+		if er != nil {
+			return audit, er
+		}
+
+		for _, table := range tables {
+			var exported int64
+			if writer != nil {
+				if exported, err = dbs.exportTable(template, table, writer); err != nil {
+					return
+				}
+				if err = writer.Flush(); err != nil {
+					return
+				}
+			}
+
+			companions, er := dbs.tableCompanions(table)
+			if er != nil {
+				return audit, er
+			}
+			for _, name := range append([]string{table}, companions...) {
+				entry := TenantAuditEntry{Tenant: tenantKey, Table: name}
+				if name == table {
+					entry.Exported = exported
+				}
+				if err = dbs.decommissionTable(&entry, opts.ArchivePrefix); err != nil {
+					return
+				}
+				if opts.OnAudit != nil {
+					opts.OnAudit(entry)
+				}
+				audit = append(audit, entry)
+			}
+
+			// the blobs of archived tables are still referenced by their documents
+			if opts.ArchivePrefix == "" {
+				if err = dbs.deleteOverflowBlobs(template, table); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// decommissionTable drop the table of the audit entry or rename it with the archive prefix
+func (dbs *MySqlDatabase) decommissionTable(entry *TenantAuditEntry, archivePrefix string) error {
+	SQL := fmt.Sprintf(ddlDropTableMySql, entry.Table)
+	entry.Action = "dropped"
+	if archivePrefix != "" {
+		entry.Archive = archivePrefix + entry.Table
+		entry.Action = "archived"
+		SQL = fmt.Sprintf(ddlRenameTable, entry.Table, entry.Archive)
+	}
+	if _, err := dbs.exec(dbs.pgDb, entry.Table, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+		return err
+	}
+
+	entry.Timestamp = Now()
+	dbs.log().Info("tenant %s table %s %s (%d rows exported)", entry.Tenant, entry.Table, entry.Action, entry.Exported)
+	return nil
+}
+
+// tableCompanions returns the existing companion tables of the physical table: prior versions and soft deleted entities
+func (dbs *MySqlDatabase) tableCompanions(table string) ([]string, error) {
+	companions := make([]string, 0)
+	for _, companion := range []string{historyTable(table), trashTableName(table)} {
+		existing, err := dbs.listTables(companion)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range existing {
+			if name == companion {
+				companions = append(companions, companion)
+				break
+			}
+		}
+	}
+	return companions, nil
+}
+
+// deleteOverflowBlobs delete the overflow blobs of the dropped physical table (the keys are prefixed by the table name)
+func (dbs *MySqlDatabase) deleteOverflowBlobs(template, table string) error {
+	storage := dbs.overflowStorage(template)
+	if storage == nil {
+		return nil
+	}
+	lister, ok := storage.store.(IBlobLister)
+	if !ok {
+		dbs.log().Warn("the overflow blob store of %s does not support listing, the blobs of %s are not deleted", template, table)
+		return nil
+	}
+
+	blobs, err := lister.List(table + "/")
+	if err != nil {
+		return err
+	}
+	for _, key := range blobs {
+		if err = storage.store.Delete(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportTable write all the table rows as JSON lines, the documents are decoded by the table template
+func (dbs *MySqlDatabase) exportTable(template, table string, writer io.Writer) (count int64, err error) {
+
+	rows, err := dbs.query(dbs.pgDb, table, "", fmt.Sprintf(`SELECT id, data FROM "%s"`, table))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	encoder := json.NewEncoder(writer)
+	for rows.Next() {
+		line := exportLine{Table: table}
+		var data []byte
+		if err = rows.Scan(&line.Id, &data); err != nil {
+			return
+		}
+		if line.Data, err = dbs.decode(template, data); err != nil {
+			return
+		}
+		if err = encoder.Encode(&line); err != nil {
+			return
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// tenantTables returns the physical tables of the template which belong to the tenant. The LIKE pattern matches any
+// value of the other placeholders (e.g. tenant a matches the tables of tenant a-b), so the candidates are filtered by
+// the template regex with the tenant key resolved
+func (dbs *MySqlDatabase) tenantTables(template, tenantKey string) ([]string, error) {
+	template = strings.Replace(template, "{{accountId}}", "{{0}}", -1)
+	if !strings.Contains(template, "{{0}}") {
+		return nil, fmt.Errorf("table template %s is not sharded by tenant", template)
+	}
+
+	regex, _, err := templateRegex(template, tenantKey)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := dbs.listTables(templatePattern(template, tenantKey))
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(candidates))
+	for _, table := range candidates {
+		if regex.MatchString(table) {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+// templatePattern convert table template to SQL LIKE pattern: the shard keys are resolved and the other placeholders match any value
+func templatePattern(template string, keys ...string) string {
+	pattern := strings.Replace(template, "{{accountId}}", "{{0}}", -1)
+	pattern = strings.Replace(pattern, "%", `\%`, -1)
+	pattern = strings.Replace(pattern, "_", `\_`, -1)
+
+	for idx, key := range keys {
+		key = strings.Replace(key, "%", `\%`, -1)
+		key = strings.Replace(key, "_", `\_`, -1)
+		pattern = strings.Replace(pattern, fmt.Sprintf("{{%d}}", idx), key, -1)
+	}
+	return templatePlaceholderRegex.ReplaceAllString(pattern, "%")
+}
+
+// endregion
+
+// region Shards enumeration methods -----------------------------------------------------------------------------------
+
+// ShardInfo describes a physical table of a sharded entity
+type ShardInfo struct {
+	Table string            // The physical table name
+	Keys  []string          // The shard keys (values of the {{0}}..{{n}} placeholders)
+	Time  map[string]string // The time bucket (values of the {{year}}, {{month}}, {{week}}, {{day}} and {{hour}} placeholders)
+}
+
+// ListShards Inspect the existing tables matching the entity table template and return the shard keys / time buckets present
+// so maintenance jobs can iterate tenants without an external registry
+//
+// param: factory - Entity factory
+// return: List of shards, error
+func (dbs *MySqlDatabase) ListShards(factory EntityFactory) (shards []ShardInfo, err error) {
+	return dbs.listShards(factory().TABLE())
+}
+
+// listShards returns the existing shards of the table template
+func (dbs *MySqlDatabase) listShards(template string) (shards []ShardInfo, err error) {
+
+	shards = make([]ShardInfo, 0)
+	template = strings.Replace(template, "{{accountId}}", "{{0}}", -1)
+
+	if !strings.Contains(template, "{{") {
+		return shards, nil
+	}
+
+	regex, groups, err := templateRegex(template)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := dbs.listTables(templatePattern(template))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range tables {
+		match := regex.FindStringSubmatch(table)
+		if match == nil {
+			continue
+		}
+
+		shard := ShardInfo{Table: table, Keys: make([]string, 0), Time: make(map[string]string)}
+		for i, group := range groups {
+			if idx, er := strconv.Atoi(group); er == nil {
+				for len(shard.Keys) <= idx {
+					shard.Keys = append(shard.Keys, "")
+				}
+				shard.Keys[idx] = match[i+1]
+			} else {
+				shard.Time[group] = match[i+1]
+			}
+		}
+		shards = append(shards, shard)
+	}
+	return shards, nil
+}
+
+// templateRegex build regular expression matching the physical tables of the template, returns the list of captured placeholders
+// The shard keys placeholders ({{0}}..{{n}}) of the provided keys are matched literally (and not captured)
+func templateRegex(template string, keys ...string) (*regexp.Regexp, []string, error) {
+	groups := make([]string, 0)
+	expr := strings.Builder{}
+	expr.WriteString("^")
+
+	rest := template
+	for {
+		loc := templatePlaceholderRegex.FindStringIndex(rest)
+		if loc == nil {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:loc[0]]))
+
+		placeholder := rest[loc[0]+2 : loc[1]-2]
+		if idx, er := strconv.Atoi(placeholder); er == nil && idx < len(keys) {
+			expr.WriteString(regexp.QuoteMeta(keys[idx]))
+			rest = rest[loc[1]:]
+			continue
+		}
+		groups = append(groups, placeholder)
+		switch placeholder {
+		case "year":
+			expr.WriteString(`(\d{4})`)
+		case "month", "week", "day", "hour":
+			expr.WriteString(`(\d{2})`)
+		default:
+			expr.WriteString(`(.+?)`)
+		}
+		rest = rest[loc[1]:]
+	}
+	expr.WriteString("$")
+
+	regex, err := regexp.Compile(expr.String())
+	return regex, groups, err
+}
+
+// endregion
@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"sync"
+)
+
+// region Tenant concurrency limits ------------------------------------------------------------------------------------
+
+// tenantLimiter limits the number of concurrent operations per shard key (tenant)
+type tenantLimiter struct {
+	mu           sync.Mutex               // Protect the limits and semaphores
+	defaultLimit int                      // Default limit per shard key (0 for unlimited)
+	limits       map[string]int           // Specific limits per shard key
+	sems         map[string]chan struct{} // Semaphores per shard key
+}
+
+// SetTenantLimit set the maximum number of concurrent operations per shard key, so a noisy tenant
+// can not starve the other tenants sharing the same connection pool. Operations exceeding the limit wait for a free slot
+//
+// param: key - The shard key (empty string to set the default limit for all the shard keys)
+// param: limit - Maximum number of concurrent operations (0 for unlimited)
+func (dbs *MySqlDatabase) SetTenantLimit(key string, limit int) {
+	l := &dbs.tenants
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if key == "" {
+		l.defaultLimit = limit
+		l.sems = nil
+		return
+	}
+	if l.limits == nil {
+		l.limits = make(map[string]int)
+	}
+	l.limits[key] = limit
+	delete(l.sems, key)
+}
+
+// throttle wait for a free slot of the shard key (first key) and returns the function to release it
+// the release function may be called more than once
+func (dbs *MySqlDatabase) throttle(keys ...string) (release func()) {
+	tenant := tenantOf(keys...)
+	if tenant == "" {
+		return func() {}
+	}
+
+	sem := dbs.tenants.semaphore(tenant)
+	if sem == nil {
+		return func() {}
+	}
+
+	sem <- struct{}{}
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { <-sem })
+	}
+}
+
+// semaphore returns the semaphore of the shard key (nil if unlimited)
+func (l *tenantLimiter) semaphore(key string) chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit, ok := l.limits[key]
+	if !ok {
+		limit = l.defaultLimit
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	if sem, exists := l.sems[key]; exists {
+		return sem
+	}
+	if l.sems == nil {
+		l.sems = make(map[string]chan struct{})
+	}
+	sem := make(chan struct{}, limit)
+	l.sems[key] = sem
+	return sem
+}
+
+// endregion
@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Timestamp columns definitions --------------------------------------------------------------------------------
+
+// Timestamp columns, maintained by the server on every insert and update of the entity row.
+// Use the column names as query fields to filter and sort, the filter values are epoch milliseconds (Timestamp)
+const (
+	CreatedAtColumn = "created_at"
+	UpdatedAtColumn = "updated_at"
+)
+
+const (
+	ddlAddCreatedAt = `ADD COLUMN "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3), ADD INDEX "%s_created_at_idx" ("created_at")`
+	ddlAddUpdatedAt = `ADD COLUMN "updated_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3), ADD INDEX "%s_updated_at_idx" ("updated_at")`
+)
+
+// endregion
+
+// region Timestamp columns methods ------------------------------------------------------------------------------------
+
+// EnableTimestampColumns add created_at and updated_at columns to the entity tables (see CreatePromotedColumns), the
+// columns are set by the server on Insert, Update and Upsert (and any other change of the row), so the temporal data
+// does not depend on the Json document. The columns follow the session time zone, the connection time zone (loc) should
+// match it (default: UTC)
+//
+// param: factory - Entity factory
+func (dbs *MySqlDatabase) EnableTimestampColumns(factory EntityFactory) {
+	template := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.timestamps == nil {
+		dbs.timestamps = make(map[string]bool)
+	}
+	dbs.timestamps[template] = true
+}
+
+// createTimestampColumns create the timestamp columns and indexes of the template in the physical table (if enabled)
+func (dbs *MySqlDatabase) createTimestampColumns(template, table string) (err error) {
+	if !dbs.timestampsEnabled(template) {
+		return nil
+	}
+
+	for column, ddl := range map[string]string{CreatedAtColumn: ddlAddCreatedAt, UpdatedAtColumn: ddlAddUpdatedAt} {
+		var count int
+		if err = dbs.scalar(table, sqlColumnExists, schemaArgs(table, column), &count); err != nil {
+			return
+		}
+		if count > 0 {
+			continue
+		}
+		if err = dbs.AlterTable(table, fmt.Sprintf(ddl, baseName(table))); err != nil {
+			return
+		}
+	}
+	return nil
+}
+
+// timestampsEnabled returns true if the timestamp columns are enabled for the table template
+func (dbs *MySqlDatabase) timestampsEnabled(template string) bool {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.timestamps[template]
+}
+
+// timestampColumn returns the column of the timestamp field (if the field is timestamp column of the template)
+func (dbs *MySqlDatabase) timestampColumn(template, field string) (column string, ok bool) {
+	if field != CreatedAtColumn && field != UpdatedAtColumn {
+		return "", false
+	}
+	if !dbs.timestampsEnabled(template) {
+		return "", false
+	}
+	return fmt.Sprintf(`"%s"`, field), true
+}
+
+// timestampArgs convert the epoch milliseconds filter values to time values of the timestamp columns
+func timestampArgs(args []any) []any {
+	result := make([]any, 0, len(args))
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case []any:
+			result = append(result, timestampArgs(v))
+		case Timestamp:
+			result = append(result, time.UnixMilli(int64(v)).UTC())
+		case int:
+			result = append(result, time.UnixMilli(int64(v)).UTC())
+		case int64:
+			result = append(result, time.UnixMilli(v).UTC())
+		case uint64:
+			result = append(result, time.UnixMilli(int64(v)).UTC())
+		case float64:
+			result = append(result, time.UnixMilli(int64(v)).UTC())
+		default:
+			result = append(result, arg)
+		}
+	}
+	return result
+}
+
+// endregion
@@ -0,0 +1,217 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Trash definitions --------------------------------------------------------------------------------------------
+
+// trashEntry is the document of a soft deleted entity, stored in the companion trash table of the entity table
+// (<table>_trash) under the entity id
+type trashEntry struct {
+	BaseEntity                 // The entity id, CreatedOn is the deletion time
+	Data       json.RawMessage `json:"data"` // The entity document (as stored)
+}
+
+const (
+	sqlListTrash  = `SELECT data FROM "%s" WHERE (data->>'createdOn')::BIGINT >= $1 ORDER BY (data->>'createdOn')::BIGINT DESC`
+	sqlEmptyTrash = `DELETE FROM "%s" WHERE (data->>'createdOn')::BIGINT < $1`
+)
+
+// endregion
+
+// region Trash methods ------------------------------------------------------------------------------------------------
+
+// SetSoftDelete enable (or disable) soft delete of the entity table: Delete moves the entity document to the companion
+// trash table in the same transaction, from which it can be restored (see ListTrash, Restore and EmptyTrash).
+// Bulk and query deletes are not affected (hard delete).
+//
+// param: factory - Entity factory
+// param: enabled - Enable or disable soft delete
+func (dbs *MySqlDatabase) SetSoftDelete(factory EntityFactory, enabled bool) {
+	template := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if !enabled {
+		delete(dbs.softDelete, template)
+		return
+	}
+	if dbs.softDelete == nil {
+		dbs.softDelete = make(map[string]bool)
+	}
+	dbs.softDelete[template] = true
+}
+
+// ListTrash returns the entities deleted since the given time (the latest deleted first)
+//
+// param: factory - Entity factory
+// param: since - Start of the deletion time range
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: List of deleted entities, error
+func (dbs *MySqlDatabase) ListTrash(factory EntityFactory, since Timestamp, keys ...string) (list []Entity, err error) {
+
+	list = make([]Entity, 0)
+	defer dbs.observe("list_trash", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	table, err := dbs.trashTable(factory, keys...)
+	if err != nil || table == "" {
+		return
+	}
+
+	rows, err := dbs.query(dbs.pgDb, table, tenantOf(keys...), fmt.Sprintf(sqlListTrash, table), int64(since))
+	if err != nil {
+		return
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return
+		}
+		entry := trashEntry{}
+		if err = json.Unmarshal(data, &entry); err != nil {
+			return
+		}
+		entity, er := dbs.unmarshal(factory, entry.Data)
+		if er != nil {
+			return nil, er
+		}
+		list = append(list, entity)
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+	return dbs.maskEntities(factory, list)
+}
+
+// Restore move the soft deleted entity from the trash table back to the entity table (fails if an entity with the same
+// id was created since it was deleted)
+//
+// param: factory - Entity factory
+// param: entityID - The entity id
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Restored entity, error
+func (dbs *MySqlDatabase) Restore(factory EntityFactory, entityID string, keys ...string) (restored Entity, err error) {
+
+	defer dbs.throttle(keys...)()
+	defer dbs.observe("restore", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	tblName, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return
+	}
+	table, err := dbs.trashTable(factory, keys...)
+	if err != nil {
+		return
+	}
+	if table == "" {
+		return nil, fmt.Errorf("entity %s not found in trash", entityID)
+	}
+
+	tenant := tenantOf(keys...)
+	tx, err := dbs.pgDb.Begin()
+	if err != nil {
+		return
+	}
+
+	data, err := dbs.readDocument(tx, table, tenant, entityID, false)
+	if err == nil && data == nil {
+		err = fmt.Errorf("entity %s not found in trash", entityID)
+	}
+	entry := trashEntry{}
+	if err == nil {
+		err = json.Unmarshal(data, &entry)
+	}
+	if err == nil {
+		_, err = dbs.exec(tx, tblName, tenant, fmt.Sprintf(sqlInsert, tblName), entityID, []byte(entry.Data))
+	}
+	if err == nil {
+		_, err = dbs.exec(tx, table, tenant, fmt.Sprintf(sqlDelete, table), entityID)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return
+	}
+
+	if restored, err = dbs.unmarshal(factory, entry.Data); err != nil {
+		return
+	}
+	dbs.publishChange(AddEntity, restored)
+	return
+}
+
+// EmptyTrash permanently delete the entities deleted before the given time
+//
+// param: factory - Entity factory
+// param: olderThan - End of the deletion time range (exclusive)
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Number of deleted entities, error
+func (dbs *MySqlDatabase) EmptyTrash(factory EntityFactory, olderThan Timestamp, keys ...string) (affected int64, err error) {
+
+	defer dbs.observe("empty_trash", factory().TABLE(), 0, time.Now(), &affected, &err)
+
+	table, err := dbs.trashTable(factory, keys...)
+	if err != nil || table == "" {
+		return
+	}
+
+	result, err := dbs.exec(dbs.pgDb, table, tenantOf(keys...), fmt.Sprintf(sqlEmptyTrash, table), int64(olderThan))
+	if err != nil {
+		return
+	}
+	return result.RowsAffected()
+}
+
+// softDeleteEnabled returns true if soft delete of the table template is enabled
+func (dbs *MySqlDatabase) softDeleteEnabled(template string) bool {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.softDelete[template]
+}
+
+// trashTable returns the trash table of the entity shard table (empty if it does not exist)
+func (dbs *MySqlDatabase) trashTable(factory EntityFactory, keys ...string) (string, error) {
+	tblName, err := dbs.resolveTable(factory().TABLE(), keys...)
+	if err != nil {
+		return "", err
+	}
+	table := trashTableName(tblName)
+	if exists, er := dbs.listTables(table); er != nil || len(exists) == 0 {
+		return "", er
+	}
+	return table, nil
+}
+
+// writeTrash write the deleted entity document (the audit entry before document) to the trash table
+func (dbs *MySqlDatabase) writeTrash(tx *sql.Tx, table, tenant string, entry *AuditEntry) error {
+	trash := trashEntry{Data: entry.Before}
+	trash.Id = entry.EntityId
+	trash.CreatedOn = Timestamp(dbs.now().UnixMilli())
+	trash.UpdatedOn = trash.CreatedOn
+
+	data, err := json.Marshal(trash)
+	if err != nil {
+		return err
+	}
+	trashTable := trashTableName(table)
+	_, err = dbs.exec(tx, trashTable, tenant, fmt.Sprintf(sqlUpsert, trashTable), trash.Id, data)
+	return err
+}
+
+// trashTableName returns the trash table name of the entity physical table
+func trashTableName(table string) string {
+	return table + "_trash"
+}
+
+// endregion
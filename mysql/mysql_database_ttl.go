@@ -0,0 +1,223 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region TTL definitions ----------------------------------------------------------------------------------------------
+
+// TTLPolicy defines the expiration of the documents of an entity table
+type TTLPolicy struct {
+	Field      string        // Timestamp field (epoch milliseconds) of the document (default: updatedOn)
+	Duration   time.Duration // Time to live since the field time (zero when the field holds the expiration time)
+	BatchSize  int           // Max number of documents deleted per batch (default: 500)
+	BatchDelay time.Duration // Delay between consecutive batches to limit the load on the database (optional)
+}
+
+// ttlPolicy is a registered TTL policy
+type ttlPolicy struct {
+	TTLPolicy
+	factory EntityFactory
+}
+
+// endregion
+
+// region TTL methods --------------------------------------------------------------------------------------------------
+
+// SetTTL set the expiration policy of the entity table (nil policy removes it), expired documents are deleted by
+// PurgeExpired or by the background reaper (see StartReaper)
+//
+// param: factory - Entity factory
+// param: policy - The TTL policy
+// return: error
+func (dbs *MySqlDatabase) SetTTL(factory EntityFactory, policy *TTLPolicy) error {
+	template := factory().TABLE()
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if policy == nil {
+		delete(dbs.ttl, template)
+		return nil
+	}
+
+	p := &ttlPolicy{TTLPolicy: *policy, factory: factory}
+	if p.Field == "" {
+		p.Field = "updatedOn"
+	}
+	if err := validateFields(p.Field); err != nil {
+		return err
+	}
+	if p.Duration < 0 || p.BatchDelay < 0 {
+		return fmt.Errorf("TTL duration and batch delay must not be negative")
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = 500
+	}
+	if dbs.ttl == nil {
+		dbs.ttl = make(map[string]*ttlPolicy)
+	}
+	dbs.ttl[template] = p
+	return nil
+}
+
+// PurgeExpired delete the expired documents of the entity table in batches (by its TTL policy), delete notifications
+// are published for every deleted document
+//
+// param: factory - Entity factory
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Number of deleted documents, error
+func (dbs *MySqlDatabase) PurgeExpired(factory EntityFactory, keys ...string) (affected int64, err error) {
+	policy := dbs.ttlPolicy(factory().TABLE())
+	if policy == nil {
+		return 0, fmt.Errorf("no TTL policy for table %s", factory().TABLE())
+	}
+
+	cutoff := dbs.now().Add(-policy.Duration)
+	return dbs.deleteBefore(factory, policy.Field, cutoff, policy.BatchSize, policy.BatchDelay, nil, keys...)
+}
+
+// DeleteOlderThan delete the documents whose timestamp field (epoch milliseconds) is before the cutoff time in batches
+// (by the batch size and delay of the TTL policy of the table, if set), so a large purge does not hold long locks or
+// produce huge binlog transactions. The batches are rate limited by the write rate of the entity (see SetWriteRate)
+// and delete notifications are published for every deleted document.
+// The progress channel delivers the accumulated number of deleted documents after every batch and must be drained,
+// it is closed when the purge completes and then the error channel delivers the error (if any) and is closed.
+//
+// param: factory - Entity factory
+// param: timeField - Timestamp field (epoch milliseconds) of the document
+// param: cutoff - Documents before this time are deleted
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: Progress channel, error channel
+func (dbs *MySqlDatabase) DeleteOlderThan(factory EntityFactory, timeField string, cutoff time.Time, keys ...string) (<-chan int64, <-chan error) {
+	progress := make(chan int64, 1)
+	errs := make(chan error, 1)
+
+	batchSize, batchDelay := 500, time.Duration(0)
+	if policy := dbs.ttlPolicy(factory().TABLE()); policy != nil {
+		batchSize, batchDelay = policy.BatchSize, policy.BatchDelay
+	}
+
+	go func() {
+		defer close(errs)
+		defer close(progress)
+		if err := validateFields(timeField); err != nil {
+			errs <- err
+			return
+		}
+		report := func(affected int64) { progress <- affected }
+		if _, err := dbs.deleteBefore(factory, timeField, cutoff, batchSize, batchDelay, report, keys...); err != nil {
+			errs <- err
+		}
+	}()
+	return progress, errs
+}
+
+// deleteBefore delete the documents whose timestamp field is before the cutoff time in batches, the report function
+// (optional) is called with the accumulated number of deleted documents after every batch
+func (dbs *MySqlDatabase) deleteBefore(factory EntityFactory, field string, cutoff time.Time, batchSize int, batchDelay time.Duration, report func(int64), keys ...string) (affected int64, err error) {
+	limit := int(cutoff.UnixMilli()) // int values are compared as numbers
+	for {
+		ids, er := dbs.Query(factory).Filter(database.F(field).Lt(limit)).Limit(batchSize).GetIDs(keys...)
+		if er != nil || len(ids) == 0 {
+			return affected, er
+		}
+
+		count, er := dbs.BulkDelete(factory, ids, keys...)
+		affected += count
+		if report != nil && count > 0 {
+			report(affected)
+		}
+		if er != nil || len(ids) < batchSize {
+			return affected, er
+		}
+		if batchDelay > 0 {
+			time.Sleep(batchDelay)
+		}
+	}
+}
+
+// StartReaper start background worker purging the expired documents of all the tables with TTL policy (including all
+// the existing shards of sharded tables) every interval
+//
+// param: interval - Time interval between purge cycles (must be positive)
+// return: Function stopping the reaper (waits for the running cycle to complete), error
+func (dbs *MySqlDatabase) StartReaper(interval time.Duration) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("reaper interval must be positive: %s", interval)
+	}
+
+	done := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				dbs.reap()
+			}
+		}
+	}()
+
+	once := sync.Once{}
+	return func() {
+		once.Do(func() { close(done) })
+		wg.Wait()
+	}, nil
+}
+
+// reap purge the expired documents of all the tables with TTL policy
+func (dbs *MySqlDatabase) reap() {
+	dbs.mu.RLock()
+	policies := make([]*ttlPolicy, 0, len(dbs.ttl))
+	for _, policy := range dbs.ttl {
+		policies = append(policies, policy)
+	}
+	dbs.mu.RUnlock()
+
+	for _, policy := range policies {
+		template := policy.factory().TABLE()
+		if !strings.Contains(template, "{{") {
+			if _, err := dbs.PurgeExpired(policy.factory); err != nil {
+				dbs.log().Error("purge expired %s error: %s", template, err.Error())
+			}
+			continue
+		}
+
+		shards, err := dbs.listShards(template)
+		if err != nil {
+			dbs.log().Error("list shards of %s error: %s", template, err.Error())
+			continue
+		}
+		for _, shard := range shards {
+			keys := append([]string{}, shard.Keys...)
+			if at, ok := shardTime(shard); ok {
+				keys = append(keys, AtTime(at))
+			}
+			if _, err = dbs.PurgeExpired(policy.factory, keys...); err != nil {
+				dbs.log().Error("purge expired %s error: %s", shard.Table, err.Error())
+			}
+		}
+	}
+}
+
+// ttlPolicy returns the TTL policy of the table template (nil if not defined)
+func (dbs *MySqlDatabase) ttlPolicy(template string) *ttlPolicy {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.ttl[template]
+}
+
+// endregion
@@ -0,0 +1,380 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Document validation definitions ------------------------------------------------------------------------------
+
+// ErrValidation is the sentinel of ValidationError (use errors.Is)
+var ErrValidation = errors.New("document validation failed")
+
+// Violation is a single validation failure of the document
+type Violation struct {
+	Field   string `json:"field"`   // The (dot separated) field path, empty for the document root
+	Rule    string `json:"rule"`    // The violated rule (e.g. required, type, minimum, pattern)
+	Message string `json:"message"` // Human readable description
+}
+
+// ValidationError is returned by the writes of invalid entity document (see SetJsonSchema)
+type ValidationError struct {
+	Table      string      // The entity table (template)
+	Id         string      // The entity id
+	Violations []Violation // The violations
+}
+
+// Error returns the error message
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s: %s", v.Field, v.Message))
+	}
+	return fmt.Sprintf("%s: entity %s of table %s: %s", ErrValidation.Error(), e.Id, e.Table, strings.Join(parts, "; "))
+}
+
+// Unwrap returns the ErrValidation sentinel
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// DocumentValidator validates the entity Json document, returns the violations (empty if valid)
+type DocumentValidator func(doc map[string]any) []Violation
+
+// documentValidation holds the validation of entity table template
+type documentValidation struct {
+	schema     string              // The Json Schema (raw, used by the server side CHECK constraint)
+	compiled   map[string]any      // The parsed Json Schema
+	validators []DocumentValidator // Custom validation functions
+}
+
+const (
+	ddlSchemaCheck     = `ADD CONSTRAINT "%s_schema_chk" CHECK (JSON_SCHEMA_VALID('%s', data))`
+	ddlDropSchemaCheck = `DROP CHECK "%s_schema_chk"`
+	sqlConstraintCount = `SELECT COUNT(*) FROM information_schema.TABLE_CONSTRAINTS WHERE TABLE_SCHEMA = COALESCE(NULLIF($1, ''), DATABASE()) AND TABLE_NAME = $2 AND CONSTRAINT_NAME = $3`
+)
+
+// endregion
+
+// region Document validation methods ----------------------------------------------------------------------------------
+
+// SetJsonSchema set the Json Schema of the entity documents (empty to remove), the marshalled document is validated on
+// every write and invalid writes are rejected with ValidationError. The in-place updates of single entity (SetField,
+// IncrementField, Patch, JsonPatch and the array operations) are applied in memory and the updated document is
+// validated, the multi-row updates (BulkSetFields and query SetFields) are not validated on the client side (see
+// EnforceJsonSchema).
+// The client side validation supports: type, enum, const, required, properties, additionalProperties, items, minItems,
+// maxItems, minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum and exclusiveMaximum (other keywords are
+// enforced only by the server side constraint, see EnforceJsonSchema)
+//
+// param: factory - Entity factory
+// param: schema - The Json Schema
+// return: error
+func (dbs *MySqlDatabase) SetJsonSchema(factory EntityFactory, schema string) error {
+	var compiled map[string]any
+	if schema != "" {
+		if err := json.Unmarshal([]byte(schema), &compiled); err != nil {
+			return fmt.Errorf("invalid json schema: %w", err)
+		}
+	}
+
+	v := dbs.documentValidation(factory().TABLE())
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	v.schema, v.compiled = schema, compiled
+	return nil
+}
+
+// AddValidator add custom validation function of the entity documents, invalid writes are rejected with ValidationError
+// (the same writes are validated as of SetJsonSchema)
+//
+// param: factory - Entity factory
+// param: validator - The validation function
+func (dbs *MySqlDatabase) AddValidator(factory EntityFactory, validator DocumentValidator) {
+	v := dbs.documentValidation(factory().TABLE())
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	v.validators = append(v.validators, validator)
+}
+
+// EnforceJsonSchema enforce the entity Json Schema (see SetJsonSchema) on the server side by CHECK constraint on the
+// entity table (replacing the previous constraint), so writes which bypass the package (e.g. raw SQL) are rejected too.
+// Requires MySQL 8.0.17 or later, and is not applicable to encrypted documents
+//
+// param: factory - Entity factory
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) EnforceJsonSchema(factory EntityFactory, keys ...string) (err error) {
+	template := factory().TABLE()
+	schema := dbs.jsonSchema(template)
+	if schema == "" {
+		return fmt.Errorf("json schema of %s is not set", template)
+	}
+
+	table, err := dbs.resolveTable(template, keys...)
+	if err != nil {
+		return
+	}
+
+	var count int
+	if err = dbs.scalar(table, sqlConstraintCount, schemaArgs(table, baseName(table)+"_schema_chk"), &count); err != nil {
+		return
+	}
+
+	literal := strings.ReplaceAll(strings.ReplaceAll(schema, `\`, `\\`), `'`, `''`)
+	alter := fmt.Sprintf(ddlSchemaCheck, baseName(table), literal)
+	if count > 0 {
+		alter = fmt.Sprintf("%s, %s", fmt.Sprintf(ddlDropSchemaCheck, baseName(table)), alter)
+	}
+	return dbs.AlterTable(table, alter)
+}
+
+// ValidateDocument validate the Json document against the Json Schema (the supported keywords, see SetJsonSchema)
+//
+// param: schema - The Json Schema
+// param: document - The Json document
+// return: List of violations (empty if valid), error if the schema or the document are not valid Json
+func ValidateDocument(schema, document []byte) ([]Violation, error) {
+	var compiled map[string]any
+	if err := json.Unmarshal(schema, &compiled); err != nil {
+		return nil, fmt.Errorf("invalid json schema: %w", err)
+	}
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return validateSchema(compiled, doc, ""), nil
+}
+
+// documentValidation returns the validation of the table template (created if not exists)
+func (dbs *MySqlDatabase) documentValidation(template string) *documentValidation {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if dbs.validations == nil {
+		dbs.validations = make(map[string]*documentValidation)
+	}
+	v, ok := dbs.validations[template]
+	if !ok {
+		v = &documentValidation{}
+		dbs.validations[template] = v
+	}
+	return v
+}
+
+// jsonSchema returns the Json Schema of the table template (empty if not set)
+func (dbs *MySqlDatabase) jsonSchema(template string) string {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	if v, ok := dbs.validations[template]; ok {
+		return v.schema
+	}
+	return ""
+}
+
+// validating check if any validation (Json Schema or custom validator) is registered for the table template
+func (dbs *MySqlDatabase) validating(template string) bool {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	v, ok := dbs.validations[template]
+	return ok && (v.compiled != nil || len(v.validators) > 0)
+}
+
+// validate the marshalled entity document, returns ValidationError if invalid (nil if no validation is registered)
+func (dbs *MySqlDatabase) validate(template, id string, data []byte) error {
+	dbs.mu.RLock()
+	v, ok := dbs.validations[template]
+	var compiled map[string]any
+	var validators []DocumentValidator
+	if ok {
+		compiled, validators = v.compiled, v.validators
+	}
+	dbs.mu.RUnlock()
+
+	if compiled == nil && len(validators) == 0 {
+		return nil
+	}
+
+	doc := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return err
+	}
+
+	violations := make([]Violation, 0)
+	if compiled != nil {
+		violations = append(violations, validateSchema(compiled, doc, "")...)
+	}
+	for _, validator := range validators {
+		violations = append(violations, validator(doc)...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Table: template, Id: id, Violations: violations}
+}
+
+// endregion
+
+// region Json Schema validation ---------------------------------------------------------------------------------------
+
+// validateSchema validate the value against the schema (the supported keywords)
+func validateSchema(schema map[string]any, value any, path string) []Violation {
+	violations := make([]Violation, 0)
+	fail := func(rule, format string, args ...any) {
+		violations = append(violations, Violation{Field: path, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t, ok := schema["type"]; ok && !matchesType(t, value) {
+		fail("type", "expected %v", t)
+		return violations
+	}
+	if enum, ok := schema["enum"].([]any); ok && !containsJson(enum, value) {
+		fail("enum", "value is not one of %v", enum)
+	}
+	if c, ok := schema["const"]; ok && !containsJson([]any{c}, value) {
+		fail("const", "value must be %v", c)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if required, ok := schema["required"].([]any); ok {
+			for _, field := range required {
+				if _, exists := v[fmt.Sprintf("%v", field)]; !exists {
+					violations = append(violations, Violation{Field: joinPath(path, fmt.Sprintf("%v", field)), Rule: "required", Message: "field is required"})
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if sub, ok := properties[name].(map[string]any); ok {
+				violations = append(violations, validateSchema(sub, v[name], joinPath(path, name))...)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				violations = append(violations, Violation{Field: joinPath(path, name), Rule: "additionalProperties", Message: "field is not allowed"})
+			}
+		}
+	case []any:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			fail("minItems", "at least %v items are required", n)
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			fail("maxItems", "at most %v items are allowed", n)
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				violations = append(violations, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			fail("minLength", "length must be at least %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			fail("maxLength", "length must be at most %v", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if rex, err := regexp.Compile(pattern); err == nil && !rex.MatchString(v) {
+				fail("pattern", "value does not match %s", pattern)
+			}
+		}
+	case json.Number:
+		f, _ := v.Float64()
+		if n, ok := schemaNumber(schema, "minimum"); ok && f < n {
+			fail("minimum", "value must be >= %v", n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && f > n {
+			fail("maximum", "value must be <= %v", n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMinimum"); ok && f <= n {
+			fail("exclusiveMinimum", "value must be > %v", n)
+		}
+		if n, ok := schemaNumber(schema, "exclusiveMaximum"); ok && f >= n {
+			fail("exclusiveMaximum", "value must be < %v", n)
+		}
+	}
+	return violations
+}
+
+// matchesType returns true if the value matches the schema type (single type or list of types)
+func matchesType(t any, value any) bool {
+	if list, ok := t.([]any); ok {
+		for _, item := range list {
+			if matchesType(item, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch t {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		return err == nil && f == float64(int64(f))
+	}
+	return true
+}
+
+// containsJson returns true if the list contains the value (compared by Json encoding)
+func containsJson(list []any, value any) bool {
+	encoded, _ := json.Marshal(value)
+	for _, item := range list {
+		if e, _ := json.Marshal(item); bytes.Equal(e, encoded) {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaNumber returns the numeric keyword of the schema
+func schemaNumber(schema map[string]any, keyword string) (float64, bool) {
+	n, ok := schema[keyword].(float64)
+	return n, ok
+}
+
+// joinPath returns the path of the field
+func joinPath(path, field string) string {
+	if path == "" {
+		return field
+	}
+	return path + "." + field
+}
+
+// endregion
@@ -0,0 +1,186 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Verify definitions -------------------------------------------------------------------------------------------
+
+// Integrity issue kinds
+const (
+	IssueDecode     = "decode"      // The document fails to unmarshal into the entity
+	IssueIdMismatch = "id_mismatch" // The id column differs from the document id field
+)
+
+// VerifyOptions configures the table integrity scan
+type VerifyOptions struct {
+	Keys       []string          // Sharding key(s) of the table
+	BatchSize  int               // Number of rows to read in each batch (default: 500)
+	Repair     bool              // Fix id mismatch by setting the document id to the id column
+	Quarantine bool              // Move undecodable rows to the quarantine table ({table}_quarantine)
+	OnIssue    func(VerifyIssue) // Optional callback on every issue found
+}
+
+// VerifyIssue is a single integrity issue
+type VerifyIssue struct {
+	Id     string // The row id
+	Kind   string // The issue kind: decode or id_mismatch
+	Error  string // The issue details
+	Action string // The applied action: repaired, quarantined or empty
+}
+
+// VerifyReport is the result of the table integrity scan
+type VerifyReport struct {
+	Table       string        // The physical table
+	Scanned     int64         // Number of scanned rows
+	Issues      []VerifyIssue // The issues found
+	Repaired    int64         // Number of repaired rows
+	Quarantined int64         // Number of quarantined rows
+}
+
+const (
+	sqlVerifyBatch      = `SELECT id, data FROM "%s" WHERE id > $1 ORDER BY id LIMIT %d`
+	ddlQuarantineTable  = `CREATE TABLE IF NOT EXISTS "%s" (id VARCHAR(255) PRIMARY KEY NOT NULL, data LONGBLOB, error TEXT, quarantined_on BIGINT NOT NULL)`
+	sqlQuarantineInsert = `REPLACE INTO "%s" (id, data, error, quarantined_on) VALUES ($1, $2, $3, $4)`
+)
+
+// endregion
+
+// region Verify methods -----------------------------------------------------------------------------------------------
+
+// VerifyTable scan the entity table and detect documents which fail to unmarshal or whose id column differs from the
+// document id, the issues are reported and optionally repaired (id mismatch) or quarantined (undecodable rows are moved
+// to the {table}_quarantine table)
+//
+// param: factory - Entity factory
+// param: opts - Verify options
+// return: Verify report, error
+func (dbs *MySqlDatabase) VerifyTable(factory EntityFactory, opts VerifyOptions) (report VerifyReport, err error) {
+	defer dbs.observe("verify", factory().TABLE(), 0, time.Now(), nil, &err)
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if report.Table, err = dbs.resolveTable(factory().TABLE(), opts.Keys...); err != nil {
+		return
+	}
+	report.Issues = make([]VerifyIssue, 0)
+	tenant := tenantOf(opts.Keys...)
+
+	lastId := ""
+	for {
+		docs, er := dbs.verifyBatch(report.Table, tenant, lastId, opts.BatchSize)
+		if er != nil {
+			return report, er
+		}
+		for _, doc := range docs {
+			report.Scanned++
+			issue := dbs.verifyDocument(factory, doc)
+			if issue == nil {
+				continue
+			}
+			if issue.Action, er = dbs.fixDocument(factory, report.Table, tenant, doc, issue, opts); er != nil {
+				return report, er
+			}
+			switch issue.Action {
+			case "repaired":
+				report.Repaired++
+			case "quarantined":
+				report.Quarantined++
+			}
+			report.Issues = append(report.Issues, *issue)
+			if opts.OnIssue != nil {
+				opts.OnIssue(*issue)
+			}
+		}
+		if len(docs) < opts.BatchSize {
+			return report, nil
+		}
+		lastId = docs[len(docs)-1].Id
+	}
+}
+
+// verifyBatch read the next batch of documents by id order
+func (dbs *MySqlDatabase) verifyBatch(table, tenant, lastId string, limit int) ([]JsonDoc, error) {
+	rows, err := dbs.query(dbs.pgDb, table, tenant, fmt.Sprintf(sqlVerifyBatch, table, limit), lastId)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	docs := make([]JsonDoc, 0, limit)
+	for rows.Next() {
+		doc := JsonDoc{}
+		if err = rows.Scan(&doc.Id, &doc.Data); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// verifyDocument returns the integrity issue of the document (nil if valid)
+func (dbs *MySqlDatabase) verifyDocument(factory EntityFactory, doc JsonDoc) *VerifyIssue {
+	entity, err := dbs.unmarshal(factory, []byte(doc.Data))
+	if err != nil {
+		return &VerifyIssue{Id: doc.Id, Kind: IssueDecode, Error: err.Error()}
+	}
+	if entity.ID() != doc.Id {
+		return &VerifyIssue{Id: doc.Id, Kind: IssueIdMismatch, Error: fmt.Sprintf("document id: %s", entity.ID())}
+	}
+	return nil
+}
+
+// fixDocument apply the repair or quarantine action of the issue (if enabled)
+func (dbs *MySqlDatabase) fixDocument(factory EntityFactory, table, tenant string, doc JsonDoc, issue *VerifyIssue, opts VerifyOptions) (string, error) {
+	switch {
+	case issue.Kind == IssueIdMismatch && opts.Repair:
+		entity, err := dbs.unmarshal(factory, []byte(doc.Data))
+		if err != nil {
+			return "", err
+		}
+		if err = json.Unmarshal([]byte(fmt.Sprintf(`{"id":%q}`, doc.Id)), entity); err != nil {
+			return "", err
+		}
+		data, err := dbs.marshal(entity, table)
+		if err != nil {
+			return "", err
+		}
+		if _, err = dbs.exec(dbs.pgDb, table, tenant, fmt.Sprintf(sqlUpdate, table), doc.Id, data); err != nil {
+			return "", err
+		}
+		return "repaired", nil
+
+	case issue.Kind == IssueDecode && opts.Quarantine:
+		quarantine := table + "_quarantine"
+		if _, err := dbs.exec(dbs.pgDb, quarantine, tenant, fmt.Sprintf(ddlQuarantineTable, quarantine)); err != nil {
+			return "", err
+		}
+		var (
+			tx  *sql.Tx
+			err error
+		)
+		if tx, err = dbs.pgDb.Begin(); err != nil {
+			return "", err
+		}
+		if _, err = dbs.exec(tx, quarantine, tenant, fmt.Sprintf(sqlQuarantineInsert, quarantine), doc.Id, doc.Data, issue.Error, dbs.now().UnixMilli()); err == nil {
+			_, err = dbs.exec(tx, table, tenant, fmt.Sprintf(sqlDelete, table), doc.Id)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return "", err
+		}
+		if err = tx.Commit(); err != nil {
+			return "", err
+		}
+		return "quarantined", nil
+	}
+	return "", nil
+}
+
+// endregion
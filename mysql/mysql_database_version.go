@@ -0,0 +1,161 @@
+package mysql
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Optimistic locking definitions -------------------------------------------------------------------------------
+
+// ErrConcurrentModification is the sentinel of ConcurrentModificationError (use errors.Is)
+var ErrConcurrentModification = errors.New("concurrent modification")
+
+// ConcurrentModificationError is returned by Update and Upsert of versioned entity when the stored version differs from
+// the entity version, and by UpdateIfUnchanged when the stored document hash differs from the expected hash (the entity
+// was modified by another writer since it was read)
+type ConcurrentModificationError struct {
+	Table   string // The entity physical table
+	Id      string // The entity id
+	Version int64  // The (stale) entity version
+	Hash    string // The (stale) document hash (UpdateIfUnchanged)
+}
+
+// Error returns the error message
+func (e *ConcurrentModificationError) Error() string {
+	if e.Hash != "" {
+		return fmt.Sprintf("%s: entity %s of table %s was modified since hash %s", ErrConcurrentModification.Error(), e.Id, e.Table, e.Hash)
+	}
+	return fmt.Sprintf("%s: entity %s of table %s was modified since version %d", ErrConcurrentModification.Error(), e.Id, e.Table, e.Version)
+}
+
+// Unwrap returns the ErrConcurrentModification sentinel
+func (e *ConcurrentModificationError) Unwrap() error {
+	return ErrConcurrentModification
+}
+
+const (
+	sqlUpdateVersioned = `UPDATE "%s" SET data = $2 WHERE id = $1 AND COALESCE(data->>'%s', '0') = $3`
+	sqlUpsertVersioned = `INSERT INTO "%s" (id, data) VALUES ($1, $2) ON CONFLICT (id) DO UPDATE SET data = $2 WHERE COALESCE("%s".data->>'%s', '0') = $3`
+)
+
+// endregion
+
+// region Optimistic locking methods -----------------------------------------------------------------------------------
+
+// SetVersionField enable optimistic locking of the entity table by the version field (empty to disable): Insert sets the
+// version to 1, Update and Upsert succeed only if the stored version equals the entity version and increment it
+// (the entity field is updated), otherwise ConcurrentModificationError is returned.
+// Bulk operations and field updates (SetField, SetFields) do not check or increment the version.
+//
+// param: factory - Entity factory
+// param: field - The version field (integer Json field)
+// return: error
+func (dbs *MySqlDatabase) SetVersionField(factory EntityFactory, field string) error {
+	if field != "" {
+		if err := validateFields(field); err != nil {
+			return err
+		}
+	}
+
+	template := factory().TABLE()
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if field == "" {
+		delete(dbs.versions, template)
+		return nil
+	}
+	if dbs.versions == nil {
+		dbs.versions = make(map[string]string)
+	}
+	dbs.versions[template] = field
+	return nil
+}
+
+// versionField returns the version field of the table template (empty if optimistic locking is disabled)
+func (dbs *MySqlDatabase) versionField(template string) string {
+	dbs.mu.RLock()
+	defer dbs.mu.RUnlock()
+	return dbs.versions[template]
+}
+
+// entityVersion returns the version of the entity (0 if not set)
+func entityVersion(entity Entity, field string) (int64, error) {
+	data, err := json.Marshal(entity)
+	if err != nil {
+		return 0, err
+	}
+	doc := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&doc); err != nil {
+		return 0, err
+	}
+	if value, ok := doc[field].(json.Number); ok {
+		return value.Int64()
+	}
+	return 0, nil
+}
+
+// setEntityVersion set the version field of the entity
+func setEntityVersion(entity Entity, field string, version int64) error {
+	return json.Unmarshal([]byte(fmt.Sprintf(`{%q:%d}`, field, version)), entity)
+}
+
+// versionedStatement returns the update (or upsert) statement and its arguments, for versioned entity the statement
+// checks the stored version and the entity version is incremented, the returned restore function reverts it (nil if
+// optimistic locking is disabled)
+func (dbs *MySqlDatabase) versionedStatement(upsert bool, entity Entity, table string) (SQL string, args []any, restore func(), err error) {
+	field := dbs.versionField(entity.TABLE())
+	if field == "" {
+		if upsert {
+			return fmt.Sprintf(sqlUpsert, table), nil, nil, nil
+		}
+		return fmt.Sprintf(sqlUpdate, table), nil, nil, nil
+	}
+
+	version, err := entityVersion(entity, field)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if err = setEntityVersion(entity, field, version+1); err != nil {
+		return "", nil, nil, err
+	}
+	restore = func() { _ = setEntityVersion(entity, field, version) }
+
+	if upsert {
+		SQL = fmt.Sprintf(sqlUpsertVersioned, table, table, field)
+	} else {
+		SQL = fmt.Sprintf(sqlUpdateVersioned, table, field)
+	}
+	return SQL, []any{strconv.FormatInt(version, 10)}, restore, nil
+}
+
+// concurrentModification returns the error of versioned update which affected no row (nil if the entity is not versioned)
+func (dbs *MySqlDatabase) concurrentModification(entity Entity, table string) error {
+	field := dbs.versionField(entity.TABLE())
+	if field == "" {
+		return nil
+	}
+	version, _ := entityVersion(entity, field)
+	return &ConcurrentModificationError{Table: table, Id: entity.ID(), Version: version - 1}
+}
+
+// initVersion set the version of new versioned entity to 1 (if not set)
+func (dbs *MySqlDatabase) initVersion(entity Entity) error {
+	field := dbs.versionField(entity.TABLE())
+	if field == "" {
+		return nil
+	}
+	if version, err := entityVersion(entity, field); err != nil || version > 0 {
+		return err
+	}
+	return setEntityVersion(entity, field, 1)
+}
+
+// endregion
@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-yaaf/yaaf-common/database"
+)
+
+// region Database view methods ----------------------------------------------------------------------------------------
+
+const (
+	ddlCreateView = `CREATE OR REPLACE VIEW "%s" AS SELECT id, %s FROM "%s" %s`
+	ddlDropView   = `DROP VIEW IF EXISTS "%s"`
+)
+
+// CreateView Create (or replace) SQL view from the query builder criteria
+// Each of the entity fields is extracted from the json document to a plain column with the field name,
+// so BI tools can read the entity data without knowing the json layout
+//
+// param: name - The view name
+// param: query - Query built by this database Query() method
+// param: fields - List of entity fields to expose as view columns
+// param: keys - Sharding key(s) (for sharded entities and multi-tenant support)
+// return: error
+func (dbs *MySqlDatabase) CreateView(name string, query database.IQuery, fields []string, keys ...string) (err error) {
+
+	q, ok := query.(*mSqlDatabaseQuery)
+	if !ok {
+		return fmt.Errorf("query was not created by the mysql database")
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one field is required to create view: %s", name)
+	}
+
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if column, exists := dbs.promotedColumn(q.factory().TABLE(), field); exists {
+			columns = append(columns, fmt.Sprintf(`%s AS "%s"`, column, field))
+		} else {
+			columns = append(columns, fmt.Sprintf(`JSON_UNQUOTE(JSON_EXTRACT(data, '$.%s')) AS "%s"`, field, field))
+		}
+	}
+
+	// A view can't have parameters, so the query arguments are embedded as literals
+	where, args := q.buildCriteria()
+	where = inlineArgs(where, args)
+
+	table, err := dbs.resolveTable(q.factory().TABLE(), keys...)
+	if err != nil {
+		return
+	}
+	SQL := fmt.Sprintf(ddlCreateView, name, strings.Join(columns, ", "), table, where)
+	if _, err = dbs.exec(dbs.pgDb, table, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+	}
+	return
+}
+
+// DropView Drop SQL view
+//
+// param: name - The view name
+// return: error
+func (dbs *MySqlDatabase) DropView(name string) (err error) {
+	SQL := fmt.Sprintf(ddlDropView, name)
+	if _, err = dbs.exec(dbs.pgDb, name, "", SQL); err != nil {
+		dbs.log().Error("%s error: %s", SQL, err.Error())
+	}
+	return
+}
+
+// inlineArgs replace the positional placeholders ($1..$n) with the SQL literal of the arguments
+func inlineArgs(SQL string, args []any) string {
+	// Replace from the last placeholder, so $1 will not match the prefix of $10
+	for i := len(args); i > 0; i-- {
+		SQL = strings.Replace(SQL, fmt.Sprintf("$%d", i), sqlLiteral(args[i-1]), -1)
+	}
+	return SQL
+}
+
+// sqlLiteral returns the SQL literal representation of the value
+func sqlLiteral(value any) string {
+	if value == nil {
+		return "NULL"
+	}
+
+	switch v := value.(type) {
+	case string:
+		return quoteString(v)
+	case []byte:
+		return quoteString(string(v))
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]string, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			items = append(items, sqlLiteral(rv.Index(i).Interface()))
+		}
+		return fmt.Sprintf("(%s)", strings.Join(items, ", "))
+	case reflect.String:
+		return quoteString(rv.String())
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// quoteString returns quoted and escaped SQL string literal
+func quoteString(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `'`, `''`, -1)
+	return fmt.Sprintf("'%s'", value)
+}
+
+// endregion
@@ -0,0 +1,128 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Warmup definitions -------------------------------------------------------------------------------------------
+
+// warmupStatements are the hot statements of entity table prepared by Warmup
+var warmupStatements = []string{
+	`SELECT id, data FROM "%s" WHERE id = $1`,
+	`SELECT id FROM "%s" WHERE id = $1`,
+	`SELECT id, data FROM "%s" WHERE id = ANY($1)`,
+	sqlInsert,
+	sqlUpdate,
+	sqlUpsert,
+	sqlDelete,
+}
+
+// endregion
+
+// region Warmup methods -----------------------------------------------------------------------------------------------
+
+// SetSessionInit set the session initialization statements (e.g. SET time_zone = '+00:00') run by Warmup on every
+// warmed connection. Connections opened later by the pool are not initialized, settings required by every session
+// should be set in the connection string
+//
+// param: statements - List of session statements (empty to disable)
+func (dbs *MySqlDatabase) SetSessionInit(statements ...string) {
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.sessionInit = statements
+}
+
+// SetWarmupEntities register the entity types whose hot statements (get, exists, list, insert, update, upsert and
+// delete) are prepared by Warmup. Sharded entity tables are skipped since their table names depend on the shard keys
+//
+// param: factories - List of entity factories
+func (dbs *MySqlDatabase) SetWarmupEntities(factories ...EntityFactory) {
+	templates := make([]string, 0, len(factories))
+	for _, factory := range factories {
+		templates = append(templates, factory().TABLE())
+	}
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+	dbs.warmup = templates
+}
+
+// Warmup pre-open n connections of the pool, run the session initialization statements (see SetSessionInit) and
+// prepare the hot statements of the registered entity tables (see SetWarmupEntities) on every connection, so the
+// first requests after deploy don't pay for the connection handshake and cold server caches. The pool must allow
+// at least n idle connections (see DBConfig.MaxIdleConns) to keep the warmed connections open
+//
+// param: ctx - Context to cancel the warmup
+// param: n - Number of connections to warm
+// return: error
+func (dbs *MySqlDatabase) Warmup(ctx context.Context, n int) (err error) {
+	defer dbs.observe("warmup", "", n, time.Now(), nil, &err)
+
+	dbs.mu.RLock()
+	init := append([]string{}, dbs.sessionInit...)
+	templates := append([]string{}, dbs.warmup...)
+	dbs.mu.RUnlock()
+
+	statements := make([]string, 0, len(templates)*len(warmupStatements))
+	for _, template := range templates {
+		if strings.Contains(template, "{{") {
+			continue
+		}
+		table, er := dbs.resolveTable(template)
+		if er != nil {
+			dbs.log().Debug("warmup %s skipped: %s", template, er.Error())
+			continue
+		}
+		for _, statement := range warmupStatements {
+			statements = append(statements, fmt.Sprintf(statement, table))
+		}
+	}
+
+	// hold all the connections until done, so every warmup runs on a different connection
+	conns := make([]*sql.Conn, 0, n)
+	defer func() {
+		for _, conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		conn, er := dbs.pgDb.Conn(ctx)
+		if er != nil {
+			return er
+		}
+		conns = append(conns, conn)
+		if err = dbs.warmConnection(ctx, conn, init, statements); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warmConnection ping the connection, run the session statements and prepare the hot statements on it
+func (dbs *MySqlDatabase) warmConnection(ctx context.Context, conn *sql.Conn, init, statements []string) error {
+	if err := conn.PingContext(ctx); err != nil {
+		return err
+	}
+	for _, statement := range init {
+		if _, err := dbs.exec(connRunner{conn: conn}, "", "", statement); err != nil {
+			return fmt.Errorf("session init statement %s: %w", statement, err)
+		}
+	}
+	for _, statement := range statements {
+		stmt, err := conn.PrepareContext(ctx, statement)
+		if err != nil {
+			return fmt.Errorf("prepare statement %s: %w", statement, err)
+		}
+		_ = stmt.Close()
+	}
+	return ctx.Err()
+}
+
+// endregion
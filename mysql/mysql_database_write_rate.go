@@ -0,0 +1,180 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	. "github.com/go-yaaf/yaaf-common/entity"
+)
+
+// region Write rate limit definitions ---------------------------------------------------------------------------------
+
+// ErrWriteRateExceeded is the sentinel of WriteRateError (use errors.Is)
+var ErrWriteRateExceeded = errors.New("write rate exceeded")
+
+// WriteRateError is returned by mutations rejected by the write rate limit (non-blocking limit, or the wait for tokens
+// exceeds the maximum wait)
+type WriteRateError struct {
+	Table string  // The entity table template (empty for the global limit)
+	Rate  float64 // The write rate limit (rows per second)
+	Rows  int     // The number of rows of the rejected mutation
+}
+
+// Error returns the error message
+func (e *WriteRateError) Error() string {
+	if e.Table == "" {
+		return fmt.Sprintf("%s: %d rows exceed the global limit of %g rows/s", ErrWriteRateExceeded.Error(), e.Rows, e.Rate)
+	}
+	return fmt.Sprintf("%s: %d rows exceed the limit of %g rows/s of %s", ErrWriteRateExceeded.Error(), e.Rows, e.Rate, e.Table)
+}
+
+// Unwrap returns the ErrWriteRateExceeded sentinel
+func (e *WriteRateError) Unwrap() error {
+	return ErrWriteRateExceeded
+}
+
+// WriteRateOptions configures the write rate limit (token bucket)
+type WriteRateOptions struct {
+	Rate    float64       // Sustained write rate (rows per second), 0 to disable the limit
+	Burst   int           // Maximum rows written at once above the rate (default: the rate)
+	Block   bool          // Wait for tokens (backpressure) instead of failing with WriteRateError
+	MaxWait time.Duration // Maximum wait of blocking limit, longer waits fail with WriteRateError (0 for no maximum)
+}
+
+// tokenBucket is the token bucket of single write rate limit
+type tokenBucket struct {
+	mu      sync.Mutex
+	table   string
+	options WriteRateOptions
+	tokens  float64
+	last    time.Time
+}
+
+// endregion
+
+// region Write rate limit methods -------------------------------------------------------------------------------------
+
+// SetWriteRate limit the rate of the entity mutations (rows per second) of the entity table, or of all the tables, so
+// bulk jobs sharing the connection pool with online traffic can't saturate the server. Bulk operations consume a token
+// per row, batches larger than the burst are admitted when the bucket is full and the debt is paid by the next writes.
+// Query Delete and SetFields are admitted with a single token and charged for the affected rows after the fact.
+//
+// param: factory - Entity factory (nil for the global limit of all the tables)
+// param: options - Write rate options
+func (dbs *MySqlDatabase) SetWriteRate(factory EntityFactory, options WriteRateOptions) {
+	template := ""
+	if factory != nil {
+		template = factory().TABLE()
+	}
+	if options.Burst <= 0 {
+		options.Burst = int(math.Max(1, math.Ceil(options.Rate)))
+	}
+
+	dbs.mu.Lock()
+	defer dbs.mu.Unlock()
+
+	if options.Rate <= 0 {
+		delete(dbs.writeRates, template)
+		return
+	}
+	if dbs.writeRates == nil {
+		dbs.writeRates = make(map[string]*tokenBucket)
+	}
+	dbs.writeRates[template] = &tokenBucket{table: template, options: options, tokens: float64(options.Burst), last: time.Now()}
+}
+
+// admitWrite consume the tokens of the mutation rows from the table and the global limits, wait for the tokens of
+// blocking limits and returns WriteRateError if the mutation is rejected
+func (dbs *MySqlDatabase) admitWrite(template string, rows int) error {
+	dbs.mu.RLock()
+	buckets := make([]*tokenBucket, 0, 2)
+	for _, key := range []string{template, ""} {
+		if bucket, ok := dbs.writeRates[key]; ok {
+			buckets = append(buckets, bucket)
+		}
+	}
+	dbs.mu.RUnlock()
+
+	if rows < 1 {
+		rows = 1
+	}
+
+	wait := time.Duration(0)
+	for _, bucket := range buckets {
+		delay, ok := bucket.reserve(rows, time.Now())
+		if !ok {
+			return &WriteRateError{Table: bucket.table, Rate: bucket.options.Rate, Rows: rows}
+		}
+		if delay > wait {
+			wait = delay
+		}
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// chargeWrite consume the tokens of the rows written by a mutation whose rows are known only after it was executed
+// (e.g. query Delete and SetFields which are admitted with a single token), the debt is paid by the next writes
+func (dbs *MySqlDatabase) chargeWrite(template string, rows int64) {
+	if rows <= 1 {
+		return
+	}
+	dbs.mu.RLock()
+	buckets := make([]*tokenBucket, 0, 2)
+	for _, key := range []string{template, ""} {
+		if bucket, ok := dbs.writeRates[key]; ok {
+			buckets = append(buckets, bucket)
+		}
+	}
+	dbs.mu.RUnlock()
+
+	for _, bucket := range buckets {
+		bucket.charge(float64(rows-1), time.Now())
+	}
+}
+
+// charge consume the tokens without waiting or rejecting (the bucket may go into debt)
+func (b *tokenBucket) charge(tokens float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tokens = math.Min(float64(b.options.Burst), b.tokens+now.Sub(b.last).Seconds()*b.options.Rate) - tokens
+	b.last = now
+}
+
+// reserve consume the tokens of the rows and returns the time to wait for them, or false if the rows are rejected
+func (b *tokenBucket) reserve(rows int, now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	burst := float64(b.options.Burst)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*b.options.Rate)
+	b.last = now
+
+	need := float64(rows)
+	if !b.options.Block {
+		if b.tokens < math.Min(need, burst) {
+			return 0, false
+		}
+		b.tokens -= need
+		return 0, true
+	}
+
+	b.tokens -= need
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	wait := time.Duration(-b.tokens / b.options.Rate * float64(time.Second))
+	if b.options.MaxWait > 0 && wait > b.options.MaxWait {
+		b.tokens += need
+		return wait, false
+	}
+	return wait, true
+}
+
+// endregion
@@ -0,0 +1,198 @@
+// Package mysqltest provides integration test harness running MySQL server in a docker container
+//
+// Example:
+//
+//	func TestHeroRepository(t *testing.T) {
+//		mysqltest.Run(t, mysqltest.Options{DDL: map[string][]string{"hero": {"name"}}}, func(t *testing.T, db *mysql.MySqlDatabase) {
+//			...
+//		})
+//	}
+//
+// The version matrix can be overridden by the MYSQLTEST_VERSIONS environment variable (comma separated image tags),
+// tests are skipped when docker is not available.
+package mysqltest
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+)
+
+// region Harness definitions ------------------------------------------------------------------------------------------
+
+// Options configures the MySQL container
+type Options struct {
+	Image          string              // Docker image (default: mysql)
+	Versions       []string            // Image tags to run the tests against (default: 8.0)
+	Database       string              // Database name (default: test)
+	Password       string              // Root password (default: secret)
+	DDL            map[string][]string // Tables and indexed fields to create before running the test
+	Fixtures       fs.FS               // File system of the fixture files to load after applying the DDL (optional)
+	FixturesGlob   string              // Glob pattern of the fixture files (default: *.json)
+	StartupTimeout time.Duration       // Max time to wait for the server to accept connections (default: 2 minutes)
+}
+
+// Container is a running MySQL container
+type Container struct {
+	ID  string // Docker container id
+	URI string // Connection URI of the database
+}
+
+// withDefaults returns the options with the default values of missing fields
+func (o Options) withDefaults() Options {
+	if o.Image == "" {
+		o.Image = "mysql"
+	}
+	if env := os.Getenv("MYSQLTEST_VERSIONS"); env != "" {
+		o.Versions = strings.Split(env, ",")
+	}
+	if len(o.Versions) == 0 {
+		o.Versions = []string{"8.0"}
+	}
+	if o.Database == "" {
+		o.Database = "test"
+	}
+	if o.Password == "" {
+		o.Password = "secret"
+	}
+	if o.FixturesGlob == "" {
+		o.FixturesGlob = "*.json"
+	}
+	if o.StartupTimeout <= 0 {
+		o.StartupTimeout = 2 * time.Minute
+	}
+	return o
+}
+
+// endregion
+
+// region Harness methods ----------------------------------------------------------------------------------------------
+
+// Run the test function against a fresh MySQL container of every version in the matrix (as sub-tests)
+//
+// param: t - The test
+// param: options - Container options
+// param: fn - The test function
+func Run(t *testing.T, options Options, fn func(t *testing.T, db *mysql.MySqlDatabase)) {
+	options = options.withDefaults()
+	for _, version := range options.Versions {
+		version = strings.TrimSpace(version)
+		t.Run("mysql-"+version, func(t *testing.T) {
+			fn(t, Start(t, version, options))
+		})
+	}
+}
+
+// Start MySQL container of the version, apply the DDL and returns connected database
+// The container and the connection are removed when the test completes
+//
+// param: t - The test
+// param: version - Image tag
+// param: options - Container options
+// return: Connected database
+func Start(t testing.TB, version string, options Options) *mysql.MySqlDatabase {
+	t.Helper()
+	options = options.withDefaults()
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not available")
+	}
+
+	container, err := StartContainer(version, options)
+	if err != nil {
+		t.Fatalf("start mysql %s container: %s", version, err.Error())
+	}
+	t.Cleanup(func() { _ = container.Stop() })
+
+	db, err := connect(container.URI, options.StartupTimeout)
+	if err != nil {
+		t.Fatalf("connect to mysql %s container: %s", version, err.Error())
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	if len(options.DDL) > 0 {
+		if err = db.ExecuteDDL(options.DDL); err != nil {
+			t.Fatalf("apply DDL: %s", err.Error())
+		}
+	}
+	if options.Fixtures != nil {
+		if _, err = db.LoadFixtures(options.Fixtures, options.FixturesGlob); err != nil {
+			t.Fatalf("load fixtures: %s", err.Error())
+		}
+	}
+	return db
+}
+
+// StartContainer start MySQL container of the version, bound to random local port
+//
+// param: version - Image tag
+// param: options - Container options
+// return: Container, error
+func StartContainer(version string, options Options) (*Container, error) {
+	options = options.withDefaults()
+
+	id, err := docker("run", "-d", "--rm",
+		"-e", "MYSQL_ROOT_PASSWORD="+options.Password,
+		"-e", "MYSQL_DATABASE="+options.Database,
+		"-p", "127.0.0.1::3306",
+		fmt.Sprintf("%s:%s", options.Image, version))
+	if err != nil {
+		return nil, err
+	}
+
+	container := &Container{ID: id}
+	address, err := docker("port", id, "3306/tcp")
+	if err != nil {
+		_ = container.Stop()
+		return nil, err
+	}
+
+	// docker port may list both IPv4 and IPv6 bindings, use the first one
+	address = strings.Split(address, "\n")[0]
+	container.URI = fmt.Sprintf("mysql://root:%s@%s/%s", options.Password, address, options.Database)
+	return container, nil
+}
+
+// Stop and remove the container
+func (c *Container) Stop() error {
+	_, err := docker("rm", "-f", c.ID)
+	return err
+}
+
+// connect wait for the server to accept connections
+func connect(URI string, timeout time.Duration) (*mysql.MySqlDatabase, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		db, err := mysql.NewMySqlDatabase(URI)
+		if err == nil {
+			if err = db.Ping(1, 1); err == nil {
+				return db.(*mysql.MySqlDatabase), nil
+			}
+			_ = db.Close()
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// docker run docker command and returns its trimmed output
+func docker(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %s %s", args[0], err.Error(), strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// endregion
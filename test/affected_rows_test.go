@@ -0,0 +1,44 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoRowsAffected(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	// MySQL reports zero affected rows for unchanged rows (without found rows)
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if !stmt.Query && (strings.HasPrefix(stmt.SQL, "UPDATE") || strings.HasPrefix(stmt.SQL, "INSERT")) {
+				return &mysql.StatementResult{Result: driver.RowsAffected(0)}, nil
+			}
+			return next(stmt)
+		}
+	})
+
+	_, err := db.Upsert(NewHero1("1", 1, "Batman"))
+	require.NoError(t, err)
+
+	_, err = db.Update(NewHero1("1", 1, "Batman"))
+	require.True(t, errors.Is(err, mysql.ErrNoRowsAffected))
+	require.EqualError(t, err, "no row affected when executing update operation")
+
+	statements := recorder.Statements()
+	require.Equal(t, `SELECT data FROM "hero" WHERE id = $1`, statements[len(statements)-1].SQL)
+
+	uri, err := mysql.NewConfigBuilder().WithDatabase("app").WithFoundRows(true).URI()
+	require.NoError(t, err)
+	require.Equal(t, "mysql://localhost:3306/app?found_rows=true", uri)
+
+	cfg := mysql.DBConfig{Username: "u", Password: "p", Host: "localhost", Port: 3306, DBName: "app", TLS: "true", FoundRows: true}
+	require.Equal(t, "u:p@tcp(localhost:3306)/app?tls=true&clientFoundRows=true", cfg.ConnectionString())
+}
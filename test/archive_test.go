@@ -0,0 +1,49 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveTable(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("ORDER BY ts, id",
+		[]driver.Value{"1", int64(100), []byte(`{"id":"1","createdOn":100}`)},
+		[]driver.Value{"3", int64(200), []byte(`{"id":"3","createdOn":200}`)},
+	))
+
+	checkpoints := make([]mysql.ArchiveCheckpoint, 0)
+	buf := &bytes.Buffer{}
+	cp, err := db.ArchiveTable("hero", buf, mysql.ArchiveOptions{Before: time.UnixMilli(1000), BatchSize: 10, OnCheckpoint: func(cp mysql.ArchiveCheckpoint) error {
+		checkpoints = append(checkpoints, cp)
+		return nil
+	}})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), cp.Archived)
+	require.Equal(t, int64(1), cp.Deleted)
+	require.True(t, cp.Uploaded)
+	require.Empty(t, cp.Pending)
+	require.Equal(t, []string{"1", "3"}, checkpoints[0].Pending)
+
+	zr, err := gzip.NewReader(buf)
+	require.NoError(t, err)
+	archive, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Equal(t, 2, strings.Count(string(archive), "\n"))
+
+	// only the archived rows are deleted (rows written behind the checkpoint during the run are kept)
+	statements := recorder.Statements()
+	last := statements[len(statements)-1]
+	require.Equal(t, `DELETE FROM "hero" WHERE id = ANY($1)`, last.SQL)
+	require.Equal(t, []any{[]string{"1", "3"}}, last.Args)
+}
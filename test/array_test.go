@@ -0,0 +1,26 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayOperations(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	require.NoError(t, db.AddToArray(NewHero, "1", "tags", []any{"a", 2}))
+	require.NoError(t, db.AddToSet(NewHero, "1", "tags", []any{"b"}))
+	require.NoError(t, db.RemoveFromArray(NewHero, "1", "tags", []string{"50%_off"}))
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	require.Equal(t, `UPDATE "hero" SET data = JSON_ARRAY_APPEND(JSON_SET(data, '$.tags', COALESCE(JSON_EXTRACT(data, '$.tags'), JSON_ARRAY())), `+
+		`'$.tags', CAST($1 AS JSON), '$.tags', CAST($2 AS JSON)) WHERE id = $3`, statements[0].SQL)
+	require.Equal(t, []any{`"a"`, "2", "1"}, statements[0].Args)
+	require.Contains(t, statements[1].SQL, "NOT COALESCE(JSON_CONTAINS(JSON_EXTRACT(data, '$.tags'), CAST($1 AS JSON)), 0)")
+	require.Equal(t, []any{`50\%\_off`, "1"}, statements[2].Args)
+}
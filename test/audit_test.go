@@ -0,0 +1,47 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditNoRowsAffected(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.EnableAudit(&mysql.AuditOptions{Actor: func() string { return "tester" }})
+	db.SetHistory(NewHero, true)
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+	require.True(t, writesTo(recorder, "audit-global"))
+
+	// the update does not match any row: the audit entry and the prior version are not written
+	recorder.Reset()
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.HasPrefix(stmt.SQL, `UPDATE "hero"`) {
+				return &mysql.StatementResult{Result: driver.RowsAffected(0)}, nil
+			}
+			return next(stmt)
+		}
+	})
+	_, err = db.Update(NewHero1("2", 2, "Loki"))
+	require.Error(t, err)
+	require.False(t, writesTo(recorder, "audit-global"))
+	require.False(t, writesTo(recorder, "hero_history"))
+}
+
+// writesTo check if any of the recorded statements inserts into the table
+func writesTo(recorder *mysql.StatementRecorder, table string) bool {
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, "INSERT") && strings.Contains(stmt.SQL, table) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestoreTable(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	// Empty table backup is a valid (empty) archive
+	backup := &bytes.Buffer{}
+	count, err := db.BackupTable("hero", backup)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
+
+	backup.Reset()
+	zw := gzip.NewWriter(backup)
+	_, _ = zw.Write([]byte("{\"id\":\"1\",\"data\":{\"name\":\"Ant man\"}}\n{\"id\":\"2\",\"data\":{\"name\":\"Aqua man\"}}\n"))
+	require.NoError(t, zw.Close())
+
+	recorder.Reset()
+	count, err = db.RestoreTable("hero_restored", backup, mysql.RestoreOptions{BatchSize: 1})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	inserts := 0
+	for _, stmt := range recorder.Statements() {
+		if stmt.Table == "hero_restored" && stmt.InTx {
+			inserts++
+			require.JSONEq(t, `{"name":"Ant man"}`, string(stmt.Args[1].([]byte)))
+			break
+		}
+	}
+	require.Equal(t, 1, inserts)
+}
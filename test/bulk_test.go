@@ -0,0 +1,31 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkUpdateInTransaction(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	heroes := []Entity{NewHero1("1", 1, "Thor"), NewHero1("2", 2, "Loki")}
+
+	affected, err := db.BulkUpdate(heroes)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), affected)
+
+	affected, err = db.BulkUpsert(heroes)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), affected)
+
+	// every statement is executed within the transaction of the bulk operation
+	statements := recorder.Statements()
+	require.Len(t, statements, 4)
+	for _, stmt := range statements {
+		require.True(t, stmt.InTx, stmt.SQL)
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+type Account struct {
+	BaseEntity
+}
+
+func (a *Account) TABLE() string { return "suitecrm.accounts" }
+func NewAccount() Entity         { return &Account{} }
+
+func TestCatalogs(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	_, err := db.Insert(&Account{BaseEntity: BaseEntity{Id: "1"}})
+	require.NoError(t, err)
+
+	db.SetDefaultCatalog("app")
+	_, err = db.Get(NewHero, "1")
+	require.Error(t, err)
+
+	db.SetEntityCatalog(NewDevice, "iot")
+	_, err = db.Query(NewDevice).Count()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	require.Contains(t, statements[0].SQL, `INSERT INTO "suitecrm"."accounts"`)
+	require.Contains(t, statements[1].SQL, `FROM "app"."hero"`)
+	require.Contains(t, statements[2].SQL, `FROM "iot"."device"`)
+}
+
+func TestCatalogDDL(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("information_schema.COLUMNS", []driver.Value{int64(0)}))
+	db.EnableTimestampColumns(NewAccount)
+
+	require.NoError(t, db.CreatePromotedColumns(NewAccount))
+
+	// the qualified name is quoted by the statement quotes, the index names are not qualified
+	alters := make([]string, 0)
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, "ALTER TABLE") {
+			alters = append(alters, stmt.SQL)
+		}
+	}
+	require.Len(t, alters, 2)
+	for _, alter := range alters {
+		require.True(t, strings.HasPrefix(alter, `ALTER TABLE "suitecrm"."accounts" ADD COLUMN`), alter)
+	}
+	require.Contains(t, alters[0]+alters[1], `ADD INDEX "accounts_created_at_idx"`)
+}
+
+func TestCatalogDottedKey(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	// the dot of the tenant key is part of the table name, not a catalog separator
+	_, err := db.Get(NewReading, "1", "acme.com")
+	require.Error(t, err)
+
+	db.SetEntityCatalog(NewReading, "iot")
+	_, err = db.Get(NewReading, "1", "acme.com")
+	require.Error(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Contains(t, statements[0].SQL, `FROM "reading-acme.com-`)
+	require.Contains(t, statements[1].SQL, `FROM "iot"."reading-acme.com-`)
+}
@@ -0,0 +1,47 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetCircuitBreaker(&mysql.CircuitBreakerOptions{Failures: 2, OpenTimeout: 50 * time.Millisecond})
+
+	down := true
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if down {
+				return nil, driver.ErrBadConn
+			}
+			return next(stmt)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		_, err := db.Insert(NewHero1("1", 1, "Thor"))
+		require.True(t, errors.Is(err, driver.ErrBadConn))
+	}
+	require.Equal(t, mysql.CircuitOpen, db.CircuitState())
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.True(t, errors.Is(err, mysql.ErrCircuitOpen))
+
+	// the probe succeeds after the open timeout
+	time.Sleep(60 * time.Millisecond)
+	down = false
+	_, err = db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+	require.Equal(t, mysql.CircuitClosed, db.CircuitState())
+
+	require.True(t, mysql.IsConnectionError(driver.ErrBadConn))
+	require.False(t, mysql.IsConnectionError(errors.New("duplicate key")))
+}
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneTableData(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	_, err := db.CloneTableData("hero", "hero_asof", 1000)
+	require.Error(t, err)
+
+	// since 1000: hero 2 was updated twice, hero 3 was deleted and hero 4 was created
+	db.Use(cannedRows("information_schema.TABLES", []driver.Value{"hero_history"}))
+	db.Use(cannedRows(`SELECT data FROM "hero_history"`,
+		[]driver.Value{[]byte(`{"id":"v1","createdOn":1500,"entityId":"2","data":{"id":"2","createdOn":100,"name":"Hulk"}}`)},
+		[]driver.Value{[]byte(`{"id":"v2","createdOn":1600,"entityId":"3","data":{"id":"3","createdOn":200,"name":"Loki"}}`)},
+		[]driver.Value{[]byte(`{"id":"v3","createdOn":1800,"entityId":"2","data":{"id":"2","createdOn":100,"name":"Banner"}}`)},
+	))
+	db.Use(cannedRows(`SELECT id, data FROM "hero"`,
+		[]driver.Value{"1", []byte(`{"id":"1","createdOn":100,"name":"Thor"}`)},
+		[]driver.Value{"2", []byte(`{"id":"2","createdOn":100,"name":"Bruce"}`)},
+		[]driver.Value{"4", []byte(`{"id":"4","createdOn":1700,"name":"Wasp"}`)},
+	))
+
+	count, err := db.CloneTableData("hero", "hero_asof", 1000)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+
+	// the unchanged entities are copied as is and the changed entities are taken from their first later version
+	cloned := make(map[string]string)
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, `INSERT INTO "hero_asof"`) {
+			require.True(t, stmt.InTx)
+			cloned[stmt.Args[0].(string)] = string(stmt.Args[1].([]byte))
+		}
+	}
+	require.Equal(t, map[string]string{
+		"1": `{"id":"1","createdOn":100,"name":"Thor"}`,
+		"2": `{"id":"2","createdOn":100,"name":"Hulk"}`,
+		"3": `{"id":"3","createdOn":200,"name":"Loki"}`,
+	}, cloned)
+	require.Contains(t, recorder.String(), `CREATE TABLE "hero_asof" LIKE "hero"`)
+}
@@ -89,3 +89,15 @@ func (u *Stream) TABLE() string { return "stream" }
 func NewStream() Entity         { return &Stream{} }
 
 // endregion
+
+// region Reading Test Model (monthly table per account) ---------------------------------------------------------------
+
+type Reading struct {
+	BaseEntity
+	Value float64 `json:"value"` // Value
+}
+
+func (u *Reading) TABLE() string { return "reading-{{accountId}}-{{year}}-{{month}}" }
+func NewReading() Entity         { return &Reading{} }
+
+// endregion
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySqlDataCache(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	var cache database.IDataCache = mysql.NewRecordingDatabase(recorder).DataCache()
+
+	require.NoError(t, cache.Set("hero:1", NewHero1("1", 1, "Ant man"), time.Minute))
+
+	ok, err := cache.SetNX("hero:2", NewHero1("2", 2, "Bat Man"))
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = cache.Get(NewHero, "hero:3")
+	require.EqualError(t, err, "key hero:3 not found")
+
+	_, _, err = cache.Scan(0, "hero_*", 5)
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 7)
+	require.Contains(t, statements[3].SQL, `INSERT INTO "cache_keys"`)
+	require.Equal(t, "hero:1", statements[3].Args[0])
+	require.NotNil(t, statements[3].Args[2])
+	require.Nil(t, statements[4].Args[2])
+	require.Equal(t, `hero\_%`, statements[6].Args[1])
+}
+
+func TestMySqlDataCacheSetNX(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	cache := db.DataCache()
+
+	// the key exists and is not expired: neither the insert nor the replace of expired key change a row
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.HasPrefix(stmt.SQL, "INSERT IGNORE") || strings.HasPrefix(stmt.SQL, "UPDATE") {
+				return &mysql.StatementResult{Result: driver.RowsAffected(0)}, nil
+			}
+			return next(stmt)
+		}
+	})
+
+	ok, err := cache.SetNX("lock", NewHero1("1", 1, "Thor"), time.Minute)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	statements := recorder.Statements()
+	require.Equal(t, `INSERT IGNORE INTO "cache_keys" (k, v, expires_at) VALUES ($1, $2, $3)`, statements[len(statements)-2].SQL)
+	require.Equal(t, `UPDATE "cache_keys" SET v = $2, expires_at = $3 WHERE k = $1 AND expires_at IS NOT NULL AND expires_at <= $4`, statements[len(statements)-1].SQL)
+}
@@ -1,8 +1,15 @@
 package test
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
 )
 
 func skipCI(t *testing.T) {
@@ -10,3 +17,50 @@ func skipCI(t *testing.T) {
 		t.Skip("Skipping testing in CI environment")
 	}
 }
+
+// cannedRows returns middleware answering the queries which contain the SQL fragment with the rows (without executing them)
+func cannedRows(fragment string, rows ...[]driver.Value) mysql.Middleware {
+	db := sql.OpenDB(cannedConnector{rows: rows})
+	return func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if !stmt.Query || !strings.Contains(stmt.SQL, fragment) {
+				return next(stmt)
+			}
+			result, err := db.Query("canned")
+			return &mysql.StatementResult{Rows: result}, err
+		}
+	}
+}
+
+type cannedConnector struct{ rows [][]driver.Value }
+
+func (c cannedConnector) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c cannedConnector) Driver() driver.Driver                        { return nil }
+func (c cannedConnector) Prepare(string) (driver.Stmt, error)          { return c, nil }
+func (c cannedConnector) Close() error                                 { return nil }
+func (c cannedConnector) Begin() (driver.Tx, error)                    { return nil, io.EOF }
+func (c cannedConnector) NumInput() int                                { return -1 }
+func (c cannedConnector) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (c cannedConnector) Query([]driver.Value) (driver.Rows, error) {
+	return &cannedResult{rows: c.rows}, nil
+}
+
+type cannedResult struct{ rows [][]driver.Value }
+
+func (r *cannedResult) Columns() []string {
+	if len(r.rows) == 0 {
+		return []string{}
+	}
+	return make([]string, len(r.rows[0]))
+}
+func (r *cannedResult) Close() error { return nil }
+func (r *cannedResult) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
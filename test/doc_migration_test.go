@@ -0,0 +1,77 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentTransforms(t *testing.T) {
+
+	doc := map[string]any{"name": "Ant man", "power": 7}
+
+	changed, err := mysql.RenameField("name", "title")(doc)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "Ant man", doc["title"])
+
+	changed, err = mysql.SetDefault("color", "red")(doc)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	changed, err = mysql.SetDefault("color", "blue")(doc)
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, "red", doc["color"])
+
+	changed, err = mysql.ToString("power")(doc)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "7", doc["power"])
+}
+
+func TestRunDocumentMigration(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	_, err := db.RunDocumentMigration(NewHero, "v2", mysql.MigrationOptions{})
+	require.Error(t, err)
+
+	db.RegisterDocumentMigration(NewHero, "v2", mysql.RenameField("name", "title"))
+
+	checkpoints := 0
+	cp, err := db.RunDocumentMigration(NewHero, "v2", mysql.MigrationOptions{
+		BatchSize:    10,
+		OnCheckpoint: func(mysql.MigrationCheckpoint) error { checkpoints++; return nil },
+	})
+	require.NoError(t, err)
+	require.True(t, cp.Done)
+	require.Equal(t, "hero", cp.Table)
+	require.Equal(t, 1, checkpoints)
+}
+
+func TestRunDocumentMigrationLocksRows(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("ORDER BY id LIMIT", []driver.Value{"1", []byte(`{"id":"1","name":"Ant man"}`)}))
+	db.Use(cannedRows("FOR UPDATE", []driver.Value{[]byte(`{"id":"1","name":"Wasp","power":9}`)}))
+	db.RegisterDocumentMigration(NewHero, "v2", mysql.RenameField("name", "title"))
+
+	cp, err := db.RunDocumentMigration(NewHero, "v2", mysql.MigrationOptions{BatchSize: 10})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), cp.Migrated)
+
+	// the transforms are applied to the locked document, so the concurrent write is not overwritten
+	var update []byte
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, "UPDATE") {
+			update = stmt.Args[1].([]byte)
+		}
+	}
+	require.JSONEq(t, `{"id":"1","title":"Wasp","power":9}`, string(update))
+}
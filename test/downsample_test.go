@@ -0,0 +1,41 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownsample(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	query := db.Query(NewHero).Filter(database.F("name").Eq("Thor")).(mysql.IMySqlQuery)
+	points, err := query.Downsample("createdOn", 5*time.Minute, []mysql.Downsampling{
+		{Name: "avg", Field: "key", Function: database.AVG},
+		{Name: "max", Field: "key", Function: database.MAX},
+	})
+	require.NoError(t, err)
+	require.Len(t, points, 0)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, statements[0].SQL, `SELECT FLOOR((data->>'createdOn')::BIGINT / 300000) * 300000 AS bucket, COUNT(*) AS cnt, avg((data->>'key')::FLOAT) AS a0, max((data->>'key')::FLOAT) AS a1 FROM "hero"`)
+	require.Contains(t, statements[0].SQL, "GROUP BY bucket ORDER BY bucket")
+
+	_, err = query.Downsample("createdOn", 0, nil)
+	require.Error(t, err)
+	_, err = query.Downsample("createdOn", time.Hour, []mysql.Downsampling{{Name: "p99", Field: "key", Function: "p99"}})
+	require.Error(t, err)
+
+	// the time field is resolved like the other fields (e.g. promoted column)
+	db.PromoteFields(NewHero, mysql.PromotedField{Field: "createdOn", Column: "created_on", SqlType: "BIGINT"})
+	_, err = db.Query(NewHero).(mysql.IMySqlQuery).Downsample("createdOn", time.Minute, nil)
+	require.NoError(t, err)
+	statements = recorder.Statements()
+	require.Contains(t, statements[len(statements)-1].SQL, `SELECT FLOOR(("created_on")::BIGINT / 60000) * 60000 AS bucket`)
+}
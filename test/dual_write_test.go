@@ -0,0 +1,74 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDualWrite(t *testing.T) {
+
+	primary, secondary := mysql.NewFakeDatabase(), mysql.NewFakeDatabase()
+	db := mysql.NewDualWriteDatabase(primary, secondary, mysql.DualWriteOptions{Retries: 1, RetryInterval: time.Millisecond})
+	defer func() { _ = db.Close() }()
+
+	_, err := db.BulkInsert(list_of_heroes)
+	require.NoError(t, err)
+	require.NoError(t, db.SetField(NewHero, "5", "name", "Dark Knight"))
+	require.NoError(t, db.Delete(NewHero, "6"))
+
+	// Entity which exists in the primary database only
+	_, err = primary.Insert(NewHero1("99", 99, "Hidden"))
+	require.NoError(t, err)
+
+	require.NoError(t, db.Flush(time.Second))
+	status := db.Status()
+	require.Equal(t, int64(3), status.Replicated)
+	require.Zero(t, status.Failed)
+
+	hero, err := secondary.Get(NewHero, "5")
+	require.NoError(t, err)
+	require.Equal(t, "Dark Knight", hero.(*Hero).Name)
+
+	report, err := db.CompareTable(NewHero, 4)
+	require.NoError(t, err)
+	require.Equal(t, []string{"99"}, report.Missing)
+	require.Empty(t, report.Mismatched)
+	require.False(t, report.Consistent())
+}
+
+func TestShadowRead(t *testing.T) {
+
+	primary, secondary := mysql.NewFakeDatabase(), mysql.NewFakeDatabase()
+	_, err := primary.BulkInsert(list_of_heroes)
+	require.NoError(t, err)
+	_, err = secondary.BulkInsert(list_of_heroes)
+	require.NoError(t, err)
+	require.NoError(t, secondary.SetField(NewHero, "5", "name", "Dark Knight"))
+
+	mismatches := make([]mysql.ShadowMismatch, 0)
+	db := mysql.NewShadowReadDatabase(primary, secondary, mysql.ShadowReadOptions{
+		Sync:       true,
+		OnMismatch: func(m mysql.ShadowMismatch) { mismatches = append(mismatches, m) },
+	})
+
+	hero, err := db.Get(NewHero, "5")
+	require.NoError(t, err)
+	require.Equal(t, "Bat Man", hero.(*Hero).Name)
+
+	_, err = db.Get(NewHero, "1")
+	require.NoError(t, err)
+
+	count, err := db.Query(NewHero).Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(list_of_heroes)), count)
+
+	status := db.Status()
+	require.Equal(t, int64(3), status.Compared)
+	require.Equal(t, int64(1), status.Mismatched)
+	require.Len(t, mismatches, 1)
+	require.Equal(t, "get", mismatches[0].Operation)
+	require.Equal(t, "5", mismatches[0].Query)
+}
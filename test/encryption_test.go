@@ -0,0 +1,58 @@
+package test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldEncryption(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	k1 := bytes.Repeat([]byte{1}, 32)
+	require.NoError(t, db.SetFieldEncryption(NewHero, mysql.NewStaticKeyProvider("k1", map[string][]byte{"k1": k1}), "name"))
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+
+	stored := recorder.Statements()[0].Args[1].([]byte)
+	require.Contains(t, string(stored), `"name":"enc:v1:k1:`)
+	require.NotContains(t, string(stored), "Thor")
+
+	// after rotation new values are encrypted by the new key, and values of the old key are still decrypted
+	k2 := bytes.Repeat([]byte{2}, 32)
+	require.NoError(t, db.SetFieldEncryption(NewHero, mysql.NewStaticKeyProvider("k2", map[string][]byte{"k1": k1, "k2": k2}), "name"))
+	db.Use(cannedRows(`data FROM "hero"`, []driver.Value{"1", stored}))
+
+	entity, err := db.Get(NewHero, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Thor", entity.(*Hero).Name)
+
+	_, err = db.Insert(NewHero1("2", 2, "Loki"))
+	require.NoError(t, err)
+	statements := recorder.Statements()
+	require.Contains(t, string(statements[len(statements)-1].Args[1].([]byte)), `"name":"enc:v1:k2:`)
+}
+
+func TestSetFieldsEncryption(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	provider := mysql.NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, db.SetFieldEncryption(NewHero, provider, "name"))
+
+	_, err := db.Query(NewHero).SetField("name", "Thor")
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	token, ok := statements[0].Args[0].(string)
+	require.True(t, ok)
+	require.True(t, strings.HasPrefix(token, "enc:v1:k1:"), token)
+	require.NotContains(t, token, "Thor")
+}
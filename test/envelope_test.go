@@ -0,0 +1,67 @@
+package test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDocumentEncryption(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	k1, k2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	db.SetDocumentEncryption(NewHero, mysql.NewStaticKeyProvider("k1", map[string][]byte{"k1": k1}))
+
+	// the stored document of hero 1 is served to the reads
+	var stored []byte
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if stmt.Query && strings.Contains(stmt.SQL, `data FROM "hero"`) {
+				return cannedRows("", []driver.Value{"1", stored})(next)(stmt)
+			}
+			return next(stmt)
+		}
+	})
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+	stored = recorder.Statements()[0].Args[1].([]byte)
+	require.Contains(t, string(stored), `"_enc":{"v":1,"kid":"k1"`)
+	require.NotContains(t, string(stored), "Thor")
+
+	entity, err := db.Get(NewHero, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Thor", entity.(*Hero).Name)
+
+	// rotation re-wraps the data key by the current key, the document is still opened
+	db.SetDocumentEncryption(NewHero, mysql.NewStaticKeyProvider("k2", map[string][]byte{"k1": k1, "k2": k2}))
+	rotated, err := db.RotateDocumentKeys(NewHero)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), rotated)
+
+	statements := recorder.Statements()
+	update := statements[len(statements)-1]
+	require.True(t, strings.HasPrefix(update.SQL, `UPDATE "hero"`), update.SQL)
+	stored = update.Args[1].([]byte)
+	require.Contains(t, string(stored), `"kid":"k2"`)
+
+	// the old key is no longer required
+	db.SetDocumentEncryption(NewHero, mysql.NewStaticKeyProvider("k2", map[string][]byte{"k2": k2}))
+	entity, err = db.Get(NewHero, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Thor", entity.(*Hero).Name)
+
+	rotated, err = db.RotateDocumentKeys(NewHero)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), rotated)
+
+	// documents wrapped by unknown key can't be opened
+	db.SetDocumentEncryption(NewHero, mysql.NewStaticKeyProvider("k1", map[string][]byte{"k1": k1}))
+	_, err = db.Get(NewHero, "1")
+	require.Error(t, err)
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteQueryPaged(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	pages := 0
+	fn := func(page []Json) error {
+		pages++
+		return nil
+	}
+
+	require.NoError(t, db.ExecuteQueryPaged("crm", "SELECT id, name FROM accounts WHERE type = ? ORDER BY id;", "", 100, fn, "customer"))
+	require.NoError(t, db.ExecuteQueryPaged("crm", "SELECT id, name FROM accounts WHERE type = ?", "id", 100, fn, "customer"))
+	require.Equal(t, 0, pages)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, "SELECT id, name FROM accounts WHERE type = ? ORDER BY id LIMIT 100 OFFSET 0", statements[0].SQL)
+	require.Equal(t, `SELECT * FROM (SELECT id, name FROM accounts WHERE type = ?) AS paged ORDER BY "id" LIMIT 100`, statements[1].SQL)
+	require.Equal(t, []any{"customer"}, statements[1].Args)
+
+	require.Error(t, db.ExecuteQueryPaged("crm", "SELECT id FROM accounts", "id; DROP", 100, fn))
+	require.Error(t, db.ExecuteQueryPaged("crm", "SELECT id FROM accounts", "", 0, fn))
+}
+
+func TestExecuteQueryPagedGuard(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetStatementGuard(mysql.NewStatementGuard(mysql.StatementGuardOptions{DenyMultiStatement: true, MaxLimit: 100}))
+	fn := func(page []Json) error { return nil }
+
+	// the guard inspects the paged statement (no LIMIT is appended to the raw query)
+	require.NoError(t, db.ExecuteQueryPaged("crm", "SELECT id FROM accounts ORDER BY id", "", 50, fn))
+	require.NoError(t, db.ExecuteQueryPaged("crm", "SELECT id FROM accounts", "id", 100, fn))
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, "SELECT id FROM accounts ORDER BY id LIMIT 50 OFFSET 0", statements[0].SQL)
+	require.Equal(t, `SELECT * FROM (SELECT id FROM accounts) AS paged ORDER BY "id" LIMIT 100`, statements[1].SQL)
+
+	// page size larger than the max limit and multiple statements are rejected
+	var denied *mysql.StatementDeniedError
+	require.ErrorAs(t, db.ExecuteQueryPaged("crm", "SELECT id FROM accounts ORDER BY id", "", 500, fn), &denied)
+	require.ErrorAs(t, db.ExecuteQueryPaged("crm", "SELECT id FROM accounts; DELETE FROM accounts", "id", 50, fn), &denied)
+	require.Len(t, recorder.Statements(), 2)
+}
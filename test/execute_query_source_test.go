@@ -0,0 +1,42 @@
+package test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+// metricsRecorder records the observed operations
+type metricsRecorder struct {
+	ops []mysql.OperationMetric
+}
+
+func (m *metricsRecorder) ObserveOperation(metric mysql.OperationMetric) {
+	m.ops = append(m.ops, metric)
+}
+func (m *metricsRecorder) ObservePool(sql.DBStats) {}
+
+func TestExecuteQuerySource(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	hook := &metricsRecorder{}
+	db.SetMetricsHook(hook)
+
+	rows, err := db.ExecuteQuery("crm-sync", "SELECT VERSION() AS version")
+	require.NoError(t, err)
+	require.Empty(t, rows)
+
+	_, err = db.ExecuteQuery(mysql.SourcePrimary, "SELECT 1")
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, "crm-sync", statements[0].Source)
+	require.Equal(t, mysql.SourcePrimary, statements[1].Source)
+
+	require.Equal(t, "execute_query", hook.ops[0].Operation)
+	require.Equal(t, "crm-sync", hook.ops[0].Table)
+}
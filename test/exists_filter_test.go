@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistsFilter(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	devices := mysql.Relation{Name: "devices", Factory: NewDevice, ForeignField: "ownerId"}
+	query := db.Query(NewHero).Filter(database.F("key").Gt(5)).(mysql.IMySqlQuery)
+	_, err := query.Exists(devices, database.F("name").Eq("Sensor")).NotExists(devices, database.F("key").Lt(0)).GetIDs()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, statements[0].SQL, `id IN (SELECT data->>'ownerId' FROM "device" WHERE data->>'ownerId' IS NOT NULL AND (data->>'name' = $2))`)
+	require.Contains(t, statements[0].SQL, `id NOT IN (SELECT data->>'ownerId' FROM "device" WHERE data->>'ownerId' IS NOT NULL AND ((data->>'key')::BIGINT < $3))`)
+	require.Len(t, statements[0].Args, 3)
+
+	_, err = db.Query(NewHero).(mysql.IMySqlQuery).Exists(mysql.Relation{Factory: NewDevice, LocalField: "x'y"}).GetIDs()
+	require.Error(t, err)
+}
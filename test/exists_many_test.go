@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExistsMany(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	existing, missing, err := db.ExistsMany(NewHero, []string{"1", "2", "1", "3"})
+	require.NoError(t, err)
+	require.Empty(t, existing)
+	require.Equal(t, []string{"1", "2", "3"}, missing)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `SELECT id FROM "hero" WHERE id = ANY($1)`, statements[0].SQL)
+
+	existing, missing, err = db.ExistsMany(NewHero, nil)
+	require.NoError(t, err)
+	require.Empty(t, existing)
+	require.Empty(t, missing)
+	require.Len(t, recorder.Statements(), 1)
+}
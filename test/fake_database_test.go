@@ -0,0 +1,55 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeDatabase(t *testing.T) {
+
+	var db database.IDatabase = mysql.NewFakeDatabase()
+
+	affected, err := db.BulkInsert(list_of_heroes)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(list_of_heroes)), affected)
+
+	_, err = db.Insert(list_of_heroes[0])
+	require.Error(t, err)
+
+	hero, err := db.Get(NewHero, "5")
+	require.NoError(t, err)
+	require.Equal(t, "Bat Man", hero.(*Hero).Name)
+
+	// Filters, sort and pagination
+	list, total, err := db.Query(NewHero).
+		Filter(database.F("name").Like("man")).
+		Filter(database.F("key").Gt(2)).
+		Sort("key-").
+		Limit(3).
+		Find()
+	require.NoError(t, err)
+	require.Equal(t, int64(8), total)
+	require.Len(t, list, 3)
+	require.Equal(t, "X-Man", list[0].(*Hero).Name)
+
+	count, err := db.Query(NewHero).MatchAny(database.F("key").In(1, 2), database.F("name").Eq("Thor")).Count()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), count)
+
+	// Field updates and deletes
+	require.NoError(t, db.SetField(NewHero, "5", "name", "Batman"))
+	hero, err = db.Get(NewHero, "5")
+	require.NoError(t, err)
+	require.Equal(t, "Batman", hero.(*Hero).Name)
+
+	deleted, err := db.Query(NewHero).Filter(database.F("key").Lte(10)).Delete()
+	require.NoError(t, err)
+	require.Equal(t, int64(10), deleted)
+
+	exists, err := db.Exists(NewHero, "5")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
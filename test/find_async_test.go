@@ -0,0 +1,35 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAsync(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	query := db.Query(NewHero).Filter(database.F("key").Gt(5)).(mysql.IMySqlQuery)
+	entities, errs := query.FindAsync(context.Background())
+	count := 0
+	for range entities {
+		count++
+	}
+	require.NoError(t, <-errs)
+	require.Equal(t, 0, count)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, statements[0].SQL, `SELECT id, data FROM "hero" WHERE`)
+
+	// missing shard keys
+	entities, errs = db.Query(NewReading).(mysql.IMySqlQuery).FindAsync(context.Background())
+	for range entities {
+	}
+	require.Error(t, <-errs)
+}
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindWithTotal(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	query := db.Query(NewHero).Filter(database.F("key").Gt(5)).Sort("name").Limit(10).(mysql.IMySqlQuery)
+	out, total, err := query.FindWithTotal()
+	require.NoError(t, err)
+	require.Len(t, out, 0)
+	require.Equal(t, int64(0), total)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, statements[0].SQL, `SELECT id, data, COUNT(*) OVER() AS total FROM "hero"`)
+	require.Contains(t, statements[0].SQL, "LIMIT 10")
+
+	// empty page beyond the first one falls back to count query
+	recorder.Reset()
+	_, _, err = db.Query(NewHero).Limit(10).Page(3).(mysql.IMySqlQuery).FindWithTotal()
+	require.NoError(t, err)
+
+	statements = recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Contains(t, statements[1].SQL, "SELECT count(*)")
+}
@@ -0,0 +1,42 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeoFilters(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	require.NoError(t, db.SetGeoFields(NewHero, mysql.GeoField{Column: "location", Lat: "lat", Lng: "lng"}))
+
+	query := db.Query(NewHero).(mysql.IMySqlQuery).WithinRadius("location", 32, 34.8, 1000).NearestFirst("location", 32, 34.8)
+	_, err := query.Limit(10).GetIDs()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `SELECT id FROM "hero" WHERE MBRContains(ST_GeomFromText($1, 4326), "location") AND `+
+		`ST_Distance_Sphere("location", ST_SRID(POINT(32, 34.8), 4326)) <= $2 `+
+		`ORDER BY ST_Distance_Sphere("location", ST_SRID(POINT(32, 34.8), 4326)) ASC LIMIT 10`, statements[0].SQL)
+	require.Equal(t, 1000.0, statements[0].Args[1])
+	require.Contains(t, statements[0].Args[0], "POLYGON((31.99")
+
+	// only registered geo fields can be used (the column is part of the SQL)
+	_, err = db.Query(NewHero).(mysql.IMySqlQuery).WithinBox(`location") OR (1=1`, 0, 0, 1, 1).GetIDs()
+	require.Error(t, err)
+	_, err = db.Query(NewHero).(mysql.IMySqlQuery).NearestFirst("name", 0, 0).GetIDs()
+	require.Error(t, err)
+
+	// the radius box crossing the antimeridian is split to its east and west sides
+	recorder.Reset()
+	_, err = db.Query(NewHero).(mysql.IMySqlQuery).WithinRadius("location", 0, 179.999, 1000).GetIDs()
+	require.NoError(t, err)
+	statements = recorder.Statements()
+	require.Contains(t, statements[0].SQL, `(MBRContains(ST_GeomFromText($1, 4326), "location") OR MBRContains(ST_GeomFromText($2, 4326), "location"))`)
+	require.Contains(t, statements[0].Args[0], " 180")
+	require.Contains(t, statements[0].Args[1], " -180")
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetFields(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	_, err := db.GetFields(NewHero, "1", []string{"name", "key"})
+	require.EqualError(t, err, "no row fetched for id: 1")
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `SELECT JSON_OBJECT('name', JSON_EXTRACT(data, '$.name'), 'key', JSON_EXTRACT(data, '$.key')) FROM "hero" WHERE id = $1`, statements[0].SQL)
+	require.Equal(t, []any{"1"}, statements[0].Args)
+
+	_, err = db.GetFields(NewHero, "1", []string{"name'); DROP TABLE hero; --"})
+	require.Error(t, err)
+
+	_, err = db.GetFields(NewHero, "1", nil)
+	require.Error(t, err)
+	require.Len(t, recorder.Statements(), 1)
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionSelection(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetHistory(NewHero, true)
+
+	// Ant man was replaced at 1000 by Wasp, which was replaced at 2000 by the current version
+	db.Use(cannedRows("information_schema.TABLES", []driver.Value{"hero_history"}))
+	db.Use(cannedRows(`FROM "hero_history"`,
+		[]driver.Value{[]byte(`{"id":"v1","createdOn":1000,"entityId":"1","action":"update","data":{"id":"1","key":1,"name":"Ant man"}}`)},
+		[]driver.Value{[]byte(`{"id":"v2","createdOn":2000,"entityId":"1","action":"update","data":{"id":"1","key":2,"name":"Wasp"}}`)},
+	))
+	db.Use(cannedRows(`data FROM "hero" WHERE`, []driver.Value{"1", []byte(`{"id":"1","key":3,"name":"Wasp"}`)}))
+
+	versions, err := db.ListVersions(NewHero, "1")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	require.Equal(t, "update", versions[0].Action)
+
+	// the version in effect at the time is the first version replaced after it
+	for ts, key := range map[int64]int{500: 1, 1000: 2, 1999: 2, 2000: 3, 3000: 3} {
+		entity, er := db.GetVersion(NewHero, "1", Timestamp(ts))
+		require.NoError(t, er)
+		require.Equal(t, key, entity.(*Hero).Key, "version at %d", ts)
+	}
+
+	changes, err := db.Diff(NewHero, "1", 500, 3000)
+	require.NoError(t, err)
+	require.Equal(t, []mysql.FieldChange{
+		{Field: "key", Old: float64(1), New: float64(3)},
+		{Field: "name", Old: "Ant man", New: "Wasp"},
+	}, changes)
+
+	changes, err = db.Diff(NewHero, "1", 1000, 3000)
+	require.NoError(t, err)
+	require.Equal(t, []mysql.FieldChange{{Field: "key", Old: float64(2), New: float64(3)}}, changes)
+}
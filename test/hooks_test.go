@@ -0,0 +1,81 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleHooks(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	events := make([]mysql.HookEvent, 0)
+	db.RegisterHook("hero", mysql.BeforeInsert, func(ctx *mysql.HookContext) error {
+		events = append(events, ctx.Event)
+		require.NotNil(t, ctx.Tx)
+		if hero := ctx.Entity.(*Hero); hero.Name == "" {
+			hero.Name = "Unknown"
+		}
+		return nil
+	})
+	db.RegisterHook("hero", mysql.AfterInsert, func(ctx *mysql.HookContext) error {
+		events = append(events, ctx.Event)
+		if ctx.EntityId == "2" {
+			return fmt.Errorf("rejected")
+		}
+		return nil
+	})
+
+	_, err := db.Insert(NewHero1("1", 1, ""))
+	require.NoError(t, err)
+	require.Equal(t, []mysql.HookEvent{mysql.BeforeInsert, mysql.AfterInsert}, events)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, string(statements[0].Args[1].([]byte)), `"name":"Unknown"`)
+
+	_, err = db.Insert(NewHero1("2", 2, "Ant man"))
+	require.ErrorContains(t, err, "after_insert hook of hero: rejected")
+}
+
+func TestLifecycleHooksUnchangedEntity(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	store := &countingBlobStore{memoryBlobStore: memoryBlobStore{}}
+	db.SetOverflowStorage(NewHero, 200, store)
+
+	calls := 0
+	db.RegisterHook("hero", mysql.BeforeInsert, func(ctx *mysql.HookContext) error {
+		calls++
+		return nil
+	})
+
+	// the hook did not change the entity: the document is not marshaled again, so a single blob is written
+	_, err := db.Insert(NewHero1("1", 1, strings.Repeat("Hulk", 100)))
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, 1, store.puts)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	for key := range store.memoryBlobStore {
+		require.Contains(t, string(statements[0].Args[1].([]byte)), key)
+	}
+}
+
+// countingBlobStore counts the blobs written to the store
+type countingBlobStore struct {
+	memoryBlobStore
+	puts int
+}
+
+func (c *countingBlobStore) Put(key string, data []byte) error {
+	c.puts++
+	return c.memoryBlobStore.Put(key, data)
+}
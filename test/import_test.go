@@ -0,0 +1,45 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	lines := strings.Join([]string{
+		`{"id":"1","key":1,"name":"Ant man"}`,
+		`{"id":"2","key":2,"name":"Aqua man"}`,
+		``,
+		`{"key":3,"name":"Asterix"}`,
+		`not a json`,
+		`{"id":"5","key":5,"name":"Bat Man"}`,
+		`{"id":"6","key":-1,"name":"Bad"}`,
+	}, "\n")
+
+	progress := 0
+	report, err := db.Import(NewHero, strings.NewReader(lines), mysql.ImportOptions{
+		ChunkSize: 2,
+		Validate: func(entity Entity) error {
+			if entity.(*Hero).Key < 0 {
+				return &mysql.InvalidFieldError{Field: "key"}
+			}
+			return nil
+		},
+		OnProgress: func(mysql.ImportReport) { progress++ },
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(6), report.Lines)
+	require.Equal(t, int64(3), report.Imported)
+	require.Equal(t, 2, progress)
+	require.Len(t, report.Rejected, 3)
+	require.Equal(t, []int64{4, 5, 7}, []int64{report.Rejected[0].Line, report.Rejected[1].Line, report.Rejected[2].Line})
+	require.Len(t, recorder.Statements(), 3)
+}
@@ -0,0 +1,22 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementField(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	require.NoError(t, db.IncrementField(NewHero, "1", "key", 5))
+	require.Error(t, db.IncrementField(NewHero, "1", "key;drop", 5))
+
+	statements := recorder.Statements()
+	require.NotEmpty(t, statements)
+	require.Equal(t, `UPDATE "hero" SET data = JSON_SET(data, '$.key', COALESCE(CAST(JSON_EXTRACT(data, '$.key') AS SIGNED), 0) + $1) WHERE id = $2`, statements[0].SQL)
+	require.Equal(t, []any{int64(5), "1"}, statements[0].Args)
+}
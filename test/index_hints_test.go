@@ -0,0 +1,23 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexHints(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	query := db.Query(NewHero).(mysql.IMySqlQuery).UseIndex("hero_key_idx").IgnoreIndex("hero_name_idx", "PRIMARY")
+	_, err := query.Filter(database.F("key").Eq(5)).Limit(10).GetIDs()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, statements[0].SQL, `FROM "hero" USE INDEX ("hero_key_idx") IGNORE INDEX ("hero_name_idx", "PRIMARY") WHERE `)
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJsonPatch(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	err := db.JsonPatch(NewHero, "1", []mysql.PatchOperation{
+		{Op: mysql.PatchTest, Path: "/name", Value: "Batman"},
+		{Op: mysql.PatchReplace, Path: "/name", Value: "Robin"},
+		{Op: mysql.PatchAdd, Path: "/tags/-", Value: "x"},
+		{Op: mysql.PatchRemove, Path: "/old"},
+	})
+	require.NoError(t, err)
+
+	err = db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchMove, From: "/a", Path: "/b/0"}})
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, `UPDATE "hero" SET data = JSON_REMOVE(JSON_ARRAY_APPEND(JSON_REPLACE(data, $1, CAST($2 AS JSON)), $3, CAST($4 AS JSON)), $5) `+
+		`WHERE id = $6 AND JSON_TYPE(JSON_EXTRACT(data, $7)) = 'ARRAY' AND JSON_EXTRACT(data, $8) = CAST($9 AS JSON)`, statements[0].SQL)
+	require.Equal(t, []any{`$."name"`, `"Robin"`, `$."tags"`, `"x"`, `$."old"`, "1", `$."tags"`, `$."name"`, `"Batman"`}, statements[0].Args)
+	require.Equal(t, `UPDATE "hero" SET data = JSON_ARRAY_INSERT(JSON_REMOVE(data, $1), $2, JSON_EXTRACT(data, $1)) WHERE id = $3 AND JSON_TYPE(JSON_EXTRACT(data, $4)) = 'ARRAY'`, statements[1].SQL)
+	require.Equal(t, []any{`$."a"`, `$."b"[0]`, "1", `$."b"`}, statements[1].Args)
+
+	// test after modification is applied in memory (the recording database has no documents)
+	err = db.JsonPatch(NewHero, "1", []mysql.PatchOperation{
+		{Op: mysql.PatchAdd, Path: "/name", Value: "Robin"},
+		{Op: mysql.PatchTest, Path: "/name", Value: "Robin"},
+	})
+	require.EqualError(t, err, "no row fetched for id: 1")
+
+	require.Error(t, db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: "copy", From: "/a", Path: "/b"}}))
+	require.Error(t, db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchAdd, Path: "name"}}))
+	require.Error(t, db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchMove, From: "/a", Path: "/a/b"}}))
+}
+
+func TestJsonPatchUnchangedRow(t *testing.T) {
+
+	// the server statement changes no row, the stored document is read again
+	stored := []byte(`{"id":"1","name":"Batman","b":{"0":"x"}}`)
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("SHA2", []driver.Value{stored, "hash"}))
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.HasPrefix(stmt.SQL, `UPDATE "hero" SET data = JSON_`) {
+				return &mysql.StatementResult{Result: driver.RowsAffected(0)}, nil
+			}
+			return next(stmt)
+		}
+	})
+
+	// the tests still pass: the document was modified concurrently
+	var conflict *mysql.ConcurrentModificationError
+	err := db.JsonPatch(NewHero, "1", []mysql.PatchOperation{
+		{Op: mysql.PatchTest, Path: "/name", Value: "Batman"},
+		{Op: mysql.PatchReplace, Path: "/name", Value: "Robin"},
+	})
+	require.True(t, errors.As(err, &conflict))
+
+	// the test fails on the stored document
+	err = db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchTest, Path: "/name", Value: "Robin"}, {Op: mysql.PatchRemove, Path: "/name"}})
+	require.True(t, errors.Is(err, mysql.ErrPatchTestFailed))
+
+	// the patch does not change the document
+	require.NoError(t, db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchReplace, Path: "/name", Value: "Batman"}}))
+
+	// numeric token of object is object key: the patch is applied in memory
+	require.NoError(t, db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchReplace, Path: "/b/0", Value: "y"}}))
+	statements := recorder.Statements()
+	last := statements[len(statements)-1]
+	require.True(t, strings.HasPrefix(last.SQL, `UPDATE "hero" SET data = $2`), last.SQL)
+	require.JSONEq(t, `{"id":"1","name":"Batman","b":{"0":"y"}}`, string(last.Args[1].([]byte)))
+}
+
+func TestJsonPatchValidation(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("SHA2", []driver.Value{[]byte(`{"id":"1","name":"Batman"}`), "hash"}))
+	require.NoError(t, db.SetJsonSchema(NewHero, `{"type":"object","properties":{"name":{"type":"string"}}}`))
+
+	// validated documents are patched in memory
+	err := db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchReplace, Path: "/name", Value: 7}})
+	require.True(t, errors.Is(err, mysql.ErrValidation))
+	require.NoError(t, db.JsonPatch(NewHero, "1", []mysql.PatchOperation{{Op: mysql.PatchReplace, Path: "/name", Value: "Robin"}}))
+}
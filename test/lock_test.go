@@ -0,0 +1,39 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("GET_LOCK", []driver.Value{int64(1)}))
+	db.Use(cannedRows("RELEASE_LOCK", []driver.Value{int64(1)}))
+
+	require.NoError(t, db.AcquireLock("rollover", time.Minute))
+
+	// the lock is held by this instance: the second acquire fails without waiting for the lock
+	err := db.AcquireLock("rollover", time.Minute)
+	require.Error(t, err)
+	require.False(t, errors.Is(err, mysql.ErrLockTimeout))
+
+	require.NoError(t, db.ReleaseLock("rollover"))
+	require.Error(t, db.ReleaseLock("rollover"))
+	require.NoError(t, db.WithLock("rollover", time.Minute, func() error { return nil }))
+
+	acquires := 0
+	for _, stmt := range recorder.Statements() {
+		if strings.Contains(stmt.SQL, "GET_LOCK") {
+			acquires++
+		}
+	}
+	require.Equal(t, 2, acquires)
+}
@@ -0,0 +1,26 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMappedFields(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	require.Error(t, db.MapFields(NewHero, mysql.MappedField{Field: "key", OnDelete: "DROP"}))
+	require.Error(t, db.MapFields(NewHero, mysql.MappedField{Field: "key;"}))
+	require.NoError(t, db.MapFields(NewHero, mysql.MappedField{Field: "key", Column: "hero_key", SqlType: "INT", Index: true}))
+
+	_, err := db.Query(NewHero).Filter(database.F("key").Eq(5)).Sort("key").GetIDs()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `SELECT id FROM "hero" WHERE ("hero_key" = $1) ORDER BY "hero_key" ASC `, statements[0].SQL)
+}
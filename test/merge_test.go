@@ -0,0 +1,67 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	merged, err := db.Merge(NewHero, "7", func(current Entity, exists bool) (Entity, error) {
+		require.False(t, exists)
+		hero := current.(*Hero)
+		hero.Id, hero.Key, hero.Name = "7", hero.Key+1, "Superman"
+		return hero, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, merged.(*Hero).Key)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, `SELECT data, SHA2(CAST(data AS CHAR), 256) FROM "hero" WHERE id = $1`, statements[0].SQL)
+	require.Equal(t, `INSERT INTO "hero" (id, data) VALUES ($1, $2)`, statements[1].SQL)
+
+	_, err = db.Merge(NewHero, "7", func(current Entity, exists bool) (Entity, error) {
+		return NewHero1("8", 1, "Batman"), nil
+	})
+	require.Error(t, err)
+}
+
+func TestMergeUnchanged(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("SHA2(", []driver.Value{`{"id":"7","key":1,"name":"Superman"}`, "hash"}))
+
+	// the merge does not change the entity: nothing is written
+	merged, err := db.Merge(NewHero, "7", func(current Entity, exists bool) (Entity, error) {
+		require.True(t, exists)
+		return current, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Superman", merged.(*Hero).Name)
+	require.Len(t, recorder.Statements(), 1)
+
+	// update of the expected document with identical data does not change the row (without found rows)
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.HasPrefix(stmt.SQL, "UPDATE") {
+				return &mysql.StatementResult{Result: driver.RowsAffected(0)}, nil
+			}
+			return next(stmt)
+		}
+	})
+	_, err = db.UpdateIfUnchanged(NewHero1("7", 1, "Superman"), "hash")
+	require.NoError(t, err)
+	_, err = db.UpdateIfUnchanged(NewHero1("7", 1, "Superman"), "stale")
+	require.True(t, errors.Is(err, mysql.ErrConcurrentModification))
+}
@@ -0,0 +1,33 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiGet(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	result, err := db.MultiGet(
+		mysql.GetRequest{Factory: NewHero, Id: "1"},
+		mysql.GetRequest{Factory: NewDevice, Id: "d1"},
+		mysql.GetRequest{Factory: NewHero, Id: "2"},
+		mysql.GetRequest{Factory: NewHero, Id: "1"},
+	)
+	require.NoError(t, err)
+	require.Equal(t, 4, len(result))
+	require.Nil(t, result[0])
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, `SELECT id, data FROM "hero" WHERE id = ANY($1)`, statements[0].SQL)
+	require.Equal(t, []any{[]string{"1", "2"}}, statements[0].Args)
+	require.Equal(t, `SELECT id, data FROM "device" WHERE id = ANY($1)`, statements[1].SQL)
+
+	_, err = db.MultiGet(mysql.GetRequest{Factory: NewHero})
+	require.Error(t, err)
+}
@@ -0,0 +1,19 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common-mysql/mysqltest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMySqlDatabaseContainer(t *testing.T) {
+
+	mysqltest.Run(t, mysqltest.Options{}, func(t *testing.T, db *mysql.MySqlDatabase) {
+		rows, err := db.ExecuteQuery("", "SELECT VERSION() AS version")
+		require.NoError(t, err)
+		require.Len(t, rows, 1)
+		require.NotEmpty(t, rows[0]["version"])
+	})
+}
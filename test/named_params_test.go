@@ -0,0 +1,28 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindNamed(t *testing.T) {
+
+	SQL, args, err := mysql.BindNamed("SELECT id FROM t WHERE a = :a AND id IN (:ids) AND b = ':a' AND c::int = 1 AND d IN (:none) -- :x",
+		map[string]any{"a": 1, "ids": []string{"x", "y"}, "none": []int{}})
+	require.NoError(t, err)
+	require.Equal(t, "SELECT id FROM t WHERE a = ? AND id IN (?, ?) AND b = ':a' AND c::int = 1 AND d IN (NULL) -- :x", SQL)
+	require.Equal(t, []any{1, "x", "y"}, args)
+
+	_, _, err = mysql.BindNamed("SELECT :missing", nil)
+	require.Error(t, err)
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	_, err = db.ExecuteSQL("DELETE FROM t WHERE id = :id", Json{"id": "1"})
+	require.NoError(t, err)
+	require.Equal(t, "DELETE FROM t WHERE id = ?", recorder.Statements()[0].SQL)
+	require.Equal(t, []any{"1"}, recorder.Statements()[0].Args)
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimisticLocking(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	require.NoError(t, db.SetVersionField(NewHero, "key"))
+
+	hero := NewHero1("1", 0, "Ant man").(*Hero)
+	_, err := db.Insert(hero)
+	require.NoError(t, err)
+	require.Equal(t, 1, hero.Key)
+
+	_, err = db.Update(hero)
+	require.NoError(t, err)
+	require.Equal(t, 2, hero.Key)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Contains(t, statements[1].SQL, `COALESCE(data->>'key', '0') = $3`)
+	require.Equal(t, "1", statements[1].Args[2])
+
+	err = &mysql.ConcurrentModificationError{Table: "hero", Id: "1", Version: 1}
+	require.True(t, errors.Is(err, mysql.ErrConcurrentModification))
+}
+
+func TestUpsertReturningOld(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	previous, err := db.UpsertReturningOld(NewHero1("1", 1, "Ant man"))
+	require.NoError(t, err)
+	require.Nil(t, previous)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, `SELECT data FROM "hero" WHERE id = $1 FOR UPDATE`, statements[0].SQL)
+	require.True(t, statements[1].InTx)
+}
+
+func TestUpdateIfUnchanged(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	_, err := db.UpdateIfUnchanged(NewHero1("1", 1, "Ant man"), "abc")
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `UPDATE "hero" SET data = $2 WHERE id = $1 AND SHA2(CAST(data AS CHAR), 256) = $3`, statements[0].SQL)
+	require.Equal(t, "abc", statements[0].Args[2])
+
+	err = &mysql.ConcurrentModificationError{Table: "hero", Id: "1", Hash: "abc"}
+	require.True(t, errors.Is(err, mysql.ErrConcurrentModification))
+	require.Contains(t, err.Error(), "since hash abc")
+}
@@ -0,0 +1,169 @@
+package test
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryBlobStore map[string][]byte
+
+func (m memoryBlobStore) Put(key string, data []byte) error { m[key] = data; return nil }
+func (m memoryBlobStore) Delete(key string) error           { delete(m, key); return nil }
+func (m memoryBlobStore) List(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	for key := range m {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+func (m memoryBlobStore) Get(key string) ([]byte, error) {
+	if data, ok := m[key]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("blob not found: %s", key)
+}
+
+func TestOverflowStorage(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	store := memoryBlobStore{}
+	db.SetOverflowStorage(NewHero, 200, store)
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+	require.Len(t, store, 0)
+
+	_, err = db.Insert(NewHero1("2", 2, strings.Repeat("Hulk", 100)))
+	require.NoError(t, err)
+	require.Len(t, store, 1)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Contains(t, string(statements[0].Args[1].([]byte)), `"name":"Thor"`)
+
+	pointer := string(statements[1].Args[1].([]byte))
+	require.Contains(t, pointer, `"_overflow":{"key":"hero/`)
+	require.Contains(t, pointer, `"id":"2"`)
+	require.NotContains(t, pointer, "Hulk")
+
+	for _, body := range store {
+		require.Contains(t, string(body), strings.Repeat("Hulk", 100))
+	}
+
+	db.SetOverflowStorage(NewHero, 0, nil)
+	_, err = db.PurgeOverflow(NewHero)
+	require.Error(t, err)
+}
+
+func TestPurgeOverflow(t *testing.T) {
+
+	db := mysql.NewRecordingDatabase(mysql.NewStatementRecorder())
+	store := memoryBlobStore{}
+	db.SetOverflowStorage(NewHero, 200, store)
+
+	old := time.Now().Add(-time.Hour).UnixMilli()
+	store[fmt.Sprintf("hero/%d-aaaa", old)] = []byte("{}")
+	store[fmt.Sprintf("hero/%d-bbbb", time.Now().UnixMilli())] = []byte("{}")
+	store[fmt.Sprintf("hero-eu/%d-cccc", old)] = []byte("{}")
+	store["hero/dddd"] = []byte("{}")
+
+	// only the old blob of the table is deleted: recent blobs may belong to writes in progress, and other tables blobs
+	// are referenced by the other tables rows
+	deleted, err := db.PurgeOverflow(NewHero)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+	require.Len(t, store, 3)
+	require.NotContains(t, store, fmt.Sprintf("hero/%d-aaaa", old))
+}
+
+func TestOverflowSetField(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	store := memoryBlobStore{}
+	db.SetOverflowStorage(NewHero, 200, store)
+
+	body := fmt.Sprintf(`{"id":"2","key":2,"name":%q,"tags":["a"]}`, strings.Repeat("Hulk", 100))
+	store["hero/1-aaaa"] = []byte(body)
+	db.Use(cannedRows("SHA2(", []driver.Value{`{"id":"2","_overflow":{"key":"hero/1-aaaa","size":100}}`, "hash"}))
+
+	// the field is set in the document body (blob), and the row is replaced only if it was not modified
+	require.NoError(t, db.SetField(NewHero, "2", "name", "Banner"))
+	require.NoError(t, db.AddToSet(NewHero, "2", "tags", []any{"a", "b"}))
+
+	updates := make([]mysql.Statement, 0)
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, "UPDATE") {
+			updates = append(updates, stmt)
+		}
+	}
+	require.Len(t, updates, 2)
+	require.Equal(t, `UPDATE "hero" SET data = $2 WHERE id = $1 AND SHA2(CAST(data AS CHAR), 256) = $3`, updates[0].SQL)
+	require.Equal(t, "hash", updates[0].Args[2])
+
+	// the renamed document is below the threshold, so it is stored in the row
+	require.Contains(t, string(updates[0].Args[1].([]byte)), `"name":"Banner"`)
+	require.Contains(t, string(updates[1].Args[1].([]byte)), `"_overflow":{"key":"hero/`)
+	require.Len(t, store, 2)
+	for key, data := range store {
+		if key != "hero/1-aaaa" {
+			require.Contains(t, string(data), `"tags":["a","b"]`)
+		}
+	}
+
+	_, err := db.BulkSetFields(NewHero, "name", map[string]any{"2": "Banner"})
+	require.Error(t, err)
+}
+
+func TestPurgeOverflowHistory(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	store := memoryBlobStore{}
+	db.SetOverflowStorage(NewHero, 200, store)
+	db.SetHistory(NewHero, true)
+
+	old := time.Now().Add(-time.Hour).UnixMilli()
+	versioned := fmt.Sprintf("hero/%d-aaaa", old)
+	store[versioned] = []byte("{}")
+	store[fmt.Sprintf("hero/%d-bbbb", old)] = []byte("{}")
+
+	// only the history table exists, the prior version references the first blob
+	history := cannedRows("information_schema.TABLES", []driver.Value{"hero_history"})
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		canned := history(next)
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if len(stmt.Args) > 0 && strings.Contains(fmt.Sprint(stmt.Args[0]), "history") {
+				return canned(stmt)
+			}
+			return next(stmt)
+		}
+	})
+	db.Use(cannedRows(`FROM "hero_history"`, []driver.Value{versioned}))
+
+	deleted, err := db.PurgeOverflow(NewHero)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), deleted)
+	require.Len(t, store, 1)
+	require.Contains(t, store, versioned)
+
+	queried := make([]string, 0)
+	for _, stmt := range recorder.Statements() {
+		if strings.Contains(stmt.SQL, "_overflow.key") {
+			queried = append(queried, stmt.SQL)
+		}
+	}
+	require.Equal(t, []string{
+		`SELECT JSON_UNQUOTE(JSON_EXTRACT(data, '$._overflow.key')) FROM "hero" WHERE JSON_EXTRACT(data, '$._overflow') IS NOT NULL`,
+		`SELECT JSON_UNQUOTE(JSON_EXTRACT(data, '$.data._overflow.key')) FROM "hero_history" WHERE JSON_EXTRACT(data, '$.data._overflow') IS NOT NULL`,
+	}, queried)
+}
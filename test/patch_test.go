@@ -0,0 +1,22 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePatch(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	require.NoError(t, db.Patch(NewHero, "1", Json{"name": "Ant man", "key": nil}))
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `UPDATE "hero" SET data = JSON_MERGE_PATCH(data, CAST($1 AS JSON)) WHERE id = $2`, statements[0].SQL)
+	require.Equal(t, []any{`{"key":null,"name":"Ant man"}`, "1"}, statements[0].Args)
+}
@@ -0,0 +1,107 @@
+package test
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAverageAcross(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	// shard a: values 10 and 20, shard b: value 10 and a reading without value (not counted)
+	db.Use(cannedRows(`FROM "reading-a-`, []driver.Value{float64(30), int64(2)}))
+	db.Use(cannedRows(`FROM "reading-b-`, []driver.Value{float64(10), int64(1)}))
+
+	avg, err := db.Query(NewReading).(mysql.IMySqlQuery).Across("a", "b").Aggregation("value", database.AVG)
+	require.NoError(t, err)
+	require.Equal(t, float64(40)/3, avg)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	for _, stmt := range statements {
+		require.Contains(t, stmt.SQL, `SELECT SUM((data->>'value')::FLOAT) as aggr, COUNT((data->>'value')::FLOAT) as cnt FROM "reading-`)
+	}
+}
+
+// monthSuffix matches the period suffix of the monthly reading tables
+var monthSuffix = regexp.MustCompile(`-\d{4}-\d{2}"`)
+
+func TestFindAcrossOnClient(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows(`data FROM "reading-a-`,
+		[]driver.Value{"1", []byte(`{"id":"1","value":1}`)},
+		[]driver.Value{"2", []byte(`{"id":"2","value":5}`)}))
+	db.Use(cannedRows(`data FROM "reading-b-`,
+		[]driver.Value{"3", []byte(`{"id":"3","value":3}`)},
+		[]driver.Value{"4", []byte(`{"id":"4","value":4}`)}))
+	db.Use(cannedRows(`aggr FROM "reading-a-`, []driver.Value{int64(2)}))
+	db.Use(cannedRows(`aggr FROM "reading-b-`, []driver.Value{int64(2)}))
+
+	// every shard returns the rows up to the requested page, the merged rows are sorted and the page is cut
+	list, total, err := db.Query(NewReading).Filter(database.F("value").Gt(0)).Sort("value-").Page(2).Limit(2).(mysql.IMySqlQuery).
+		Across("a", "b").Find()
+	require.NoError(t, err)
+	require.Equal(t, int64(4), total)
+	require.Len(t, list, 2)
+	require.Equal(t, "3", list[0].ID())
+	require.Equal(t, "1", list[1].ID())
+
+	finds := 0
+	for _, stmt := range recorder.Statements() {
+		if SQL := monthSuffix.ReplaceAllString(stmt.SQL, `"`); SQL == `SELECT id, data FROM "reading-a" WHERE ((data->>'value')::BIGINT > $1) ORDER BY data->>'value' DESC LIMIT 4` ||
+			SQL == `SELECT id, data FROM "reading-b" WHERE ((data->>'value')::BIGINT > $1) ORDER BY data->>'value' DESC LIMIT 4` {
+			finds++
+		}
+	}
+	require.Equal(t, 2, finds)
+}
+
+func TestFindAcrossOnServer(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows(`AS u ORDER BY`,
+		[]driver.Value{"3", []byte(`{"id":"3","value":3}`)},
+		[]driver.Value{"1", []byte(`{"id":"1","value":1}`)}))
+	db.Use(cannedRows(`SELECT count(*) FROM (`, []driver.Value{int64(4)}))
+
+	// the shards are merged, sorted and paginated by a single UNION ALL statement of the id and data columns
+	list, total, err := db.Query(NewReading).Filter(database.F("value").Gt(0)).Sort("value-").Page(2).Limit(2).(mysql.IMySqlQuery).
+		Across("a", "b").MergeOnServer().Find()
+	require.NoError(t, err)
+	require.Equal(t, int64(4), total)
+	require.Len(t, list, 2)
+	require.Equal(t, "3", list[0].ID())
+
+	union := `SELECT id, data FROM "reading-a" WHERE ((data->>'value')::BIGINT > $1) UNION ALL ` +
+		`SELECT id, data FROM "reading-b" WHERE ((data->>'value')::BIGINT > $2)`
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, `SELECT id, data FROM (`+union+`) AS u ORDER BY data->>'value' DESC LIMIT 2 OFFSET 2`, monthSuffix.ReplaceAllString(statements[0].SQL, `"`))
+	require.Equal(t, []any{0, 0}, statements[0].Args)
+	require.Equal(t, `SELECT count(*) FROM (`+union+`) AS u`, monthSuffix.ReplaceAllString(statements[1].SQL, `"`))
+}
+
+func TestFindAcrossOnServerSortColumns(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.EnableTimestampColumns(NewReading)
+
+	// the typed columns of the order are selected from every shard, so the merged rows can be sorted by them
+	_, _, _ = db.Query(NewReading).Sort(mysql.UpdatedAtColumn+"-").(mysql.IMySqlQuery).Across("a", "b").MergeOnServer().Find()
+
+	statements := recorder.Statements()
+	require.NotEmpty(t, statements)
+	require.Contains(t, monthSuffix.ReplaceAllString(statements[0].SQL, `"`), `SELECT id, data, "updated_at" FROM "reading-a"`)
+	require.Contains(t, statements[0].SQL, `AS u ORDER BY "updated_at" DESC`)
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteQueryInto(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	var report []struct {
+		Name  string `db:"name"`
+		Total int64  `db:"total"`
+	}
+	require.NoError(t, db.ExecuteQueryInto(&report, "SELECT name, COUNT(*) AS total FROM hero GROUP BY name"))
+	require.Empty(t, report)
+
+	var heroes []*Hero
+	require.NoError(t, db.ExecuteQueryInto(&heroes, "SELECT id, data FROM hero"))
+
+	require.Error(t, db.ExecuteQueryInto(report, "SELECT name FROM hero"))
+	var names []string
+	require.Error(t, db.ExecuteQueryInto(&names, "SELECT name FROM hero"))
+	require.Len(t, recorder.Statements(), 2)
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryLimit(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetQueryLimit(1, 1, 50*time.Millisecond)
+
+	// hold the only slot by blocking the first query
+	started, unblock := make(chan bool), make(chan bool)
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if stmt.Table == "hero" {
+				started <- true
+				<-unblock
+			}
+			return next(stmt)
+		}
+	})
+	done := make(chan error)
+	go func() {
+		_, err := db.Query(NewHero).Count()
+		done <- err
+	}()
+	<-started
+
+	// queued query times out
+	_, err := db.Query(NewDevice).Count()
+	require.True(t, errors.Is(err, mysql.ErrTooManyQueries))
+
+	close(unblock)
+	require.NoError(t, <-done)
+
+	_, err = db.Query(NewDevice).Count()
+	require.NoError(t, err)
+}
+
+func TestQueryLimitAcross(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetQueryLimit(1, 0, 0)
+
+	// slow shard queries, so concurrent shard queries would overlap
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.Contains(stmt.SQL, "reading-") {
+				time.Sleep(5 * time.Millisecond)
+			}
+			return next(stmt)
+		}
+	})
+
+	// the shard queries of the same query do not reject each other
+	_, _, err := db.Query(NewReading).(mysql.IMySqlQuery).Across("a", "b", "c").Find()
+	require.NoError(t, err)
+
+	// the UNION ALL statement takes a slot
+	started, unblock := make(chan bool), make(chan bool)
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if stmt.Table == "hero" {
+				started <- true
+				<-unblock
+			}
+			return next(stmt)
+		}
+	})
+	done := make(chan error)
+	go func() {
+		_, err := db.Query(NewHero).Count()
+		done <- err
+	}()
+	<-started
+
+	_, _, err = db.Query(NewReading).(mysql.IMySqlQuery).Across("a", "b").MergeOnServer().Find()
+	require.True(t, errors.Is(err, mysql.ErrTooManyQueries))
+
+	close(unblock)
+	require.NoError(t, <-done)
+}
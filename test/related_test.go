@@ -0,0 +1,28 @@
+package test
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRelatedMasking(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows(`data FROM "device"`, []driver.Value{"1", []byte(`{"id":"1"}`)}))
+	db.Use(cannedRows(`data FROM "hero"`, []driver.Value{"h1", []byte(`{"id":"h1","key":1,"name":"Ant man"}`)}))
+	db.SetMaskingRules(map[string]mysql.MaskFunc{"name": mysql.MaskRedact})
+
+	out, _, err := db.Query(NewDevice).Limit(10).(mysql.IMySqlQuery).Include(mysql.Relation{Name: "heroes", Factory: NewHero, ForeignField: "key"}).FindRelated()
+	require.NoError(t, err)
+	require.Len(t, out, 1)
+
+	// the related entities are grouped by the stored reference and masked
+	heroes := out[0].Related["heroes"]
+	require.Len(t, heroes, 1)
+	require.Equal(t, 1, heroes[0].(*Hero).Key)
+	require.NotEqual(t, "Ant man", heroes[0].(*Hero).Name)
+}
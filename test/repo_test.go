@@ -0,0 +1,28 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedRepo(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	heroes := mysql.NewRepo[*Hero](mysql.NewRecordingDatabase(recorder), NewHero)
+
+	hero, err := heroes.Insert(NewHero1("1", 1, "Ant man").(*Hero))
+	require.NoError(t, err)
+	require.Equal(t, "Ant man", hero.Name)
+
+	list, total, err := heroes.Query().Filter(database.F("name").Eq("Ant man")).Limit(10).Find()
+	require.NoError(t, err)
+	require.Equal(t, int64(0), total)
+	require.Empty(t, list)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	require.Contains(t, statements[1].SQL, `data->>'name'`)
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolloverPlanning(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetClock(func() time.Time { return time.Date(2024, 3, 7, 9, 30, 0, 0, time.UTC) })
+	db.Use(cannedRows("information_schema.TABLES",
+		[]driver.Value{"reading-acme-2023-11"},
+		[]driver.Value{"reading-acme-2024-01"},
+		[]driver.Value{"reading-beta-2024-03"},
+	))
+
+	// the current and next months are created for every discovered account, the months ended before the retention window are archived
+	manager := mysql.NewRolloverManager(db, time.Hour, mysql.RolloverPolicy{
+		Template:      NewReading().TABLE(),
+		Retention:     60 * 24 * time.Hour,
+		ArchivePrefix: "archive_",
+	})
+	require.NoError(t, manager.RunOnce())
+
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "reading-acme-2024-03"`,
+		`CREATE TABLE IF NOT EXISTS "reading-acme-2024-04"`,
+		`CREATE TABLE IF NOT EXISTS "reading-beta-2024-03"`,
+		`CREATE TABLE IF NOT EXISTS "reading-beta-2024-04"`,
+		`RENAME TABLE "reading-acme-2023-11" TO "archive_reading-acme-2023-11"`,
+	}, rolloverStatements(recorder))
+}
+
+func TestRolloverPlanningWeeks(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetClock(func() time.Time { return time.Date(2024, 3, 7, 9, 30, 0, 0, time.UTC) })
+	db.Use(cannedRows("information_schema.TABLES",
+		[]driver.Value{"event-2024-01"},
+		[]driver.Value{"event-2024-08"},
+	))
+
+	// 2024-03-07 is in ISO week 10, expired tables are dropped when no archive prefix is set
+	manager := mysql.NewRolloverManager(db, time.Hour, mysql.RolloverPolicy{
+		Template:  "event-{{year}}-{{week}}",
+		Ahead:     2,
+		Retention: 14 * 24 * time.Hour,
+	})
+	require.NoError(t, manager.RunOnce())
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "event-2024-10"`,
+		`CREATE TABLE IF NOT EXISTS "event-2024-11"`,
+		`CREATE TABLE IF NOT EXISTS "event-2024-12"`,
+		`DROP TABLE IF EXISTS "event-2024-01"`,
+	}, rolloverStatements(recorder))
+
+	// templates without time placeholder can't be rolled over
+	manager = mysql.NewRolloverManager(db, time.Hour, mysql.RolloverPolicy{Template: "hero"})
+	require.Error(t, manager.RunOnce())
+}
+
+func TestRolloverPlanningKeys(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetClock(func() time.Time { return time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC) })
+
+	// the configured keys are created even when no table exists yet, the next month crosses the year
+	manager := mysql.NewRolloverManager(db, time.Hour, mysql.RolloverPolicy{Template: NewReading().TABLE(), Keys: []string{"acme"}})
+	require.NoError(t, manager.RunOnce())
+	require.Equal(t, []string{
+		`CREATE TABLE IF NOT EXISTS "reading-acme-2024-12"`,
+		`CREATE TABLE IF NOT EXISTS "reading-acme-2025-01"`,
+	}, rolloverStatements(recorder))
+}
+
+// rolloverStatements returns the recorded DDL statements (the create table statements are cut after the table name)
+func rolloverStatements(recorder *mysql.StatementRecorder) []string {
+	result := make([]string, 0)
+	for _, stmt := range recorder.Statements() {
+		if stmt.Query {
+			continue
+		}
+		if idx := strings.Index(stmt.SQL, `" (`); idx > 0 {
+			result = append(result, stmt.SQL[:idx+1])
+		} else {
+			result = append(result, stmt.SQL)
+		}
+	}
+	return result
+}
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollup(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	require.NoError(t, db.DefineRollup(&mysql.Rollup{Name: "hero_daily", Factory: NewHero, Dimensions: []string{"name"},
+		TimeField: "createdOn", Period: 24 * time.Hour, Sums: []string{"key"}}))
+
+	hero := NewHero1("1", 5, "Ant man").(*Hero)
+	hero.CreatedOn = Timestamp(90000000)
+	_, err := db.Insert(hero)
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	require.Contains(t, statements[0].SQL, `CREATE TABLE IF NOT EXISTS "hero_daily"`)
+	require.Contains(t, statements[0].SQL, `"sum_key" DOUBLE NOT NULL DEFAULT 0`)
+	require.Equal(t, `INSERT INTO "hero_daily" (rollup_key, dimensions, bucket, count, "sum_key") VALUES ($1, $2, $3, $4, $5) `+
+		`ON DUPLICATE KEY UPDATE count = count + VALUES(count), "sum_key" = "sum_key" + VALUES("sum_key")`, statements[2].SQL)
+	require.Equal(t, []any{`{"name":"Ant man"}`, int64(86400000), int64(1), 5.0}, statements[2].Args[1:])
+
+	_, err = db.QueryRollup("unknown", 0, 1, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,54 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScan(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	it, err := db.Scan(NewHero, 10).Resume(db.Scan(NewHero, 10).ResumeToken())
+	require.NoError(t, err)
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+	require.Nil(t, it.Entity())
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `SELECT id, data FROM "hero" WHERE id > $1 ORDER BY id LIMIT 10`, statements[0].SQL)
+	require.Equal(t, []any{""}, statements[0].Args)
+
+	_, err = db.Scan(NewHero, 10).Resume(db.Scan(NewDevice, 10).ResumeToken())
+	require.Error(t, err)
+
+	_, err = db.Scan(NewHero, 10).Resume("not a token")
+	require.Error(t, err)
+}
+
+func TestScanSegments(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	segments, err := db.ScanSegments(NewHero, 4)
+	require.NoError(t, err)
+	require.Equal(t, []mysql.ScanSegment{{Segment: 0}}, segments)
+
+	it := db.Scan(NewHero, 10).Segment(mysql.ScanSegment{Segment: 1, From: "100", To: "200"})
+	require.False(t, it.Next())
+	require.NoError(t, it.Err())
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 2)
+	require.Equal(t, `SELECT MAX(id) FROM (SELECT id, NTILE(4) OVER (ORDER BY id) AS segment FROM "hero") AS t GROUP BY segment ORDER BY segment`, statements[0].SQL)
+	require.Equal(t, `SELECT id, data FROM "hero" WHERE id > $1 AND id <= $2 ORDER BY id LIMIT 10`, statements[1].SQL)
+	require.Equal(t, []any{"100", "200"}, statements[1].Args)
+
+	_, err = db.ScanSegments(NewHero, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,36 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitScript(t *testing.T) {
+
+	script := `-- provisioning
+CREATE TABLE t (id INT); INSERT INTO t VALUES (1);
+INSERT INTO s VALUES ('a;b'); # trailing comment
+DELIMITER //
+CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END //
+DELIMITER ;
+DROP TABLE x;`
+
+	statements, err := mysql.SplitScript(script)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"CREATE TABLE t (id INT)",
+		"INSERT INTO t VALUES (1)",
+		"INSERT INTO s VALUES ('a;b')",
+		"CREATE PROCEDURE p() BEGIN SELECT 1; SELECT 2; END",
+		"DROP TABLE x",
+	}, statements)
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	executed, err := db.ExecuteScript(script, true)
+	require.NoError(t, err)
+	require.Equal(t, 5, executed)
+	require.True(t, recorder.Statements()[4].InTx)
+}
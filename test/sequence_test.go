@@ -0,0 +1,64 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+// lastInsertId is the result of the sequence statement (the new value of the sequence)
+type lastInsertId int64
+
+func (r lastInsertId) LastInsertId() (int64, error) { return int64(r), nil }
+func (r lastInsertId) RowsAffected() (int64, error) { return 1, nil }
+
+func TestSequence(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	// the sequences table: the statement advances the named sequence by the block size
+	sequences := make(map[string]int64)
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if !strings.HasPrefix(stmt.SQL, `INSERT INTO "sequences"`) {
+				return next(stmt)
+			}
+			name, block := stmt.Args[0].(string), stmt.Args[1].(int)
+			sequences[name] += int64(block)
+			return &mysql.StatementResult{Result: lastInsertId(sequences[name])}, nil
+		}
+	})
+
+	// the ids are assigned from the reserved block, a new block is reserved when it is exhausted
+	ids := make([]int64, 0)
+	for i := 0; i < 4; i++ {
+		id, err := db.NextID("order", 3)
+		require.NoError(t, err)
+		ids = append(ids, id)
+	}
+	require.Equal(t, []int64{1, 2, 3, 4}, ids)
+
+	first, last, err := db.ReserveIDs("invoice", 10)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 10}, []int64{first, last})
+	first, last, err = db.ReserveIDs("invoice", 0)
+	require.NoError(t, err)
+	require.Equal(t, []int64{11, 11}, []int64{first, last})
+
+	_, err = db.NextID("", 1)
+	require.Error(t, err)
+
+	reserved := make([]mysql.Statement, 0)
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, `INSERT INTO "sequences"`) {
+			reserved = append(reserved, stmt)
+		}
+	}
+	require.Len(t, reserved, 4)
+	require.Equal(t, `INSERT INTO "sequences" (name, value) VALUES ($1, LAST_INSERT_ID($2)) ON DUPLICATE KEY UPDATE value = LAST_INSERT_ID(value + $2)`, reserved[0].SQL)
+	require.Equal(t, []any{"order", 3}, reserved[0].Args)
+	require.Equal(t, []any{"invoice", 1}, reserved[3].Args)
+}
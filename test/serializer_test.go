@@ -0,0 +1,31 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomSerializer(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	serializer := mysql.NewSerializer(mysql.SerializerOptions{OmitNulls: true, Aliases: map[string]string{"title": "name"}})
+	db.SetSerializer(NewHero, serializer)
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Regexp(t, `^\{"createdOn":\d+,"id":"1","key":1,"name":"Thor","updatedOn":\d+\}$`, string(statements[0].Args[1].([]byte)))
+
+	hero := NewHero().(*Hero)
+	require.NoError(t, serializer.Unmarshal([]byte(`{"id":"2","title":"Hulk"}`), hero))
+	require.Equal(t, "Hulk", hero.Name)
+
+	hero = NewHero().(*Hero)
+	require.NoError(t, serializer.Unmarshal([]byte(`{"id":"3","title":"Old","name":"New"}`), hero))
+	require.Equal(t, "New", hero.Name)
+}
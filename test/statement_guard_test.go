@@ -0,0 +1,46 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementGuard(t *testing.T) {
+
+	guard := mysql.NewStatementGuard(mysql.StatementGuardOptions{DenyDDL: true, DenyMultiStatement: true, MaxLimit: 100})
+
+	// DDL and multiple statements are rejected, semicolons within literals are ignored
+	_, err := guard("DROP TABLE hero", false)
+	require.Error(t, err)
+	_, err = guard("DELETE FROM hero WHERE id = 1; DROP TABLE hero", false)
+	require.Error(t, err)
+	SQL, err := guard("UPDATE hero SET name = 'a;b' WHERE id = 1;", false)
+	require.NoError(t, err)
+	require.Equal(t, "UPDATE hero SET name = 'a;b' WHERE id = 1;", SQL)
+
+	// LIMIT is appended when missing and enforced when present
+	SQL, err = guard("SELECT * FROM hero;", true)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM hero LIMIT 100", SQL)
+	_, err = guard("SELECT * FROM hero LIMIT 10, 500", true)
+	require.Error(t, err)
+	SQL, err = guard("SELECT * FROM hero WHERE name = 'LIMIT 500' LIMIT 50", true)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM hero WHERE name = 'LIMIT 500' LIMIT 50", SQL)
+
+	// executable comments are executed by the server, so they are inspected as code
+	_, err = guard("/*!50000 DROP TABLE hero */", false)
+	require.Error(t, err)
+	_, err = guard("SELECT 1 /*! ; DROP TABLE hero */", true)
+	require.Error(t, err)
+
+	// the appended LIMIT is not commented out, and LIMIT of a subquery does not bound the query
+	SQL, err = guard("SELECT * FROM hero -- all heroes", true)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM hero LIMIT 100", SQL)
+	SQL, err = guard("SELECT * FROM hero WHERE id IN (SELECT id FROM hero LIMIT 5)", true)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT * FROM hero WHERE id IN (SELECT id FROM hero LIMIT 5) LIMIT 100", SQL)
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogger collects the logged messages
+type captureLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *captureLogger) add(format string, params ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, params...))
+}
+
+func (l *captureLogger) Debug(format string, params ...any) { l.add(format, params...) }
+func (l *captureLogger) Info(format string, params ...any)  { l.add(format, params...) }
+func (l *captureLogger) Warn(format string, params ...any)  { l.add(format, params...) }
+func (l *captureLogger) Error(format string, params ...any) { l.add(format, params...) }
+
+func TestStatementLogRedaction(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	logger := &captureLogger{}
+	db.SetLogger(logger)
+	db.SetStatementLog(&mysql.StatementLogOptions{})
+
+	// sensitive fields of documents and scalar values of sensitive fields are redacted
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+	require.NoError(t, db.SetField(NewHero, "1", "password", "hunter2"))
+	require.NoError(t, db.SetField(NewHero, "1", "name", "Loki"))
+
+	log := strings.Join(logger.messages, "\n")
+	require.NotContains(t, log, "hunter2")
+	require.Contains(t, log, "Thor")
+	require.Contains(t, log, "Loki")
+}
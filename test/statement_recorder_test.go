@@ -0,0 +1,36 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementRecorder(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	_, err := db.Insert(list_of_heroes[0])
+	require.NoError(t, err)
+
+	_, _, err = db.Query(NewHero).Filter(database.F("name").Eq("Thor")).Limit(10).Find()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	require.Equal(t, "hero", statements[0].Table)
+	require.Contains(t, statements[0].SQL, "INSERT INTO")
+	require.Equal(t, list_of_heroes[0].ID(), statements[0].Args[0])
+	require.True(t, statements[1].Query)
+
+	lines := strings.Split(strings.TrimSpace(recorder.String()), "\n")
+	require.Len(t, lines, len(statements))
+	require.Equal(t, `SELECT id, data FROM "hero" WHERE (data->>'name' = $1) LIMIT 10 [Thor]`, lines[1])
+
+	recorder.Reset()
+	require.Empty(t, recorder.Statements())
+}
@@ -0,0 +1,39 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementStats(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	require.Empty(t, db.Stats())
+
+	db.SetStatementStats(true)
+	_, _ = db.Get(NewHero, "1")
+	_, _ = db.Get(NewHero, "2")
+	_, err := db.BulkDelete(NewHero, []string{"1", "2"})
+	require.NoError(t, err)
+	_, _, _ = db.Query(NewHero).Filter(database.F("name").Eq("Batman")).Find()
+
+	stats := make(map[string]mysql.StatementStats)
+	for _, s := range db.Stats() {
+		stats[s.Shape] = s
+	}
+	require.Contains(t, stats, `SELECT id, data FROM "hero" WHERE (data->>'name' = ?)`)
+
+	get := stats[`SELECT id, data FROM "hero" WHERE id = ?`]
+	require.Equal(t, int64(2), get.Count)
+	require.Equal(t, int64(0), get.Errors)
+	require.True(t, get.P95 > 0 && get.Mean <= get.Total)
+
+	require.Equal(t, int64(1), stats[`DELETE FROM "hero" WHERE id = ANY(?)`].Rows)
+
+	db.SetStatementStats(false)
+	require.Empty(t, db.Stats())
+}
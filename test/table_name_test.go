@@ -0,0 +1,95 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultTableNameResolver(t *testing.T) {
+
+	resolver := mysql.DefaultTableNameResolver{}
+	now := time.Date(2024, 3, 7, 9, 30, 0, 0, time.UTC)
+
+	require.Equal(t, "hero", resolver.Resolve("hero", now))
+	require.Equal(t, "event-acme", resolver.Resolve("event-{{0}}", now, "acme"))
+	require.Equal(t, "event-acme-2024-03", resolver.Resolve("event-{{accountId}}-{{year}}-{{month}}", now, "acme"))
+	require.Equal(t, "event-2024-10", resolver.Resolve("event-{{year}}-{{week}}", now))
+	require.Equal(t, "event-07-09", resolver.Resolve("event-{{day}}-{{hour}}", now))
+
+	// The last days of December belong to the first ISO week of the next year
+	newYear := time.Date(2024, 12, 30, 0, 0, 0, 0, time.UTC)
+	require.Equal(t, "event-2025-01", resolver.Resolve("event-{{year}}-{{week}}", newYear))
+}
+
+func TestReferenceTime(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetClock(func() time.Time { return time.Date(2024, 3, 7, 9, 30, 0, 0, time.UTC) })
+	db.SetTenantLimit("acme", 1)
+
+	_, err := db.Exists(NewReading, "1", "acme")
+	require.NoError(t, err)
+
+	// The explicit reference time overrides the clock and is not used as shard key
+	backfill := time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)
+	_, err = db.Exists(NewReading, "1", mysql.AtTime(backfill), "acme")
+	require.NoError(t, err)
+
+	// The time zone of the reference time is kept (the last evening of November is December in UTC)
+	evening := time.Date(2023, 11, 30, 23, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	_, err = db.Exists(NewReading, "1", mysql.AtTime(evening), "acme")
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	require.Equal(t, "reading-acme-2024-03", statements[0].Table)
+	require.Equal(t, "reading-acme-2023-11", statements[1].Table)
+	require.Equal(t, "acme", statements[1].Tenant)
+	require.Equal(t, "reading-acme-2023-11", statements[2].Table)
+}
+
+func TestConsistentHashResolver(t *testing.T) {
+
+	resolver := mysql.NewConsistentHashResolver(16)
+	now := time.Date(2024, 3, 7, 9, 30, 0, 0, time.UTC)
+
+	table := resolver.Resolve("event_{{accountId}}", now, "acme")
+	require.Equal(t, table, resolver.Resolve("event_{{accountId}}", now, "acme"))
+	require.Regexp(t, `^event_(0\d|1[0-5])$`, table)
+	require.Equal(t, table+"-2024", resolver.Resolve("event_{{0}}-{{year}}", now, "acme"))
+
+	// Growing from 16 to 17 buckets should move only a small fraction of the keys
+	grown := mysql.NewConsistentHashResolver(17)
+	moved := 0
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("account-%d", i)
+		if resolver.Bucket(key) != grown.Bucket(key) {
+			moved++
+		}
+	}
+	require.Less(t, moved, 200)
+}
+
+func TestRangeAcrossPeriodsRequiresKeys(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	from, to := Timestamp(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()), Timestamp(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).UnixMilli())
+
+	// the range targets the period tables of the tenant only, so the shard key is required
+	_, _, err := db.Query(NewReading).Range("createdOn", from, to).Find()
+	var missing *mysql.MissingShardKeyError
+	require.True(t, errors.As(err, &missing))
+	require.Len(t, recorder.Statements(), 0)
+
+	_, _, err = db.Query(NewReading).Range("createdOn", from, to).Find("acme")
+	require.NoError(t, err)
+}
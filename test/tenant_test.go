@@ -0,0 +1,88 @@
+package test
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecommissionTenant(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("information_schema.TABLES",
+		[]driver.Value{"reading-acme-2024-01"},
+		[]driver.Value{"reading-acme-eu-2024-01"},
+		[]driver.Value{"reading-acme-2024-02"},
+	))
+
+	// tenant acme is a prefix of tenant acme-eu, the tables of acme-eu must not be decommissioned
+	audit, err := db.DecommissionTenant("acme", []string{NewReading().TABLE()}, mysql.DecommissionOptions{ArchivePrefix: "archive_"})
+	require.NoError(t, err)
+	require.Len(t, audit, 2)
+	require.Equal(t, "reading-acme-2024-01", audit[0].Table)
+	require.Equal(t, "reading-acme-2024-02", audit[1].Table)
+
+	renamed := make([]string, 0)
+	for _, stmt := range recorder.Statements() {
+		if !stmt.Query {
+			renamed = append(renamed, stmt.SQL)
+		}
+	}
+	require.Equal(t, []string{
+		`RENAME TABLE "reading-acme-2024-01" TO "archive_reading-acme-2024-01"`,
+		`RENAME TABLE "reading-acme-2024-02" TO "archive_reading-acme-2024-02"`,
+	}, renamed)
+
+	_, err = db.DecommissionTenant("acme", []string{"hero"}, mysql.DecommissionOptions{})
+	require.Error(t, err)
+}
+
+func TestDecommissionTenantCompanions(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	store := memoryBlobStore{}
+	db.SetOverflowStorage(NewReading, 100, store)
+	store["reading-acme-2024-01/1-aaaa"] = []byte(`{"id":"1","value":7}`)
+	store["reading-acme-eu-2024-01/1-bbbb"] = []byte(`{"id":"2","value":8}`)
+
+	db.Use(cannedRows("information_schema.TABLES",
+		[]driver.Value{"reading-acme-2024-01"},
+		[]driver.Value{"reading-acme-2024-01_history"},
+		[]driver.Value{"reading-acme-eu-2024-01"},
+	))
+	db.Use(cannedRows(`data FROM "reading-acme-2024-01"`,
+		[]driver.Value{"1", []byte(`{"id":"1","_overflow":{"key":"reading-acme-2024-01/1-aaaa","size":20}}`)}))
+
+	dump := &bytes.Buffer{}
+	audit, err := db.DecommissionTenant("acme", []string{NewReading().TABLE()}, mysql.DecommissionOptions{Writer: dump})
+	require.NoError(t, err)
+
+	// the exported document is loaded from the blob store
+	require.Equal(t, `{"table":"reading-acme-2024-01","id":"1","data":{"id":"1","value":7}}`, strings.TrimSpace(dump.String()))
+
+	// the history table is dropped with the table, and the blobs of the other tenant are kept
+	require.Len(t, audit, 2)
+	require.Equal(t, "reading-acme-2024-01", audit[0].Table)
+	require.Equal(t, int64(1), audit[0].Exported)
+	require.Equal(t, "reading-acme-2024-01_history", audit[1].Table)
+	require.Equal(t, "dropped", audit[1].Action)
+	require.Len(t, store, 1)
+	require.Contains(t, store, "reading-acme-eu-2024-01/1-bbbb")
+
+	dropped := make([]string, 0)
+	for _, stmt := range recorder.Statements() {
+		if !stmt.Query {
+			dropped = append(dropped, stmt.SQL)
+		}
+	}
+	require.Equal(t, []string{
+		`DROP TABLE IF EXISTS "reading-acme-2024-01"`,
+		`DROP TABLE IF EXISTS "reading-acme-2024-01_history"`,
+	}, dropped)
+}
@@ -0,0 +1,25 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampColumns(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.EnableTimestampColumns(NewHero)
+
+	_, err := db.Query(NewHero).Filter(database.F(mysql.CreatedAtColumn).Gte(1700000000000)).Sort("updated_at-").Limit(5).GetIDs()
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Equal(t, `SELECT id FROM "hero" WHERE ("created_at" >= $1) ORDER BY "updated_at" DESC LIMIT 5`, statements[0].SQL)
+	require.Equal(t, time.UnixMilli(1700000000000).UTC(), statements[0].Args[0])
+}
@@ -0,0 +1,63 @@
+package test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransientRetry(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetTransientRetry(&mysql.TransientRetryOptions{Attempts: 2, Backoff: time.Millisecond})
+
+	failures := 0
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if failures > 0 {
+				failures--
+				return nil, driver.ErrInvalidConn
+			}
+			return next(stmt)
+		}
+	})
+
+	// upsert and query are retried
+	failures = 2
+	_, err := db.Upsert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+
+	failures = 1
+	_, err = db.Query(NewHero).Count()
+	require.NoError(t, err)
+	require.Len(t, recorder.Statements(), 5) // the recorder sees every attempt
+
+	// retries are bounded
+	failures = 3
+	_, err = db.Query(NewHero).Count()
+	require.True(t, errors.Is(err, driver.ErrInvalidConn))
+
+	// insert is not idempotent
+	failures = 1
+	_, err = db.Insert(NewHero1("2", 2, "Hulk"))
+	require.True(t, errors.Is(err, driver.ErrInvalidConn))
+
+	// statements which may have been committed before the response was lost are not retried
+	cache := db.DataCache()
+	require.NoError(t, cache.RPush("list", NewHero1("3", 3, "Thor")))
+	failures = 1
+	require.True(t, errors.Is(cache.RPush("list", NewHero1("3", 3, "Thor")), driver.ErrInvalidConn))
+	failures = 1
+	_, err = cache.SetNX("lock", NewHero1("3", 3, "Thor"))
+	require.True(t, errors.Is(err, driver.ErrInvalidConn))
+	failures = 1
+	require.NoError(t, cache.Set("key", NewHero1("3", 3, "Thor")))
+
+	require.True(t, mysql.IsTransientError(errors.New("write: broken pipe")))
+	require.False(t, mysql.IsTransientError(errors.New("duplicate key")))
+}
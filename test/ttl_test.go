@@ -0,0 +1,129 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPurgeExpired(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	now := time.Date(2024, 3, 7, 9, 30, 0, 0, time.UTC)
+	db.SetClock(func() time.Time { return now })
+
+	_, err := db.PurgeExpired(NewDevice)
+	require.Error(t, err)
+
+	require.NoError(t, db.SetTTL(NewDevice, &mysql.TTLPolicy{Duration: time.Hour, BatchSize: 100}))
+	require.Error(t, db.SetTTL(NewStream, &mysql.TTLPolicy{Field: "bad field"}))
+
+	affected, err := db.PurgeExpired(NewDevice)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), affected)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, recorder.String(), `SELECT id FROM "device" WHERE ((data->>'updatedOn')::BIGINT < $1) LIMIT 100`)
+	require.EqualValues(t, now.Add(-time.Hour).UnixMilli(), statements[0].Args[0])
+}
+
+func TestDeleteOlderThan(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	cutoff := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	progress, errs := db.DeleteOlderThan(NewDevice, "createdOn", cutoff)
+	for range progress {
+		require.Fail(t, "no documents should be deleted")
+	}
+	require.NoError(t, <-errs)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, recorder.String(), `SELECT id FROM "device" WHERE ((data->>'createdOn')::BIGINT < $1) LIMIT 500`)
+	require.EqualValues(t, cutoff.UnixMilli(), statements[0].Args[0])
+
+	progress, errs = db.DeleteOlderThan(NewDevice, "bad field", cutoff)
+	for range progress {
+	}
+	require.Error(t, <-errs)
+}
+
+// idBatches returns middleware answering the id queries with the next batch of ids, and the deletes with the number of
+// deleted ids
+func idBatches(batches ...[]string) mysql.Middleware {
+	mu := sync.Mutex{}
+	return func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			switch {
+			case strings.HasPrefix(stmt.SQL, "SELECT id FROM"):
+				mu.Lock()
+				rows := make([][]driver.Value, 0)
+				if len(batches) > 0 {
+					for _, id := range batches[0] {
+						rows = append(rows, []driver.Value{id})
+					}
+					batches = batches[1:]
+				}
+				mu.Unlock()
+				return cannedRows("SELECT id", rows...)(next)(stmt)
+			case strings.HasPrefix(stmt.SQL, "DELETE"):
+				return &mysql.StatementResult{Result: driver.RowsAffected(len(stmt.Args[0].([]string)))}, nil
+			}
+			return next(stmt)
+		}
+	}
+}
+
+func TestPurgeExpiredBatches(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	require.NoError(t, db.SetTTL(NewDevice, &mysql.TTLPolicy{Duration: time.Hour, BatchSize: 2}))
+
+	// the purge stops on the short batch
+	db.Use(idBatches([]string{"1", "2"}, []string{"3"}, []string{"4"}))
+	affected, err := db.PurgeExpired(NewDevice)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), affected)
+
+	sqls := make([]string, 0)
+	for _, stmt := range recorder.Statements() {
+		sqls = append(sqls, stmt.SQL)
+	}
+	batch := []string{
+		`SELECT id FROM "device" WHERE ((data->>'updatedOn')::BIGINT < $1)  LIMIT 2`,
+		`SELECT id, data FROM "device" WHERE id = ANY($1)`,
+		`DELETE FROM "device" WHERE id = ANY($1)`,
+	}
+	require.Equal(t, append(batch, batch...), sqls)
+	require.Equal(t, []string{"3"}, recorder.Statements()[5].Args[0])
+}
+
+func TestReaper(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	require.NoError(t, db.SetTTL(NewDevice, &mysql.TTLPolicy{Duration: time.Hour, BatchSize: 2}))
+
+	_, err := db.StartReaper(0)
+	require.Error(t, err)
+
+	// every cycle purges the expired documents of the tables with TTL policy
+	db.Use(idBatches([]string{"1", "2"}))
+	stop, err := db.StartReaper(time.Millisecond)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return strings.Count(recorder.String(), `DELETE FROM "device"`) == 1 && strings.Count(recorder.String(), `SELECT id FROM "device"`) >= 3
+	}, time.Second, time.Millisecond)
+	stop()
+	stop()
+}
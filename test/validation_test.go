@@ -0,0 +1,100 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+const heroSchema = `{
+	"type": "object",
+	"required": ["id", "name"],
+	"properties": {
+		"key": {"type": "integer", "minimum": 1},
+		"name": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"}
+	}
+}`
+
+func TestJsonSchemaValidation(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	require.NoError(t, db.SetJsonSchema(NewHero, heroSchema))
+	require.Error(t, db.SetJsonSchema(NewHero, "{"))
+
+	_, err := db.Insert(NewHero1("1", 1, "Ant man"))
+	require.NoError(t, err)
+
+	_, err = db.Insert(NewHero1("2", 0, "x"))
+	require.True(t, errors.Is(err, mysql.ErrValidation))
+
+	var validation *mysql.ValidationError
+	require.True(t, errors.As(err, &validation))
+	require.Equal(t, "2", validation.Id)
+	require.Len(t, validation.Violations, 3)
+	require.Equal(t, "key", validation.Violations[0].Field)
+	require.Equal(t, "minimum", validation.Violations[0].Rule)
+
+	_, err = db.BulkInsert([]Entity{NewHero1("3", 3, "Thor"), NewHero1("4", -1, "Hulk")})
+	require.True(t, errors.Is(err, mysql.ErrValidation))
+
+	db.AddValidator(NewHero, func(doc map[string]any) []mysql.Violation {
+		if doc["name"] == "Joker" {
+			return []mysql.Violation{{Field: "name", Rule: "villain", Message: "villains are not allowed"}}
+		}
+		return nil
+	})
+	_, err = db.Upsert(NewHero1("5", 5, "Joker"))
+	require.True(t, errors.Is(err, mysql.ErrValidation))
+}
+
+func TestInPlaceUpdateValidation(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(cannedRows("SHA2", []driver.Value{[]byte(`{"id":"1","key":1,"name":"Thor"}`), "hash"}))
+	require.NoError(t, db.SetJsonSchema(NewHero, heroSchema))
+	db.AddValidator(NewHero, func(doc map[string]any) []mysql.Violation {
+		if _, ok := doc["tags"]; ok {
+			return []mysql.Violation{{Field: "tags", Rule: "tags", Message: "tags are not allowed"}}
+		}
+		return nil
+	})
+
+	// the in-place updates are applied in memory and validated
+	require.True(t, errors.Is(db.SetField(NewHero, "1", "name", "x"), mysql.ErrValidation))
+	require.True(t, errors.Is(db.IncrementField(NewHero, "1", "key", -5), mysql.ErrValidation))
+	require.True(t, errors.Is(db.Patch(NewHero, "1", Json{"name": nil}), mysql.ErrValidation))
+	require.True(t, errors.Is(db.AddToArray(NewHero, "1", "tags", []any{"x"}), mysql.ErrValidation))
+	require.Empty(t, updates(recorder))
+
+	require.NoError(t, db.SetField(NewHero, "1", "name", "Loki"))
+	require.Len(t, updates(recorder), 1)
+	require.JSONEq(t, `{"id":"1","key":1,"name":"Loki"}`, string(updates(recorder)[0].Args[1].([]byte)))
+}
+
+// updates returns the recorded UPDATE statements
+func updates(recorder *mysql.StatementRecorder) []mysql.Statement {
+	list := make([]mysql.Statement, 0)
+	for _, stmt := range recorder.Statements() {
+		if strings.HasPrefix(stmt.SQL, "UPDATE") {
+			list = append(list, stmt)
+		}
+	}
+	return list
+}
+
+func TestValidateDocument(t *testing.T) {
+
+	violations, err := mysql.ValidateDocument([]byte(heroSchema), []byte(`{"id": "1", "key": 1.5}`))
+	require.NoError(t, err)
+	require.Equal(t, []mysql.Violation{
+		{Field: "name", Rule: "required", Message: "field is required"},
+		{Field: "key", Rule: "type", Message: "expected integer"},
+	}, violations)
+}
@@ -0,0 +1,74 @@
+package test
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyTable(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	// the batches are read by id order after the last id of the previous batch
+	batches := map[string][][]driver.Value{
+		"": {
+			{"1", []byte(`{"id":"1","key":1,"name":"Thor"}`)},
+			{"2", []byte(`{"id":"x","key":2,"name":"Loki"}`)},
+		},
+		"2": {
+			{"3", []byte(`{"id":"3","key":"not a number"}`)},
+		},
+	}
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.Contains(stmt.SQL, "WHERE id > $1") {
+				return cannedRows("", batches[stmt.Args[0].(string)]...)(next)(stmt)
+			}
+			return next(stmt)
+		}
+	})
+
+	issues := 0
+	report, err := db.VerifyTable(NewHero, mysql.VerifyOptions{BatchSize: 2, Repair: true, Quarantine: true, OnIssue: func(mysql.VerifyIssue) { issues++ }})
+	require.NoError(t, err)
+	require.Equal(t, "hero", report.Table)
+	require.Equal(t, int64(3), report.Scanned)
+	require.Equal(t, int64(1), report.Repaired)
+	require.Equal(t, int64(1), report.Quarantined)
+	require.Equal(t, 2, issues)
+	require.Len(t, report.Issues, 2)
+	require.Equal(t, mysql.VerifyIssue{Id: "2", Kind: mysql.IssueIdMismatch, Error: "document id: x", Action: "repaired"}, report.Issues[0])
+	require.Equal(t, "3", report.Issues[1].Id)
+	require.Equal(t, mysql.IssueDecode, report.Issues[1].Kind)
+	require.Equal(t, "quarantined", report.Issues[1].Action)
+
+	// the mismatched document id is set to the id column, the undecodable row is moved to the quarantine table
+	writes := make([]mysql.Statement, 0)
+	for _, stmt := range recorder.Statements() {
+		if !stmt.Query {
+			writes = append(writes, stmt)
+		}
+	}
+	require.Len(t, writes, 4)
+	require.Equal(t, `UPDATE "hero" SET data = $2 WHERE id = $1`, writes[0].SQL)
+	require.Equal(t, "2", writes[0].Args[0])
+	require.Contains(t, string(writes[0].Args[1].([]byte)), `"id":"2"`)
+	require.True(t, strings.HasPrefix(writes[1].SQL, `CREATE TABLE IF NOT EXISTS "hero_quarantine"`))
+	require.True(t, strings.HasPrefix(writes[2].SQL, `REPLACE INTO "hero_quarantine"`))
+	require.True(t, writes[2].InTx)
+	require.Equal(t, "3", writes[2].Args[0])
+	require.True(t, strings.HasPrefix(writes[3].SQL, `DELETE FROM "hero"`))
+	require.True(t, writes[3].InTx)
+
+	// without repair and quarantine the issues are only reported
+	report, err = db.VerifyTable(NewHero, mysql.VerifyOptions{BatchSize: 2})
+	require.NoError(t, err)
+	require.Len(t, report.Issues, 2)
+	require.Empty(t, report.Issues[0].Action)
+	require.Equal(t, int64(0), report.Repaired+report.Quarantined)
+}
@@ -0,0 +1,29 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmup(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	db.SetSessionInit("SET time_zone = '+00:00'")
+	db.SetWarmupEntities(NewHero, NewReading)
+	require.NoError(t, db.Warmup(context.Background(), 3))
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 3)
+	for _, stmt := range statements {
+		require.Equal(t, "SET time_zone = '+00:00'", stmt.SQL)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.Error(t, db.Warmup(ctx, 1))
+}
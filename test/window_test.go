@@ -0,0 +1,33 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindowFunctions(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+
+	query := db.Query(NewHero).Sort("createdOn").(mysql.IMySqlQuery)
+	_, err := query.Window([]mysql.WindowColumn{
+		{Name: "total", Function: mysql.WindowRunningTotal, Field: "key"},
+		{Name: "rank", Function: mysql.WindowRank, OrderBy: "key-"},
+		{Name: "delta", Function: mysql.WindowDelta, Field: "key", PartitionBy: "name"},
+	})
+	require.NoError(t, err)
+
+	statements := recorder.Statements()
+	require.Len(t, statements, 1)
+	require.Contains(t, statements[0].SQL, `SUM((data->>'key')::FLOAT) OVER (ORDER BY data->>'createdOn' ASC ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS w0`)
+	require.Contains(t, statements[0].SQL, `RANK() OVER (ORDER BY data->>'key' DESC) AS w1`)
+	require.Contains(t, statements[0].SQL, `(data->>'key')::FLOAT - LAG((data->>'key')::FLOAT, 1) OVER (PARTITION BY data->>'name' ORDER BY data->>'createdOn' ASC) AS w2`)
+
+	_, err = query.Window([]mysql.WindowColumn{{Name: "x", Function: mysql.WindowLag}})
+	require.Error(t, err)
+	_, err = query.Window([]mysql.WindowColumn{{Name: "x", Function: "median", Field: "key"}})
+	require.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-yaaf/yaaf-common-mysql/mysql"
+	"github.com/go-yaaf/yaaf-common/database"
+	. "github.com/go-yaaf/yaaf-common/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRate(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.SetWriteRate(NewHero, mysql.WriteRateOptions{Rate: 1, Burst: 2})
+
+	_, err := db.Insert(NewHero1("1", 1, "Thor"))
+	require.NoError(t, err)
+	_, err = db.Insert(NewHero1("2", 2, "Hulk"))
+	require.NoError(t, err)
+	_, err = db.Insert(NewHero1("3", 3, "Loki"))
+	require.True(t, errors.Is(err, mysql.ErrWriteRateExceeded))
+	require.Len(t, recorder.Statements(), 2)
+
+	// other tables are not limited
+	_, err = db.Insert(NewDevice())
+	require.NoError(t, err)
+
+	// blocking global limit
+	db.SetWriteRate(NewHero, mysql.WriteRateOptions{})
+	db.SetWriteRate(nil, mysql.WriteRateOptions{Rate: 100, Burst: 1, Block: true})
+	start := time.Now()
+	_, err = db.BulkInsert([]Entity{NewHero1("4", 4, "Ant man"), NewHero1("5", 5, "Wasp"), NewHero1("6", 6, "Vision")})
+	require.NoError(t, err)
+	_, err = db.Insert(NewHero1("7", 7, "Falcon"))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestWriteRateQueryAndArrays(t *testing.T) {
+
+	recorder := mysql.NewStatementRecorder()
+	db := mysql.NewRecordingDatabase(recorder)
+	db.Use(func(next mysql.Executor) mysql.Executor {
+		return func(stmt *mysql.Statement) (*mysql.StatementResult, error) {
+			if strings.HasPrefix(stmt.SQL, "DELETE") {
+				return &mysql.StatementResult{Result: driver.RowsAffected(4)}, nil
+			}
+			return next(stmt)
+		}
+	})
+	db.SetWriteRate(NewHero, mysql.WriteRateOptions{Rate: 1, Burst: 5})
+
+	// query delete is charged for the affected rows after the fact
+	deleted, err := db.Query(NewHero).Filter(database.F("key").Gt(5)).Delete()
+	require.NoError(t, err)
+	require.Equal(t, int64(4), deleted)
+
+	// array operations consume a token
+	require.NoError(t, db.AddToArray(NewHero, "1", "tags", []any{"a"}))
+	err = db.AddToSet(NewHero, "1", "tags", []any{"b"})
+	require.True(t, errors.Is(err, mysql.ErrWriteRateExceeded))
+	err = db.RemoveFromArray(NewHero, "1", "tags", []string{"a"})
+	require.True(t, errors.Is(err, mysql.ErrWriteRateExceeded))
+}